@@ -0,0 +1,126 @@
+package access
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/ncondezo/final/internal/access"
+	"github.com/ncondezo/final/internal/domain"
+	"github.com/ncondezo/final/internal/patients"
+	"github.com/ncondezo/final/pkg/web"
+)
+
+type Controller struct {
+	service access.Service
+}
+
+func NewAccessController(service access.Service) *Controller {
+	return &Controller{service: service}
+}
+
+// @BasePath /api/v1
+
+// HandlerBreakGlass godoc
+// @Summary Break the glass to read a patient
+// @Description Lets the logged in dentist read a patient they have no turns with, for a limited time. The reason is kept for review.
+// @Tags access
+// @Accept json
+// @Produce json
+// @Param ID path int true "Patient ID"
+// @Param BreakGlass body domain.BreakGlassDTO true "Why the patient must be read"
+// @Success 201 {object} web.SuccessResponse
+// @Failure 400 {object} web.ErrorResponse
+// @Failure 404 {object} web.ErrorResponse
+// @Failure 500 {object} web.ErrorResponse
+// @Router /patients/:id/break-glass [post]
+func (c *Controller) HandlerBreakGlass() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+
+		id, err := strconv.Atoi(ctx.Param("id"))
+		if err != nil {
+			web.NewErrorResponse(ctx, http.StatusBadRequest, "invalid id")
+			return
+		}
+
+		var request domain.BreakGlassDTO
+
+		errBind := ctx.Bind(&request)
+		if errBind != nil {
+			web.NewErrorResponse(ctx, http.StatusBadRequest, "bad request binding")
+			return
+		}
+
+		breakGlass, err := c.service.BreakGlass(ctx, request, id)
+		switch {
+		case errors.Is(err, access.ErrInvalidReason):
+			web.NewErrorResponse(ctx, http.StatusBadRequest, "reason must have at least 10 characters")
+			return
+		case errors.Is(err, access.ErrBreakGlassNotNeeded):
+			web.NewErrorResponse(ctx, http.StatusBadRequest, "only users linked to a dentist need to break the glass")
+			return
+		case errors.Is(err, patients.ErrNotFound):
+			web.NewErrorResponse(ctx, http.StatusNotFound, "patient not found")
+			return
+		case err != nil:
+			web.NewErrorResponse(ctx, http.StatusInternalServerError, "internal server error")
+			return
+		}
+
+		web.NewSuccessResponse(ctx, http.StatusCreated, breakGlass)
+	}
+}
+
+// HandlerReport godoc
+// @Summary Get who read a patient
+// @Description Returns every logged read of the patient, denied ones included, and the break-the-glass accesses to it.
+// @Tags access
+// @Produce json
+// @Param ID path int true "Patient ID"
+// @Success 200 {object} web.SuccessResponse
+// @Failure 400 {object} web.ErrorResponse
+// @Failure 404 {object} web.ErrorResponse
+// @Failure 500 {object} web.ErrorResponse
+// @Router /patients/:id/access-log [get]
+func (c *Controller) HandlerReport() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+
+		id, err := strconv.Atoi(ctx.Param("id"))
+		if err != nil {
+			web.NewErrorResponse(ctx, http.StatusBadRequest, "invalid id")
+			return
+		}
+
+		report, err := c.service.Report(ctx, id)
+		if errors.Is(err, patients.ErrNotFound) {
+			web.NewErrorResponse(ctx, http.StatusNotFound, "patient not found")
+			return
+		}
+		if err != nil {
+			web.NewErrorResponse(ctx, http.StatusInternalServerError, "internal server error")
+			return
+		}
+
+		web.NewSuccessResponse(ctx, http.StatusOK, report)
+	}
+}
+
+// Purpose returns the purpose the reader declared in the request.
+func Purpose(ctx *gin.Context) string {
+	return ctx.GetHeader(access.PurposeHeader)
+}
+
+// Error writes the response of the errors of reading a patient, and reports
+// whether err was one of them.
+func Error(ctx *gin.Context, err error) bool {
+	switch {
+	case errors.Is(err, access.ErrInvalidPurpose):
+		web.NewErrorResponse(ctx, http.StatusBadRequest, "invalid "+access.PurposeHeader)
+	case errors.Is(err, access.ErrNoTurns):
+		web.NewErrorResponse(ctx, http.StatusForbidden, "you have no turns with this patient, break the glass to read it")
+	default:
+		return false
+	}
+	return true
+}
@@ -0,0 +1,156 @@
+package apikey
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/ncondezo/final/internal/apikeys"
+	"github.com/ncondezo/final/internal/domain"
+	"github.com/ncondezo/final/pkg/web"
+)
+
+type Controller struct {
+	service apikeys.Service
+}
+
+func NewApiKeyController(service apikeys.Service) *Controller {
+	return &Controller{service: service}
+}
+
+// @BasePath /api/v1
+
+// HandlerCreate godoc
+// @Summary Create an api key
+// @Description The key is only shown in this response. It can grant only permissions the creator holds.
+// @Tags api-keys
+// @Accept json
+// @Produce json
+// @Param ApiKey body domain.ApiKeyDTO true "Name and permissions of the key"
+// @Success 201 {object} web.SuccessResponse
+// @Failure 400 {object} web.ErrorResponse
+// @Failure 403 {object} web.ErrorResponse
+// @Failure 500 {object} web.ErrorResponse
+// @Router /api-keys [post]
+func (c *Controller) HandlerCreate() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+
+		var request domain.ApiKeyDTO
+
+		errBind := ctx.Bind(&request)
+		if errBind != nil {
+			web.NewErrorResponse(ctx, http.StatusBadRequest, "bad request binding")
+			return
+		}
+
+		key, err := c.service.Create(ctx, request)
+		if errors.Is(err, apikeys.ErrInvalidName) {
+			web.NewErrorResponse(ctx, http.StatusBadRequest, "name is required")
+			return
+		}
+		if errors.Is(err, apikeys.ErrInvalidPermission) {
+			web.NewErrorResponse(ctx, http.StatusBadRequest, "invalid permissions")
+			return
+		}
+		if errors.Is(err, apikeys.ErrPermissionNotHeld) {
+			web.NewErrorResponse(ctx, http.StatusForbidden, "cannot grant a permission you do not hold")
+			return
+		}
+		if err != nil {
+			web.NewErrorResponse(ctx, http.StatusInternalServerError, "internal server error")
+			return
+		}
+
+		web.NewSuccessResponse(ctx, http.StatusCreated, key)
+	}
+}
+
+// HandlerGetAll godoc
+// @Summary Get the api keys
+// @Tags api-keys
+// @Produce json
+// @Success 200 {object} web.SuccessResponse
+// @Failure 500 {object} web.ErrorResponse
+// @Router /api-keys [get]
+func (c *Controller) HandlerGetAll() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+
+		keys, err := c.service.GetAll(ctx)
+		if err != nil {
+			web.NewErrorResponse(ctx, http.StatusInternalServerError, "internal server error")
+			return
+		}
+
+		web.NewSuccessResponse(ctx, http.StatusOK, keys)
+	}
+}
+
+// HandlerRotate godoc
+// @Summary Rotate an api key
+// @Description Replaces the secret of the key. The new key is only shown in this response and the previous one stops working.
+// @Tags api-keys
+// @Produce json
+// @Param ID path int true "Api key ID"
+// @Success 200 {object} web.SuccessResponse
+// @Failure 400 {object} web.ErrorResponse
+// @Failure 404 {object} web.ErrorResponse
+// @Failure 500 {object} web.ErrorResponse
+// @Router /api-keys/:id/rotate [post]
+func (c *Controller) HandlerRotate() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+
+		id, err := strconv.Atoi(ctx.Param("id"))
+		if err != nil {
+			web.NewErrorResponse(ctx, http.StatusBadRequest, "invalid id")
+			return
+		}
+
+		key, err := c.service.Rotate(ctx, id)
+		if errors.Is(err, apikeys.ErrNotFound) {
+			web.NewErrorResponse(ctx, http.StatusNotFound, "api key not found")
+			return
+		}
+		if err != nil {
+			web.NewErrorResponse(ctx, http.StatusInternalServerError, "internal server error")
+			return
+		}
+
+		web.NewSuccessResponse(ctx, http.StatusOK, key)
+	}
+}
+
+// HandlerRevoke godoc
+// @Summary Revoke an api key
+// @Tags api-keys
+// @Produce json
+// @Param ID path int true "Api key ID"
+// @Success 200 {object} web.SuccessResponse
+// @Failure 400 {object} web.ErrorResponse
+// @Failure 404 {object} web.ErrorResponse
+// @Failure 500 {object} web.ErrorResponse
+// @Router /api-keys/:id [delete]
+func (c *Controller) HandlerRevoke() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+
+		id, err := strconv.Atoi(ctx.Param("id"))
+		if err != nil {
+			web.NewErrorResponse(ctx, http.StatusBadRequest, "invalid id")
+			return
+		}
+
+		err = c.service.Revoke(ctx, id)
+		if errors.Is(err, apikeys.ErrNotFound) {
+			web.NewErrorResponse(ctx, http.StatusNotFound, "api key not found")
+			return
+		}
+		if err != nil {
+			web.NewErrorResponse(ctx, http.StatusInternalServerError, "internal server error")
+			return
+		}
+
+		web.NewSuccessResponse(ctx, http.StatusOK, gin.H{
+			"message": "api key revoked",
+		})
+	}
+}
@@ -0,0 +1,365 @@
+package attachment
+
+import (
+	"errors"
+	"mime"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	accessController "github.com/ncondezo/final/cmd/server/handler/access"
+	"github.com/ncondezo/final/internal/attachments"
+	"github.com/ncondezo/final/internal/domain"
+	"github.com/ncondezo/final/internal/patients"
+	"github.com/ncondezo/final/internal/turns"
+	"github.com/ncondezo/final/pkg/blob"
+	"github.com/ncondezo/final/pkg/web"
+)
+
+type Controller struct {
+	service attachments.Service
+}
+
+func NewAttachmentController(service attachments.Service) *Controller {
+	return &Controller{service: service}
+}
+
+// @BasePath /api/v1
+
+// HandlerUploadForPatient godoc
+// @Summary Upload a file for a patient
+// @Tags attachments
+// @Accept multipart/form-data
+// @Produce json
+// @Param ID path int true "Patient ID"
+// @Param file formData file true "File to upload"
+// @Param kind formData string true "xray, consent, lab_result or other"
+// @Success 201 {object} web.SuccessResponse
+// @Failure 400 {object} web.ErrorResponse
+// @Failure 404 {object} web.ErrorResponse
+// @Failure 409 {object} web.ErrorResponse
+// @Failure 413 {object} web.ErrorResponse
+// @Failure 415 {object} web.ErrorResponse
+// @Failure 500 {object} web.ErrorResponse
+// @Router /patients/:id/attachments [post]
+func (c *Controller) HandlerUploadForPatient() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+
+		id, err := strconv.Atoi(ctx.Param("id"))
+		if err != nil {
+			web.NewErrorResponse(ctx, http.StatusBadRequest, "invalid id")
+			return
+		}
+
+		c.upload(ctx, domain.AttachmentDTO{IdPatient: id})
+	}
+}
+
+// HandlerUploadForTurn godoc
+// @Summary Upload a file for a turn
+// @Tags attachments
+// @Accept multipart/form-data
+// @Produce json
+// @Param ID path int true "Turn ID"
+// @Param file formData file true "File to upload"
+// @Param kind formData string true "xray, consent, lab_result or other"
+// @Success 201 {object} web.SuccessResponse
+// @Failure 400 {object} web.ErrorResponse
+// @Failure 404 {object} web.ErrorResponse
+// @Failure 409 {object} web.ErrorResponse
+// @Failure 413 {object} web.ErrorResponse
+// @Failure 415 {object} web.ErrorResponse
+// @Failure 500 {object} web.ErrorResponse
+// @Router /turns/:id/attachments [post]
+func (c *Controller) HandlerUploadForTurn() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+
+		id, err := strconv.Atoi(ctx.Param("id"))
+		if err != nil {
+			web.NewErrorResponse(ctx, http.StatusBadRequest, "invalid id")
+			return
+		}
+
+		c.upload(ctx, domain.AttachmentDTO{IdTurn: id})
+	}
+}
+
+// HandlerGetByID godoc
+// @Summary Get the metadata of an attachment by id
+// @Tags attachments
+// @Produce json
+// @Param ID path int true "Attachment ID to search"
+// @Param X-Access-Purpose header string false "treatment, scheduling, billing, administration or emergency"
+// @Success 200 {object} web.SuccessResponse
+// @Failure 400 {object} web.ErrorResponse
+// @Failure 403 {object} web.ErrorResponse
+// @Failure 404 {object} web.ErrorResponse
+// @Failure 500 {object} web.ErrorResponse
+// @Router /attachments/:id [get]
+func (c *Controller) HandlerGetByID() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+
+		id, err := strconv.Atoi(ctx.Param("id"))
+		if err != nil {
+			web.NewErrorResponse(ctx, http.StatusBadRequest, "invalid id")
+			return
+		}
+
+		attachment, err := c.service.GetByID(ctx, id, accessController.Purpose(ctx))
+		if errors.Is(err, attachments.ErrNotFound) {
+			web.NewErrorResponse(ctx, http.StatusNotFound, "attachment not found")
+			return
+		}
+		if accessController.Error(ctx, err) {
+			return
+		}
+		if err != nil {
+			web.NewErrorResponse(ctx, http.StatusInternalServerError, "internal server error")
+			return
+		}
+
+		web.NewSuccessResponse(ctx, http.StatusOK, attachment)
+	}
+}
+
+// HandlerDownload godoc
+// @Summary Download the content of an attachment by id
+// @Tags attachments
+// @Produce octet-stream
+// @Param ID path int true "Attachment ID to download"
+// @Param X-Access-Purpose header string false "treatment, scheduling, billing, administration or emergency"
+// @Success 200 {file} file
+// @Failure 400 {object} web.ErrorResponse
+// @Failure 403 {object} web.ErrorResponse
+// @Failure 404 {object} web.ErrorResponse
+// @Failure 500 {object} web.ErrorResponse
+// @Router /attachments/:id/content [get]
+func (c *Controller) HandlerDownload() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+
+		id, err := strconv.Atoi(ctx.Param("id"))
+		if err != nil {
+			web.NewErrorResponse(ctx, http.StatusBadRequest, "invalid id")
+			return
+		}
+
+		attachment, content, err := c.service.Open(ctx, id, accessController.Purpose(ctx))
+		if errors.Is(err, attachments.ErrNotFound) || errors.Is(err, blob.ErrNotFound) {
+			web.NewErrorResponse(ctx, http.StatusNotFound, "attachment not found")
+			return
+		}
+		if accessController.Error(ctx, err) {
+			return
+		}
+		if err != nil {
+			web.NewErrorResponse(ctx, http.StatusInternalServerError, "internal server error")
+			return
+		}
+		defer content.Close()
+
+		ctx.DataFromReader(http.StatusOK, attachment.Size, attachment.ContentType, content,
+			map[string]string{
+				"Content-Disposition": mime.FormatMediaType("attachment", map[string]string{"filename": attachment.Filename}),
+				"Digest":              "sha-256=" + attachment.Checksum,
+			})
+	}
+}
+
+// HandlerPreview godoc
+// @Summary Get the PNG preview of a radiograph by id
+// @Tags attachments
+// @Produce png
+// @Param ID path int true "Attachment ID"
+// @Param X-Access-Purpose header string false "treatment, scheduling, billing, administration or emergency"
+// @Success 200 {file} file
+// @Failure 400 {object} web.ErrorResponse
+// @Failure 403 {object} web.ErrorResponse
+// @Failure 404 {object} web.ErrorResponse
+// @Failure 500 {object} web.ErrorResponse
+// @Router /attachments/:id/preview [get]
+func (c *Controller) HandlerPreview() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+
+		id, err := strconv.Atoi(ctx.Param("id"))
+		if err != nil {
+			web.NewErrorResponse(ctx, http.StatusBadRequest, "invalid id")
+			return
+		}
+
+		preview, err := c.service.OpenPreview(ctx, id, accessController.Purpose(ctx))
+		if errors.Is(err, attachments.ErrNotFound) || errors.Is(err, blob.ErrNotFound) {
+			web.NewErrorResponse(ctx, http.StatusNotFound, "attachment not found")
+			return
+		}
+		if errors.Is(err, attachments.ErrNoPreview) {
+			web.NewErrorResponse(ctx, http.StatusNotFound, "attachment has no preview")
+			return
+		}
+		if accessController.Error(ctx, err) {
+			return
+		}
+		if err != nil {
+			web.NewErrorResponse(ctx, http.StatusInternalServerError, "internal server error")
+			return
+		}
+		defer preview.Close()
+
+		ctx.DataFromReader(http.StatusOK, -1, "image/png", preview, nil)
+	}
+}
+
+// HandlerGetByPatientID godoc
+// @Summary Get the attachments of a patient
+// @Tags attachments
+// @Produce json
+// @Param ID path int true "Patient ID to search"
+// @Param X-Access-Purpose header string false "treatment, scheduling, billing, administration or emergency"
+// @Success 200 {object} web.SuccessResponse
+// @Failure 400 {object} web.ErrorResponse
+// @Failure 403 {object} web.ErrorResponse
+// @Failure 404 {object} web.ErrorResponse
+// @Failure 500 {object} web.ErrorResponse
+// @Router /patients/:id/attachments [get]
+func (c *Controller) HandlerGetByPatientID() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+
+		id, err := strconv.Atoi(ctx.Param("id"))
+		if err != nil {
+			web.NewErrorResponse(ctx, http.StatusBadRequest, "invalid id")
+			return
+		}
+
+		found, err := c.service.GetByPatientID(ctx, id, accessController.Purpose(ctx))
+		if errors.Is(err, patients.ErrNotFound) {
+			web.NewErrorResponse(ctx, http.StatusNotFound, "patient not found")
+			return
+		}
+		if accessController.Error(ctx, err) {
+			return
+		}
+		if err != nil {
+			web.NewErrorResponse(ctx, http.StatusInternalServerError, "internal server error")
+			return
+		}
+
+		web.NewSuccessResponse(ctx, http.StatusOK, found)
+	}
+}
+
+// HandlerGetByTurnID godoc
+// @Summary Get the attachments of a turn
+// @Tags attachments
+// @Produce json
+// @Param ID path int true "Turn ID to search"
+// @Param X-Access-Purpose header string false "treatment, scheduling, billing, administration or emergency"
+// @Success 200 {object} web.SuccessResponse
+// @Failure 400 {object} web.ErrorResponse
+// @Failure 403 {object} web.ErrorResponse
+// @Failure 404 {object} web.ErrorResponse
+// @Failure 500 {object} web.ErrorResponse
+// @Router /turns/:id/attachments [get]
+func (c *Controller) HandlerGetByTurnID() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+
+		id, err := strconv.Atoi(ctx.Param("id"))
+		if err != nil {
+			web.NewErrorResponse(ctx, http.StatusBadRequest, "invalid id")
+			return
+		}
+
+		found, err := c.service.GetByTurnID(ctx, id, accessController.Purpose(ctx))
+		if errors.Is(err, turns.ErrNotFound) {
+			web.NewErrorResponse(ctx, http.StatusNotFound, "turn not found")
+			return
+		}
+		if accessController.Error(ctx, err) {
+			return
+		}
+		if err != nil {
+			web.NewErrorResponse(ctx, http.StatusInternalServerError, "internal server error")
+			return
+		}
+
+		web.NewSuccessResponse(ctx, http.StatusOK, found)
+	}
+}
+
+// HandlerDelete godoc
+// @Summary Delete an attachment by id
+// @Tags attachments
+// @Produce json
+// @Param ID path int true "Attachment ID to delete"
+// @Success 200 {object} web.SuccessResponse
+// @Failure 400 {object} web.ErrorResponse
+// @Failure 404 {object} web.ErrorResponse
+// @Failure 500 {object} web.ErrorResponse
+// @Router /attachments/:id [delete]
+func (c *Controller) HandlerDelete() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+
+		id, err := strconv.Atoi(ctx.Param("id"))
+		if err != nil {
+			web.NewErrorResponse(ctx, http.StatusBadRequest, "invalid id")
+			return
+		}
+
+		err = c.service.Delete(ctx, id)
+		if errors.Is(err, attachments.ErrNotFound) {
+			web.NewErrorResponse(ctx, http.StatusNotFound, "attachment not found")
+			return
+		}
+		if err != nil {
+			web.NewErrorResponse(ctx, http.StatusInternalServerError, "internal server error")
+			return
+		}
+
+		web.NewSuccessResponse(ctx, http.StatusOK, gin.H{
+			"message": "attachment deleted",
+		})
+	}
+}
+
+func (c *Controller) upload(ctx *gin.Context, request domain.AttachmentDTO) {
+	header, err := ctx.FormFile("file")
+	if err != nil {
+		web.NewErrorResponse(ctx, http.StatusBadRequest, "file is required")
+		return
+	}
+	request.Kind = ctx.PostForm("kind")
+	request.Filename = header.Filename
+
+	file, err := header.Open()
+	if err != nil {
+		web.NewErrorResponse(ctx, http.StatusBadRequest, "bad request")
+		return
+	}
+	defer file.Close()
+
+	attachment, err := c.service.Upload(ctx, request, file)
+	switch {
+	case errors.Is(err, attachments.ErrInvalidKind):
+		web.NewErrorResponse(ctx, http.StatusBadRequest, "invalid kind")
+	case errors.Is(err, attachments.ErrFilenameTooLong):
+		web.NewErrorResponse(ctx, http.StatusBadRequest, "filename must have at most 250 characters")
+	case errors.Is(err, attachments.ErrEmptyContent):
+		web.NewErrorResponse(ctx, http.StatusBadRequest, "file is empty")
+	case errors.Is(err, attachments.ErrUnsupportedContent):
+		web.NewErrorResponse(ctx, http.StatusUnsupportedMediaType, "unsupported file type")
+	case errors.Is(err, attachments.ErrTooLarge):
+		web.NewErrorResponse(ctx, http.StatusRequestEntityTooLarge, "file is too large")
+	case errors.Is(err, attachments.ErrInvalidDicom):
+		web.NewErrorResponse(ctx, http.StatusBadRequest, "invalid DICOM file")
+	case errors.Is(err, attachments.ErrPatientMismatch):
+		web.NewErrorResponse(ctx, http.StatusConflict, "radiograph header does not match patient")
+	case errors.Is(err, attachments.ErrTurnMismatch):
+		web.NewErrorResponse(ctx, http.StatusBadRequest, "turn does not belong to patient")
+	case errors.Is(err, patients.ErrNotFound):
+		web.NewErrorResponse(ctx, http.StatusNotFound, "patient not found")
+	case errors.Is(err, turns.ErrNotFound):
+		web.NewErrorResponse(ctx, http.StatusNotFound, "turn not found")
+	case err != nil:
+		web.NewErrorResponse(ctx, http.StatusInternalServerError, "internal server error")
+	default:
+		web.NewSuccessResponse(ctx, http.StatusCreated, attachment)
+	}
+}
@@ -0,0 +1,122 @@
+package audit
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/ncondezo/final/internal/audit"
+	"github.com/ncondezo/final/internal/domain"
+	"github.com/ncondezo/final/pkg/web"
+)
+
+type Controller struct {
+	service audit.Service
+}
+
+func NewAuditController(service audit.Service) *Controller {
+	return &Controller{service: service}
+}
+
+// @BasePath /api/v1
+
+// HandlerList godoc
+// @Summary List the audit log
+// @Description Returns the changes to patients, dentists and turns, the newest first, with the fields each one changed.
+// @Tags audit
+// @Produce json
+// @Param entity query string false "patient, dentist or turn"
+// @Param entity_id query int false "ID of the entity"
+// @Param actor query string false "ID of the user or api key"
+// @Param action query string false "create, update, delete or merge"
+// @Param from query string false "First day (YYYY-MM-DD)"
+// @Param to query string false "Last day (YYYY-MM-DD)"
+// @Param page query int false "Page number, from 1"
+// @Param page_size query int false "Page size, up to 200"
+// @Success 200 {object} web.SuccessResponse
+// @Failure 400 {object} web.ErrorResponse
+// @Failure 403 {object} web.ErrorResponse
+// @Failure 500 {object} web.ErrorResponse
+// @Router /audit [get]
+func (c *Controller) HandlerList() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+
+		filter := domain.AuditFilter{
+			Entity: ctx.Query("entity"),
+			Actor:  ctx.Query("actor"),
+			Action: ctx.Query("action"),
+		}
+
+		var err error
+		if value := ctx.Query("entity_id"); value != "" {
+			if filter.EntityId, err = strconv.Atoi(value); err != nil {
+				web.NewErrorResponse(ctx, http.StatusBadRequest, "invalid entity_id")
+				return
+			}
+		}
+		if value := ctx.Query("from"); value != "" {
+			if filter.From, err = time.Parse("2006-01-02", value); err != nil {
+				web.NewErrorResponse(ctx, http.StatusBadRequest, "invalid from date")
+				return
+			}
+		}
+		if value := ctx.Query("to"); value != "" {
+			if filter.To, err = time.Parse("2006-01-02", value); err != nil {
+				web.NewErrorResponse(ctx, http.StatusBadRequest, "invalid to date")
+				return
+			}
+			filter.To = filter.To.AddDate(0, 0, 1)
+		}
+		if value := ctx.Query("page"); value != "" {
+			if filter.Page, err = strconv.Atoi(value); err != nil {
+				web.NewErrorResponse(ctx, http.StatusBadRequest, "invalid page")
+				return
+			}
+		}
+		if value := ctx.Query("page_size"); value != "" {
+			if filter.PageSize, err = strconv.Atoi(value); err != nil {
+				web.NewErrorResponse(ctx, http.StatusBadRequest, "invalid page_size")
+				return
+			}
+		}
+
+		page, err := c.service.List(ctx, filter)
+		switch {
+		case errors.Is(err, audit.ErrInvalidPage):
+			web.NewErrorResponse(ctx, http.StatusBadRequest, "page must be positive and page_size at most 200")
+			return
+		case errors.Is(err, audit.ErrInvalidRange):
+			web.NewErrorResponse(ctx, http.StatusBadRequest, "to date is before from date")
+			return
+		case err != nil:
+			web.NewErrorResponse(ctx, http.StatusInternalServerError, "internal server error")
+			return
+		}
+
+		web.NewSuccessResponse(ctx, http.StatusOK, page)
+	}
+}
+
+// HandlerVerify godoc
+// @Summary Verify the audit log
+// @Description Recomputes the hash chain of the audit log. It is invalid from the first entry that was altered, or when entries were removed.
+// @Tags audit
+// @Produce json
+// @Success 200 {object} web.SuccessResponse
+// @Failure 403 {object} web.ErrorResponse
+// @Failure 500 {object} web.ErrorResponse
+// @Router /audit/verify [get]
+func (c *Controller) HandlerVerify() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+
+		verification, err := c.service.Verify(ctx)
+		if err != nil {
+			web.NewErrorResponse(ctx, http.StatusInternalServerError, "internal server error")
+			return
+		}
+
+		web.NewSuccessResponse(ctx, http.StatusOK, verification)
+	}
+}
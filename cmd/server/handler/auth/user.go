@@ -1,16 +1,29 @@
 package user
 
 import (
+	"crypto/subtle"
 	"errors"
+	"math"
 	"net/http"
+	"path"
+	"strconv"
+	"time"
 
+	"github.com/ncondezo/final/internal/dentists"
 	"github.com/ncondezo/final/internal/domain"
+	"github.com/ncondezo/final/internal/patients"
 	user "github.com/ncondezo/final/internal/user"
+	"github.com/ncondezo/final/pkg/middleware"
 	"github.com/ncondezo/final/pkg/web"
 
 	"github.com/gin-gonic/gin"
 )
 
+const (
+	ssoStateCookie    = "oidc_state"
+	ssoStateCookieAge = time.Minute * 10
+)
+
 type controller struct {
 	service user.Service
 }
@@ -23,13 +36,14 @@ func NewController(service user.Service) *controller {
 
 // Signup godoc
 // @Summary Register a new user
-// @Description Takes user information and store in DB. Return saved user.
+// @Description Takes user information and an invitation token and store in DB. The user must verify the email before logging in. Return saved user.
 // @Tags users
 // @Accept json
 // @Produce json
 // @Param user body domain.SignupDTO true "User register information"
 // @Success 201 {object} web.SuccessResponse
 // @Failure 400 {object} web.ErrorResponse
+// @Failure 403 {object} web.ErrorResponse
 // @Failure 409 {object} web.ErrorResponse
 // @Failure 500 {object} web.ErrorResponse
 // @Router /auth/signup [post]
@@ -46,7 +60,17 @@ func (controller *controller) Signup() gin.HandlerFunc {
 			web.NewErrorResponse(context, http.StatusBadRequest, err)
 			return
 		}
-		created, err := controller.service.Signup(userData)
+		created, err := controller.service.Signup(context, userData)
+		var rejected *user.PasswordPolicyError
+		if errors.As(err, &rejected) {
+			web.NewErrorResponse(context, http.StatusBadRequest, rejected.Reason)
+			return
+		}
+		if errors.Is(err, user.ErrorInvalidInvitation) {
+			web.NewErrorResponse(context, http.StatusForbidden,
+				"Se requiere una invitación válida para registrarse")
+			return
+		}
 		if errors.Is(err, user.ErrorUserExists) {
 			web.NewErrorResponse(context, http.StatusConflict,
 				"El usuario con email "+userData.Email+" ya existe")
@@ -63,15 +87,16 @@ func (controller *controller) Signup() gin.HandlerFunc {
 
 // Login godoc
 // @Summary Existing user login
-// @Description Takes and verify user credentials. Returns an access token for the user.
+// @Description Takes and verify user credentials. Returns an access token for the user, or a challenge to finish at /auth/mfa/verify when the user logs in with two factors. Repeated failures are delayed and then locked for a while.
 // @Tags users
 // @Accept json
 // @Produce json
 // @Param user body domain.LoginDTO true "User credentials"
 // @Success 200 {object} web.LoginResponse
+// @Success 202 {object} web.ChallengeResponse
 // @Failure 400 {object} web.ErrorResponse
 // @Failure 403 {object} web.ErrorResponse
-// @Failure 404 {object} web.ErrorResponse
+// @Failure 429 {object} web.ErrorResponse
 // @Failure 500 {object} web.ErrorResponse
 // @Router /auth/login [post]
 func (controller *controller) Login() gin.HandlerFunc {
@@ -87,10 +112,17 @@ func (controller *controller) Login() gin.HandlerFunc {
 			web.NewErrorResponse(context, http.StatusBadRequest, err)
 			return
 		}
-		logged, err := controller.service.Login(userData)
-		if errors.Is(err, user.ErrorUserNotFound) {
-			web.NewErrorResponse(context, http.StatusNotFound,
-				"El usuario con email "+userData.Email+" no existe")
+		logged, err := controller.service.Login(context, userData, context.ClientIP())
+		var challenged *user.MfaRequiredError
+		if errors.As(err, &challenged) {
+			context.JSON(http.StatusAccepted, challenged.Challenge)
+			return
+		}
+		var throttled *user.ThrottledError
+		if errors.As(err, &throttled) {
+			context.Header("Retry-After", strconv.Itoa(int(math.Ceil(throttled.RetryAfter.Seconds()))))
+			web.NewErrorResponse(context, http.StatusTooManyRequests,
+				"Demasiados intentos fallidos, intente nuevamente más tarde")
 			return
 		}
 		if errors.Is(err, user.ErrorInvalidCredentials) {
@@ -98,6 +130,11 @@ func (controller *controller) Login() gin.HandlerFunc {
 				"Las credenciales son inválidas")
 			return
 		}
+		if errors.Is(err, user.ErrorUnverified) {
+			web.NewErrorResponse(context, http.StatusForbidden,
+				"El email no fue verificado")
+			return
+		}
 		if err != nil {
 			web.NewErrorResponse(context, http.StatusInternalServerError,
 				"Se ha producido un error al intentar loguear el usuario")
@@ -106,3 +143,911 @@ func (controller *controller) Login() gin.HandlerFunc {
 		web.NewLoginResponse(context, http.StatusOK, *logged)
 	}
 }
+
+// Refresh godoc
+// @Summary Rotate a refresh token
+// @Description Exchanges a refresh token for a new access and refresh token. A refresh token can be used once; reusing it revokes every token of its session.
+// @Tags users
+// @Accept json
+// @Produce json
+// @Param token body domain.RefreshDTO true "Refresh token"
+// @Success 200 {object} web.LoginResponse
+// @Failure 400 {object} web.ErrorResponse
+// @Failure 401 {object} web.ErrorResponse
+// @Failure 500 {object} web.ErrorResponse
+// @Router /auth/refresh [post]
+func (controller *controller) Refresh() gin.HandlerFunc {
+	return func(context *gin.Context) {
+		var request domain.RefreshDTO
+		err := context.ShouldBindJSON(&request)
+		if err != nil {
+			web.NewErrorResponse(context, http.StatusBadRequest,
+				"El JSON enviado en el cuerpo no es válido")
+			return
+		}
+		if err := web.RequestJsonValidation(request); err != "" {
+			web.NewErrorResponse(context, http.StatusBadRequest, err)
+			return
+		}
+		refreshed, err := controller.service.Refresh(request)
+		if errors.Is(err, user.ErrorInvalidRefresh) || errors.Is(err, user.ErrorRefreshReused) {
+			web.NewErrorResponse(context, http.StatusUnauthorized,
+				"El refresh token es inválido")
+			return
+		}
+		if err != nil {
+			web.NewErrorResponse(context, http.StatusInternalServerError,
+				"Se ha producido un error al renovar el token")
+			return
+		}
+		web.NewLoginResponse(context, http.StatusOK, *refreshed)
+	}
+}
+
+// Logout godoc
+// @Summary Logout
+// @Description Revokes the access token and, when sent, the refresh token with every token rotated from it.
+// @Tags users
+// @Accept json
+// @Produce json
+// @Param token body domain.RefreshDTO false "Refresh token"
+// @Success 204
+// @Failure 400 {object} web.ErrorResponse
+// @Failure 401 {object} web.ErrorResponse
+// @Failure 500 {object} web.ErrorResponse
+// @Router /auth/logout [post]
+func (controller *controller) Logout() gin.HandlerFunc {
+	return func(context *gin.Context) {
+		var request domain.RefreshDTO
+		if context.Request.ContentLength > 0 {
+			if err := context.ShouldBindJSON(&request); err != nil {
+				web.NewErrorResponse(context, http.StatusBadRequest,
+					"El JSON enviado en el cuerpo no es válido")
+				return
+			}
+		}
+		claim := middleware.Claim(context)
+		if claim == nil {
+			web.NewErrorResponse(context, http.StatusBadRequest,
+				"Solo se puede cerrar la sesión de un token de acceso")
+			return
+		}
+		err := controller.service.Logout(claim, request)
+		if errors.Is(err, user.ErrorInvalidRefresh) {
+			web.NewErrorResponse(context, http.StatusUnauthorized,
+				"El refresh token es inválido")
+			return
+		}
+		if err != nil {
+			web.NewErrorResponse(context, http.StatusInternalServerError,
+				"Se ha producido un error al cerrar la sesión")
+			return
+		}
+		context.Status(http.StatusNoContent)
+	}
+}
+
+// ForgotPassword godoc
+// @Summary Request a password reset
+// @Description Emails a one-time link to reset the password. The response is the same whether the email exists or not.
+// @Tags users
+// @Accept json
+// @Produce json
+// @Param user body domain.ForgotPasswordDTO true "User email"
+// @Success 202
+// @Failure 400 {object} web.ErrorResponse
+// @Failure 500 {object} web.ErrorResponse
+// @Router /auth/password/forgot [post]
+func (controller *controller) ForgotPassword() gin.HandlerFunc {
+	return func(context *gin.Context) {
+		var request domain.ForgotPasswordDTO
+		err := context.ShouldBindJSON(&request)
+		if err != nil {
+			web.NewErrorResponse(context, http.StatusBadRequest,
+				"El JSON enviado en el cuerpo no es válido")
+			return
+		}
+		if err := web.RequestJsonValidation(request); err != "" {
+			web.NewErrorResponse(context, http.StatusBadRequest, err)
+			return
+		}
+		if err := controller.service.ForgotPassword(context, request); err != nil {
+			web.NewErrorResponse(context, http.StatusInternalServerError,
+				"Se ha producido un error al solicitar el cambio de contraseña")
+			return
+		}
+		context.Status(http.StatusAccepted)
+	}
+}
+
+// ResetPassword godoc
+// @Summary Reset a password
+// @Description Sets a new password with the token of a reset email. Every open session of the user is closed.
+// @Tags users
+// @Accept json
+// @Produce json
+// @Param reset body domain.ResetPasswordDTO true "Reset token and new password"
+// @Success 204
+// @Failure 400 {object} web.ErrorResponse
+// @Failure 500 {object} web.ErrorResponse
+// @Router /auth/password/reset [post]
+func (controller *controller) ResetPassword() gin.HandlerFunc {
+	return func(context *gin.Context) {
+		var request domain.ResetPasswordDTO
+		err := context.ShouldBindJSON(&request)
+		if err != nil {
+			web.NewErrorResponse(context, http.StatusBadRequest,
+				"El JSON enviado en el cuerpo no es válido")
+			return
+		}
+		if err := web.RequestJsonValidation(request); err != "" {
+			web.NewErrorResponse(context, http.StatusBadRequest, err)
+			return
+		}
+		err = controller.service.ResetPassword(request)
+		var rejected *user.PasswordPolicyError
+		if errors.As(err, &rejected) {
+			web.NewErrorResponse(context, http.StatusBadRequest, rejected.Reason)
+			return
+		}
+		if errors.Is(err, user.ErrorInvalidReset) {
+			web.NewErrorResponse(context, http.StatusBadRequest,
+				"El enlace para restablecer la contraseña es inválido o venció")
+			return
+		}
+		if err != nil {
+			web.NewErrorResponse(context, http.StatusInternalServerError,
+				"Se ha producido un error al restablecer la contraseña")
+			return
+		}
+		context.Status(http.StatusNoContent)
+	}
+}
+
+// Invite godoc
+// @Summary Invite a user
+// @Description Emails a link to sign up with the given role. The invitation expires in seven days.
+// @Tags users
+// @Accept json
+// @Produce json
+// @Param invitation body domain.InvitationDTO true "Email and role of the invited user"
+// @Success 201 {object} web.SuccessResponse
+// @Failure 400 {object} web.ErrorResponse
+// @Failure 403 {object} web.ErrorResponse
+// @Failure 409 {object} web.ErrorResponse
+// @Failure 500 {object} web.ErrorResponse
+// @Router /invitations [post]
+func (controller *controller) Invite() gin.HandlerFunc {
+	return func(context *gin.Context) {
+		var request domain.InvitationDTO
+		err := context.ShouldBindJSON(&request)
+		if err != nil {
+			web.NewErrorResponse(context, http.StatusBadRequest,
+				"El JSON enviado en el cuerpo no es válido")
+			return
+		}
+		if err := web.RequestJsonValidation(request); err != "" {
+			web.NewErrorResponse(context, http.StatusBadRequest, err)
+			return
+		}
+		invitation, err := controller.service.Invite(context, request)
+		if errors.Is(err, user.ErrorInvalidRole) {
+			web.NewErrorResponse(context, http.StatusBadRequest, "Rol inválido")
+			return
+		}
+		if errors.Is(err, user.ErrorUserExists) {
+			web.NewErrorResponse(context, http.StatusConflict,
+				"El usuario con email "+request.Email+" ya existe")
+			return
+		}
+		if err != nil {
+			web.NewErrorResponse(context, http.StatusInternalServerError,
+				"Se ha producido un error al enviar la invitación")
+			return
+		}
+		web.NewSuccessResponse(context, http.StatusCreated, invitation)
+	}
+}
+
+// VerifyEmail godoc
+// @Summary Verify an email
+// @Description Activates the account with the token of a verification email.
+// @Tags users
+// @Accept json
+// @Produce json
+// @Param verification body domain.VerifyEmailDTO true "Verification token"
+// @Success 204
+// @Failure 400 {object} web.ErrorResponse
+// @Failure 500 {object} web.ErrorResponse
+// @Router /auth/verify [post]
+func (controller *controller) VerifyEmail() gin.HandlerFunc {
+	return func(context *gin.Context) {
+		var request domain.VerifyEmailDTO
+		err := context.ShouldBindJSON(&request)
+		if err != nil {
+			web.NewErrorResponse(context, http.StatusBadRequest,
+				"El JSON enviado en el cuerpo no es válido")
+			return
+		}
+		if err := web.RequestJsonValidation(request); err != "" {
+			web.NewErrorResponse(context, http.StatusBadRequest, err)
+			return
+		}
+		err = controller.service.VerifyEmail(request)
+		if errors.Is(err, user.ErrorInvalidVerify) {
+			web.NewErrorResponse(context, http.StatusBadRequest,
+				"El enlace de verificación es inválido o venció")
+			return
+		}
+		if err != nil {
+			web.NewErrorResponse(context, http.StatusInternalServerError,
+				"Se ha producido un error al verificar el email")
+			return
+		}
+		context.Status(http.StatusNoContent)
+	}
+}
+
+// ResendVerification godoc
+// @Summary Resend the verification email
+// @Description The response is the same whether the email exists or not.
+// @Tags users
+// @Accept json
+// @Produce json
+// @Param user body domain.ResendVerificationDTO true "User email"
+// @Success 202
+// @Failure 400 {object} web.ErrorResponse
+// @Failure 500 {object} web.ErrorResponse
+// @Router /auth/verify/resend [post]
+func (controller *controller) ResendVerification() gin.HandlerFunc {
+	return func(context *gin.Context) {
+		var request domain.ResendVerificationDTO
+		err := context.ShouldBindJSON(&request)
+		if err != nil {
+			web.NewErrorResponse(context, http.StatusBadRequest,
+				"El JSON enviado en el cuerpo no es válido")
+			return
+		}
+		if err := web.RequestJsonValidation(request); err != "" {
+			web.NewErrorResponse(context, http.StatusBadRequest, err)
+			return
+		}
+		if err := controller.service.ResendVerification(context, request); err != nil {
+			web.NewErrorResponse(context, http.StatusInternalServerError,
+				"Se ha producido un error al enviar la verificación")
+			return
+		}
+		context.Status(http.StatusAccepted)
+	}
+}
+
+// Me godoc
+// @Summary Logged in user
+// @Description Returns the user that owns the access token, including the linked dentist.
+// @Tags users
+// @Produce json
+// @Success 200 {object} web.SuccessResponse
+// @Failure 403 {object} web.ErrorResponse
+// @Failure 404 {object} web.ErrorResponse
+// @Failure 500 {object} web.ErrorResponse
+// @Router /me [get]
+func (controller *controller) Me() gin.HandlerFunc {
+	return func(context *gin.Context) {
+		principal, ok := domain.PrincipalFrom(context)
+		if !ok {
+			web.NewErrorResponse(context, http.StatusForbidden, "Token inválido")
+			return
+		}
+		found, err := controller.service.FindByEmail(principal.Email)
+		if errors.Is(err, user.ErrorUserNotFound) {
+			web.NewErrorResponse(context, http.StatusNotFound,
+				"El usuario con email "+principal.Email+" no existe")
+			return
+		}
+		if err != nil {
+			web.NewErrorResponse(context, http.StatusInternalServerError,
+				"Se ha producido un error al buscar el usuario")
+			return
+		}
+		web.NewSuccessResponse(context, http.StatusOK, found)
+	}
+}
+
+// LinkDentist godoc
+// @Summary Link a user to a dentist
+// @Description Lets the user see the agenda and patients of the dentist under /me. The sessions of the user are ended, it must log in again to get a scoped token.
+// @Tags users
+// @Accept json
+// @Produce json
+// @Param id path string true "User ID"
+// @Param dentist body domain.UserDentistDTO true "Dentist to link"
+// @Success 200 {object} web.SuccessResponse
+// @Failure 400 {object} web.ErrorResponse
+// @Failure 404 {object} web.ErrorResponse
+// @Failure 409 {object} web.ErrorResponse
+// @Failure 500 {object} web.ErrorResponse
+// @Router /users/:id/dentist [put]
+func (controller *controller) LinkDentist() gin.HandlerFunc {
+	return func(context *gin.Context) {
+		var request domain.UserDentistDTO
+		err := context.ShouldBindJSON(&request)
+		if err != nil {
+			web.NewErrorResponse(context, http.StatusBadRequest,
+				"El JSON enviado en el cuerpo no es válido")
+			return
+		}
+		if err := web.RequestJsonValidation(request); err != "" {
+			web.NewErrorResponse(context, http.StatusBadRequest, err)
+			return
+		}
+		linked, err := controller.service.LinkDentist(context, context.Param("id"), request)
+		if errors.Is(err, dentists.ErrNotFound) {
+			web.NewErrorResponse(context, http.StatusNotFound, "El odontólogo no existe")
+			return
+		}
+		if errors.Is(err, user.ErrorUserNotFound) {
+			web.NewErrorResponse(context, http.StatusNotFound, "El usuario no existe")
+			return
+		}
+		if errors.Is(err, user.ErrorDentistLinked) {
+			web.NewErrorResponse(context, http.StatusConflict,
+				"El odontólogo ya está vinculado a otro usuario")
+			return
+		}
+		if err != nil {
+			web.NewErrorResponse(context, http.StatusInternalServerError,
+				"Se ha producido un error al vincular el odontólogo")
+			return
+		}
+		web.NewSuccessResponse(context, http.StatusOK, linked)
+	}
+}
+
+// UnlinkDentist godoc
+// @Summary Unlink a user from its dentist
+// @Description The sessions of the user are ended.
+// @Tags users
+// @Produce json
+// @Param id path string true "User ID"
+// @Success 200 {object} web.SuccessResponse
+// @Failure 404 {object} web.ErrorResponse
+// @Failure 500 {object} web.ErrorResponse
+// @Router /users/:id/dentist [delete]
+func (controller *controller) UnlinkDentist() gin.HandlerFunc {
+	return func(context *gin.Context) {
+		unlinked, err := controller.service.UnlinkDentist(context, context.Param("id"))
+		if errors.Is(err, user.ErrorUserNotFound) {
+			web.NewErrorResponse(context, http.StatusNotFound, "El usuario no existe")
+			return
+		}
+		if err != nil {
+			web.NewErrorResponse(context, http.StatusInternalServerError,
+				"Se ha producido un error al desvincular el odontólogo")
+			return
+		}
+		web.NewSuccessResponse(context, http.StatusOK, unlinked)
+	}
+}
+
+// LinkPatient godoc
+// @Summary Link a user to a patient
+// @Description Lets the user see and book the turns of the patient and its dependents under /me/family. The sessions of the user are ended, it must log in again to get a scoped token.
+// @Tags users
+// @Accept json
+// @Produce json
+// @Param id path string true "User ID"
+// @Param patient body domain.UserPatientDTO true "Patient to link"
+// @Success 200 {object} web.SuccessResponse
+// @Failure 400 {object} web.ErrorResponse
+// @Failure 404 {object} web.ErrorResponse
+// @Failure 409 {object} web.ErrorResponse
+// @Failure 500 {object} web.ErrorResponse
+// @Router /users/:id/patient [put]
+func (controller *controller) LinkPatient() gin.HandlerFunc {
+	return func(context *gin.Context) {
+		var request domain.UserPatientDTO
+		err := context.ShouldBindJSON(&request)
+		if err != nil {
+			web.NewErrorResponse(context, http.StatusBadRequest,
+				"El JSON enviado en el cuerpo no es válido")
+			return
+		}
+		if err := web.RequestJsonValidation(request); err != "" {
+			web.NewErrorResponse(context, http.StatusBadRequest, err)
+			return
+		}
+		linked, err := controller.service.LinkPatient(context, context.Param("id"), request)
+		if errors.Is(err, patients.ErrNotFound) {
+			web.NewErrorResponse(context, http.StatusNotFound, "El paciente no existe")
+			return
+		}
+		if errors.Is(err, user.ErrorUserNotFound) {
+			web.NewErrorResponse(context, http.StatusNotFound, "El usuario no existe")
+			return
+		}
+		if errors.Is(err, user.ErrorPatientLinked) {
+			web.NewErrorResponse(context, http.StatusConflict,
+				"El paciente ya está vinculado a otro usuario")
+			return
+		}
+		if err != nil {
+			web.NewErrorResponse(context, http.StatusInternalServerError,
+				"Se ha producido un error al vincular el paciente")
+			return
+		}
+		web.NewSuccessResponse(context, http.StatusOK, linked)
+	}
+}
+
+// UnlinkPatient godoc
+// @Summary Unlink a user from its patient
+// @Description The sessions of the user are ended.
+// @Tags users
+// @Produce json
+// @Param id path string true "User ID"
+// @Success 200 {object} web.SuccessResponse
+// @Failure 404 {object} web.ErrorResponse
+// @Failure 500 {object} web.ErrorResponse
+// @Router /users/:id/patient [delete]
+func (controller *controller) UnlinkPatient() gin.HandlerFunc {
+	return func(context *gin.Context) {
+		unlinked, err := controller.service.UnlinkPatient(context, context.Param("id"))
+		if errors.Is(err, user.ErrorUserNotFound) {
+			web.NewErrorResponse(context, http.StatusNotFound, "El usuario no existe")
+			return
+		}
+		if err != nil {
+			web.NewErrorResponse(context, http.StatusInternalServerError,
+				"Se ha producido un error al desvincular el paciente")
+			return
+		}
+		web.NewSuccessResponse(context, http.StatusOK, unlinked)
+	}
+}
+
+// SetRoles godoc
+// @Summary Replace the roles of a user
+// @Description Roles are admin, receptionist, dentist and patient. The sessions of the user are ended, it must log in again to get the new permissions.
+// @Tags users
+// @Accept json
+// @Produce json
+// @Param id path string true "User ID"
+// @Param roles body domain.UserRolesDTO true "Roles of the user"
+// @Success 200 {object} web.SuccessResponse
+// @Failure 400 {object} web.ErrorResponse
+// @Failure 403 {object} web.ErrorResponse
+// @Failure 404 {object} web.ErrorResponse
+// @Failure 500 {object} web.ErrorResponse
+// @Router /users/:id/roles [put]
+func (controller *controller) SetRoles() gin.HandlerFunc {
+	return func(context *gin.Context) {
+		var request domain.UserRolesDTO
+		err := context.ShouldBindJSON(&request)
+		if err != nil {
+			web.NewErrorResponse(context, http.StatusBadRequest,
+				"El JSON enviado en el cuerpo no es válido")
+			return
+		}
+		updated, err := controller.service.SetRoles(context, context.Param("id"), request)
+		if errors.Is(err, user.ErrorInvalidRole) {
+			web.NewErrorResponse(context, http.StatusBadRequest, "Rol inválido")
+			return
+		}
+		if errors.Is(err, user.ErrorUserNotFound) {
+			web.NewErrorResponse(context, http.StatusNotFound, "El usuario no existe")
+			return
+		}
+		if err != nil {
+			web.NewErrorResponse(context, http.StatusInternalServerError,
+				"Se ha producido un error al asignar los roles")
+			return
+		}
+		web.NewSuccessResponse(context, http.StatusOK, updated)
+	}
+}
+
+// Unlock godoc
+// @Summary Unlock a user
+// @Description Clears the failed logins that delay or lock the user.
+// @Tags users
+// @Produce json
+// @Param id path string true "User ID"
+// @Success 204
+// @Failure 403 {object} web.ErrorResponse
+// @Failure 404 {object} web.ErrorResponse
+// @Failure 500 {object} web.ErrorResponse
+// @Router /users/:id/unlock [post]
+func (controller *controller) Unlock() gin.HandlerFunc {
+	return func(context *gin.Context) {
+		err := controller.service.Unlock(context, context.Param("id"))
+		if errors.Is(err, user.ErrorUserNotFound) {
+			web.NewErrorResponse(context, http.StatusNotFound, "El usuario no existe")
+			return
+		}
+		if err != nil {
+			web.NewErrorResponse(context, http.StatusInternalServerError,
+				"Se ha producido un error al desbloquear el usuario")
+			return
+		}
+		context.Status(http.StatusNoContent)
+	}
+}
+
+// VerifyMfa godoc
+// @Summary Finish a login with the second factor
+// @Description Takes the challenge of the login and a code of the authenticator app or a recovery code. When the challenge enrolls a new app the response includes the recovery codes, which are not shown again.
+// @Tags mfa
+// @Accept json
+// @Produce json
+// @Param code body domain.MfaVerifyDTO true "Challenge and code"
+// @Success 200 {object} web.LoginResponse
+// @Failure 400 {object} web.ErrorResponse
+// @Failure 401 {object} web.ErrorResponse
+// @Failure 500 {object} web.ErrorResponse
+// @Router /auth/mfa/verify [post]
+func (controller *controller) VerifyMfa() gin.HandlerFunc {
+	return func(context *gin.Context) {
+		var request domain.MfaVerifyDTO
+		err := context.ShouldBindJSON(&request)
+		if err != nil {
+			web.NewErrorResponse(context, http.StatusBadRequest,
+				"El JSON enviado en el cuerpo no es válido")
+			return
+		}
+		if err := web.RequestJsonValidation(request); err != "" {
+			web.NewErrorResponse(context, http.StatusBadRequest, err)
+			return
+		}
+		logged, err := controller.service.VerifyMfa(context, request, context.ClientIP())
+		if err != nil {
+			mfaError(context, err, "Se ha producido un error al verificar el segundo factor")
+			return
+		}
+		web.NewLoginResponse(context, http.StatusOK, *logged)
+	}
+}
+
+// StartMfaEnrollment godoc
+// @Summary Set up an authenticator app during login
+// @Description For users whose role requires two factors and have no app yet. Returns the secret, its otpauth URI and a QR code; the login finishes at /auth/mfa/verify with a first code.
+// @Tags mfa
+// @Accept json
+// @Produce json
+// @Param challenge body domain.MfaChallengeDTO true "Challenge of the login"
+// @Success 200 {object} web.SuccessResponse
+// @Failure 400 {object} web.ErrorResponse
+// @Failure 401 {object} web.ErrorResponse
+// @Failure 409 {object} web.ErrorResponse
+// @Failure 500 {object} web.ErrorResponse
+// @Router /auth/mfa/enroll [post]
+func (controller *controller) StartMfaEnrollment() gin.HandlerFunc {
+	return func(context *gin.Context) {
+		var request domain.MfaChallengeDTO
+		err := context.ShouldBindJSON(&request)
+		if err != nil {
+			web.NewErrorResponse(context, http.StatusBadRequest,
+				"El JSON enviado en el cuerpo no es válido")
+			return
+		}
+		if err := web.RequestJsonValidation(request); err != "" {
+			web.NewErrorResponse(context, http.StatusBadRequest, err)
+			return
+		}
+		enrollment, err := controller.service.StartMfaEnrollment(request)
+		if err != nil {
+			mfaError(context, err, "Se ha producido un error al configurar el segundo factor")
+			return
+		}
+		web.NewSuccessResponse(context, http.StatusOK, enrollment)
+	}
+}
+
+// EnrollMfa godoc
+// @Summary Set up an authenticator app
+// @Description Returns the secret, its otpauth URI and a QR code. The app is enabled once confirmed with a first code.
+// @Tags mfa
+// @Produce json
+// @Success 200 {object} web.SuccessResponse
+// @Failure 404 {object} web.ErrorResponse
+// @Failure 409 {object} web.ErrorResponse
+// @Failure 500 {object} web.ErrorResponse
+// @Router /me/mfa [post]
+func (controller *controller) EnrollMfa() gin.HandlerFunc {
+	return func(context *gin.Context) {
+		enrollment, err := controller.service.EnrollMfa(context)
+		if err != nil {
+			mfaError(context, err, "Se ha producido un error al configurar el segundo factor")
+			return
+		}
+		web.NewSuccessResponse(context, http.StatusOK, enrollment)
+	}
+}
+
+// ConfirmMfa godoc
+// @Summary Enable the authenticator app
+// @Description Takes a first code of the app set up at /me/mfa. Returns the recovery codes, which are not shown again.
+// @Tags mfa
+// @Accept json
+// @Produce json
+// @Param code body domain.MfaCodeDTO true "Code of the app"
+// @Success 200 {object} web.SuccessResponse
+// @Failure 400 {object} web.ErrorResponse
+// @Failure 401 {object} web.ErrorResponse
+// @Failure 409 {object} web.ErrorResponse
+// @Failure 500 {object} web.ErrorResponse
+// @Router /me/mfa/confirm [post]
+func (controller *controller) ConfirmMfa() gin.HandlerFunc {
+	return func(context *gin.Context) {
+		var request domain.MfaCodeDTO
+		err := context.ShouldBindJSON(&request)
+		if err != nil {
+			web.NewErrorResponse(context, http.StatusBadRequest,
+				"El JSON enviado en el cuerpo no es válido")
+			return
+		}
+		if err := web.RequestJsonValidation(request); err != "" {
+			web.NewErrorResponse(context, http.StatusBadRequest, err)
+			return
+		}
+		codes, err := controller.service.ConfirmMfa(context, request)
+		if err != nil {
+			mfaError(context, err, "Se ha producido un error al activar el segundo factor")
+			return
+		}
+		web.NewSuccessResponse(context, http.StatusOK, codes)
+	}
+}
+
+// DisableMfa godoc
+// @Summary Disable the authenticator app
+// @Description Takes a code of the app or a recovery code. Removes the app and the recovery codes.
+// @Tags mfa
+// @Accept json
+// @Produce json
+// @Param code body domain.MfaCodeDTO true "Code of the app or recovery code"
+// @Success 204
+// @Failure 400 {object} web.ErrorResponse
+// @Failure 401 {object} web.ErrorResponse
+// @Failure 409 {object} web.ErrorResponse
+// @Failure 500 {object} web.ErrorResponse
+// @Router /me/mfa [delete]
+func (controller *controller) DisableMfa() gin.HandlerFunc {
+	return func(context *gin.Context) {
+		var request domain.MfaCodeDTO
+		err := context.ShouldBindJSON(&request)
+		if err != nil {
+			web.NewErrorResponse(context, http.StatusBadRequest,
+				"El JSON enviado en el cuerpo no es válido")
+			return
+		}
+		if err := web.RequestJsonValidation(request); err != "" {
+			web.NewErrorResponse(context, http.StatusBadRequest, err)
+			return
+		}
+		if err := controller.service.DisableMfa(context, request); err != nil {
+			mfaError(context, err, "Se ha producido un error al desactivar el segundo factor")
+			return
+		}
+		context.Status(http.StatusNoContent)
+	}
+}
+
+// RegenerateRecoveryCodes godoc
+// @Summary Replace the recovery codes
+// @Description Takes a code of the app or a recovery code. The previous recovery codes stop working.
+// @Tags mfa
+// @Accept json
+// @Produce json
+// @Param code body domain.MfaCodeDTO true "Code of the app or recovery code"
+// @Success 200 {object} web.SuccessResponse
+// @Failure 400 {object} web.ErrorResponse
+// @Failure 401 {object} web.ErrorResponse
+// @Failure 409 {object} web.ErrorResponse
+// @Failure 500 {object} web.ErrorResponse
+// @Router /me/mfa/recovery-codes [post]
+func (controller *controller) RegenerateRecoveryCodes() gin.HandlerFunc {
+	return func(context *gin.Context) {
+		var request domain.MfaCodeDTO
+		err := context.ShouldBindJSON(&request)
+		if err != nil {
+			web.NewErrorResponse(context, http.StatusBadRequest,
+				"El JSON enviado en el cuerpo no es válido")
+			return
+		}
+		if err := web.RequestJsonValidation(request); err != "" {
+			web.NewErrorResponse(context, http.StatusBadRequest, err)
+			return
+		}
+		codes, err := controller.service.RegenerateRecoveryCodes(context, request)
+		if err != nil {
+			mfaError(context, err, "Se ha producido un error al generar los códigos de recuperación")
+			return
+		}
+		web.NewSuccessResponse(context, http.StatusOK, codes)
+	}
+}
+
+// ResetMfa godoc
+// @Summary Remove the authenticator app of a user
+// @Description For users who lost their app. If a role requires two factors the next login asks to enroll again.
+// @Tags mfa
+// @Produce json
+// @Param id path string true "User ID"
+// @Success 204
+// @Failure 403 {object} web.ErrorResponse
+// @Failure 404 {object} web.ErrorResponse
+// @Failure 500 {object} web.ErrorResponse
+// @Router /users/:id/mfa [delete]
+func (controller *controller) ResetMfa() gin.HandlerFunc {
+	return func(context *gin.Context) {
+		if err := controller.service.ResetMfa(context, context.Param("id")); err != nil {
+			mfaError(context, err, "Se ha producido un error al quitar el segundo factor")
+			return
+		}
+		context.Status(http.StatusNoContent)
+	}
+}
+
+// GetMfaPolicy godoc
+// @Summary Roles that require two factors
+// @Tags mfa
+// @Produce json
+// @Success 200 {object} web.SuccessResponse
+// @Failure 403 {object} web.ErrorResponse
+// @Failure 500 {object} web.ErrorResponse
+// @Router /mfa/policy [get]
+func (controller *controller) GetMfaPolicy() gin.HandlerFunc {
+	return func(context *gin.Context) {
+		policy, err := controller.service.GetMfaPolicy()
+		if err != nil {
+			web.NewErrorResponse(context, http.StatusInternalServerError,
+				"Se ha producido un error al buscar la política de segundo factor")
+			return
+		}
+		web.NewSuccessResponse(context, http.StatusOK, policy)
+	}
+}
+
+// SetMfaPolicy godoc
+// @Summary Replace the roles that require two factors
+// @Description Users of these roles without an authenticator app set one up on their next login.
+// @Tags mfa
+// @Accept json
+// @Produce json
+// @Param policy body domain.MfaPolicyDTO true "Roles that require two factors"
+// @Success 200 {object} web.SuccessResponse
+// @Failure 400 {object} web.ErrorResponse
+// @Failure 403 {object} web.ErrorResponse
+// @Failure 500 {object} web.ErrorResponse
+// @Router /mfa/policy [put]
+func (controller *controller) SetMfaPolicy() gin.HandlerFunc {
+	return func(context *gin.Context) {
+		var request domain.MfaPolicyDTO
+		err := context.ShouldBindJSON(&request)
+		if err != nil {
+			web.NewErrorResponse(context, http.StatusBadRequest,
+				"El JSON enviado en el cuerpo no es válido")
+			return
+		}
+		policy, err := controller.service.SetMfaPolicy(request)
+		if errors.Is(err, user.ErrorInvalidRole) {
+			web.NewErrorResponse(context, http.StatusBadRequest, "Rol inválido")
+			return
+		}
+		if err != nil {
+			web.NewErrorResponse(context, http.StatusInternalServerError,
+				"Se ha producido un error al guardar la política de segundo factor")
+			return
+		}
+		web.NewSuccessResponse(context, http.StatusOK, policy)
+	}
+}
+
+// SsoLogin godoc
+// @Summary Log in with the identity provider
+// @Description Redirects the browser to the OpenID Connect provider, which sends it back to /auth/oidc/callback.
+// @Tags users
+// @Success 302
+// @Failure 404 {object} web.ErrorResponse
+// @Failure 500 {object} web.ErrorResponse
+// @Router /auth/oidc/login [get]
+func (controller *controller) SsoLogin() gin.HandlerFunc {
+	return func(context *gin.Context) {
+		url, state, err := controller.service.StartSso(context)
+		if errors.Is(err, user.ErrorSsoDisabled) {
+			web.NewErrorResponse(context, http.StatusNotFound,
+				"El inicio de sesión con el proveedor de identidad no está configurado")
+			return
+		}
+		if err != nil {
+			web.NewErrorResponse(context, http.StatusInternalServerError,
+				"Se ha producido un error al iniciar sesión con el proveedor de identidad")
+			return
+		}
+		// The state is bound to the browser that started the login, so a
+		// callback cannot be replayed in another one.
+		context.SetSameSite(http.SameSiteLaxMode)
+		context.SetCookie(ssoStateCookie, state, int(ssoStateCookieAge.Seconds()),
+			path.Dir(context.FullPath()), "", context.Request.TLS != nil, true)
+		context.Redirect(http.StatusFound, url)
+	}
+}
+
+// SsoCallback godoc
+// @Summary Finish the login with the identity provider
+// @Description Takes the code the OpenID Connect provider redirects with. Returns the tokens, or a challenge to finish at /auth/mfa/verify when the user logs in with two factors.
+// @Tags users
+// @Produce json
+// @Param code query string true "Authorization code"
+// @Param state query string true "State of the login"
+// @Success 200 {object} web.LoginResponse
+// @Success 202 {object} web.ChallengeResponse
+// @Failure 401 {object} web.ErrorResponse
+// @Failure 403 {object} web.ErrorResponse
+// @Failure 404 {object} web.ErrorResponse
+// @Failure 500 {object} web.ErrorResponse
+// @Router /auth/oidc/callback [get]
+func (controller *controller) SsoCallback() gin.HandlerFunc {
+	return func(context *gin.Context) {
+		var request domain.SsoCallbackDTO
+		if err := context.ShouldBindQuery(&request); err != nil || context.Query("error") != "" {
+			web.NewErrorResponse(context, http.StatusUnauthorized,
+				"El proveedor de identidad rechazó el inicio de sesión")
+			return
+		}
+		cookie, _ := context.Cookie(ssoStateCookie)
+		context.SetCookie(ssoStateCookie, "", -1, path.Dir(context.FullPath()), "",
+			context.Request.TLS != nil, true)
+		if request.State == "" || subtle.ConstantTimeCompare([]byte(cookie), []byte(request.State)) != 1 {
+			web.NewErrorResponse(context, http.StatusUnauthorized,
+				"El inicio de sesión con el proveedor de identidad es inválido o venció")
+			return
+		}
+		logged, err := controller.service.FinishSso(context, request, context.ClientIP())
+		var challenged *user.MfaRequiredError
+		if errors.As(err, &challenged) {
+			context.JSON(http.StatusAccepted, challenged.Challenge)
+			return
+		}
+		if errors.Is(err, user.ErrorSsoDisabled) {
+			web.NewErrorResponse(context, http.StatusNotFound,
+				"El inicio de sesión con el proveedor de identidad no está configurado")
+			return
+		}
+		if errors.Is(err, user.ErrorInvalidSso) {
+			web.NewErrorResponse(context, http.StatusUnauthorized,
+				"El inicio de sesión con el proveedor de identidad es inválido o venció")
+			return
+		}
+		if errors.Is(err, user.ErrorSsoNoAccount) {
+			web.NewErrorResponse(context, http.StatusForbidden,
+				"No hay un usuario para la identidad del proveedor")
+			return
+		}
+		if err != nil {
+			web.NewErrorResponse(context, http.StatusInternalServerError,
+				"Se ha producido un error al iniciar sesión con el proveedor de identidad")
+			return
+		}
+		web.NewLoginResponse(context, http.StatusOK, *logged)
+	}
+}
+
+// mfaError answers the errors shared by the second factor handlers.
+func mfaError(context *gin.Context, err error, message string) {
+	switch {
+	case errors.Is(err, user.ErrorInvalidChallenge):
+		web.NewErrorResponse(context, http.StatusUnauthorized,
+			"El desafío de segundo factor es inválido o venció")
+	case errors.Is(err, user.ErrorInvalidMfaCode):
+		web.NewErrorResponse(context, http.StatusUnauthorized, "El código es inválido")
+	case errors.Is(err, user.ErrorMfaEnabled):
+		web.NewErrorResponse(context, http.StatusConflict, "El segundo factor ya está activado")
+	case errors.Is(err, user.ErrorMfaNotEnabled):
+		web.NewErrorResponse(context, http.StatusConflict, "El segundo factor no está activado")
+	case errors.Is(err, user.ErrorUserNotFound):
+		web.NewErrorResponse(context, http.StatusNotFound, "El usuario no existe")
+	default:
+		web.NewErrorResponse(context, http.StatusInternalServerError, message)
+	}
+}
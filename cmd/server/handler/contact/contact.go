@@ -0,0 +1,183 @@
+package contact
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	accessController "github.com/ncondezo/final/cmd/server/handler/access"
+	"github.com/ncondezo/final/internal/contacts"
+	"github.com/ncondezo/final/internal/domain"
+	"github.com/ncondezo/final/internal/patients"
+	"github.com/ncondezo/final/pkg/web"
+)
+
+type Controller struct {
+	service contacts.Service
+}
+
+func NewContactController(service contacts.Service) *Controller {
+	return &Controller{service: service}
+}
+
+// @BasePath /api/v1
+
+// HandlerGetByPatientID godoc
+// @Summary Get the contact details and consents of a patient
+// @Tags contacts
+// @Produce json
+// @Param ID path int true "Patient ID"
+// @Param X-Access-Purpose header string false "treatment, scheduling, billing, administration or emergency"
+// @Success 200 {object} web.SuccessResponse
+// @Failure 400 {object} web.ErrorResponse
+// @Failure 403 {object} web.ErrorResponse
+// @Failure 404 {object} web.ErrorResponse
+// @Failure 500 {object} web.ErrorResponse
+// @Router /patients/:id/contact [get]
+func (c *Controller) HandlerGetByPatientID() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+
+		id, err := strconv.Atoi(ctx.Param("id"))
+		if err != nil {
+			web.NewErrorResponse(ctx, http.StatusBadRequest, "invalid id")
+			return
+		}
+
+		contact, err := c.service.View(ctx, id, accessController.Purpose(ctx))
+		if errors.Is(err, patients.ErrNotFound) {
+			web.NewErrorResponse(ctx, http.StatusNotFound, "patient not found")
+			return
+		}
+		if accessController.Error(ctx, err) {
+			return
+		}
+		if err != nil {
+			web.NewErrorResponse(ctx, http.StatusInternalServerError, "internal server error")
+			return
+		}
+
+		web.NewSuccessResponse(ctx, http.StatusOK, contact)
+	}
+}
+
+// HandlerUpdate godoc
+// @Summary Replace the contact details and preferences of a patient
+// @Tags contacts
+// @Accept json
+// @Produce json
+// @Param ID path int true "Patient ID"
+// @Param Contact body domain.PatientContactDTO true "Contact details"
+// @Success 200 {object} web.SuccessResponse
+// @Failure 400 {object} web.ErrorResponse
+// @Failure 404 {object} web.ErrorResponse
+// @Failure 500 {object} web.ErrorResponse
+// @Router /patients/:id/contact [put]
+func (c *Controller) HandlerUpdate() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+
+		var request domain.PatientContactDTO
+
+		errBind := ctx.Bind(&request)
+		if errBind != nil {
+			web.NewErrorResponse(ctx, http.StatusBadRequest, "bad request binding")
+			return
+		}
+
+		id, err := strconv.Atoi(ctx.Param("id"))
+		if err != nil {
+			web.NewErrorResponse(ctx, http.StatusBadRequest, "invalid id")
+			return
+		}
+
+		contact, err := c.service.Update(ctx, request, id)
+		if errors.Is(err, patients.ErrNotFound) {
+			web.NewErrorResponse(ctx, http.StatusNotFound, "patient not found")
+			return
+		}
+		if message, ok := validationMessage(err); ok {
+			web.NewErrorResponse(ctx, http.StatusBadRequest, message)
+			return
+		}
+		if err != nil {
+			web.NewErrorResponse(ctx, http.StatusInternalServerError, "internal server error")
+			return
+		}
+
+		web.NewSuccessResponse(ctx, http.StatusOK, contact)
+	}
+}
+
+// HandlerSetConsent godoc
+// @Summary Opt a patient in or out of a contact channel
+// @Tags contacts
+// @Accept json
+// @Produce json
+// @Param ID path int true "Patient ID"
+// @Param channel path string true "sms, whatsapp or email"
+// @Param Consent body domain.ContactConsentDTO true "Consent"
+// @Success 200 {object} web.SuccessResponse
+// @Failure 400 {object} web.ErrorResponse
+// @Failure 404 {object} web.ErrorResponse
+// @Failure 500 {object} web.ErrorResponse
+// @Router /patients/:id/contact/consents/:channel [put]
+func (c *Controller) HandlerSetConsent() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+
+		var request domain.ContactConsentDTO
+
+		errBind := ctx.Bind(&request)
+		if errBind != nil {
+			web.NewErrorResponse(ctx, http.StatusBadRequest, "bad request binding")
+			return
+		}
+
+		id, err := strconv.Atoi(ctx.Param("id"))
+		if err != nil {
+			web.NewErrorResponse(ctx, http.StatusBadRequest, "invalid id")
+			return
+		}
+
+		contact, err := c.service.SetConsent(ctx, request, id, ctx.Param("channel"))
+		if errors.Is(err, contacts.ErrInvalidChannel) {
+			web.NewErrorResponse(ctx, http.StatusBadRequest, "invalid channel")
+			return
+		}
+		if errors.Is(err, contacts.ErrGuardianRequired) {
+			web.NewErrorResponse(ctx, http.StatusBadRequest, "consent must be signed by a guardian")
+			return
+		}
+		if errors.Is(err, contacts.ErrNotGuardian) {
+			web.NewErrorResponse(ctx, http.StatusBadRequest, "signer is not a guardian of the patient")
+			return
+		}
+		if errors.Is(err, patients.ErrNotFound) {
+			web.NewErrorResponse(ctx, http.StatusNotFound, "patient not found")
+			return
+		}
+		if err != nil {
+			web.NewErrorResponse(ctx, http.StatusInternalServerError, "internal server error")
+			return
+		}
+
+		web.NewSuccessResponse(ctx, http.StatusOK, contact)
+	}
+}
+
+func validationMessage(err error) (string, bool) {
+	switch {
+	case errors.Is(err, contacts.ErrInvalidPhone):
+		return "phone must be in E.164 format, e.g. +5491155556666", true
+	case errors.Is(err, contacts.ErrInvalidEmail):
+		return "invalid email", true
+	case errors.Is(err, contacts.ErrInvalidChannel):
+		return "invalid preferred channel", true
+	case errors.Is(err, contacts.ErrChannelNoAddress):
+		return "preferred channel has no contact address", true
+	case errors.Is(err, contacts.ErrInvalidQuietHours):
+		return "quiet hours must be both set as HH:MM", true
+	case errors.Is(err, contacts.ErrInvalidTimezone):
+		return "invalid timezone", true
+	}
+	return "", false
+}
@@ -8,6 +8,7 @@ import (
 	"github.com/gin-gonic/gin"
 	"github.com/ncondezo/final/internal/dentists"
 	"github.com/ncondezo/final/internal/domain"
+	"github.com/ncondezo/final/pkg/patch"
 	"github.com/ncondezo/final/pkg/web"
 )
 
@@ -143,29 +144,26 @@ func (c *Controller) HandlerUpdate() gin.HandlerFunc {
 }
 
 // HandlerPatch godoc
-// @Summary Update a dentist registry number by id
+// @Summary Partially update a dentist by id
+// @Description Accepts a JSON Merge Patch (RFC 7396) or, with application/json-patch+json, a JSON Patch (RFC 6902).
 // @Tags dentists
 // @Accept json
 // @Produce json
 // @Param ID path int true "Dentist ID to update"
-// @Param DentistRegistry body domain.DentistRegistryDTO true "Dentist registry number"
+// @Param Patch body object true "Merge patch or JSON patch document"
 // @Success 200 {object} web.SuccessResponse
 // @Failure 400 {object} web.ErrorResponse
 // @Failure 404 {object} web.ErrorResponse
+// @Failure 409 {object} web.ErrorResponse
+// @Failure 415 {object} web.ErrorResponse
 // @Failure 500 {object} web.ErrorResponse
 // @Router /dentists/:id [patch]
 func (c *Controller) HandlerPatch() gin.HandlerFunc {
 	return func(ctx *gin.Context) {
 
-		var request domain.DentistRegistryDTO
-
-		errBind := ctx.Bind(&request)
-		if errBind != nil {
-			web.NewErrorResponse(ctx, http.StatusBadRequest, "bad request binding")
-			return
-		}
-		if err := web.RequestJsonValidation(request); err != "" {
-			web.NewErrorResponse(ctx, http.StatusBadRequest, err)
+		document, errBody := ctx.GetRawData()
+		if errBody != nil {
+			web.NewErrorResponse(ctx, http.StatusBadRequest, "bad request body")
 			return
 		}
 
@@ -175,12 +173,28 @@ func (c *Controller) HandlerPatch() gin.HandlerFunc {
 			return
 		}
 
-		dentist, err := c.service.Patch(ctx, request, id)
-		if errors.Is(err, dentists.ErrNotFound) {
+		dentist, err := c.service.Patch(ctx, document, ctx.GetHeader("Content-Type"), id)
+		var resultError *patch.ResultError
+		switch {
+		case errors.As(err, &resultError):
+			web.NewErrorResponse(ctx, http.StatusBadRequest, resultError.Reason)
+			return
+		case errors.Is(err, patch.ErrInvalidPatch):
+			web.NewErrorResponse(ctx, http.StatusBadRequest, "invalid patch document")
+			return
+		case errors.Is(err, patch.ErrUnsupportedMediaType):
+			web.NewErrorResponse(ctx, http.StatusUnsupportedMediaType, "unsupported patch media type")
+			return
+		case errors.Is(err, patch.ErrTestFailed):
+			web.NewErrorResponse(ctx, http.StatusConflict, "patch test operation failed")
+			return
+		case errors.Is(err, dentists.ErrNotFound):
 			web.NewErrorResponse(ctx, http.StatusNotFound, "dentist not found")
 			return
-		}
-		if err != nil {
+		case errors.Is(err, dentists.ErrAlreadyExists):
+			web.NewErrorResponse(ctx, http.StatusConflict, "dentist already exists")
+			return
+		case err != nil:
 			web.NewErrorResponse(ctx, http.StatusInternalServerError, "internal server error")
 			return
 		}
@@ -224,3 +238,225 @@ func (c *Controller) HandlerDelete() gin.HandlerFunc {
 		})
 	}
 }
+
+// HandlerList godoc
+// @Summary List dentists with pagination, sorting and search
+// @Tags dentists
+// @Produce json
+// @Param specialty query string false "Specialty code"
+// @Param q query string false "Part of the name or registry"
+// @Param include_inactive query bool false "Include inactive dentists"
+// @Param sort query string false "id, name, lastname or registry"
+// @Param order query string false "asc or desc"
+// @Param page query int false "Page number, from 1"
+// @Param page_size query int false "Page size, up to 100"
+// @Success 200 {object} web.SuccessResponse
+// @Failure 400 {object} web.ErrorResponse
+// @Failure 404 {object} web.ErrorResponse
+// @Failure 500 {object} web.ErrorResponse
+// @Router /dentists [get]
+func (c *Controller) HandlerList() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+
+		filter := domain.DentistFilter{
+			Specialty: ctx.Query("specialty"),
+			Q:         ctx.Query("q"),
+			Sort:      ctx.Query("sort"),
+			Order:     ctx.Query("order"),
+		}
+
+		var err error
+		if value := ctx.Query("include_inactive"); value != "" {
+			if filter.IncludeInactive, err = strconv.ParseBool(value); err != nil {
+				web.NewErrorResponse(ctx, http.StatusBadRequest, "invalid include_inactive")
+				return
+			}
+		}
+		if value := ctx.Query("page"); value != "" {
+			if filter.Page, err = strconv.Atoi(value); err != nil {
+				web.NewErrorResponse(ctx, http.StatusBadRequest, "invalid page")
+				return
+			}
+		}
+		if value := ctx.Query("page_size"); value != "" {
+			if filter.PageSize, err = strconv.Atoi(value); err != nil {
+				web.NewErrorResponse(ctx, http.StatusBadRequest, "invalid page_size")
+				return
+			}
+		}
+
+		page, err := c.service.List(ctx, filter)
+		switch {
+		case errors.Is(err, dentists.ErrInvalidSort):
+			web.NewErrorResponse(ctx, http.StatusBadRequest, "sort must be id, name, lastname or registry")
+			return
+		case errors.Is(err, dentists.ErrInvalidOrder):
+			web.NewErrorResponse(ctx, http.StatusBadRequest, "order must be asc or desc")
+			return
+		case errors.Is(err, dentists.ErrInvalidPage):
+			web.NewErrorResponse(ctx, http.StatusBadRequest, "page must be positive and page_size at most 100")
+			return
+		case errors.Is(err, dentists.ErrSpecialtyNotFound):
+			web.NewErrorResponse(ctx, http.StatusNotFound, "specialty not found")
+			return
+		case err != nil:
+			web.NewErrorResponse(ctx, http.StatusInternalServerError, "internal server error")
+			return
+		}
+
+		web.NewSuccessResponse(ctx, http.StatusOK, page)
+	}
+}
+
+// HandlerSetActive godoc
+// @Summary Activate or deactivate a dentist
+// @Tags dentists
+// @Accept json
+// @Produce json
+// @Param ID path int true "Dentist ID"
+// @Param Status body domain.DentistStatusDTO true "Dentist status"
+// @Success 200 {object} web.SuccessResponse
+// @Failure 400 {object} web.ErrorResponse
+// @Failure 404 {object} web.ErrorResponse
+// @Failure 500 {object} web.ErrorResponse
+// @Router /dentists/:id/status [put]
+func (c *Controller) HandlerSetActive() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+
+		var request domain.DentistStatusDTO
+
+		errBind := ctx.Bind(&request)
+		if errBind != nil {
+			web.NewErrorResponse(ctx, http.StatusBadRequest, "bad request binding")
+			return
+		}
+
+		id, err := strconv.Atoi(ctx.Param("id"))
+		if err != nil {
+			web.NewErrorResponse(ctx, http.StatusBadRequest, "invalid id")
+			return
+		}
+
+		dentist, err := c.service.SetActive(ctx, request, id)
+		if errors.Is(err, dentists.ErrNotFound) {
+			web.NewErrorResponse(ctx, http.StatusNotFound, "dentist not found")
+			return
+		}
+		if err != nil {
+			web.NewErrorResponse(ctx, http.StatusInternalServerError, "internal server error")
+			return
+		}
+
+		web.NewSuccessResponse(ctx, http.StatusOK, dentist)
+	}
+}
+
+// HandlerSetSpecialties godoc
+// @Summary Replace the specialties of a dentist
+// @Tags dentists
+// @Accept json
+// @Produce json
+// @Param ID path int true "Dentist ID"
+// @Param Specialties body domain.DentistSpecialtiesDTO true "Specialty codes"
+// @Success 200 {object} web.SuccessResponse
+// @Failure 400 {object} web.ErrorResponse
+// @Failure 404 {object} web.ErrorResponse
+// @Failure 500 {object} web.ErrorResponse
+// @Router /dentists/:id/specialties [put]
+func (c *Controller) HandlerSetSpecialties() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+
+		var request domain.DentistSpecialtiesDTO
+
+		errBind := ctx.Bind(&request)
+		if errBind != nil {
+			web.NewErrorResponse(ctx, http.StatusBadRequest, "bad request binding")
+			return
+		}
+
+		id, err := strconv.Atoi(ctx.Param("id"))
+		if err != nil {
+			web.NewErrorResponse(ctx, http.StatusBadRequest, "invalid id")
+			return
+		}
+
+		dentist, err := c.service.SetSpecialties(ctx, request, id)
+		if errors.Is(err, dentists.ErrNotFound) {
+			web.NewErrorResponse(ctx, http.StatusNotFound, "dentist not found")
+			return
+		}
+		if errors.Is(err, dentists.ErrSpecialtyNotFound) {
+			web.NewErrorResponse(ctx, http.StatusNotFound, "specialty not found")
+			return
+		}
+		if err != nil {
+			web.NewErrorResponse(ctx, http.StatusInternalServerError, "internal server error")
+			return
+		}
+
+		web.NewSuccessResponse(ctx, http.StatusOK, dentist)
+	}
+}
+
+// HandlerCreateSpecialty godoc
+// @Summary Create a new specialty
+// @Tags dentists
+// @Accept json
+// @Produce json
+// @Param Specialty body domain.Specialty true "Specialty"
+// @Success 201 {object} web.SuccessResponse
+// @Failure 400 {object} web.ErrorResponse
+// @Failure 409 {object} web.ErrorResponse
+// @Failure 500 {object} web.ErrorResponse
+// @Router /specialties [post]
+func (c *Controller) HandlerCreateSpecialty() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+
+		var request domain.Specialty
+
+		if err := ctx.Bind(&request); err != nil {
+			web.NewErrorResponse(ctx, http.StatusBadRequest, "bad request")
+			return
+		}
+		if err := web.RequestJsonValidation(request); err != "" {
+			web.NewErrorResponse(ctx, http.StatusBadRequest, err)
+			return
+		}
+
+		specialty, err := c.service.CreateSpecialty(ctx, request)
+		if errors.Is(err, dentists.ErrInvalidSpecialtyCode) {
+			web.NewErrorResponse(ctx, http.StatusBadRequest, "code must be lowercase letters and underscores")
+			return
+		}
+		if errors.Is(err, dentists.ErrSpecialtyAlreadyExists) {
+			web.NewErrorResponse(ctx, http.StatusConflict, "specialty already exists")
+			return
+		}
+		if err != nil {
+			web.NewErrorResponse(ctx, http.StatusInternalServerError, "internal server error")
+			return
+		}
+
+		web.NewSuccessResponse(ctx, http.StatusCreated, specialty)
+	}
+}
+
+// HandlerGetSpecialties godoc
+// @Summary Get every specialty
+// @Tags dentists
+// @Produce json
+// @Success 200 {object} web.SuccessResponse
+// @Failure 500 {object} web.ErrorResponse
+// @Router /specialties [get]
+func (c *Controller) HandlerGetSpecialties() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+
+		specialties, err := c.service.GetSpecialties(ctx)
+		if err != nil {
+			web.NewErrorResponse(ctx, http.StatusInternalServerError, "internal server error")
+			return
+		}
+
+		web.NewSuccessResponse(ctx, http.StatusOK, specialties)
+	}
+}
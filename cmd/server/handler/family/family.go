@@ -0,0 +1,325 @@
+package family
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	accessController "github.com/ncondezo/final/cmd/server/handler/access"
+	"github.com/ncondezo/final/internal/dentists"
+	"github.com/ncondezo/final/internal/domain"
+	"github.com/ncondezo/final/internal/family"
+	"github.com/ncondezo/final/internal/insurance"
+	"github.com/ncondezo/final/internal/patients"
+	"github.com/ncondezo/final/internal/turns"
+	"github.com/ncondezo/final/pkg/web"
+)
+
+type Controller struct {
+	service family.Service
+}
+
+func NewFamilyController(service family.Service) *Controller {
+	return &Controller{service: service}
+}
+
+// @BasePath /api/v1
+
+// HandlerGetFamily godoc
+// @Summary Get a guardian together with its dependents
+// @Tags family
+// @Produce json
+// @Param ID path int true "Guardian patient ID"
+// @Param X-Access-Purpose header string false "treatment, scheduling, billing, administration or emergency"
+// @Success 200 {object} web.SuccessResponse
+// @Failure 400 {object} web.ErrorResponse
+// @Failure 403 {object} web.ErrorResponse
+// @Failure 404 {object} web.ErrorResponse
+// @Failure 500 {object} web.ErrorResponse
+// @Router /patients/:id/family [get]
+// @Router /me/family [get]
+func (c *Controller) HandlerGetFamily() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+
+		id, ok := guardianId(ctx)
+		if !ok {
+			return
+		}
+
+		result, err := c.service.GetFamily(ctx, id, accessController.Purpose(ctx))
+		if errors.Is(err, patients.ErrNotFound) {
+			web.NewErrorResponse(ctx, http.StatusNotFound, "patient not found")
+			return
+		}
+		if accessController.Error(ctx, err) {
+			return
+		}
+		if err != nil {
+			web.NewErrorResponse(ctx, http.StatusInternalServerError, "internal server error")
+			return
+		}
+
+		web.NewSuccessResponse(ctx, http.StatusOK, result)
+	}
+}
+
+// HandlerGetGuardians godoc
+// @Summary Get the guardians of a patient
+// @Tags family
+// @Produce json
+// @Param ID path int true "Dependent patient ID"
+// @Param X-Access-Purpose header string false "treatment, scheduling, billing, administration or emergency"
+// @Success 200 {object} web.SuccessResponse
+// @Failure 400 {object} web.ErrorResponse
+// @Failure 403 {object} web.ErrorResponse
+// @Failure 404 {object} web.ErrorResponse
+// @Failure 500 {object} web.ErrorResponse
+// @Router /patients/:id/guardians [get]
+func (c *Controller) HandlerGetGuardians() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+
+		id, err := strconv.Atoi(ctx.Param("id"))
+		if err != nil {
+			web.NewErrorResponse(ctx, http.StatusBadRequest, "invalid id")
+			return
+		}
+
+		guardians, err := c.service.GetGuardians(ctx, id, accessController.Purpose(ctx))
+		if errors.Is(err, patients.ErrNotFound) {
+			web.NewErrorResponse(ctx, http.StatusNotFound, "patient not found")
+			return
+		}
+		if accessController.Error(ctx, err) {
+			return
+		}
+		if err != nil {
+			web.NewErrorResponse(ctx, http.StatusInternalServerError, "internal server error")
+			return
+		}
+
+		web.NewSuccessResponse(ctx, http.StatusOK, guardians)
+	}
+}
+
+// HandlerAddDependent godoc
+// @Summary Make a patient the guardian of another one
+// @Tags family
+// @Accept json
+// @Produce json
+// @Param ID path int true "Guardian patient ID"
+// @Param Dependent body domain.PatientGuardianDTO true "Dependent"
+// @Success 201 {object} web.SuccessResponse
+// @Failure 400 {object} web.ErrorResponse
+// @Failure 404 {object} web.ErrorResponse
+// @Failure 409 {object} web.ErrorResponse
+// @Failure 500 {object} web.ErrorResponse
+// @Router /patients/:id/dependents [post]
+func (c *Controller) HandlerAddDependent() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+
+		var request domain.PatientGuardianDTO
+
+		errBind := ctx.Bind(&request)
+		if errBind != nil {
+			web.NewErrorResponse(ctx, http.StatusBadRequest, "bad request binding")
+			return
+		}
+		if err := web.RequestJsonValidation(request); err != "" {
+			web.NewErrorResponse(ctx, http.StatusBadRequest, err)
+			return
+		}
+
+		id, err := strconv.Atoi(ctx.Param("id"))
+		if err != nil {
+			web.NewErrorResponse(ctx, http.StatusBadRequest, "invalid id")
+			return
+		}
+
+		guardian, err := c.service.AddDependent(ctx, request, id)
+		switch {
+		case errors.Is(err, family.ErrInvalidRelationship):
+			web.NewErrorResponse(ctx, http.StatusBadRequest, "relationship must be parent, legal_guardian or relative")
+			return
+		case errors.Is(err, family.ErrSelfRelation):
+			web.NewErrorResponse(ctx, http.StatusBadRequest, "a patient cannot be its own guardian")
+			return
+		case errors.Is(err, family.ErrCircularRelation):
+			web.NewErrorResponse(ctx, http.StatusConflict, "dependent is already a guardian of the patient")
+			return
+		case errors.Is(err, family.ErrAlreadyExists):
+			web.NewErrorResponse(ctx, http.StatusConflict, "dependent already linked")
+			return
+		case errors.Is(err, patients.ErrNotFound):
+			web.NewErrorResponse(ctx, http.StatusNotFound, "patient not found")
+			return
+		case err != nil:
+			web.NewErrorResponse(ctx, http.StatusInternalServerError, "internal server error")
+			return
+		}
+
+		web.NewSuccessResponse(ctx, http.StatusCreated, guardian)
+	}
+}
+
+// HandlerRemoveDependent godoc
+// @Summary Unlink a dependent from its guardian
+// @Tags family
+// @Param ID path int true "Guardian patient ID"
+// @Param dependentId path int true "Dependent patient ID"
+// @Success 204
+// @Failure 400 {object} web.ErrorResponse
+// @Failure 404 {object} web.ErrorResponse
+// @Failure 500 {object} web.ErrorResponse
+// @Router /patients/:id/dependents/:dependentId [delete]
+func (c *Controller) HandlerRemoveDependent() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+
+		id, err := strconv.Atoi(ctx.Param("id"))
+		if err != nil {
+			web.NewErrorResponse(ctx, http.StatusBadRequest, "invalid id")
+			return
+		}
+		dependentId, err := strconv.Atoi(ctx.Param("dependentId"))
+		if err != nil {
+			web.NewErrorResponse(ctx, http.StatusBadRequest, "invalid dependent id")
+			return
+		}
+
+		err = c.service.RemoveDependent(ctx, id, dependentId)
+		if errors.Is(err, family.ErrNotFound) {
+			web.NewErrorResponse(ctx, http.StatusNotFound, "dependent not found")
+			return
+		}
+		if err != nil {
+			web.NewErrorResponse(ctx, http.StatusInternalServerError, "internal server error")
+			return
+		}
+
+		ctx.Status(http.StatusNoContent)
+	}
+}
+
+// HandlerGetFamilyTurns godoc
+// @Summary Get the turns of a guardian and all of its dependents
+// @Tags family
+// @Produce json
+// @Param ID path int true "Guardian patient ID"
+// @Param X-Access-Purpose header string false "treatment, scheduling, billing, administration or emergency"
+// @Success 200 {object} web.SuccessResponse
+// @Failure 400 {object} web.ErrorResponse
+// @Failure 403 {object} web.ErrorResponse
+// @Failure 404 {object} web.ErrorResponse
+// @Failure 500 {object} web.ErrorResponse
+// @Router /patients/:id/family/turns [get]
+// @Router /me/family/turns [get]
+func (c *Controller) HandlerGetFamilyTurns() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+
+		id, ok := guardianId(ctx)
+		if !ok {
+			return
+		}
+
+		familyTurns, err := c.service.GetFamilyTurns(ctx, id, accessController.Purpose(ctx))
+		if errors.Is(err, patients.ErrNotFound) {
+			web.NewErrorResponse(ctx, http.StatusNotFound, "patient not found")
+			return
+		}
+		if accessController.Error(ctx, err) {
+			return
+		}
+		if err != nil {
+			web.NewErrorResponse(ctx, http.StatusInternalServerError, "internal server error")
+			return
+		}
+
+		web.NewSuccessResponse(ctx, http.StatusOK, familyTurns)
+	}
+}
+
+// HandlerBookTurn godoc
+// @Summary Book a turn for a guardian or one of its dependents
+// @Tags family
+// @Accept json
+// @Produce json
+// @Param ID path int true "Guardian patient ID"
+// @Param Turn body domain.TurnDTO true "Turn information"
+// @Success 201 {object} web.SuccessResponse
+// @Failure 400 {object} web.ErrorResponse
+// @Failure 403 {object} web.ErrorResponse
+// @Failure 404 {object} web.ErrorResponse
+// @Failure 500 {object} web.ErrorResponse
+// @Router /patients/:id/family/turns [post]
+// @Router /me/family/turns [post]
+func (c *Controller) HandlerBookTurn() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+
+		var request domain.TurnDTO
+
+		errBind := ctx.Bind(&request)
+		if errBind != nil {
+			web.NewErrorResponse(ctx, http.StatusBadRequest, "bad request binding")
+			return
+		}
+		if err := web.RequestJsonValidation(request); err != "" {
+			web.NewErrorResponse(ctx, http.StatusBadRequest, err)
+			return
+		}
+
+		id, ok := guardianId(ctx)
+		if !ok {
+			return
+		}
+
+		turn, err := c.service.BookTurn(ctx, request, id)
+		switch {
+		case errors.Is(err, turns.ErrInvalidDate):
+			web.NewErrorResponse(ctx, http.StatusBadRequest, "date is missing or in the past")
+			return
+		case errors.Is(err, family.ErrNotFamilyMember):
+			web.NewErrorResponse(ctx, http.StatusForbidden, "patient is not part of the family")
+			return
+		case errors.Is(err, patients.ErrNotFound):
+			web.NewErrorResponse(ctx, http.StatusNotFound, "patient not found")
+			return
+		case errors.Is(err, dentists.ErrNotFound):
+			web.NewErrorResponse(ctx, http.StatusNotFound, "dentist not found")
+			return
+		case errors.Is(err, insurance.ErrProcedureNotFound):
+			web.NewErrorResponse(ctx, http.StatusNotFound, "procedure not found")
+			return
+		case errors.Is(err, turns.ErrSpecialtyMismatch):
+			web.NewErrorResponse(ctx, http.StatusConflict, "dentist lacks the specialty required by the procedure")
+			return
+		case errors.Is(err, turns.ErrDentistInactive):
+			web.NewErrorResponse(ctx, http.StatusConflict, "dentist is inactive")
+			return
+		case err != nil:
+			web.NewErrorResponse(ctx, http.StatusInternalServerError, "internal server error")
+			return
+		}
+
+		web.NewSuccessResponse(ctx, http.StatusCreated, turn)
+	}
+}
+
+// guardianId returns the guardian a request acts for: the patient of the
+// path, or on /me routes the patient the user is linked to.
+func guardianId(ctx *gin.Context) (int, bool) {
+	if ctx.Param("id") == "" {
+		principal, ok := domain.PrincipalFrom(ctx)
+		if !ok || principal.PatientId == 0 {
+			web.NewErrorResponse(ctx, http.StatusForbidden, "user is not linked to a patient")
+			return 0, false
+		}
+		return principal.PatientId, true
+	}
+
+	id, err := strconv.Atoi(ctx.Param("id"))
+	if err != nil {
+		web.NewErrorResponse(ctx, http.StatusBadRequest, "invalid id")
+		return 0, false
+	}
+	return id, true
+}
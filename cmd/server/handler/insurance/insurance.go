@@ -0,0 +1,454 @@
+package insurance
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	accessController "github.com/ncondezo/final/cmd/server/handler/access"
+	"github.com/ncondezo/final/internal/dentists"
+	"github.com/ncondezo/final/internal/domain"
+	"github.com/ncondezo/final/internal/insurance"
+	"github.com/ncondezo/final/internal/patients"
+	"github.com/ncondezo/final/pkg/web"
+)
+
+type Controller struct {
+	service insurance.Service
+}
+
+func NewInsuranceController(service insurance.Service) *Controller {
+	return &Controller{service: service}
+}
+
+// @BasePath /api/v1
+
+// HandlerCreateProcedure godoc
+// @Summary Create a new procedure with its price
+// @Tags insurance
+// @Accept json
+// @Produce json
+// @Param Procedure body domain.Procedure true "Procedure information"
+// @Success 201 {object} web.SuccessResponse
+// @Failure 400 {object} web.ErrorResponse
+// @Failure 409 {object} web.ErrorResponse
+// @Failure 500 {object} web.ErrorResponse
+// @Router /procedures [post]
+func (c *Controller) HandlerCreateProcedure() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+
+		var request domain.Procedure
+
+		if err := ctx.Bind(&request); err != nil {
+			web.NewErrorResponse(ctx, http.StatusBadRequest, "bad request")
+			return
+		}
+		if err := web.RequestJsonValidation(request); err != "" {
+			web.NewErrorResponse(ctx, http.StatusBadRequest, err)
+			return
+		}
+
+		procedure, err := c.service.CreateProcedure(ctx, request)
+		if err != nil {
+			writeError(ctx, err)
+			return
+		}
+
+		web.NewSuccessResponse(ctx, http.StatusCreated, procedure)
+	}
+}
+
+// HandlerGetProcedures godoc
+// @Summary Get every procedure
+// @Tags insurance
+// @Produce json
+// @Success 200 {object} web.SuccessResponse
+// @Failure 500 {object} web.ErrorResponse
+// @Router /procedures [get]
+func (c *Controller) HandlerGetProcedures() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+
+		procedures, err := c.service.GetProcedures(ctx)
+		if err != nil {
+			writeError(ctx, err)
+			return
+		}
+
+		web.NewSuccessResponse(ctx, http.StatusOK, procedures)
+	}
+}
+
+// HandlerCreateInsurer godoc
+// @Summary Create a new insurer
+// @Tags insurance
+// @Accept json
+// @Produce json
+// @Param Insurer body domain.InsurerDTO true "Insurer information"
+// @Success 201 {object} web.SuccessResponse
+// @Failure 400 {object} web.ErrorResponse
+// @Failure 409 {object} web.ErrorResponse
+// @Failure 500 {object} web.ErrorResponse
+// @Router /insurers [post]
+func (c *Controller) HandlerCreateInsurer() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+
+		var request domain.InsurerDTO
+
+		if err := ctx.Bind(&request); err != nil {
+			web.NewErrorResponse(ctx, http.StatusBadRequest, "bad request")
+			return
+		}
+		if err := web.RequestJsonValidation(request); err != "" {
+			web.NewErrorResponse(ctx, http.StatusBadRequest, err)
+			return
+		}
+
+		insurer, err := c.service.CreateInsurer(ctx, request)
+		if err != nil {
+			writeError(ctx, err)
+			return
+		}
+
+		web.NewSuccessResponse(ctx, http.StatusCreated, insurer)
+	}
+}
+
+// HandlerGetInsurers godoc
+// @Summary Get every insurer
+// @Tags insurance
+// @Produce json
+// @Success 200 {object} web.SuccessResponse
+// @Failure 500 {object} web.ErrorResponse
+// @Router /insurers [get]
+func (c *Controller) HandlerGetInsurers() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+
+		insurers, err := c.service.GetInsurers(ctx)
+		if err != nil {
+			writeError(ctx, err)
+			return
+		}
+
+		web.NewSuccessResponse(ctx, http.StatusOK, insurers)
+	}
+}
+
+// HandlerCreatePlan godoc
+// @Summary Create a new plan for an insurer
+// @Tags insurance
+// @Accept json
+// @Produce json
+// @Param ID path int true "Insurer ID"
+// @Param Plan body domain.InsurancePlanDTO true "Plan information"
+// @Success 201 {object} web.SuccessResponse
+// @Failure 400 {object} web.ErrorResponse
+// @Failure 404 {object} web.ErrorResponse
+// @Failure 500 {object} web.ErrorResponse
+// @Router /insurers/:id/plans [post]
+func (c *Controller) HandlerCreatePlan() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+
+		var request domain.InsurancePlanDTO
+
+		if err := ctx.Bind(&request); err != nil {
+			web.NewErrorResponse(ctx, http.StatusBadRequest, "bad request")
+			return
+		}
+		if err := web.RequestJsonValidation(request); err != "" {
+			web.NewErrorResponse(ctx, http.StatusBadRequest, err)
+			return
+		}
+
+		id, err := strconv.Atoi(ctx.Param("id"))
+		if err != nil {
+			web.NewErrorResponse(ctx, http.StatusBadRequest, "invalid id")
+			return
+		}
+
+		plan, err := c.service.CreatePlan(ctx, request, id)
+		if err != nil {
+			writeError(ctx, err)
+			return
+		}
+
+		web.NewSuccessResponse(ctx, http.StatusCreated, plan)
+	}
+}
+
+// HandlerGetPlans godoc
+// @Summary Get the plans of an insurer
+// @Tags insurance
+// @Produce json
+// @Param ID path int true "Insurer ID"
+// @Success 200 {object} web.SuccessResponse
+// @Failure 400 {object} web.ErrorResponse
+// @Failure 500 {object} web.ErrorResponse
+// @Router /insurers/:id/plans [get]
+func (c *Controller) HandlerGetPlans() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+
+		id, err := strconv.Atoi(ctx.Param("id"))
+		if err != nil {
+			web.NewErrorResponse(ctx, http.StatusBadRequest, "invalid id")
+			return
+		}
+
+		plans, err := c.service.GetPlansByInsurer(ctx, id)
+		if err != nil {
+			writeError(ctx, err)
+			return
+		}
+
+		web.NewSuccessResponse(ctx, http.StatusOK, plans)
+	}
+}
+
+// HandlerCreateRule godoc
+// @Summary Create a coverage rule for a plan
+// @Tags insurance
+// @Accept json
+// @Produce json
+// @Param ID path int true "Plan ID"
+// @Param Rule body domain.CoverageRuleDTO true "Coverage rule"
+// @Success 201 {object} web.SuccessResponse
+// @Failure 400 {object} web.ErrorResponse
+// @Failure 404 {object} web.ErrorResponse
+// @Failure 409 {object} web.ErrorResponse
+// @Failure 500 {object} web.ErrorResponse
+// @Router /plans/:id/rules [post]
+func (c *Controller) HandlerCreateRule() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+
+		var request domain.CoverageRuleDTO
+
+		if err := ctx.Bind(&request); err != nil {
+			web.NewErrorResponse(ctx, http.StatusBadRequest, "bad request")
+			return
+		}
+		if err := web.RequestJsonValidation(request); err != "" {
+			web.NewErrorResponse(ctx, http.StatusBadRequest, err)
+			return
+		}
+
+		id, err := strconv.Atoi(ctx.Param("id"))
+		if err != nil {
+			web.NewErrorResponse(ctx, http.StatusBadRequest, "invalid id")
+			return
+		}
+
+		rule, err := c.service.CreateRule(ctx, request, id)
+		if err != nil {
+			writeError(ctx, err)
+			return
+		}
+
+		web.NewSuccessResponse(ctx, http.StatusCreated, rule)
+	}
+}
+
+// HandlerGetRules godoc
+// @Summary Get the coverage rules of a plan
+// @Tags insurance
+// @Produce json
+// @Param ID path int true "Plan ID"
+// @Success 200 {object} web.SuccessResponse
+// @Failure 400 {object} web.ErrorResponse
+// @Failure 404 {object} web.ErrorResponse
+// @Failure 500 {object} web.ErrorResponse
+// @Router /plans/:id/rules [get]
+func (c *Controller) HandlerGetRules() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+
+		id, err := strconv.Atoi(ctx.Param("id"))
+		if err != nil {
+			web.NewErrorResponse(ctx, http.StatusBadRequest, "invalid id")
+			return
+		}
+
+		rules, err := c.service.GetRulesByPlan(ctx, id)
+		if err != nil {
+			writeError(ctx, err)
+			return
+		}
+
+		web.NewSuccessResponse(ctx, http.StatusOK, rules)
+	}
+}
+
+// HandlerCreateCoverage godoc
+// @Summary Affiliate a patient to an insurance plan
+// @Tags insurance
+// @Accept json
+// @Produce json
+// @Param ID path int true "Patient ID"
+// @Param Coverage body domain.PatientCoverageDTO true "Coverage information"
+// @Success 201 {object} web.SuccessResponse
+// @Failure 400 {object} web.ErrorResponse
+// @Failure 404 {object} web.ErrorResponse
+// @Failure 500 {object} web.ErrorResponse
+// @Router /patients/:id/coverages [post]
+func (c *Controller) HandlerCreateCoverage() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+
+		var request domain.PatientCoverageDTO
+
+		if err := ctx.Bind(&request); err != nil {
+			web.NewErrorResponse(ctx, http.StatusBadRequest, "bad request")
+			return
+		}
+		if err := web.RequestJsonValidation(request); err != "" {
+			web.NewErrorResponse(ctx, http.StatusBadRequest, err)
+			return
+		}
+
+		id, err := strconv.Atoi(ctx.Param("id"))
+		if err != nil {
+			web.NewErrorResponse(ctx, http.StatusBadRequest, "invalid id")
+			return
+		}
+
+		coverage, err := c.service.CreateCoverage(ctx, request, id)
+		if err != nil {
+			writeError(ctx, err)
+			return
+		}
+
+		web.NewSuccessResponse(ctx, http.StatusCreated, coverage)
+	}
+}
+
+// HandlerGetCoverages godoc
+// @Summary Get the insurance coverages of a patient
+// @Tags insurance
+// @Produce json
+// @Param ID path int true "Patient ID"
+// @Param X-Access-Purpose header string false "treatment, scheduling, billing, administration or emergency"
+// @Success 200 {object} web.SuccessResponse
+// @Failure 400 {object} web.ErrorResponse
+// @Failure 403 {object} web.ErrorResponse
+// @Failure 404 {object} web.ErrorResponse
+// @Failure 500 {object} web.ErrorResponse
+// @Router /patients/:id/coverages [get]
+func (c *Controller) HandlerGetCoverages() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+
+		id, err := strconv.Atoi(ctx.Param("id"))
+		if err != nil {
+			web.NewErrorResponse(ctx, http.StatusBadRequest, "invalid id")
+			return
+		}
+
+		coverages, err := c.service.GetCoveragesByPatient(ctx, id, accessController.Purpose(ctx))
+		if err != nil {
+			writeError(ctx, err)
+			return
+		}
+
+		web.NewSuccessResponse(ctx, http.StatusOK, coverages)
+	}
+}
+
+// HandlerQuote godoc
+// @Summary Compute how a procedure would be paid by the patient's insurance
+// @Tags insurance
+// @Produce json
+// @Param ID path int true "Patient ID"
+// @Param procedure query string true "Procedure code"
+// @Param date query string false "Date as YYYY-MM-DD, defaults to today"
+// @Param X-Access-Purpose header string false "treatment, scheduling, billing, administration or emergency"
+// @Success 200 {object} web.SuccessResponse
+// @Failure 400 {object} web.ErrorResponse
+// @Failure 403 {object} web.ErrorResponse
+// @Failure 404 {object} web.ErrorResponse
+// @Failure 500 {object} web.ErrorResponse
+// @Router /patients/:id/coverages/quote [get]
+func (c *Controller) HandlerQuote() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+
+		id, err := strconv.Atoi(ctx.Param("id"))
+		if err != nil {
+			web.NewErrorResponse(ctx, http.StatusBadRequest, "invalid id")
+			return
+		}
+
+		date := time.Now()
+		if value := ctx.Query("date"); value != "" {
+			date, err = time.Parse("2006-01-02", value)
+			if err != nil {
+				web.NewErrorResponse(ctx, http.StatusBadRequest, "invalid date")
+				return
+			}
+		}
+
+		quote, err := c.service.Quote(ctx, id, ctx.Query("procedure"), date, accessController.Purpose(ctx))
+		if err != nil {
+			writeError(ctx, err)
+			return
+		}
+
+		web.NewSuccessResponse(ctx, http.StatusOK, quote)
+	}
+}
+
+// HandlerGetTurnCoverage godoc
+// @Summary Get the insurance coverage applied to a turn
+// @Tags insurance
+// @Produce json
+// @Param ID path int true "Turn ID"
+// @Param X-Access-Purpose header string false "treatment, scheduling, billing, administration or emergency"
+// @Success 200 {object} web.SuccessResponse
+// @Failure 400 {object} web.ErrorResponse
+// @Failure 403 {object} web.ErrorResponse
+// @Failure 404 {object} web.ErrorResponse
+// @Failure 500 {object} web.ErrorResponse
+// @Router /turns/:id/coverage [get]
+func (c *Controller) HandlerGetTurnCoverage() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+
+		id, err := strconv.Atoi(ctx.Param("id"))
+		if err != nil {
+			web.NewErrorResponse(ctx, http.StatusBadRequest, "invalid id")
+			return
+		}
+
+		quote, err := c.service.GetTurnCoverage(ctx, id, accessController.Purpose(ctx))
+		if err != nil {
+			writeError(ctx, err)
+			return
+		}
+
+		web.NewSuccessResponse(ctx, http.StatusOK, quote)
+	}
+}
+
+func writeError(ctx *gin.Context, err error) {
+	if accessController.Error(ctx, err) {
+		return
+	}
+	switch {
+	case errors.Is(err, insurance.ErrInvalidPercentage):
+		web.NewErrorResponse(ctx, http.StatusBadRequest, "percentage must be between 0 and 100")
+	case errors.Is(err, insurance.ErrInvalidAmount):
+		web.NewErrorResponse(ctx, http.StatusBadRequest, "amounts cannot be negative")
+	case errors.Is(err, insurance.ErrInvalidValidity):
+		web.NewErrorResponse(ctx, http.StatusBadRequest, "valid_to must be after valid_from")
+	case errors.Is(err, insurance.ErrAlreadyExists):
+		web.NewErrorResponse(ctx, http.StatusConflict, "already exists")
+	case errors.Is(err, insurance.ErrProcedureNotFound):
+		web.NewErrorResponse(ctx, http.StatusNotFound, "procedure not found")
+	case errors.Is(err, insurance.ErrInsurerNotFound):
+		web.NewErrorResponse(ctx, http.StatusNotFound, "insurer not found")
+	case errors.Is(err, insurance.ErrPlanNotFound):
+		web.NewErrorResponse(ctx, http.StatusNotFound, "plan not found")
+	case errors.Is(err, insurance.ErrCoverageNotFound):
+		web.NewErrorResponse(ctx, http.StatusNotFound, "coverage not found")
+	case errors.Is(err, patients.ErrNotFound):
+		web.NewErrorResponse(ctx, http.StatusNotFound, "patient not found")
+	case errors.Is(err, dentists.ErrSpecialtyNotFound):
+		web.NewErrorResponse(ctx, http.StatusNotFound, "specialty not found")
+	default:
+		web.NewErrorResponse(ctx, http.StatusInternalServerError, "internal server error")
+	}
+}
@@ -6,8 +6,10 @@ import (
 	"strconv"
 
 	"github.com/gin-gonic/gin"
+	accessController "github.com/ncondezo/final/cmd/server/handler/access"
 	"github.com/ncondezo/final/internal/domain"
 	"github.com/ncondezo/final/internal/patients"
+	"github.com/ncondezo/final/pkg/patch"
 	"github.com/ncondezo/final/pkg/web"
 )
 
@@ -64,11 +66,14 @@ func (c *Controller) HandlerCreate() gin.HandlerFunc {
 
 // HandlerGetByID godoc
 // @Summary Get a patient by id
+// @Description The read is logged with its purpose. Dentists only read the patients they have turns with, unless they break the glass.
 // @Tags patients
 // @Produce json
 // @Param ID path int true "Patient ID to search"
+// @Param X-Access-Purpose header string false "treatment, scheduling, billing, administration or emergency"
 // @Success 200 {object} web.SuccessResponse
 // @Failure 400 {object} web.ErrorResponse
+// @Failure 403 {object} web.ErrorResponse
 // @Failure 404 {object} web.ErrorResponse
 // @Failure 500 {object} web.ErrorResponse
 // @Router /patients/:id [get]
@@ -81,11 +86,14 @@ func (c *Controller) HandlerGetByID() gin.HandlerFunc {
 			return
 		}
 
-		patient, err := c.service.GetByID(ctx, id)
+		patient, err := c.service.View(ctx, id, accessController.Purpose(ctx))
 		if errors.Is(err, patients.ErrNotFound) {
 			web.NewErrorResponse(ctx, http.StatusNotFound, "patient not found")
 			return
 		}
+		if accessController.Error(ctx, err) {
+			return
+		}
 		if err != nil {
 			web.NewErrorResponse(ctx, http.StatusInternalServerError, "internal server error")
 			return
@@ -143,29 +151,26 @@ func (c *Controller) HandlerUpdate() gin.HandlerFunc {
 }
 
 // HandlerPatch godoc
-// @Summary Update a patient dni by id
+// @Summary Partially update a patient by id
+// @Description Accepts a JSON Merge Patch (RFC 7396) or, with application/json-patch+json, a JSON Patch (RFC 6902).
 // @Tags patients
 // @Accept json
 // @Produce json
 // @Param ID path int true "Patient ID to update"
-// @Param Patient body domain.PatientDniDTO true "Patient DNI"
+// @Param Patch body object true "Merge patch or JSON patch document"
 // @Success 200 {object} web.SuccessResponse
 // @Failure 400 {object} web.ErrorResponse
 // @Failure 404 {object} web.ErrorResponse
+// @Failure 409 {object} web.ErrorResponse
+// @Failure 415 {object} web.ErrorResponse
 // @Failure 500 {object} web.ErrorResponse
 // @Router /patients/:id [patch]
 func (c *Controller) HandlerPatch() gin.HandlerFunc {
 	return func(ctx *gin.Context) {
 
-		var request domain.PatientDniDTO
-
-		errBind := ctx.Bind(&request)
-		if errBind != nil {
-			web.NewErrorResponse(ctx, http.StatusBadRequest, "bad request binding")
-			return
-		}
-		if err := web.RequestJsonValidation(request); err != "" {
-			web.NewErrorResponse(ctx, http.StatusBadRequest, err)
+		document, errBody := ctx.GetRawData()
+		if errBody != nil {
+			web.NewErrorResponse(ctx, http.StatusBadRequest, "bad request body")
 			return
 		}
 
@@ -175,12 +180,28 @@ func (c *Controller) HandlerPatch() gin.HandlerFunc {
 			return
 		}
 
-		patient, err := c.service.Patch(ctx, request, id)
-		if errors.Is(err, patients.ErrNotFound) {
+		patient, err := c.service.Patch(ctx, document, ctx.GetHeader("Content-Type"), id)
+		var resultError *patch.ResultError
+		switch {
+		case errors.As(err, &resultError):
+			web.NewErrorResponse(ctx, http.StatusBadRequest, resultError.Reason)
+			return
+		case errors.Is(err, patch.ErrInvalidPatch):
+			web.NewErrorResponse(ctx, http.StatusBadRequest, "invalid patch document")
+			return
+		case errors.Is(err, patch.ErrUnsupportedMediaType):
+			web.NewErrorResponse(ctx, http.StatusUnsupportedMediaType, "unsupported patch media type")
+			return
+		case errors.Is(err, patch.ErrTestFailed):
+			web.NewErrorResponse(ctx, http.StatusConflict, "patch test operation failed")
+			return
+		case errors.Is(err, patients.ErrNotFound):
 			web.NewErrorResponse(ctx, http.StatusNotFound, "patient not found")
 			return
-		}
-		if err != nil {
+		case errors.Is(err, patients.ErrAlreadyExists):
+			web.NewErrorResponse(ctx, http.StatusConflict, "patient already exists")
+			return
+		case err != nil:
 			web.NewErrorResponse(ctx, http.StatusInternalServerError, "internal server error")
 			return
 		}
@@ -198,6 +219,7 @@ func (c *Controller) HandlerPatch() gin.HandlerFunc {
 // @Success 200 {object} web.SuccessResponse
 // @Failure 400 {object} web.ErrorResponse
 // @Failure 404 {object} web.ErrorResponse
+// @Failure 409 {object} web.ErrorResponse
 // @Failure 500 {object} web.ErrorResponse
 // @Router /patients/:id [delete]
 func (c *Controller) HandlerDelete() gin.HandlerFunc {
@@ -214,6 +236,10 @@ func (c *Controller) HandlerDelete() gin.HandlerFunc {
 			web.NewErrorResponse(ctx, http.StatusNotFound, "patient not found")
 			return
 		}
+		if errors.Is(err, patients.ErrHasRecords) {
+			web.NewErrorResponse(ctx, http.StatusConflict, "patient has turns, attachments or coverages")
+			return
+		}
 		if err != nil {
 			web.NewErrorResponse(ctx, http.StatusInternalServerError, "internal server error")
 			return
@@ -224,3 +250,94 @@ func (c *Controller) HandlerDelete() gin.HandlerFunc {
 		})
 	}
 }
+
+// HandlerGetDuplicates godoc
+// @Summary Get the likely duplicate patients found by the last scan
+// @Tags patients
+// @Produce json
+// @Success 200 {object} web.SuccessResponse
+// @Failure 500 {object} web.ErrorResponse
+// @Router /patients/duplicates [get]
+func (c *Controller) HandlerGetDuplicates() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+
+		duplicates, err := c.service.GetDuplicates(ctx)
+		if err != nil {
+			web.NewErrorResponse(ctx, http.StatusInternalServerError, "internal server error")
+			return
+		}
+
+		web.NewSuccessResponse(ctx, http.StatusOK, duplicates)
+	}
+}
+
+// HandlerDetectDuplicates godoc
+// @Summary Scan all patients for likely duplicates
+// @Tags patients
+// @Produce json
+// @Success 200 {object} web.SuccessResponse
+// @Failure 500 {object} web.ErrorResponse
+// @Router /patients/duplicates/scan [post]
+func (c *Controller) HandlerDetectDuplicates() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+
+		duplicates, err := c.service.DetectDuplicates(ctx)
+		if err != nil {
+			web.NewErrorResponse(ctx, http.StatusInternalServerError, "internal server error")
+			return
+		}
+
+		web.NewSuccessResponse(ctx, http.StatusOK, duplicates)
+	}
+}
+
+// HandlerMerge godoc
+// @Summary Merge a duplicate patient into the patient with the given id
+// @Tags patients
+// @Accept json
+// @Produce json
+// @Param ID path int true "Surviving patient ID"
+// @Param Merge body domain.PatientMergeDTO true "Duplicate patient to merge"
+// @Success 200 {object} web.SuccessResponse
+// @Failure 400 {object} web.ErrorResponse
+// @Failure 404 {object} web.ErrorResponse
+// @Failure 500 {object} web.ErrorResponse
+// @Router /patients/:id/merge [post]
+func (c *Controller) HandlerMerge() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+
+		var request domain.PatientMergeDTO
+
+		errBind := ctx.Bind(&request)
+		if errBind != nil {
+			web.NewErrorResponse(ctx, http.StatusBadRequest, "bad request binding")
+			return
+		}
+		if err := web.RequestJsonValidation(request); err != "" {
+			web.NewErrorResponse(ctx, http.StatusBadRequest, err)
+			return
+		}
+
+		id, err := strconv.Atoi(ctx.Param("id"))
+		if err != nil {
+			web.NewErrorResponse(ctx, http.StatusBadRequest, "invalid id")
+			return
+		}
+
+		patient, err := c.service.Merge(ctx, request, id)
+		if errors.Is(err, patients.ErrSelfMerge) {
+			web.NewErrorResponse(ctx, http.StatusBadRequest, "patient cannot be merged with itself")
+			return
+		}
+		if errors.Is(err, patients.ErrNotFound) {
+			web.NewErrorResponse(ctx, http.StatusNotFound, "patient not found")
+			return
+		}
+		if err != nil {
+			web.NewErrorResponse(ctx, http.StatusInternalServerError, "internal server error")
+			return
+		}
+
+		web.NewSuccessResponse(ctx, http.StatusOK, patient)
+	}
+}
@@ -0,0 +1,96 @@
+package privacy
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/ncondezo/final/internal/patients"
+	"github.com/ncondezo/final/internal/privacy"
+	"github.com/ncondezo/final/pkg/web"
+)
+
+type Controller struct {
+	service privacy.Service
+}
+
+func NewPrivacyController(service privacy.Service) *Controller {
+	return &Controller{service: service}
+}
+
+// @BasePath /api/v1
+
+// HandlerExport godoc
+// @Summary Export everything held about a patient as a zip bundle
+// @Tags privacy
+// @Produce application/zip
+// @Param ID path int true "Patient ID"
+// @Success 200 {file} file
+// @Failure 400 {object} web.ErrorResponse
+// @Failure 404 {object} web.ErrorResponse
+// @Failure 500 {object} web.ErrorResponse
+// @Router /patients/:id/export [get]
+func (c *Controller) HandlerExport() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+
+		id, err := strconv.Atoi(ctx.Param("id"))
+		if err != nil {
+			web.NewErrorResponse(ctx, http.StatusBadRequest, "invalid id")
+			return
+		}
+
+		export, err := c.service.Export(ctx, id)
+		if errors.Is(err, patients.ErrNotFound) {
+			web.NewErrorResponse(ctx, http.StatusNotFound, "patient not found")
+			return
+		}
+		if err != nil {
+			web.NewErrorResponse(ctx, http.StatusInternalServerError, "internal server error")
+			return
+		}
+
+		ctx.Header("Content-Type", "application/zip")
+		ctx.Header("Content-Disposition", fmt.Sprintf("attachment; filename=patient-%d-export.zip", id))
+		ctx.Status(http.StatusOK)
+		if err := c.service.WriteArchive(ctx, export, ctx.Writer); err != nil {
+			log.Println("[PrivacyController][HandlerExport] error writing archive", err)
+			ctx.Abort()
+		}
+	}
+}
+
+// HandlerErase godoc
+// @Summary Anonymize the personal data of a patient
+// @Tags privacy
+// @Produce json
+// @Param ID path int true "Patient ID"
+// @Success 200 {object} web.SuccessResponse
+// @Failure 400 {object} web.ErrorResponse
+// @Failure 404 {object} web.ErrorResponse
+// @Failure 500 {object} web.ErrorResponse
+// @Router /patients/:id/erasure [post]
+func (c *Controller) HandlerErase() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+
+		id, err := strconv.Atoi(ctx.Param("id"))
+		if err != nil {
+			web.NewErrorResponse(ctx, http.StatusBadRequest, "invalid id")
+			return
+		}
+
+		patient, err := c.service.Erase(ctx, id)
+		if errors.Is(err, patients.ErrNotFound) {
+			web.NewErrorResponse(ctx, http.StatusNotFound, "patient not found")
+			return
+		}
+		if err != nil {
+			web.NewErrorResponse(ctx, http.StatusInternalServerError, "internal server error")
+			return
+		}
+
+		web.NewSuccessResponse(ctx, http.StatusOK, patient)
+	}
+}
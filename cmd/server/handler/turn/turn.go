@@ -4,12 +4,16 @@ import (
 	"errors"
 	"net/http"
 	"strconv"
+	"time"
 
 	"github.com/gin-gonic/gin"
+	accessController "github.com/ncondezo/final/cmd/server/handler/access"
 	"github.com/ncondezo/final/internal/dentists"
 	"github.com/ncondezo/final/internal/domain"
+	"github.com/ncondezo/final/internal/insurance"
 	"github.com/ncondezo/final/internal/patients"
 	"github.com/ncondezo/final/internal/turns"
+	"github.com/ncondezo/final/pkg/patch"
 	"github.com/ncondezo/final/pkg/web"
 )
 
@@ -31,6 +35,7 @@ func NewTurnController(service turns.Service) *Controller {
 // @Param Turn body domain.TurnDTO true "Turn information"
 // @Success 201 {object} web.SuccessResponse
 // @Failure 400 {object} web.ErrorResponse
+// @Failure 403 {object} web.ErrorResponse
 // @Failure 404 {object} web.ErrorResponse
 // @Failure 500 {object} web.ErrorResponse
 // @Router /turns [post]
@@ -51,6 +56,10 @@ func (c *Controller) HandlerCreate() gin.HandlerFunc {
 		}
 
 		turn, err := c.service.Create(ctx, request)
+		if errors.Is(err, turns.ErrInvalidDate) {
+			web.NewErrorResponse(ctx, http.StatusBadRequest, "date is missing or in the past")
+			return
+		}
 		if errors.Is(err, patients.ErrNotFound) {
 			web.NewErrorResponse(ctx, http.StatusNotFound, "patient not found")
 			return
@@ -59,6 +68,22 @@ func (c *Controller) HandlerCreate() gin.HandlerFunc {
 			web.NewErrorResponse(ctx, http.StatusNotFound, "dentist not found")
 			return
 		}
+		if errors.Is(err, insurance.ErrProcedureNotFound) {
+			web.NewErrorResponse(ctx, http.StatusNotFound, "procedure not found")
+			return
+		}
+		if errors.Is(err, turns.ErrSpecialtyMismatch) {
+			web.NewErrorResponse(ctx, http.StatusConflict, "dentist lacks the specialty required by the procedure")
+			return
+		}
+		if errors.Is(err, turns.ErrDentistInactive) {
+			web.NewErrorResponse(ctx, http.StatusConflict, "dentist is inactive")
+			return
+		}
+		if errors.Is(err, turns.ErrNotOwnTurn) {
+			web.NewErrorResponse(ctx, http.StatusForbidden, "turn belongs to another dentist")
+			return
+		}
 		if err != nil {
 			web.NewErrorResponse(ctx, http.StatusInternalServerError, "internal server error")
 			return
@@ -70,11 +95,14 @@ func (c *Controller) HandlerCreate() gin.HandlerFunc {
 
 // HandlerGetByID godoc
 // @Summary Get a turn by id
+// @Description The read of the patient is logged with its purpose. Dentists only read the patients they have turns with, unless they break the glass.
 // @Tags turns
 // @Produce json
 // @Param ID path int true "Turn ID to search"
+// @Param X-Access-Purpose header string false "treatment, scheduling, billing, administration or emergency"
 // @Success 200 {object} web.SuccessResponse
 // @Failure 400 {object} web.ErrorResponse
+// @Failure 403 {object} web.ErrorResponse
 // @Failure 404 {object} web.ErrorResponse
 // @Failure 500 {object} web.ErrorResponse
 // @Router /turns/:id [get]
@@ -87,11 +115,14 @@ func (c *Controller) HandlerGetByID() gin.HandlerFunc {
 			return
 		}
 
-		turn, err := c.service.GetByID(ctx, id)
+		turn, err := c.service.View(ctx, id, accessController.Purpose(ctx))
 		if errors.Is(err, turns.ErrNotFound) {
 			web.NewErrorResponse(ctx, http.StatusNotFound, "turn not found")
 			return
 		}
+		if accessController.Error(ctx, err) {
+			return
+		}
 		if err != nil {
 			web.NewErrorResponse(ctx, http.StatusInternalServerError, "internal server error")
 			return
@@ -103,11 +134,14 @@ func (c *Controller) HandlerGetByID() gin.HandlerFunc {
 
 // HandlerGetByPatientID godoc
 // @Summary Get a turn by patient id
+// @Description The read is logged with its purpose. Dentists only read the patients they have turns with, unless they break the glass.
 // @Tags turns
 // @Produce json
 // @Param ID path int true "Patient ID to search"
+// @Param X-Access-Purpose header string false "treatment, scheduling, billing, administration or emergency"
 // @Success 200 {object} web.SuccessResponse
 // @Failure 400 {object} web.ErrorResponse
+// @Failure 403 {object} web.ErrorResponse
 // @Failure 404 {object} web.ErrorResponse
 // @Failure 500 {object} web.ErrorResponse
 // @Router /turns/patient/:id [get]
@@ -120,11 +154,14 @@ func (c *Controller) HandlerGetByPatientID() gin.HandlerFunc {
 			return
 		}
 
-		turn, err := c.service.GetByPatientID(ctx, patientId)
+		turn, err := c.service.ViewByPatientID(ctx, patientId, accessController.Purpose(ctx))
 		if errors.Is(err, patients.ErrNotFound) {
 			web.NewErrorResponse(ctx, http.StatusNotFound, "patient not found")
 			return
 		}
+		if accessController.Error(ctx, err) {
+			return
+		}
 		if err != nil {
 			web.NewErrorResponse(ctx, http.StatusInternalServerError, "internal server error")
 			return
@@ -143,6 +180,7 @@ func (c *Controller) HandlerGetByPatientID() gin.HandlerFunc {
 // @Param Turn body domain.TurnDTO true "Turn information"
 // @Success 200 {object} web.SuccessResponse
 // @Failure 400 {object} web.ErrorResponse
+// @Failure 403 {object} web.ErrorResponse
 // @Failure 404 {object} web.ErrorResponse
 // @Failure 500 {object} web.ErrorResponse
 // @Router /turns/:id [put]
@@ -168,15 +206,104 @@ func (c *Controller) HandlerUpdate() gin.HandlerFunc {
 		}
 
 		turn, err := c.service.Update(ctx, request, id)
+		if errors.Is(err, turns.ErrInvalidDate) {
+			web.NewErrorResponse(ctx, http.StatusBadRequest, "date is missing or in the past")
+			return
+		}
 		if errors.Is(err, turns.ErrNotFound) {
 			web.NewErrorResponse(ctx, http.StatusNotFound, "turn not found")
 			return
 		}
+		if errors.Is(err, turns.ErrNotOwnTurn) {
+			web.NewErrorResponse(ctx, http.StatusForbidden, "turn belongs to another dentist")
+			return
+		}
 		if errors.Is(err, dentists.ErrNotFound) {
 			web.NewErrorResponse(ctx, http.StatusNotFound, "dentist not found")
 			return
 		}
+		if errors.Is(err, insurance.ErrProcedureNotFound) {
+			web.NewErrorResponse(ctx, http.StatusNotFound, "procedure not found")
+			return
+		}
+		if errors.Is(err, turns.ErrSpecialtyMismatch) {
+			web.NewErrorResponse(ctx, http.StatusConflict, "dentist lacks the specialty required by the procedure")
+			return
+		}
+		if err != nil {
+			web.NewErrorResponse(ctx, http.StatusInternalServerError, "internal server error")
+			return
+		}
+
+		web.NewSuccessResponse(ctx, http.StatusOK, turn)
+	}
+}
+
+// HandlerPatch godoc
+// @Summary Partially update a turn by id
+// @Description Accepts a JSON Merge Patch (RFC 7396) or, with application/json-patch+json, a JSON Patch (RFC 6902).
+// @Tags turns
+// @Accept json
+// @Produce json
+// @Param ID path int true "Turn ID to update"
+// @Param Patch body object true "Merge patch or JSON patch document"
+// @Success 200 {object} web.SuccessResponse
+// @Failure 400 {object} web.ErrorResponse
+// @Failure 403 {object} web.ErrorResponse
+// @Failure 404 {object} web.ErrorResponse
+// @Failure 409 {object} web.ErrorResponse
+// @Failure 415 {object} web.ErrorResponse
+// @Failure 500 {object} web.ErrorResponse
+// @Router /turns/:id [patch]
+func (c *Controller) HandlerPatch() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+
+		document, errBody := ctx.GetRawData()
+		if errBody != nil {
+			web.NewErrorResponse(ctx, http.StatusBadRequest, "bad request body")
+			return
+		}
+
+		id, err := strconv.Atoi(ctx.Param("id"))
 		if err != nil {
+			web.NewErrorResponse(ctx, http.StatusBadRequest, "invalid id")
+			return
+		}
+
+		turn, err := c.service.Patch(ctx, document, ctx.GetHeader("Content-Type"), id)
+		var resultError *patch.ResultError
+		switch {
+		case errors.As(err, &resultError):
+			web.NewErrorResponse(ctx, http.StatusBadRequest, resultError.Reason)
+			return
+		case errors.Is(err, patch.ErrInvalidPatch):
+			web.NewErrorResponse(ctx, http.StatusBadRequest, "invalid patch document")
+			return
+		case errors.Is(err, turns.ErrInvalidDate):
+			web.NewErrorResponse(ctx, http.StatusBadRequest, "date is missing or in the past")
+			return
+		case errors.Is(err, patch.ErrUnsupportedMediaType):
+			web.NewErrorResponse(ctx, http.StatusUnsupportedMediaType, "unsupported patch media type")
+			return
+		case errors.Is(err, patch.ErrTestFailed):
+			web.NewErrorResponse(ctx, http.StatusConflict, "patch test operation failed")
+			return
+		case errors.Is(err, turns.ErrNotFound):
+			web.NewErrorResponse(ctx, http.StatusNotFound, "turn not found")
+			return
+		case errors.Is(err, turns.ErrNotOwnTurn):
+			web.NewErrorResponse(ctx, http.StatusForbidden, "turn belongs to another dentist")
+			return
+		case errors.Is(err, dentists.ErrNotFound):
+			web.NewErrorResponse(ctx, http.StatusNotFound, "dentist not found")
+			return
+		case errors.Is(err, insurance.ErrProcedureNotFound):
+			web.NewErrorResponse(ctx, http.StatusNotFound, "procedure not found")
+			return
+		case errors.Is(err, turns.ErrSpecialtyMismatch):
+			web.NewErrorResponse(ctx, http.StatusConflict, "dentist lacks the specialty required by the procedure")
+			return
+		case err != nil:
 			web.NewErrorResponse(ctx, http.StatusInternalServerError, "internal server error")
 			return
 		}
@@ -193,6 +320,7 @@ func (c *Controller) HandlerUpdate() gin.HandlerFunc {
 // @Param ID path int true "Turn ID to delete"
 // @Success 200 {object} web.SuccessResponse
 // @Failure 400 {object} web.ErrorResponse
+// @Failure 403 {object} web.ErrorResponse
 // @Failure 404 {object} web.ErrorResponse
 // @Failure 500 {object} web.ErrorResponse
 // @Router /turns/:id [delete]
@@ -210,6 +338,10 @@ func (c *Controller) HandlerDelete() gin.HandlerFunc {
 			web.NewErrorResponse(ctx, http.StatusNotFound, "turn not found")
 			return
 		}
+		if errors.Is(err, turns.ErrNotOwnTurn) {
+			web.NewErrorResponse(ctx, http.StatusForbidden, "turn belongs to another dentist")
+			return
+		}
 		if err != nil {
 			web.NewErrorResponse(ctx, http.StatusInternalServerError, "internal server error")
 			return
@@ -220,3 +352,89 @@ func (c *Controller) HandlerDelete() gin.HandlerFunc {
 		})
 	}
 }
+
+// HandlerGetAgenda godoc
+// @Summary Get the agenda of the logged in dentist
+// @Description Returns the turns between from and to (inclusive). Defaults to the next seven days.
+// @Tags turns
+// @Produce json
+// @Param from query string false "First day (YYYY-MM-DD)"
+// @Param to query string false "Last day (YYYY-MM-DD)"
+// @Success 200 {object} web.SuccessResponse
+// @Failure 400 {object} web.ErrorResponse
+// @Failure 403 {object} web.ErrorResponse
+// @Failure 404 {object} web.ErrorResponse
+// @Failure 500 {object} web.ErrorResponse
+// @Router /me/agenda [get]
+func (c *Controller) HandlerGetAgenda() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+
+		principal, ok := domain.PrincipalFrom(ctx)
+		if !ok || principal.DentistId == 0 {
+			web.NewErrorResponse(ctx, http.StatusForbidden, "user is not linked to a dentist")
+			return
+		}
+
+		from := time.Now().Truncate(24 * time.Hour)
+		var err error
+		if value := ctx.Query("from"); value != "" {
+			from, err = time.Parse("2006-01-02", value)
+			if err != nil {
+				web.NewErrorResponse(ctx, http.StatusBadRequest, "invalid from date")
+				return
+			}
+		}
+		to := from.AddDate(0, 0, 7)
+		if value := ctx.Query("to"); value != "" {
+			to, err = time.Parse("2006-01-02", value)
+			if err != nil {
+				web.NewErrorResponse(ctx, http.StatusBadRequest, "invalid to date")
+				return
+			}
+		}
+		if to.Before(from) {
+			web.NewErrorResponse(ctx, http.StatusBadRequest, "to date is before from date")
+			return
+		}
+
+		agenda, err := c.service.GetAgenda(ctx, principal.DentistId, from, to.Add(24*time.Hour-time.Nanosecond))
+		if errors.Is(err, dentists.ErrNotFound) {
+			web.NewErrorResponse(ctx, http.StatusNotFound, "dentist not found")
+			return
+		}
+		if err != nil {
+			web.NewErrorResponse(ctx, http.StatusInternalServerError, "internal server error")
+			return
+		}
+
+		web.NewSuccessResponse(ctx, http.StatusOK, agenda)
+	}
+}
+
+// HandlerGetMyPatients godoc
+// @Summary Get the patients of the logged in dentist
+// @Description Returns the patients that have at least one turn with the dentist.
+// @Tags turns
+// @Produce json
+// @Success 200 {object} web.SuccessResponse
+// @Failure 403 {object} web.ErrorResponse
+// @Failure 500 {object} web.ErrorResponse
+// @Router /me/patients [get]
+func (c *Controller) HandlerGetMyPatients() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+
+		principal, ok := domain.PrincipalFrom(ctx)
+		if !ok || principal.DentistId == 0 {
+			web.NewErrorResponse(ctx, http.StatusForbidden, "user is not linked to a dentist")
+			return
+		}
+
+		dentistPatients, err := c.service.GetPatientsByDentist(ctx, principal.DentistId)
+		if err != nil {
+			web.NewErrorResponse(ctx, http.StatusInternalServerError, "internal server error")
+			return
+		}
+
+		web.NewSuccessResponse(ctx, http.StatusOK, dentistPatients)
+	}
+}
@@ -1,10 +1,21 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+	_ "time/tzdata"
 
 	"github.com/ncondezo/final/cmd/server/router"
 	"github.com/ncondezo/final/docs"
+	"github.com/ncondezo/final/pkg/middleware"
+	"github.com/ncondezo/final/pkg/security"
 	"github.com/ncondezo/final/pkg/store"
 
 	"github.com/gin-gonic/gin"
@@ -13,6 +24,8 @@ import (
 
 const (
 	serverPort = ":8080"
+	// shutdownTimeout is how long the requests in flight have to finish.
+	shutdownTimeout = 15 * time.Second
 )
 
 // @title Desafío II - Backend Go
@@ -20,20 +33,49 @@ const (
 // @description API para la gestión de turnos de una clínica dental.
 func main() {
 
+	if err := security.LoadKeys(); err != nil {
+		log.Fatal("error loading token keys: ", err)
+	}
+	security.UseTenant(os.Getenv("TENANT_ID"))
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
 	store.NewMySQLConnection()
 	database := store.GetConnection()
 
 	engine := gin.New()
+	engine.ContextWithFallback = true
+	// ClientIP only honours X-Forwarded-For from these proxies, the failed
+	// logins per IP would be easy to dodge otherwise.
+	proxies := strings.FieldsFunc(os.Getenv("TRUSTED_PROXIES"),
+		func(r rune) bool { return r == ',' })
+	if err := engine.SetTrustedProxies(proxies); err != nil {
+		log.Fatal(err)
+	}
 	engine.Use(gin.Recovery())
+	engine.Use(middleware.RequestId())
 	engine.Use(gin.Logger())
 
-	routes := router.NewRouter(engine, database)
+	routes := router.NewRouter(ctx, engine, database)
 	routes.BuildRoutes()
 
 	docs.SwaggerInfo.BasePath = "localhost:8080/api/v1"
 
-	if engineError := engine.Run(serverPort); engineError != nil {
-		log.Fatal(engineError)
+	server := &http.Server{Addr: serverPort, Handler: engine}
+	go func() {
+		if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Fatal(err)
+		}
+	}()
+
+	<-ctx.Done()
+	stop()
+	log.Println("Shutting down server...")
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		log.Println("Error shutting down server:", err)
 	}
 
 }
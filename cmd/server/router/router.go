@@ -1,18 +1,46 @@
 package router
 
 import (
+	"context"
 	"database/sql"
+	"log"
 	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
 
+	accessController "github.com/ncondezo/final/cmd/server/handler/access"
+	apiKeyController "github.com/ncondezo/final/cmd/server/handler/apikey"
+	attachmentController "github.com/ncondezo/final/cmd/server/handler/attachment"
+	auditController "github.com/ncondezo/final/cmd/server/handler/audit"
 	authController "github.com/ncondezo/final/cmd/server/handler/auth"
+	contactController "github.com/ncondezo/final/cmd/server/handler/contact"
 	dentistController "github.com/ncondezo/final/cmd/server/handler/dentists"
+	familyController "github.com/ncondezo/final/cmd/server/handler/family"
+	insuranceController "github.com/ncondezo/final/cmd/server/handler/insurance"
 	patientController "github.com/ncondezo/final/cmd/server/handler/patient"
+	privacyController "github.com/ncondezo/final/cmd/server/handler/privacy"
 	turnController "github.com/ncondezo/final/cmd/server/handler/turn"
+	"github.com/ncondezo/final/internal/access"
+	"github.com/ncondezo/final/internal/apikeys"
+	attachment "github.com/ncondezo/final/internal/attachments"
+	"github.com/ncondezo/final/internal/audit"
+	contact "github.com/ncondezo/final/internal/contacts"
 	dentist "github.com/ncondezo/final/internal/dentists"
+	"github.com/ncondezo/final/internal/domain"
+	"github.com/ncondezo/final/internal/family"
+	"github.com/ncondezo/final/internal/insurance"
+	"github.com/ncondezo/final/internal/notifications"
 	patient "github.com/ncondezo/final/internal/patients"
+	"github.com/ncondezo/final/internal/privacy"
 	turn "github.com/ncondezo/final/internal/turns"
 	user "github.com/ncondezo/final/internal/user"
+	"github.com/ncondezo/final/pkg/blob"
+	"github.com/ncondezo/final/pkg/mail"
 	"github.com/ncondezo/final/pkg/middleware"
+	"github.com/ncondezo/final/pkg/oidc"
+	"github.com/ncondezo/final/pkg/security"
 
 	"github.com/gin-gonic/gin"
 	swaggerFiles "github.com/swaggo/files"
@@ -24,27 +52,204 @@ type Routes interface {
 }
 
 type router struct {
-	engine   *gin.Engine
-	apiGroup *gin.RouterGroup
-	db       *sql.DB
+	// ctx is done when the server shuts down, it stops the background jobs.
+	ctx       context.Context
+	engine    *gin.Engine
+	apiGroup  *gin.RouterGroup
+	db        *sql.DB
+	notifier  notifications.Notifier
+	insurance insurance.Service
+	store     blob.BlobStore
+	mailer    mail.Mailer
+	rates     middleware.RateLimitStore
+	audit     audit.Service
+	access    access.Service
 }
 
-func NewRouter(engine *gin.Engine, db *sql.DB) Routes {
-	return &router{engine: engine, db: db}
+func NewRouter(ctx context.Context, engine *gin.Engine, db *sql.DB) Routes {
+	return &router{ctx: ctx, engine: engine, db: db}
 }
 
 func (router *router) BuildRoutes() {
+	router.rates = middleware.NewMemoryRateLimitStore()
 	router.setApiGroup()
+	router.setAccess()
+	router.setNotifier()
+	router.setInsurance()
+	router.setBlobStore()
+	router.setMailer()
+	router.setPasswordHasher()
+	router.setAudit()
 	router.buildPingEndpoint()
+	router.buildJWKSEndpoint()
 	router.buildSwaggerEndpoint()
 	router.buildAuthGroup()
 	router.buildDentists()
 	router.buildPatients()
 	router.buildTurns()
+	router.buildAttachments()
+	router.buildContacts()
+	router.buildInsurance()
+	router.buildPrivacy()
+	router.buildFamily()
+	router.buildApiKeys()
+	router.buildAudit()
+	router.buildAccess()
 }
 
 func (router *router) setApiGroup() {
-	router.apiGroup = router.engine.Group("/api/v1")
+	router.apiGroup = router.engine.Group("/api/v1",
+		middleware.RateLimit(router.rates, "api", middleware.RateLimits{
+			PerIP:   rateLimit("RATE_LIMIT_IP", "300/m"),
+			PerUser: rateLimit("RATE_LIMIT_USER", "600/m"),
+		}))
+}
+
+// rateLimit reads a limit such as "60/m" from the env variable name.
+func rateLimit(name string, fallback string) middleware.Limit {
+	value := os.Getenv(name)
+	if value == "" {
+		value = fallback
+	}
+	limit, err := middleware.ParseLimit(value)
+	if err != nil {
+		log.Fatalf("Error reading %s: %v", name, err)
+	}
+	return limit
+}
+
+// ssoConfig reads the OpenID Connect provider, or returns nil when
+// OIDC_ISSUER is not set. OIDC_ROLE_MAP maps values of the OIDC_ROLE_CLAIM
+// claim to roles, as "value=role" pairs separated by comma.
+func ssoConfig() *user.Sso {
+	issuer := os.Getenv("OIDC_ISSUER")
+	if issuer == "" {
+		return nil
+	}
+	roleClaim := os.Getenv("OIDC_ROLE_CLAIM")
+	if roleClaim == "" {
+		roleClaim = "groups"
+	}
+	roleMap := map[string]string{}
+	pairs := strings.FieldsFunc(os.Getenv("OIDC_ROLE_MAP"),
+		func(r rune) bool { return r == ',' })
+	for _, pair := range pairs {
+		value, role, ok := strings.Cut(pair, "=")
+		if _, known := domain.RolePermissions[strings.TrimSpace(role)]; !ok || !known {
+			log.Fatalf("Invalid OIDC_ROLE_MAP entry %q", pair)
+		}
+		roleMap[strings.TrimSpace(value)] = strings.TrimSpace(role)
+	}
+	provision, _ := strconv.ParseBool(os.Getenv("OIDC_PROVISION"))
+	return &user.Sso{
+		Provider: oidc.NewProvider(oidc.Config{
+			Issuer:       issuer,
+			ClientID:     os.Getenv("OIDC_CLIENT_ID"),
+			ClientSecret: os.Getenv("OIDC_CLIENT_SECRET"),
+			RedirectURL:  os.Getenv("OIDC_REDIRECT_URL"),
+		}),
+		Provision: provision,
+		RoleClaim: roleClaim,
+		RoleMap:   roleMap,
+	}
+}
+
+func envInt(name string, fallback int) int {
+	value := os.Getenv(name)
+	if value == "" {
+		return fallback
+	}
+	number, err := strconv.Atoi(value)
+	if err != nil {
+		log.Fatalf("Error reading %s: %v", name, err)
+	}
+	return number
+}
+
+func envDuration(name string, fallback time.Duration) time.Duration {
+	value := os.Getenv(name)
+	if value == "" {
+		return fallback
+	}
+	duration, err := time.ParseDuration(value)
+	if err != nil {
+		log.Fatalf("Error reading %s: %v", name, err)
+	}
+	return duration
+}
+
+// setPasswordHasher picks the algorithm new passwords are hashed with.
+// Passwords hashed otherwise are rehashed on the next login.
+func (router *router) setPasswordHasher() {
+	switch algorithm := os.Getenv("PASSWORD_HASH"); algorithm {
+	case "", "bcrypt":
+		security.UsePasswordHasher(security.NewBcryptHasher(envInt("BCRYPT_COST", 10)))
+	case "argon2id":
+		security.UsePasswordHasher(security.NewArgon2idHasher(security.Argon2idParams{
+			Memory:  uint32(envInt("ARGON2_MEMORY", 64*1024)),
+			Time:    uint32(envInt("ARGON2_TIME", 3)),
+			Threads: uint8(envInt("ARGON2_THREADS", 4)),
+		}))
+	default:
+		log.Fatalf("Unknown PASSWORD_HASH %q", algorithm)
+	}
+}
+
+func (router *router) setAudit() {
+	key := os.Getenv("AUDIT_HMAC_KEY")
+	if len(key) < audit.MinKeyLength {
+		log.Fatalf("AUDIT_HMAC_KEY must have at least %d characters", audit.MinKeyLength)
+	}
+	router.audit = audit.NewAuditService(audit.NewRepository(router.db), []byte(key))
+}
+
+func (router *router) setAccess() {
+	duration := access.DefaultBreakGlassDuration
+	if value := os.Getenv("BREAK_GLASS_DURATION"); value != "" {
+		var err error
+		if duration, err = time.ParseDuration(value); err != nil {
+			log.Fatalf("Error reading BREAK_GLASS_DURATION: %v", err)
+		}
+	}
+	router.access = access.NewAccessService(access.NewRepository(router.db), patient.NewRepository(router.db), duration)
+}
+
+func (router *router) setNotifier() {
+	router.notifier = notifications.NewNotifier(contact.NewRepository(router.db), family.NewRepository(router.db),
+		notifications.NewRepository(router.db),
+		map[string]notifications.Sender{
+			domain.ChannelSMS:      notifications.NewLogSender(domain.ChannelSMS),
+			domain.ChannelWhatsApp: notifications.NewLogSender(domain.ChannelWhatsApp),
+			domain.ChannelEmail:    notifications.NewLogSender(domain.ChannelEmail),
+		})
+
+	interval := envDuration("NOTIFICATIONS_FLUSH_INTERVAL", notifications.DefaultFlushInterval)
+	go notifications.NewFlushJob(router.notifier, interval).Run(router.ctx)
+}
+
+func (router *router) setInsurance() {
+	suspended := strings.FieldsFunc(os.Getenv("INSURANCE_SUSPENDED_AFFILIATES"),
+		func(r rune) bool { return r == ',' })
+	router.insurance = insurance.NewInsuranceService(insurance.NewRepository(router.db),
+		insurance.NewLocalEligibilityChecker(suspended...), router.access)
+}
+
+func (router *router) setBlobStore() {
+	store, err := blob.NewLocalStore(os.Getenv("BLOB_STORAGE_PATH"))
+	if err != nil {
+		log.Fatalf("Error opening blob storage: %v", err)
+	}
+	router.store = store
+}
+
+func (router *router) setMailer() {
+	addr := os.Getenv("SMTP_ADDR")
+	if addr == "" {
+		router.mailer = mail.NewLogMailer()
+		return
+	}
+	router.mailer = mail.NewSMTPMailer(addr, os.Getenv("SMTP_FROM"),
+		os.Getenv("SMTP_USERNAME"), os.Getenv("SMTP_PASSWORD"))
 }
 
 func (router *router) buildPingEndpoint() {
@@ -54,6 +259,16 @@ func (router *router) buildPingEndpoint() {
 		})
 }
 
+// buildJWKSEndpoint publishes the public keys of the access tokens, at the
+// well known path outside the api group.
+func (router *router) buildJWKSEndpoint() {
+	router.engine.GET("/.well-known/jwks.json",
+		func(ctx *gin.Context) {
+			ctx.Header("Cache-Control", "public, max-age=300")
+			ctx.JSON(http.StatusOK, security.JWKS())
+		})
+}
+
 func (router *router) buildSwaggerEndpoint() {
 	router.apiGroup.GET("/docs/*any",
 		ginSwagger.WrapHandler(swaggerFiles.Handler))
@@ -62,60 +277,276 @@ func (router *router) buildSwaggerEndpoint() {
 func (router *router) buildAuthGroup() {
 
 	repository := user.NewRepository(router.db)
-	service := user.NewService(repository)
+	admins := strings.FieldsFunc(os.Getenv("ADMIN_EMAILS"),
+		func(r rune) bool { return r == ',' })
+	tokens := user.NewTokenRepository(router.db)
+	security.UseRevocationList(tokens)
+	links := user.Links{
+		ResetURL:      os.Getenv("PASSWORD_RESET_URL"),
+		InvitationURL: os.Getenv("INVITATION_URL"),
+		VerifyURL:     os.Getenv("EMAIL_VERIFICATION_URL"),
+	}
+	policy, err := user.NewPasswordPolicy(envInt("PASSWORD_MIN_LENGTH", 10), envInt("PASSWORD_MAX_LENGTH", 72),
+		os.Getenv("PASSWORD_BREACHED_LIST"))
+	if err != nil {
+		log.Fatalf("Error reading PASSWORD_BREACHED_LIST: %v", err)
+	}
+	service := user.NewService(repository, tokens, user.NewResetRepository(router.db),
+		user.NewInvitationRepository(router.db), user.NewVerificationRepository(router.db), router.mailer, links,
+		policy, user.NewThrottleRepository(router.db), user.NewEventRepository(router.db), user.NewMfaRepository(router.db),
+		user.NewSsoRepository(router.db), ssoConfig(), dentist.NewRepository(router.db), patient.NewRepository(router.db),
+		admins...)
+	if err := service.GrantAdmins(); err != nil {
+		log.Fatalf("Error granting the admin role to ADMIN_EMAILS: %v", err)
+	}
 	controller := authController.NewController(service)
 
-	authGroup := router.apiGroup.Group("/auth")
+	authGroup := router.apiGroup.Group("/auth",
+		middleware.RateLimit(router.rates, "auth", middleware.RateLimits{
+			PerIP:   rateLimit("RATE_LIMIT_AUTH_IP", "20/m"),
+			PerUser: rateLimit("RATE_LIMIT_AUTH_USER", "20/m"),
+		}))
 	authGroup.POST("/signup", controller.Signup())
 	authGroup.POST("/login", controller.Login())
+	authGroup.POST("/refresh", controller.Refresh())
+	authGroup.POST("/logout", middleware.Authorization(), controller.Logout())
+	authGroup.POST("/password/forgot", controller.ForgotPassword())
+	authGroup.POST("/password/reset", controller.ResetPassword())
+	authGroup.POST("/verify", controller.VerifyEmail())
+	authGroup.POST("/verify/resend", controller.ResendVerification())
+	authGroup.POST("/mfa/verify", controller.VerifyMfa())
+	authGroup.POST("/mfa/enroll", controller.StartMfaEnrollment())
+	authGroup.GET("/oidc/login", controller.SsoLogin())
+	authGroup.GET("/oidc/callback", controller.SsoCallback())
+
+	router.apiGroup.GET("/me", middleware.Authorization(), controller.Me())
+	router.apiGroup.POST("/me/mfa", middleware.Authorization(), controller.EnrollMfa())
+	router.apiGroup.POST("/me/mfa/confirm", middleware.Authorization(), controller.ConfirmMfa())
+	router.apiGroup.DELETE("/me/mfa", middleware.Authorization(), controller.DisableMfa())
+	router.apiGroup.POST("/me/mfa/recovery-codes", middleware.Authorization(), controller.RegenerateRecoveryCodes())
+	router.apiGroup.GET("/mfa/policy", middleware.Authorization(domain.PermissionUsersManage), controller.GetMfaPolicy())
+	router.apiGroup.PUT("/mfa/policy", middleware.Authorization(domain.PermissionUsersManage), controller.SetMfaPolicy())
+	router.apiGroup.DELETE("/users/:id/mfa", middleware.Authorization(domain.PermissionUsersManage), controller.ResetMfa())
+	router.apiGroup.POST("/invitations", middleware.Authorization(domain.PermissionUsersManage), controller.Invite())
+	router.apiGroup.POST("/users/:id/unlock", middleware.Authorization(domain.PermissionUsersManage), controller.Unlock())
+	router.apiGroup.PUT("/users/:id/roles", middleware.Authorization(domain.PermissionUsersManage), controller.SetRoles())
+	router.apiGroup.PUT("/users/:id/dentist", middleware.Authorization(domain.PermissionUsersManage), controller.LinkDentist())
+	router.apiGroup.DELETE("/users/:id/dentist", middleware.Authorization(domain.PermissionUsersManage), controller.UnlinkDentist())
+	router.apiGroup.PUT("/users/:id/patient", middleware.Authorization(domain.PermissionUsersManage), controller.LinkPatient())
+	router.apiGroup.DELETE("/users/:id/patient", middleware.Authorization(domain.PermissionUsersManage), controller.UnlinkPatient())
 
 }
 
 func (router *router) buildDentists() {
 
 	repository := dentist.NewRepository(router.db)
-	service := dentist.NewDentistService(repository)
+	service := dentist.NewDentistService(repository, router.audit)
 	controller := dentistController.NewDentistController(service)
 
 	dentistGroup := router.apiGroup.Group("/dentists")
 	{
-		dentistGroup.POST("", middleware.Authorization(), controller.HandlerCreate())
+		dentistGroup.POST("", middleware.Authorization(domain.PermissionDentistsWrite), controller.HandlerCreate())
+		dentistGroup.GET("", controller.HandlerList())
 		dentistGroup.GET("/:id", controller.HandlerGetByID())
-		dentistGroup.PUT("/:id", middleware.Authorization(), controller.HandlerUpdate())
-		dentistGroup.PATCH("/:id", middleware.Authorization(), controller.HandlerPatch())
-		dentistGroup.DELETE("/:id", middleware.Authorization(), controller.HandlerDelete())
+		dentistGroup.PUT("/:id", middleware.Authorization(domain.PermissionDentistsWrite), controller.HandlerUpdate())
+		dentistGroup.PATCH("/:id", middleware.Authorization(domain.PermissionDentistsWrite), controller.HandlerPatch())
+		dentistGroup.DELETE("/:id", middleware.Authorization(domain.PermissionDentistsWrite), controller.HandlerDelete())
+		dentistGroup.PUT("/:id/status", middleware.Authorization(domain.PermissionDentistsWrite), controller.HandlerSetActive())
+		dentistGroup.PUT("/:id/specialties", middleware.Authorization(domain.PermissionDentistsWrite), controller.HandlerSetSpecialties())
 	}
+
+	router.apiGroup.POST("/specialties", middleware.Authorization(domain.PermissionDentistsWrite), controller.HandlerCreateSpecialty())
+	router.apiGroup.GET("/specialties", controller.HandlerGetSpecialties())
 }
 
 func (router *router) buildPatients() {
 
 	repository := patient.NewRepository(router.db)
-	service := patient.NewPatientService(repository)
+	service := patient.NewPatientService(repository, router.audit, router.access)
 	controller := patientController.NewPatientController(service)
 
+	interval := envDuration("PATIENT_DUPLICATES_INTERVAL", patient.DefaultDuplicateInterval)
+	go patient.NewDuplicateJob(service, interval).Run(router.ctx)
+
 	patientGroup := router.apiGroup.Group("/patients")
 	{
-		patientGroup.POST("", middleware.Authorization(), controller.HandlerCreate())
-		patientGroup.GET("/:id", controller.HandlerGetByID())
-		patientGroup.PUT("/:id", middleware.Authorization(), controller.HandlerUpdate())
-		patientGroup.PATCH("/:id", middleware.Authorization(), controller.HandlerPatch())
-		patientGroup.DELETE("/:id", middleware.Authorization(), controller.HandlerDelete())
+		patientGroup.POST("", middleware.Authorization(domain.PermissionPatientsWrite), controller.HandlerCreate())
+		patientGroup.GET("/duplicates", middleware.Authorization(domain.PermissionPatientsManage), controller.HandlerGetDuplicates())
+		patientGroup.POST("/duplicates/scan", middleware.Authorization(domain.PermissionPatientsManage), controller.HandlerDetectDuplicates())
+		patientGroup.POST("/:id/merge", middleware.Authorization(domain.PermissionPatientsManage), controller.HandlerMerge())
+		patientGroup.GET("/:id", middleware.Authorization(domain.PermissionPatientsRead), controller.HandlerGetByID())
+		patientGroup.PUT("/:id", middleware.Authorization(domain.PermissionPatientsWrite), controller.HandlerUpdate())
+		patientGroup.PATCH("/:id", middleware.Authorization(domain.PermissionPatientsWrite), controller.HandlerPatch())
+		patientGroup.DELETE("/:id", middleware.Authorization(domain.PermissionPatientsManage), controller.HandlerDelete())
 	}
 
 }
 func (router *router) buildTurns() {
 
 	repository := turn.NewRepository(router.db)
-	service := turn.NewTurnService(repository)
+	service := turn.NewTurnService(repository, router.notifier, router.insurance, router.audit, router.access)
 	controller := turnController.NewTurnController(service)
 
 	turnGroup := router.apiGroup.Group("/turns")
 	{
-		turnGroup.POST("", middleware.Authorization(), controller.HandlerCreate())
-		turnGroup.GET("/:id", controller.HandlerGetByID())
-		turnGroup.GET("/patient/:patientId", controller.HandlerGetByPatientID())
-		turnGroup.PUT("/:id", middleware.Authorization(), controller.HandlerUpdate())
-		turnGroup.DELETE("/:id", middleware.Authorization(), controller.HandlerDelete())
+		turnGroup.POST("", middleware.Authorization(domain.PermissionTurnsWrite), controller.HandlerCreate())
+		turnGroup.GET("/:id", middleware.Authorization(domain.PermissionRecordsRead), controller.HandlerGetByID())
+		turnGroup.GET("/patient/:patientId", middleware.Authorization(domain.PermissionRecordsRead), controller.HandlerGetByPatientID())
+		turnGroup.PUT("/:id", middleware.Authorization(domain.PermissionTurnsWrite), controller.HandlerUpdate())
+		turnGroup.PATCH("/:id", middleware.Authorization(domain.PermissionTurnsWrite), controller.HandlerPatch())
+		turnGroup.DELETE("/:id", middleware.Authorization(domain.PermissionTurnsWrite), controller.HandlerDelete())
+	}
+
+	meGroup := router.apiGroup.Group("/me")
+	{
+		meGroup.GET("/agenda", middleware.Authorization(domain.PermissionAgendaRead), controller.HandlerGetAgenda())
+		meGroup.GET("/patients", middleware.Authorization(domain.PermissionAgendaRead), controller.HandlerGetMyPatients())
 	}
 
 }
+
+func (router *router) buildAttachments() {
+
+	maxSize := int64(envInt("ATTACHMENTS_MAX_SIZE", attachment.DefaultMaxSize))
+
+	repository := attachment.NewRepository(router.db)
+	service := attachment.NewAttachmentService(repository,
+		patient.NewRepository(router.db), turn.NewRepository(router.db), router.store, router.access, maxSize)
+	controller := attachmentController.NewAttachmentController(service)
+
+	router.apiGroup.POST("/patients/:id/attachments", middleware.Authorization(domain.PermissionRecordsWrite), controller.HandlerUploadForPatient())
+	router.apiGroup.GET("/patients/:id/attachments", middleware.Authorization(domain.PermissionRecordsRead), controller.HandlerGetByPatientID())
+	router.apiGroup.POST("/turns/:id/attachments", middleware.Authorization(domain.PermissionRecordsWrite), controller.HandlerUploadForTurn())
+	router.apiGroup.GET("/turns/:id/attachments", middleware.Authorization(domain.PermissionRecordsRead), controller.HandlerGetByTurnID())
+
+	attachmentGroup := router.apiGroup.Group("/attachments")
+	{
+		attachmentGroup.GET("/:id", middleware.Authorization(domain.PermissionRecordsRead), controller.HandlerGetByID())
+		attachmentGroup.GET("/:id/content", middleware.Authorization(domain.PermissionRecordsRead), controller.HandlerDownload())
+		attachmentGroup.GET("/:id/preview", middleware.Authorization(domain.PermissionRecordsRead), controller.HandlerPreview())
+		attachmentGroup.DELETE("/:id", middleware.Authorization(domain.PermissionRecordsWrite), controller.HandlerDelete())
+	}
+
+}
+
+func (router *router) buildContacts() {
+
+	repository := contact.NewRepository(router.db)
+	service := contact.NewContactService(repository, family.NewRepository(router.db), router.access)
+	controller := contactController.NewContactController(service)
+
+	contactGroup := router.apiGroup.Group("/patients/:id/contact")
+	{
+		contactGroup.GET("", middleware.Authorization(domain.PermissionRecordsRead), controller.HandlerGetByPatientID())
+		contactGroup.PUT("", middleware.Authorization(domain.PermissionRecordsWrite), controller.HandlerUpdate())
+		contactGroup.PUT("/consents/:channel", middleware.Authorization(domain.PermissionRecordsWrite), controller.HandlerSetConsent())
+	}
+
+}
+
+func (router *router) buildInsurance() {
+
+	controller := insuranceController.NewInsuranceController(router.insurance)
+
+	router.apiGroup.POST("/procedures", middleware.Authorization(domain.PermissionInsuranceWrite), controller.HandlerCreateProcedure())
+	router.apiGroup.GET("/procedures", controller.HandlerGetProcedures())
+
+	insurerGroup := router.apiGroup.Group("/insurers")
+	{
+		insurerGroup.POST("", middleware.Authorization(domain.PermissionInsuranceWrite), controller.HandlerCreateInsurer())
+		insurerGroup.GET("", controller.HandlerGetInsurers())
+		insurerGroup.POST("/:id/plans", middleware.Authorization(domain.PermissionInsuranceWrite), controller.HandlerCreatePlan())
+		insurerGroup.GET("/:id/plans", controller.HandlerGetPlans())
+	}
+
+	planGroup := router.apiGroup.Group("/plans")
+	{
+		planGroup.POST("/:id/rules", middleware.Authorization(domain.PermissionInsuranceWrite), controller.HandlerCreateRule())
+		planGroup.GET("/:id/rules", controller.HandlerGetRules())
+	}
+
+	router.apiGroup.POST("/patients/:id/coverages", middleware.Authorization(domain.PermissionRecordsWrite), controller.HandlerCreateCoverage())
+	router.apiGroup.GET("/patients/:id/coverages", middleware.Authorization(domain.PermissionRecordsRead), controller.HandlerGetCoverages())
+	router.apiGroup.GET("/patients/:id/coverages/quote", middleware.Authorization(domain.PermissionRecordsRead), controller.HandlerQuote())
+	router.apiGroup.GET("/turns/:id/coverage", middleware.Authorization(domain.PermissionRecordsRead), controller.HandlerGetTurnCoverage())
+
+}
+
+func (router *router) buildPrivacy() {
+
+	repository := privacy.NewRepository(router.db)
+	service := privacy.NewPrivacyService(repository,
+		patient.NewRepository(router.db), turn.NewRepository(router.db),
+		contact.NewRepository(router.db), family.NewRepository(router.db), insurance.NewRepository(router.db),
+		attachment.NewRepository(router.db), router.store, router.audit, access.NewRepository(router.db))
+	controller := privacyController.NewPrivacyController(service)
+
+	router.apiGroup.GET("/patients/:id/export", middleware.Authorization(domain.PermissionPatientsManage), controller.HandlerExport())
+	router.apiGroup.POST("/patients/:id/erasure", middleware.Authorization(domain.PermissionPatientsManage), controller.HandlerErase())
+
+}
+
+func (router *router) buildFamily() {
+
+	repository := family.NewRepository(router.db)
+	turns := turn.NewTurnService(turn.NewRepository(router.db), router.notifier, router.insurance, router.audit, router.access)
+	service := family.NewFamilyService(repository, patient.NewRepository(router.db), turns, router.access)
+	controller := familyController.NewFamilyController(service)
+
+	familyGroup := router.apiGroup.Group("/patients/:id")
+	{
+		familyGroup.GET("/family", middleware.Authorization(domain.PermissionRecordsRead), controller.HandlerGetFamily())
+		familyGroup.GET("/family/turns", middleware.Authorization(domain.PermissionRecordsRead), controller.HandlerGetFamilyTurns())
+		familyGroup.POST("/family/turns", middleware.Authorization(domain.PermissionTurnsWrite), controller.HandlerBookTurn())
+		familyGroup.GET("/guardians", middleware.Authorization(domain.PermissionRecordsRead), controller.HandlerGetGuardians())
+		familyGroup.POST("/dependents", middleware.Authorization(domain.PermissionRecordsWrite), controller.HandlerAddDependent())
+		familyGroup.DELETE("/dependents/:dependentId", middleware.Authorization(domain.PermissionRecordsWrite), controller.HandlerRemoveDependent())
+	}
+
+	meGroup := router.apiGroup.Group("/me/family")
+	{
+		meGroup.GET("", middleware.Authorization(domain.PermissionFamilyRead), controller.HandlerGetFamily())
+		meGroup.GET("/turns", middleware.Authorization(domain.PermissionFamilyRead), controller.HandlerGetFamilyTurns())
+		meGroup.POST("/turns", middleware.Authorization(domain.PermissionFamilyWrite), controller.HandlerBookTurn())
+	}
+
+}
+
+func (router *router) buildApiKeys() {
+
+	repository := apikeys.NewRepository(router.db)
+	service := apikeys.NewApiKeyService(repository)
+	controller := apiKeyController.NewApiKeyController(service)
+
+	middleware.UseApiKeys(service)
+
+	apiKeyGroup := router.apiGroup.Group("/api-keys")
+	{
+		apiKeyGroup.POST("", middleware.Authorization(domain.PermissionApiKeysManage), controller.HandlerCreate())
+		apiKeyGroup.GET("", middleware.Authorization(domain.PermissionApiKeysManage), controller.HandlerGetAll())
+		apiKeyGroup.POST("/:id/rotate", middleware.Authorization(domain.PermissionApiKeysManage), controller.HandlerRotate())
+		apiKeyGroup.DELETE("/:id", middleware.Authorization(domain.PermissionApiKeysManage), controller.HandlerRevoke())
+	}
+
+}
+
+func (router *router) buildAudit() {
+
+	controller := auditController.NewAuditController(router.audit)
+
+	auditGroup := router.apiGroup.Group("/audit")
+	{
+		auditGroup.GET("", middleware.Authorization(domain.PermissionAuditRead), controller.HandlerList())
+		auditGroup.GET("/verify", middleware.Authorization(domain.PermissionAuditRead), controller.HandlerVerify())
+	}
+
+}
+
+func (router *router) buildAccess() {
+
+	controller := accessController.NewAccessController(router.access)
+
+	router.apiGroup.POST("/patients/:id/break-glass", middleware.Authorization(domain.PermissionPatientsRead), controller.HandlerBreakGlass())
+	router.apiGroup.GET("/patients/:id/access-log", middleware.Authorization(domain.PermissionPatientsManage), controller.HandlerReport())
+
+}
@@ -0,0 +1,17 @@
+package access
+
+import (
+	"context"
+	"time"
+
+	"github.com/ncondezo/final/internal/domain"
+)
+
+type Repository interface {
+	Log(ctx context.Context, access domain.PatientAccess) error
+	GetByPatient(ctx context.Context, patientId int) ([]domain.PatientAccess, error)
+	HasTurns(ctx context.Context, dentistId int, patientId int) (bool, error)
+	CreateBreakGlass(ctx context.Context, breakGlass domain.BreakGlass) (domain.BreakGlass, error)
+	HasBreakGlass(ctx context.Context, actor string, patientId int, at time.Time) (bool, error)
+	GetBreakGlassByPatient(ctx context.Context, patientId int) ([]domain.BreakGlass, error)
+}
@@ -0,0 +1,10 @@
+package access
+
+var (
+	QueryInsertAccess       = `INSERT INTO patient_access_log(patients_id, actor, resource, resource_id, purpose, granted, break_glass, request_id, dateup) VALUES(?,?,?,?,?,?,?,?,?)`
+	QueryGetAccessByPatient = `SELECT id, patients_id, actor, resource, resource_id, purpose, granted, break_glass, request_id, dateup FROM patient_access_log WHERE patients_id = ? ORDER BY id DESC`
+	QueryHasTurns           = `SELECT COUNT(*) FROM turns WHERE dentists_id = ? AND patients_id = ?`
+	QueryInsertBreakGlass   = `INSERT INTO break_glass_accesses(patients_id, actor, dentists_id, reason, expires_at, dateup) VALUES(?,?,?,?,?,?)`
+	QueryHasBreakGlass      = `SELECT COUNT(*) FROM break_glass_accesses WHERE actor = ? AND patients_id = ? AND expires_at > ?`
+	QueryGetBreakGlass      = `SELECT id, patients_id, actor, dentists_id, reason, expires_at, dateup FROM break_glass_accesses WHERE patients_id = ? ORDER BY id DESC`
+)
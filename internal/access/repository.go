@@ -0,0 +1,157 @@
+package access
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/ncondezo/final/internal/domain"
+)
+
+var (
+	ErrPrepareStatement = errors.New("error prepare statement")
+	ErrExecStatement    = errors.New("error exec statement")
+	ErrLastInsertedId   = errors.New("error last inserted id")
+)
+
+type repository struct {
+	db *sql.DB
+}
+
+func NewRepository(db *sql.DB) Repository {
+	return &repository{db: db}
+}
+
+// Log is a method that stores a read of the data of a patient.
+func (r *repository) Log(ctx context.Context, access domain.PatientAccess) error {
+	_, err := r.db.Exec(QueryInsertAccess,
+		access.PatientId,
+		access.Actor,
+		access.Resource,
+		access.ResourceId,
+		access.Purpose,
+		access.Granted,
+		access.BreakGlass,
+		access.RequestId,
+		access.DateUp,
+	)
+	if err != nil {
+		return ErrExecStatement
+	}
+	return nil
+}
+
+// GetByPatient is a method that returns the reads of a patient, the newest
+// first.
+func (r *repository) GetByPatient(ctx context.Context, patientId int) ([]domain.PatientAccess, error) {
+	accesses := make([]domain.PatientAccess, 0)
+
+	rows, err := r.db.Query(QueryGetAccessByPatient, patientId)
+	if err != nil {
+		return []domain.PatientAccess{}, ErrExecStatement
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var access domain.PatientAccess
+		err := rows.Scan(
+			&access.Id,
+			&access.PatientId,
+			&access.Actor,
+			&access.Resource,
+			&access.ResourceId,
+			&access.Purpose,
+			&access.Granted,
+			&access.BreakGlass,
+			&access.RequestId,
+			&access.DateUp,
+		)
+		if err != nil {
+			return []domain.PatientAccess{}, ErrExecStatement
+		}
+		accesses = append(accesses, access)
+	}
+
+	return accesses, nil
+}
+
+// HasTurns is a method that reports whether a dentist has any turn with a
+// patient.
+func (r *repository) HasTurns(ctx context.Context, dentistId int, patientId int) (bool, error) {
+	var count int
+	if err := r.db.QueryRow(QueryHasTurns, dentistId, patientId).Scan(&count); err != nil {
+		return false, ErrExecStatement
+	}
+	return count > 0, nil
+}
+
+// CreateBreakGlass is a method that stores a break-the-glass access.
+func (r *repository) CreateBreakGlass(ctx context.Context, breakGlass domain.BreakGlass) (domain.BreakGlass, error) {
+	statement, err := r.db.Prepare(QueryInsertBreakGlass)
+	if err != nil {
+		return domain.BreakGlass{}, ErrPrepareStatement
+	}
+	defer statement.Close()
+
+	result, err := statement.Exec(
+		breakGlass.PatientId,
+		breakGlass.Actor,
+		breakGlass.DentistId,
+		breakGlass.Reason,
+		breakGlass.ExpiresAt,
+		breakGlass.DateUp,
+	)
+	if err != nil {
+		return domain.BreakGlass{}, ErrExecStatement
+	}
+
+	lastId, err := result.LastInsertId()
+	if err != nil {
+		return domain.BreakGlass{}, ErrLastInsertedId
+	}
+	breakGlass.Id = int(lastId)
+
+	return breakGlass, nil
+}
+
+// HasBreakGlass is a method that reports whether actor has a break-the-glass
+// access to a patient that has not expired at the given time.
+func (r *repository) HasBreakGlass(ctx context.Context, actor string, patientId int, at time.Time) (bool, error) {
+	var count int
+	if err := r.db.QueryRow(QueryHasBreakGlass, actor, patientId, at).Scan(&count); err != nil {
+		return false, ErrExecStatement
+	}
+	return count > 0, nil
+}
+
+// GetBreakGlassByPatient is a method that returns the break-the-glass
+// accesses to a patient, the newest first.
+func (r *repository) GetBreakGlassByPatient(ctx context.Context, patientId int) ([]domain.BreakGlass, error) {
+	accesses := make([]domain.BreakGlass, 0)
+
+	rows, err := r.db.Query(QueryGetBreakGlass, patientId)
+	if err != nil {
+		return []domain.BreakGlass{}, ErrExecStatement
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var breakGlass domain.BreakGlass
+		err := rows.Scan(
+			&breakGlass.Id,
+			&breakGlass.PatientId,
+			&breakGlass.Actor,
+			&breakGlass.DentistId,
+			&breakGlass.Reason,
+			&breakGlass.ExpiresAt,
+			&breakGlass.DateUp,
+		)
+		if err != nil {
+			return []domain.BreakGlass{}, ErrExecStatement
+		}
+		accesses = append(accesses, breakGlass)
+	}
+
+	return accesses, nil
+}
@@ -0,0 +1,172 @@
+package access
+
+import (
+	"context"
+	"errors"
+	"log"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/ncondezo/final/internal/domain"
+)
+
+const (
+	// PurposeHeader is where readers declare why they read a patient, one of
+	// the domain purposes.
+	PurposeHeader = "X-Access-Purpose"
+	// DefaultBreakGlassDuration is how long a break-the-glass access lasts.
+	DefaultBreakGlassDuration = time.Hour
+	minReasonLength           = 10
+	systemActor               = "system"
+)
+
+var (
+	ErrInvalidPurpose      = errors.New("error invalid access purpose")
+	ErrNoTurns             = errors.New("error dentist has no turns with the patient")
+	ErrInvalidReason       = errors.New("error break-the-glass reason is too short")
+	ErrBreakGlassNotNeeded = errors.New("error user is not limited to the patients of a dentist")
+)
+
+// PatientFinder checks that a patient exists, patients.Repository does.
+type PatientFinder interface {
+	GetByID(ctx context.Context, id int) (domain.Patient, error)
+}
+
+// Guard is what the services that return patient data need to log who reads
+// it.
+type Guard interface {
+	// Check logs a read of a resource of a patient, and fails if the reader
+	// of ctx may not read it. Users linked to a dentist may only read the
+	// patients they have turns with, unless they broke the glass. Reads are
+	// not allowed when they cannot be logged.
+	Check(ctx context.Context, patientId int, resource string, resourceId int, purpose string) error
+}
+
+type Service interface {
+	Guard
+	BreakGlass(ctx context.Context, dto domain.BreakGlassDTO, patientId int) (domain.BreakGlass, error)
+	Report(ctx context.Context, patientId int) (domain.PatientAccessReport, error)
+}
+
+type service struct {
+	repository Repository
+	patients   PatientFinder
+	duration   time.Duration
+}
+
+func NewAccessService(repository Repository, patients PatientFinder, duration time.Duration) Service {
+	if duration <= 0 {
+		duration = DefaultBreakGlassDuration
+	}
+	return &service{repository: repository, patients: patients, duration: duration}
+}
+
+// Check is a method that logs a read of a patient and tells whether it is
+// allowed.
+func (s *service) Check(ctx context.Context, patientId int, resource string, resourceId int, purpose string) error {
+	if purpose == "" {
+		purpose = domain.PurposeUnspecified
+	} else if !domain.IsAccessPurpose(purpose) {
+		return ErrInvalidPurpose
+	}
+	access := domain.PatientAccess{
+		PatientId:  patientId,
+		Actor:      actor(ctx),
+		Resource:   resource,
+		ResourceId: resourceId,
+		Purpose:    purpose,
+		Granted:    true,
+		RequestId:  domain.RequestIdFrom(ctx),
+		DateUp:     time.Now(),
+	}
+
+	if principal, ok := domain.PrincipalFrom(ctx); ok && principal.DentistId != 0 {
+		hasTurns, err := s.repository.HasTurns(ctx, principal.DentistId, patientId)
+		if err != nil {
+			log.Println("[AccessService][Check] error checking turns", err)
+			return err
+		}
+		if !hasTurns {
+			access.BreakGlass, err = s.repository.HasBreakGlass(ctx, access.Actor, patientId, access.DateUp)
+			if err != nil {
+				log.Println("[AccessService][Check] error checking break-the-glass", err)
+				return err
+			}
+			access.Granted = access.BreakGlass
+		}
+	}
+
+	if err := s.repository.Log(ctx, access); err != nil {
+		log.Println("[AccessService][Check] error logging access", err)
+		return err
+	}
+	if !access.Granted {
+		return ErrNoTurns
+	}
+	return nil
+}
+
+// BreakGlass is a method that lets a dentist read a patient they have no
+// turns with, for a limited time.
+func (s *service) BreakGlass(ctx context.Context, dto domain.BreakGlassDTO, patientId int) (domain.BreakGlass, error) {
+	reason := strings.TrimSpace(dto.Reason)
+	if utf8.RuneCountInString(reason) < minReasonLength {
+		return domain.BreakGlass{}, ErrInvalidReason
+	}
+	principal, ok := domain.PrincipalFrom(ctx)
+	if !ok || principal.DentistId == 0 {
+		return domain.BreakGlass{}, ErrBreakGlassNotNeeded
+	}
+	if _, err := s.patients.GetByID(ctx, patientId); err != nil {
+		log.Println("[AccessService][BreakGlass] error getting patient", err)
+		return domain.BreakGlass{}, err
+	}
+
+	now := time.Now()
+	breakGlass, err := s.repository.CreateBreakGlass(ctx, domain.BreakGlass{
+		PatientId: patientId,
+		Actor:     actor(ctx),
+		DentistId: principal.DentistId,
+		Reason:    reason,
+		ExpiresAt: now.Add(s.duration),
+		DateUp:    now,
+	})
+	if err != nil {
+		log.Println("[AccessService][BreakGlass] error creating break-the-glass", err)
+		return domain.BreakGlass{}, err
+	}
+	log.Println("[AccessService][BreakGlass] break-the-glass access to patient", patientId, principal, "reason:", reason)
+	return breakGlass, nil
+}
+
+// Report is a method that return who read a patient and the break-the-glass
+// accesses to it.
+func (s *service) Report(ctx context.Context, patientId int) (domain.PatientAccessReport, error) {
+	if _, err := s.patients.GetByID(ctx, patientId); err != nil {
+		log.Println("[AccessService][Report] error getting patient", err)
+		return domain.PatientAccessReport{}, err
+	}
+	accesses, err := s.repository.GetByPatient(ctx, patientId)
+	if err != nil {
+		log.Println("[AccessService][Report] error getting accesses", err)
+		return domain.PatientAccessReport{}, err
+	}
+	breakGlass, err := s.repository.GetBreakGlassByPatient(ctx, patientId)
+	if err != nil {
+		log.Println("[AccessService][Report] error getting break-the-glass accesses", err)
+		return domain.PatientAccessReport{}, err
+	}
+	return domain.PatientAccessReport{
+		PatientId:  patientId,
+		Accesses:   accesses,
+		BreakGlass: breakGlass,
+	}, nil
+}
+
+func actor(ctx context.Context) string {
+	if id := domain.ActorFrom(ctx); id != nil {
+		return *id
+	}
+	return systemActor
+}
@@ -0,0 +1,18 @@
+package apikeys
+
+import (
+	"context"
+	"time"
+
+	"github.com/ncondezo/final/internal/domain"
+)
+
+type Repository interface {
+	Create(ctx context.Context, key domain.ApiKey) (domain.ApiKey, error)
+	GetByID(ctx context.Context, id int) (domain.ApiKey, error)
+	GetByPrefix(ctx context.Context, prefix string) (domain.ApiKey, error)
+	GetAll(ctx context.Context) ([]domain.ApiKey, error)
+	Rotate(ctx context.Context, id int, prefix string, hash string) error
+	Revoke(ctx context.Context, id int) error
+	Touch(ctx context.Context, id int, usedAt time.Time) error
+}
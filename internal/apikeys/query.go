@@ -0,0 +1,11 @@
+package apikeys
+
+var (
+	QueryInsertApiKey      = `INSERT INTO api_keys(name, prefix, key_hash, permissions, created_by, dateup) VALUES(?,?,?,?,?,?)`
+	QueryGetApiKeyById     = `SELECT id, name, prefix, key_hash, permissions, created_by, last_used_at, revoked_at, dateup FROM api_keys WHERE id = ?`
+	QueryGetApiKeyByPrefix = `SELECT id, name, prefix, key_hash, permissions, created_by, last_used_at, revoked_at, dateup FROM api_keys WHERE prefix = ?`
+	QueryGetApiKeys        = `SELECT id, name, prefix, key_hash, permissions, created_by, last_used_at, revoked_at, dateup FROM api_keys ORDER BY id`
+	QueryRotateApiKey      = `UPDATE api_keys SET prefix = ?, key_hash = ? WHERE id = ? AND revoked_at IS NULL`
+	QueryRevokeApiKey      = `UPDATE api_keys SET revoked_at = ? WHERE id = ? AND revoked_at IS NULL`
+	QueryTouchApiKey       = `UPDATE api_keys SET last_used_at = ? WHERE id = ?`
+)
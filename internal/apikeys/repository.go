@@ -0,0 +1,177 @@
+package apikeys
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/ncondezo/final/internal/domain"
+)
+
+var (
+	ErrPrepareStatement = errors.New("error prepare statement")
+	ErrExecStatement    = errors.New("error exec statement")
+	ErrLastInsertedId   = errors.New("error last inserted id")
+	ErrNotFound         = errors.New("error not found api key")
+)
+
+type repository struct {
+	db *sql.DB
+}
+
+func NewRepository(db *sql.DB) Repository {
+	return &repository{db: db}
+}
+
+// Create is a method that stores a new api key.
+func (r *repository) Create(ctx context.Context, key domain.ApiKey) (domain.ApiKey, error) {
+	statement, err := r.db.Prepare(QueryInsertApiKey)
+	if err != nil {
+		return domain.ApiKey{}, ErrPrepareStatement
+	}
+	defer statement.Close()
+
+	result, err := statement.Exec(
+		key.Name,
+		key.Prefix,
+		key.Hash,
+		strings.Join(key.Permissions, ","),
+		key.CreatedBy,
+		key.DateUp,
+	)
+	if err != nil {
+		return domain.ApiKey{}, ErrExecStatement
+	}
+
+	lastId, err := result.LastInsertId()
+	if err != nil {
+		return domain.ApiKey{}, ErrLastInsertedId
+	}
+	key.Id = int(lastId)
+
+	return key, nil
+}
+
+// GetByID is a method that returns an api key by ID.
+func (r *repository) GetByID(ctx context.Context, id int) (domain.ApiKey, error) {
+	key, err := scanApiKey(r.db.QueryRow(QueryGetApiKeyById, id))
+	if errors.Is(err, sql.ErrNoRows) {
+		return domain.ApiKey{}, ErrNotFound
+	}
+	if err != nil {
+		return domain.ApiKey{}, ErrExecStatement
+	}
+	return key, nil
+}
+
+// GetByPrefix is a method that returns the api key a presented key belongs to.
+func (r *repository) GetByPrefix(ctx context.Context, prefix string) (domain.ApiKey, error) {
+	key, err := scanApiKey(r.db.QueryRow(QueryGetApiKeyByPrefix, prefix))
+	if errors.Is(err, sql.ErrNoRows) {
+		return domain.ApiKey{}, ErrNotFound
+	}
+	if err != nil {
+		return domain.ApiKey{}, ErrExecStatement
+	}
+	return key, nil
+}
+
+// GetAll is a method that returns every api key, revoked ones included.
+func (r *repository) GetAll(ctx context.Context) ([]domain.ApiKey, error) {
+	keys := make([]domain.ApiKey, 0)
+
+	rows, err := r.db.Query(QueryGetApiKeys)
+	if err != nil {
+		return []domain.ApiKey{}, ErrExecStatement
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		key, err := scanApiKey(rows)
+		if err != nil {
+			return []domain.ApiKey{}, ErrExecStatement
+		}
+		keys = append(keys, key)
+	}
+
+	return keys, nil
+}
+
+// Rotate is a method that replaces the secret of an active api key.
+func (r *repository) Rotate(ctx context.Context, id int, prefix string, hash string) error {
+	result, err := r.db.Exec(QueryRotateApiKey, prefix, hash, id)
+	if err != nil {
+		return ErrExecStatement
+	}
+	return affected(result)
+}
+
+// Revoke is a method that disables an active api key.
+func (r *repository) Revoke(ctx context.Context, id int) error {
+	result, err := r.db.Exec(QueryRevokeApiKey, time.Now(), id)
+	if err != nil {
+		return ErrExecStatement
+	}
+	return affected(result)
+}
+
+// Touch is a method that records when an api key was last used.
+func (r *repository) Touch(ctx context.Context, id int, usedAt time.Time) error {
+	_, err := r.db.Exec(QueryTouchApiKey, usedAt, id)
+	if err != nil {
+		return ErrExecStatement
+	}
+	return nil
+}
+
+func affected(result sql.Result) error {
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected < 1 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+type scanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanApiKey(row scanner) (domain.ApiKey, error) {
+	var key domain.ApiKey
+	var permissions string
+	var createdBy sql.NullString
+	var lastUsedAt, revokedAt sql.NullTime
+	err := row.Scan(
+		&key.Id,
+		&key.Name,
+		&key.Prefix,
+		&key.Hash,
+		&permissions,
+		&createdBy,
+		&lastUsedAt,
+		&revokedAt,
+		&key.DateUp,
+	)
+	if err != nil {
+		return domain.ApiKey{}, err
+	}
+	key.Permissions = []string{}
+	if permissions != "" {
+		key.Permissions = strings.Split(permissions, ",")
+	}
+	if createdBy.Valid {
+		key.CreatedBy = &createdBy.String
+	}
+	if lastUsedAt.Valid {
+		key.LastUsedAt = &lastUsedAt.Time
+	}
+	if revokedAt.Valid {
+		key.RevokedAt = &revokedAt.Time
+	}
+	return key, nil
+}
@@ -0,0 +1,169 @@
+package apikeys
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ncondezo/final/internal/domain"
+	"github.com/ncondezo/final/pkg/security"
+)
+
+const (
+	keyPrefix = "dk"
+	// touchEvery keeps busy keys from writing last_used_at on every request.
+	touchEvery = time.Minute
+)
+
+var (
+	ErrInvalidName       = errors.New("error api key name is required")
+	ErrInvalidPermission = errors.New("error invalid permission")
+	ErrPermissionNotHeld = errors.New("error cannot grant a permission the creator does not hold")
+	ErrInvalidKey        = errors.New("error invalid api key")
+	ErrRevoked           = errors.New("error api key is revoked")
+)
+
+type Service interface {
+	Create(ctx context.Context, dto domain.ApiKeyDTO) (domain.IssuedApiKey, error)
+	GetAll(ctx context.Context) ([]domain.ApiKey, error)
+	Rotate(ctx context.Context, id int) (domain.IssuedApiKey, error)
+	Revoke(ctx context.Context, id int) error
+	Authenticate(ctx context.Context, key string) (domain.Principal, error)
+}
+
+type service struct {
+	repository Repository
+}
+
+func NewApiKeyService(repository Repository) Service {
+	return &service{repository: repository}
+}
+
+// Create is a method that issues a new api key. The key is only returned
+// here, just its hash is stored.
+func (s *service) Create(ctx context.Context, dto domain.ApiKeyDTO) (domain.IssuedApiKey, error) {
+	if strings.TrimSpace(dto.Name) == "" {
+		return domain.IssuedApiKey{}, ErrInvalidName
+	}
+	if len(dto.Permissions) == 0 {
+		return domain.IssuedApiKey{}, ErrInvalidPermission
+	}
+	principal, _ := domain.PrincipalFrom(ctx)
+	for _, permission := range dto.Permissions {
+		if !domain.IsPermission(permission) {
+			return domain.IssuedApiKey{}, ErrInvalidPermission
+		}
+		if !principal.Can(permission) {
+			return domain.IssuedApiKey{}, ErrPermissionNotHeld
+		}
+	}
+
+	secret, prefix, hash, err := generate()
+	if err != nil {
+		return domain.IssuedApiKey{}, err
+	}
+	key, err := s.repository.Create(ctx, domain.ApiKey{
+		Name:        dto.Name,
+		Prefix:      prefix,
+		Hash:        hash,
+		Permissions: dto.Permissions,
+		CreatedBy:   domain.ActorFrom(ctx),
+		DateUp:      time.Now(),
+	})
+	if err != nil {
+		log.Println("[ApiKeysService][Create] error creating api key", err)
+		return domain.IssuedApiKey{}, err
+	}
+	return domain.IssuedApiKey{ApiKey: key, Key: secret}, nil
+}
+
+// GetAll is a method that return every api key without their secrets.
+func (s *service) GetAll(ctx context.Context) ([]domain.ApiKey, error) {
+	keys, err := s.repository.GetAll(ctx)
+	if err != nil {
+		log.Println("[ApiKeysService][GetAll] error getting api keys", err)
+		return []domain.ApiKey{}, err
+	}
+	return keys, nil
+}
+
+// Rotate is a method that replaces the secret of an api key, keeping its
+// name and permissions. The previous secret stops working at once.
+func (s *service) Rotate(ctx context.Context, id int) (domain.IssuedApiKey, error) {
+	secret, prefix, hash, err := generate()
+	if err != nil {
+		return domain.IssuedApiKey{}, err
+	}
+	if err := s.repository.Rotate(ctx, id, prefix, hash); err != nil {
+		log.Println("[ApiKeysService][Rotate] error rotating api key", err)
+		return domain.IssuedApiKey{}, err
+	}
+	key, err := s.repository.GetByID(ctx, id)
+	if err != nil {
+		return domain.IssuedApiKey{}, err
+	}
+	return domain.IssuedApiKey{ApiKey: key, Key: secret}, nil
+}
+
+// Revoke is a method that disables an api key for good.
+func (s *service) Revoke(ctx context.Context, id int) error {
+	if err := s.repository.Revoke(ctx, id); err != nil {
+		log.Println("[ApiKeysService][Revoke] error revoking api key", err)
+		return err
+	}
+	return nil
+}
+
+// Authenticate is a method that returns the principal of a presented key.
+func (s *service) Authenticate(ctx context.Context, key string) (domain.Principal, error) {
+	parts := strings.SplitN(key, "_", 3)
+	if len(parts) != 3 || parts[0] != keyPrefix {
+		return domain.Principal{}, ErrInvalidKey
+	}
+	found, err := s.repository.GetByPrefix(ctx, parts[1])
+	if errors.Is(err, ErrNotFound) {
+		return domain.Principal{}, ErrInvalidKey
+	}
+	if err != nil {
+		return domain.Principal{}, err
+	}
+	if subtle.ConstantTimeCompare([]byte(found.Hash), []byte(security.HashToken(key))) != 1 {
+		return domain.Principal{}, ErrInvalidKey
+	}
+	if found.RevokedAt != nil {
+		return domain.Principal{}, ErrRevoked
+	}
+
+	now := time.Now()
+	if found.LastUsedAt == nil || now.Sub(*found.LastUsedAt) > touchEvery {
+		if err := s.repository.Touch(ctx, found.Id, now); err != nil {
+			log.Println("[ApiKeysService][Authenticate] error touching api key", err)
+		}
+	}
+	return domain.Principal{
+		UserId:      "apikey:" + strconv.Itoa(found.Id),
+		Permissions: found.Permissions,
+		Tenant:      security.Tenant(),
+	}, nil
+}
+
+// generate returns a new key, the prefix it is looked up by and its hash.
+func generate() (string, string, string, error) {
+	bytes := make([]byte, 6)
+	if _, err := rand.Read(bytes); err != nil {
+		return "", "", "", err
+	}
+	prefix := hex.EncodeToString(bytes)
+	secret, _, err := security.GenerateOpaqueToken()
+	if err != nil {
+		return "", "", "", err
+	}
+	key := keyPrefix + "_" + prefix + "_" + secret
+	return key, prefix, security.HashToken(key), nil
+}
@@ -0,0 +1,15 @@
+package attachments
+
+import (
+	"context"
+
+	"github.com/ncondezo/final/internal/domain"
+)
+
+type Repository interface {
+	Create(ctx context.Context, attachment domain.Attachment) (domain.Attachment, error)
+	GetByID(ctx context.Context, id int) (domain.Attachment, error)
+	GetByPatientID(ctx context.Context, patientId int) ([]domain.Attachment, error)
+	GetByTurnID(ctx context.Context, turnId int) ([]domain.Attachment, error)
+	Delete(ctx context.Context, id int) error
+}
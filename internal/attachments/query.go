@@ -0,0 +1,15 @@
+package attachments
+
+var (
+	QueryInsertAttachment       = `INSERT INTO attachments(patients_id, turns_id, kind, filename, content_type, size, checksum, storage_key, dateup) VALUES(?,?,?,?,?,?,?,?,?)`
+	QueryInsertRadiograph       = `INSERT INTO attachment_radiographs(attachments_id, modality, acquisition_date, patient_name, patient_identity, region, image_rows, image_columns, preview_key) VALUES(?,?,?,?,?,?,?,?,?)`
+	QueryGetAttachmentById      = querySelectAttachment + ` WHERE attachments.id = ?`
+	QueryGetAttachmentByPatient = querySelectAttachment + ` WHERE attachments.patients_id = ? ORDER BY attachments.dateup DESC`
+	QueryGetAttachmentByTurn    = querySelectAttachment + ` WHERE attachments.turns_id = ? ORDER BY attachments.dateup DESC`
+	QueryDeleteRadiograph       = `DELETE FROM attachment_radiographs WHERE attachments_id = ?`
+	QueryDeleteAttachment       = `DELETE FROM attachments WHERE id = ?`
+)
+
+const querySelectAttachment = `SELECT attachments.id, attachments.patients_id, attachments.turns_id, attachments.kind, attachments.filename, attachments.content_type, attachments.size, attachments.checksum, attachments.storage_key, attachments.dateup, ` +
+	`attachment_radiographs.attachments_id, attachment_radiographs.modality, attachment_radiographs.acquisition_date, attachment_radiographs.patient_name, attachment_radiographs.patient_identity, attachment_radiographs.region, attachment_radiographs.image_rows, attachment_radiographs.image_columns, attachment_radiographs.preview_key ` +
+	`FROM attachments LEFT JOIN attachment_radiographs ON attachment_radiographs.attachments_id = attachments.id`
@@ -0,0 +1,131 @@
+package attachments
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"image/png"
+	"log"
+	"strings"
+	"unicode"
+
+	"github.com/ncondezo/final/internal/domain"
+	"github.com/ncondezo/final/pkg/dicom"
+)
+
+const (
+	previewSuffix  = ".preview.png"
+	previewMaxSide = 512
+)
+
+var (
+	ErrInvalidDicom    = errors.New("error invalid DICOM content")
+	ErrPatientMismatch = errors.New("error radiograph header does not match patient")
+)
+
+var accents = strings.NewReplacer(
+	"á", "a", "é", "e", "í", "i", "ó", "o", "ú", "u", "ü", "u", "ñ", "n",
+	"à", "a", "è", "e", "ì", "i", "ò", "o", "ù", "u", "ç", "c",
+)
+
+// inspectRadiograph parses a DICOM upload, rejects it when its header
+// belongs to another patient and stores a PNG preview when possible.
+func (s *service) inspectRadiograph(ctx context.Context, data []byte, patient domain.Patient, previewKey string) (*domain.Radiograph, error) {
+	file, err := dicom.Parse(data)
+	if err != nil {
+		log.Println("[AttachmentsService][inspectRadiograph] error parsing DICOM", err)
+		return nil, ErrInvalidDicom
+	}
+
+	header := file.Header()
+	if mismatches := radiographMismatches(header, patient); len(mismatches) > 0 {
+		log.Println("[AttachmentsService][inspectRadiograph] radiograph does not match patient",
+			patient.Id, strings.Join(mismatches, ", "))
+		return nil, ErrPatientMismatch
+	}
+
+	radiograph := &domain.Radiograph{
+		Modality:        header.Modality,
+		PatientName:     header.PatientName,
+		PatientIdentity: header.PatientID,
+		Region:          header.Region,
+		Rows:            header.Rows,
+		Columns:         header.Columns,
+	}
+	if radiograph.Region == "" {
+		radiograph.Region = header.BodyPart
+	}
+	if !header.AcquisitionDate.IsZero() {
+		radiograph.AcquisitionDate = &header.AcquisitionDate
+	}
+
+	preview, err := file.Preview(previewMaxSide)
+	if err != nil {
+		log.Println("[AttachmentsService][inspectRadiograph] preview not available", err)
+		return radiograph, nil
+	}
+	var encoded bytes.Buffer
+	if err := png.Encode(&encoded, preview); err != nil {
+		log.Println("[AttachmentsService][inspectRadiograph] error encoding preview", err)
+		return radiograph, nil
+	}
+	if _, err := s.store.Put(ctx, previewKey, &encoded); err != nil {
+		log.Println("[AttachmentsService][inspectRadiograph] error storing preview", err)
+		return radiograph, nil
+	}
+	radiograph.HasPreview = true
+	radiograph.PreviewKey = previewKey
+
+	return radiograph, nil
+}
+
+// radiographMismatches returns the header fields that contradict the
+// patient. Fields absent from the header cannot be checked and are skipped.
+func radiographMismatches(header dicom.Header, patient domain.Patient) []string {
+	mismatches := make([]string, 0)
+
+	if id := digits(header.PatientID); id != "" && id != digits(patient.Dni) {
+		mismatches = append(mismatches, "patient_id")
+	}
+
+	family, given := dicom.SplitPersonName(header.PatientName)
+	if family != "" && !namesMatch(family, patient.Lastname) {
+		mismatches = append(mismatches, "patient_lastname")
+	}
+	if given != "" && !namesMatch(given, patient.Name) {
+		mismatches = append(mismatches, "patient_name")
+	}
+
+	return mismatches
+}
+
+// namesMatch accepts compound names as long as they share a word, so
+// "Perez Garcia" matches "Pérez".
+func namesMatch(first, second string) bool {
+	words := make(map[string]bool)
+	for _, word := range nameWords(first) {
+		words[word] = true
+	}
+	for _, word := range nameWords(second) {
+		if words[word] {
+			return true
+		}
+	}
+	return false
+}
+
+func nameWords(name string) []string {
+	normalized := accents.Replace(strings.ToLower(name))
+	return strings.FieldsFunc(normalized, func(r rune) bool {
+		return !unicode.IsLetter(r)
+	})
+}
+
+func digits(value string) string {
+	return strings.Map(func(r rune) rune {
+		if unicode.IsDigit(r) {
+			return r
+		}
+		return -1
+	}, value)
+}
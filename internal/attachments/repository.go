@@ -0,0 +1,221 @@
+package attachments
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+
+	"github.com/ncondezo/final/internal/domain"
+	"github.com/ncondezo/final/internal/patients"
+	"github.com/ncondezo/final/internal/turns"
+)
+
+var (
+	ErrPrepareStatement = errors.New("error prepare statement")
+	ErrExecStatement    = errors.New("error exec statement")
+	ErrLastInsertedId   = errors.New("error last inserted id")
+	ErrNotFound         = errors.New("error not found attachment")
+)
+
+type repository struct {
+	db *sql.DB
+}
+
+func NewRepository(db *sql.DB) Repository {
+	return &repository{db: db}
+}
+
+// Create is a method that stores the metadata of a new attachment.
+func (r *repository) Create(ctx context.Context, attachment domain.Attachment) (domain.Attachment, error) {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return domain.Attachment{}, ErrExecStatement
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec(QueryInsertAttachment,
+		attachment.PatientId,
+		attachment.TurnId,
+		attachment.Kind,
+		attachment.Filename,
+		attachment.ContentType,
+		attachment.Size,
+		attachment.Checksum,
+		attachment.StorageKey,
+		attachment.DateUp,
+	)
+	if err != nil {
+		return domain.Attachment{}, ErrExecStatement
+	}
+
+	lastId, err := result.LastInsertId()
+	if err != nil {
+		return domain.Attachment{}, ErrLastInsertedId
+	}
+
+	if radiograph := attachment.Radiograph; radiograph != nil {
+		_, err = tx.Exec(QueryInsertRadiograph,
+			lastId,
+			radiograph.Modality,
+			radiograph.AcquisitionDate,
+			radiograph.PatientName,
+			radiograph.PatientIdentity,
+			radiograph.Region,
+			radiograph.Rows,
+			radiograph.Columns,
+			sql.NullString{String: radiograph.PreviewKey, Valid: radiograph.HasPreview},
+		)
+		if err != nil {
+			return domain.Attachment{}, ErrExecStatement
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return domain.Attachment{}, ErrExecStatement
+	}
+
+	attachment.Id = int(lastId)
+
+	return attachment, nil
+}
+
+// GetByID is a method that returns an attachment by ID.
+func (r *repository) GetByID(ctx context.Context, id int) (domain.Attachment, error) {
+	attachment, err := scanAttachment(r.db.QueryRow(QueryGetAttachmentById, id))
+	if errors.Is(err, sql.ErrNoRows) {
+		return domain.Attachment{}, ErrNotFound
+	}
+	if err != nil {
+		return domain.Attachment{}, ErrExecStatement
+	}
+
+	return attachment, nil
+}
+
+// GetByPatientID is a method that returns the attachments of a patient.
+func (r *repository) GetByPatientID(ctx context.Context, patientId int) ([]domain.Attachment, error) {
+	_, err := patients.NewRepository(r.db).GetByID(ctx, patientId)
+	if err != nil {
+		return []domain.Attachment{}, err
+	}
+
+	return r.list(QueryGetAttachmentByPatient, patientId)
+}
+
+// GetByTurnID is a method that returns the attachments of a turn.
+func (r *repository) GetByTurnID(ctx context.Context, turnId int) ([]domain.Attachment, error) {
+	_, err := turns.NewRepository(r.db).GetByID(ctx, turnId)
+	if err != nil {
+		return []domain.Attachment{}, err
+	}
+
+	return r.list(QueryGetAttachmentByTurn, turnId)
+}
+
+// Delete is a method that deletes an attachment by ID.
+func (r *repository) Delete(ctx context.Context, id int) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return ErrExecStatement
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(QueryDeleteRadiograph, id); err != nil {
+		return ErrExecStatement
+	}
+
+	result, err := tx.Exec(QueryDeleteAttachment, id)
+	if err != nil {
+		return ErrExecStatement
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected < 1 {
+		return ErrNotFound
+	}
+
+	if err := tx.Commit(); err != nil {
+		return ErrExecStatement
+	}
+
+	return nil
+}
+
+func (r *repository) list(query string, args ...interface{}) ([]domain.Attachment, error) {
+	attachments := make([]domain.Attachment, 0)
+
+	founds, err := r.db.Query(query, args...)
+	if err != nil {
+		return []domain.Attachment{}, ErrExecStatement
+	}
+	defer founds.Close()
+
+	for founds.Next() {
+		attachment, err := scanAttachment(founds)
+		if err != nil {
+			return []domain.Attachment{}, ErrExecStatement
+		}
+		attachments = append(attachments, attachment)
+	}
+
+	return attachments, nil
+}
+
+type scanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanAttachment(scanner scanner) (domain.Attachment, error) {
+	var attachment domain.Attachment
+	var turnId, radiographId, rows, columns sql.NullInt64
+	var modality, patientName, patientIdentity, region, previewKey sql.NullString
+	var acquisitionDate sql.NullTime
+	err := scanner.Scan(
+		&attachment.Id,
+		&attachment.PatientId,
+		&turnId,
+		&attachment.Kind,
+		&attachment.Filename,
+		&attachment.ContentType,
+		&attachment.Size,
+		&attachment.Checksum,
+		&attachment.StorageKey,
+		&attachment.DateUp,
+		&radiographId,
+		&modality,
+		&acquisitionDate,
+		&patientName,
+		&patientIdentity,
+		&region,
+		&rows,
+		&columns,
+		&previewKey,
+	)
+	if err != nil {
+		return domain.Attachment{}, err
+	}
+	if turnId.Valid {
+		id := int(turnId.Int64)
+		attachment.TurnId = &id
+	}
+	if radiographId.Valid {
+		attachment.Radiograph = &domain.Radiograph{
+			Modality:        modality.String,
+			PatientName:     patientName.String,
+			PatientIdentity: patientIdentity.String,
+			Region:          region.String,
+			Rows:            int(rows.Int64),
+			Columns:         int(columns.Int64),
+			HasPreview:      previewKey.Valid,
+			PreviewKey:      previewKey.String,
+		}
+		if acquisitionDate.Valid {
+			attachment.Radiograph.AcquisitionDate = &acquisitionDate.Time
+		}
+	}
+	return attachment, nil
+}
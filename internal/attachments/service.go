@@ -0,0 +1,308 @@
+package attachments
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/google/uuid"
+	"github.com/ncondezo/final/internal/access"
+	"github.com/ncondezo/final/internal/domain"
+	"github.com/ncondezo/final/internal/patients"
+	"github.com/ncondezo/final/internal/turns"
+	"github.com/ncondezo/final/pkg/blob"
+	"github.com/ncondezo/final/pkg/dicom"
+)
+
+const (
+	DefaultMaxSize = 20 << 20
+	// MaxFilenameLength is the size of the filename column, in characters.
+	MaxFilenameLength = 250
+	sniffLength       = 512
+	dicomMediaType    = "application/dicom"
+)
+
+var (
+	ErrInvalidKind        = errors.New("error invalid attachment kind")
+	ErrFilenameTooLong    = errors.New("error attachment filename is too long")
+	ErrUnsupportedContent = errors.New("error unsupported attachment content type")
+	ErrTooLarge           = errors.New("error attachment exceeds size limit")
+	ErrEmptyContent       = errors.New("error attachment is empty")
+	ErrTurnMismatch       = errors.New("error turn does not belong to patient")
+	ErrNoPreview          = errors.New("error attachment has no preview")
+)
+
+var allowedKinds = map[string]bool{
+	"xray":       true,
+	"consent":    true,
+	"lab_result": true,
+	"other":      true,
+}
+
+var allowedContentTypes = map[string]bool{
+	"image/jpeg":      true,
+	"image/png":       true,
+	"application/pdf": true,
+	dicomMediaType:    true,
+}
+
+type Service interface {
+	Upload(ctx context.Context, dto domain.AttachmentDTO, content io.Reader) (domain.Attachment, error)
+	GetByID(ctx context.Context, id int, purpose string) (domain.Attachment, error)
+	GetByPatientID(ctx context.Context, patientId int, purpose string) ([]domain.Attachment, error)
+	GetByTurnID(ctx context.Context, turnId int, purpose string) ([]domain.Attachment, error)
+	Open(ctx context.Context, id int, purpose string) (domain.Attachment, io.ReadCloser, error)
+	OpenPreview(ctx context.Context, id int, purpose string) (io.ReadCloser, error)
+	Delete(ctx context.Context, id int) error
+}
+
+type service struct {
+	repository Repository
+	patients   patients.Repository
+	turns      turns.Repository
+	store      blob.BlobStore
+	access     access.Guard
+	maxSize    int64
+}
+
+func NewAttachmentService(repository Repository, patients patients.Repository, turns turns.Repository, store blob.BlobStore,
+	access access.Guard, maxSize int64) Service {
+	if maxSize <= 0 {
+		maxSize = DefaultMaxSize
+	}
+	return &service{
+		repository: repository,
+		patients:   patients,
+		turns:      turns,
+		store:      store,
+		access:     access,
+		maxSize:    maxSize,
+	}
+}
+
+// Upload is a method that stores the content of a new attachment and its metadata.
+func (s *service) Upload(ctx context.Context, dto domain.AttachmentDTO, content io.Reader) (domain.Attachment, error) {
+	if !allowedKinds[dto.Kind] {
+		return domain.Attachment{}, ErrInvalidKind
+	}
+	if utf8.RuneCountInString(dto.Filename) > MaxFilenameLength {
+		return domain.Attachment{}, ErrFilenameTooLong
+	}
+
+	patient, err := s.owner(ctx, dto)
+	if err != nil {
+		return domain.Attachment{}, err
+	}
+
+	reader := bufio.NewReaderSize(content, sniffLength)
+	header, err := reader.Peek(sniffLength)
+	if err != nil && !errors.Is(err, io.EOF) {
+		return domain.Attachment{}, err
+	}
+	if len(header) == 0 {
+		return domain.Attachment{}, ErrEmptyContent
+	}
+
+	contentType := sniffContentType(header)
+	if !allowedContentTypes[contentType] {
+		return domain.Attachment{}, ErrUnsupportedContent
+	}
+
+	key := "attachments/" + uuid.New().String()
+	body := io.Reader(&io.LimitedReader{R: reader, N: s.maxSize + 1})
+
+	var radiograph *domain.Radiograph
+	if contentType == dicomMediaType {
+		data, err := io.ReadAll(body)
+		if err != nil {
+			return domain.Attachment{}, err
+		}
+		if int64(len(data)) > s.maxSize {
+			return domain.Attachment{}, ErrTooLarge
+		}
+		radiograph, err = s.inspectRadiograph(ctx, data, patient, key+previewSuffix)
+		if err != nil {
+			return domain.Attachment{}, err
+		}
+		body = bytes.NewReader(data)
+	}
+
+	hasher := sha256.New()
+	size, err := s.store.Put(ctx, key, io.TeeReader(body, hasher))
+	if err != nil {
+		log.Println("[AttachmentsService][Upload] error storing attachment", err)
+		s.discard(ctx, key, radiograph)
+		return domain.Attachment{}, err
+	}
+	if size > s.maxSize {
+		s.discard(ctx, key, radiograph)
+		return domain.Attachment{}, ErrTooLarge
+	}
+
+	attachment := domain.Attachment{
+		PatientId:   patient.Id,
+		Kind:        dto.Kind,
+		Filename:    dto.Filename,
+		ContentType: contentType,
+		Size:        size,
+		Checksum:    hex.EncodeToString(hasher.Sum(nil)),
+		StorageKey:  key,
+		DateUp:      time.Now(),
+		Radiograph:  radiograph,
+	}
+	if dto.IdTurn > 0 {
+		attachment.TurnId = &dto.IdTurn
+	}
+
+	attachment, err = s.repository.Create(ctx, attachment)
+	if err != nil {
+		log.Println("[AttachmentsService][Upload] error creating attachment", err)
+		s.discard(ctx, key, radiograph)
+		return domain.Attachment{}, err
+	}
+	return attachment, nil
+}
+
+// GetByID is a method that return the metadata of an attachment by ID, and
+// logs the read of its patient with its purpose.
+func (s *service) GetByID(ctx context.Context, id int, purpose string) (domain.Attachment, error) {
+	return s.view(ctx, id, purpose)
+}
+
+// GetByPatientID is a method that return the attachments of a patient, and
+// logs the read with its purpose.
+func (s *service) GetByPatientID(ctx context.Context, patientId int, purpose string) ([]domain.Attachment, error) {
+	if err := s.access.Check(ctx, patientId, domain.AccessResourcePatientAttachments, patientId, purpose); err != nil {
+		return []domain.Attachment{}, err
+	}
+	attachments, err := s.repository.GetByPatientID(ctx, patientId)
+	if err != nil {
+		log.Println("[AttachmentsService][GetByPatientID] error getting attachments by patient", err)
+		return []domain.Attachment{}, err
+	}
+	return attachments, nil
+}
+
+// GetByTurnID is a method that return the attachments of a turn, and logs
+// the read of its patient with its purpose.
+func (s *service) GetByTurnID(ctx context.Context, turnId int, purpose string) ([]domain.Attachment, error) {
+	turn, err := s.turns.GetByID(ctx, turnId)
+	if err != nil {
+		log.Println("[AttachmentsService][GetByTurnID] error getting turn", err)
+		return []domain.Attachment{}, err
+	}
+	if err := s.access.Check(ctx, turn.Patient.Id, domain.AccessResourceTurnAttachments, turnId, purpose); err != nil {
+		return []domain.Attachment{}, err
+	}
+	attachments, err := s.repository.GetByTurnID(ctx, turnId)
+	if err != nil {
+		log.Println("[AttachmentsService][GetByTurnID] error getting attachments by turn", err)
+		return []domain.Attachment{}, err
+	}
+	return attachments, nil
+}
+
+// Open is a method that return an attachment with a reader over its content.
+func (s *service) Open(ctx context.Context, id int, purpose string) (domain.Attachment, io.ReadCloser, error) {
+	attachment, err := s.view(ctx, id, purpose)
+	if err != nil {
+		return domain.Attachment{}, nil, err
+	}
+	content, err := s.store.Get(ctx, attachment.StorageKey)
+	if err != nil {
+		log.Println("[AttachmentsService][Open] error opening attachment content", err)
+		return domain.Attachment{}, nil, err
+	}
+	return attachment, content, nil
+}
+
+// OpenPreview is a method that return a reader over the PNG preview of a radiograph.
+func (s *service) OpenPreview(ctx context.Context, id int, purpose string) (io.ReadCloser, error) {
+	attachment, err := s.view(ctx, id, purpose)
+	if err != nil {
+		return nil, err
+	}
+	if attachment.Radiograph == nil || !attachment.Radiograph.HasPreview {
+		return nil, ErrNoPreview
+	}
+	preview, err := s.store.Get(ctx, attachment.Radiograph.PreviewKey)
+	if err != nil {
+		log.Println("[AttachmentsService][OpenPreview] error opening preview", err)
+		return nil, err
+	}
+	return preview, nil
+}
+
+// Delete is a method that delete an attachment and its content by ID.
+func (s *service) Delete(ctx context.Context, id int) error {
+	attachment, err := s.repository.GetByID(ctx, id)
+	if err != nil {
+		log.Println("[AttachmentsService][Delete] error getting attachment", err)
+		return err
+	}
+	err = s.repository.Delete(ctx, id)
+	if err != nil {
+		log.Println("[AttachmentsService][Delete] error deleting attachment", err)
+		return err
+	}
+	s.discard(ctx, attachment.StorageKey, attachment.Radiograph)
+	return nil
+}
+
+// view returns an attachment by ID once the read of its patient is logged.
+func (s *service) view(ctx context.Context, id int, purpose string) (domain.Attachment, error) {
+	attachment, err := s.repository.GetByID(ctx, id)
+	if err != nil {
+		log.Println("[AttachmentsService][view] error getting attachment", err)
+		return domain.Attachment{}, err
+	}
+	if err := s.access.Check(ctx, attachment.PatientId, domain.AccessResourceAttachment, id, purpose); err != nil {
+		return domain.Attachment{}, err
+	}
+	return attachment, nil
+}
+
+// owner resolves the patient an upload belongs to, checking that the turn,
+// when given, was booked for that same patient.
+func (s *service) owner(ctx context.Context, dto domain.AttachmentDTO) (domain.Patient, error) {
+	if dto.IdTurn <= 0 {
+		return s.patients.GetByID(ctx, dto.IdPatient)
+	}
+	turn, err := s.turns.GetByID(ctx, dto.IdTurn)
+	if err != nil {
+		return domain.Patient{}, err
+	}
+	if dto.IdPatient > 0 && dto.IdPatient != turn.Patient.Id {
+		return domain.Patient{}, ErrTurnMismatch
+	}
+	return turn.Patient, nil
+}
+
+func (s *service) discard(ctx context.Context, key string, radiograph *domain.Radiograph) {
+	keys := []string{key}
+	if radiograph != nil && radiograph.HasPreview {
+		keys = append(keys, radiograph.PreviewKey)
+	}
+	for _, key := range keys {
+		if err := s.store.Delete(ctx, key); err != nil && !errors.Is(err, blob.ErrNotFound) {
+			log.Println("[AttachmentsService][discard] error deleting blob", key, err)
+		}
+	}
+}
+
+func sniffContentType(header []byte) string {
+	if dicom.IsDicom(header) {
+		return dicomMediaType
+	}
+	contentType, _, _ := strings.Cut(http.DetectContentType(header), ";")
+	return contentType
+}
@@ -0,0 +1,16 @@
+package audit
+
+import (
+	"context"
+
+	"github.com/ncondezo/final/internal/domain"
+)
+
+type Repository interface {
+	Append(ctx context.Context, entry domain.AuditEntry) (domain.AuditEntry, error)
+	List(ctx context.Context, filter domain.AuditFilter) ([]domain.AuditEntry, int, error)
+	GetByEntity(ctx context.Context, entity string, entityId int) ([]domain.AuditEntry, error)
+	// Chain calls visit with every entry in order, and returns the hash of
+	// the last entry appended, all read from the same snapshot.
+	Chain(ctx context.Context, visit func(domain.AuditEntry) error) (string, error)
+}
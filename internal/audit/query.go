@@ -0,0 +1,19 @@
+package audit
+
+var (
+	QueryInsertAuditEntry = `INSERT INTO audit_log(actor, action, entity, entity_id, request_id, diff, prev_hash, hash, dateup) VALUES(?,?,?,?,?,?,?,?,?)`
+	// The head row serializes the appends, each one waits for the previous
+	// to commit before reading the hash it chains to.
+	QueryLockAuditHead   = `SELECT hash FROM audit_head WHERE id = 1 FOR UPDATE`
+	QueryGetAuditHead    = `SELECT hash FROM audit_head WHERE id = 1`
+	QueryUpdateAuditHead = `UPDATE audit_head SET hash = ? WHERE id = 1`
+	QueryListAuditLog    = `SELECT id, actor, action, entity, entity_id, request_id, diff, prev_hash, hash, dateup FROM audit_log WHERE ` +
+		auditFilter + ` ORDER BY id DESC LIMIT ? OFFSET ?`
+	QueryCountAuditLog    = `SELECT COUNT(*) FROM audit_log WHERE ` + auditFilter
+	QueryGetAuditChain    = `SELECT id, actor, action, entity, entity_id, request_id, diff, prev_hash, hash, dateup FROM audit_log ORDER BY id`
+	QueryGetAuditByEntity = `SELECT id, actor, action, entity, entity_id, request_id, diff, prev_hash, hash, dateup FROM audit_log ` +
+		`WHERE entity = ? AND entity_id = ? ORDER BY id`
+)
+
+const auditFilter = `(? = '' OR entity = ?) AND (? = 0 OR entity_id = ?) AND (? = '' OR actor = ?) ` +
+	`AND (? = '' OR action = ?) AND (? OR dateup >= ?) AND (? OR dateup < ?)`
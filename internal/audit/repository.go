@@ -0,0 +1,173 @@
+package audit
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+
+	"github.com/ncondezo/final/internal/domain"
+)
+
+var (
+	ErrExecStatement  = errors.New("error exec statement")
+	ErrLastInsertedId = errors.New("error last inserted id")
+)
+
+type repository struct {
+	db *sql.DB
+}
+
+func NewRepository(db *sql.DB) Repository {
+	return &repository{db: db}
+}
+
+// Append is a method that chains an entry to the last one and stores it.
+func (r *repository) Append(ctx context.Context, entry domain.AuditEntry) (domain.AuditEntry, error) {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return domain.AuditEntry{}, ErrExecStatement
+	}
+	defer tx.Rollback()
+
+	if err := tx.QueryRow(QueryLockAuditHead).Scan(&entry.PrevHash); err != nil {
+		return domain.AuditEntry{}, ErrExecStatement
+	}
+	entry.Hash = seal(entry)
+
+	result, err := tx.Exec(QueryInsertAuditEntry,
+		entry.Actor,
+		entry.Action,
+		entry.Entity,
+		entry.EntityId,
+		entry.RequestId,
+		entry.Diff,
+		entry.PrevHash,
+		entry.Hash,
+		entry.DateUp,
+	)
+	if err != nil {
+		return domain.AuditEntry{}, ErrExecStatement
+	}
+	entry.Id, err = result.LastInsertId()
+	if err != nil {
+		return domain.AuditEntry{}, ErrLastInsertedId
+	}
+
+	if _, err := tx.Exec(QueryUpdateAuditHead, entry.Hash); err != nil {
+		return domain.AuditEntry{}, ErrExecStatement
+	}
+	if err := tx.Commit(); err != nil {
+		return domain.AuditEntry{}, ErrExecStatement
+	}
+	return entry, nil
+}
+
+// List is a method that returns a page of entries, the newest first.
+func (r *repository) List(ctx context.Context, filter domain.AuditFilter) ([]domain.AuditEntry, int, error) {
+	args := []interface{}{
+		filter.Entity, filter.Entity,
+		filter.EntityId, filter.EntityId,
+		filter.Actor, filter.Actor,
+		filter.Action, filter.Action,
+		filter.From.IsZero(), filter.From,
+		filter.To.IsZero(), filter.To,
+	}
+
+	var total int
+	if err := r.db.QueryRow(QueryCountAuditLog, args...).Scan(&total); err != nil {
+		return []domain.AuditEntry{}, 0, ErrExecStatement
+	}
+
+	entries := make([]domain.AuditEntry, 0)
+	args = append(args, filter.PageSize, (filter.Page-1)*filter.PageSize)
+	rows, err := r.db.Query(QueryListAuditLog, args...)
+	if err != nil {
+		return []domain.AuditEntry{}, 0, ErrExecStatement
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		entry, err := scanEntry(rows)
+		if err != nil {
+			return []domain.AuditEntry{}, 0, ErrExecStatement
+		}
+		entries = append(entries, entry)
+	}
+
+	return entries, total, nil
+}
+
+// GetByEntity is a method that returns every entry of an entity, the oldest
+// first.
+func (r *repository) GetByEntity(ctx context.Context, entity string, entityId int) ([]domain.AuditEntry, error) {
+	entries := make([]domain.AuditEntry, 0)
+
+	rows, err := r.db.Query(QueryGetAuditByEntity, entity, entityId)
+	if err != nil {
+		return []domain.AuditEntry{}, ErrExecStatement
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		entry, err := scanEntry(rows)
+		if err != nil {
+			return []domain.AuditEntry{}, ErrExecStatement
+		}
+		entries = append(entries, entry)
+	}
+
+	return entries, nil
+}
+
+// Chain is a method that reads the whole log and its head in one read only
+// transaction, so entries appended meanwhile are left out of both.
+func (r *repository) Chain(ctx context.Context, visit func(domain.AuditEntry) error) (string, error) {
+	tx, err := r.db.BeginTx(ctx, &sql.TxOptions{ReadOnly: true})
+	if err != nil {
+		return "", ErrExecStatement
+	}
+	defer tx.Rollback()
+
+	var head string
+	if err := tx.QueryRow(QueryGetAuditHead).Scan(&head); err != nil {
+		return "", ErrExecStatement
+	}
+
+	rows, err := tx.Query(QueryGetAuditChain)
+	if err != nil {
+		return "", ErrExecStatement
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		entry, err := scanEntry(rows)
+		if err != nil {
+			return "", ErrExecStatement
+		}
+		if err := visit(entry); err != nil {
+			return "", err
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return "", ErrExecStatement
+	}
+
+	return head, nil
+}
+
+func scanEntry(rows *sql.Rows) (domain.AuditEntry, error) {
+	var entry domain.AuditEntry
+	err := rows.Scan(
+		&entry.Id,
+		&entry.Actor,
+		&entry.Action,
+		&entry.Entity,
+		&entry.EntityId,
+		&entry.RequestId,
+		&entry.Diff,
+		&entry.PrevHash,
+		&entry.Hash,
+		&entry.DateUp,
+	)
+	return entry, err
+}
@@ -0,0 +1,271 @@
+package audit
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"log"
+	"reflect"
+	"time"
+
+	"github.com/ncondezo/final/internal/domain"
+)
+
+const (
+	DefaultPageSize = 50
+	MaxPageSize     = 200
+	// MinKeyLength is the shortest key accepted to digest personal data.
+	MinKeyLength = 32
+	// systemActor is recorded for changes made outside a request, such as
+	// background jobs.
+	systemActor = "system"
+)
+
+var (
+	ErrInvalidPage  = errors.New("error invalid page")
+	ErrInvalidRange = errors.New("error from must be before to")
+)
+
+// personal are the fields of each entity that hold personal data. Their
+// values are recorded as keyed digests, which show what they changed from
+// and to without keeping the data.
+var personal = map[string]map[string]bool{
+	domain.AuditEntityPatient: {"name": true, "lastname": true, "address": true, "dni": true},
+	domain.AuditEntityDentist: {"name": true, "lastname": true},
+}
+
+// Recorder is what the services that change entities need to audit them.
+type Recorder interface {
+	// Record appends who made a change to an entity and the fields it
+	// changed. before is nil for created entities and after for deleted
+	// ones. It is called once the change is committed, so a failure cannot
+	// undo it: the entry that could not be written is logged in full and
+	// the request still succeeds.
+	Record(ctx context.Context, action string, entity string, entityId int, before interface{}, after interface{})
+}
+
+type Service interface {
+	Recorder
+	List(ctx context.Context, filter domain.AuditFilter) (domain.AuditPage, error)
+	History(ctx context.Context, entity string, entityId int) ([]domain.AuditEntry, error)
+	Verify(ctx context.Context) (domain.AuditVerification, error)
+}
+
+type service struct {
+	repository Repository
+	key        []byte
+}
+
+// NewAuditService returns the audit service. key digests the personal data
+// of the changes, it must stay the same for the digests to be compared.
+func NewAuditService(repository Repository, key []byte) Service {
+	return &service{repository: repository, key: key}
+}
+
+// Record is a method that appends a change to the audit log.
+func (s *service) Record(ctx context.Context, action string, entity string, entityId int, before interface{}, after interface{}) {
+	actor := systemActor
+	if id := domain.ActorFrom(ctx); id != nil {
+		actor = *id
+	}
+	requestId := domain.RequestIdFrom(ctx)
+
+	changes, err := diff(before, after)
+	if err != nil {
+		log.Println("[AuditService][Record] error computing diff", action, entity, entityId, actor, requestId, err)
+		return
+	}
+	s.redact(changes, personal[entity])
+	content, err := json.Marshal(changes)
+	if err != nil {
+		log.Println("[AuditService][Record] error encoding diff", action, entity, entityId, actor, requestId, err)
+		return
+	}
+	_, err = s.repository.Append(ctx, domain.AuditEntry{
+		Actor:     actor,
+		Action:    action,
+		Entity:    entity,
+		EntityId:  entityId,
+		RequestId: requestId,
+		Diff:      string(content),
+		// DATETIME has no fractions of a second, the hash must be made
+		// from the value read back.
+		DateUp: time.Now().Truncate(time.Second),
+	})
+	if err != nil {
+		log.Println("[AuditService][Record] error appending entry", action, entity, entityId, actor, requestId,
+			string(content), err)
+	}
+}
+
+// List is a method that return a page of the audit log, the newest entries
+// first.
+func (s *service) List(ctx context.Context, filter domain.AuditFilter) (domain.AuditPage, error) {
+	if filter.Page == 0 {
+		filter.Page = 1
+	}
+	if filter.PageSize == 0 {
+		filter.PageSize = DefaultPageSize
+	}
+	if filter.Page < 0 || filter.PageSize < 0 || filter.PageSize > MaxPageSize {
+		return domain.AuditPage{}, ErrInvalidPage
+	}
+	if !filter.From.IsZero() && !filter.To.IsZero() && !filter.From.Before(filter.To) {
+		return domain.AuditPage{}, ErrInvalidRange
+	}
+
+	entries, total, err := s.repository.List(ctx, filter)
+	if err != nil {
+		log.Println("[AuditService][List] error listing entries", err)
+		return domain.AuditPage{}, err
+	}
+	decode(entries)
+
+	return domain.AuditPage{
+		Items:      entries,
+		Page:       filter.Page,
+		PageSize:   filter.PageSize,
+		Total:      total,
+		TotalPages: (total + filter.PageSize - 1) / filter.PageSize,
+	}, nil
+}
+
+// History is a method that return every change to an entity, the oldest
+// first.
+func (s *service) History(ctx context.Context, entity string, entityId int) ([]domain.AuditEntry, error) {
+	entries, err := s.repository.GetByEntity(ctx, entity, entityId)
+	if err != nil {
+		log.Println("[AuditService][History] error getting entries", err)
+		return []domain.AuditEntry{}, err
+	}
+	decode(entries)
+	return entries, nil
+}
+
+// Verify is a method that recomputes the hash chain. The log is invalid from
+// the first entry whose hash does not match, or when its last entry is not
+// the last one appended, as happens when entries are removed from the end.
+func (s *service) Verify(ctx context.Context) (domain.AuditVerification, error) {
+	verification := domain.AuditVerification{Valid: true}
+	prev := ""
+	head, err := s.repository.Chain(ctx, func(entry domain.AuditEntry) error {
+		if !verification.Valid {
+			return nil
+		}
+		verification.Entries++
+		if entry.PrevHash != prev || seal(entry) != entry.Hash {
+			verification.Valid = false
+			verification.BrokenAt = &entry.Id
+			return nil
+		}
+		prev = entry.Hash
+		return nil
+	})
+	if err != nil {
+		log.Println("[AuditService][Verify] error reading audit log", err)
+		return domain.AuditVerification{}, err
+	}
+	if verification.Valid && head != prev {
+		verification.Valid = false
+	}
+	if verification.BrokenAt != nil {
+		log.Println("[AuditService][Verify] audit log chain is broken at entry", *verification.BrokenAt)
+	} else if !verification.Valid {
+		log.Println("[AuditService][Verify] audit log head does not match its last entry")
+	}
+	return verification, nil
+}
+
+// decode fills the changes of entries from their diffs.
+func decode(entries []domain.AuditEntry) {
+	for i := range entries {
+		if err := json.Unmarshal([]byte(entries[i].Diff), &entries[i].Changes); err != nil {
+			log.Println("[AuditService][decode] error decoding diff of entry", entries[i].Id, err)
+		}
+	}
+}
+
+// seal returns the hash of entry, chained to the hash of the previous one.
+func seal(entry domain.AuditEntry) string {
+	content, _ := json.Marshal([]interface{}{
+		entry.PrevHash,
+		entry.Actor,
+		entry.Action,
+		entry.Entity,
+		entry.EntityId,
+		entry.RequestId,
+		entry.Diff,
+		entry.DateUp.Unix(),
+	})
+	sum := sha256.Sum256(content)
+	return hex.EncodeToString(sum[:])
+}
+
+// diff returns the JSON fields that differ between before and after.
+func diff(before interface{}, after interface{}) (map[string]domain.AuditChange, error) {
+	old, err := fields(before)
+	if err != nil {
+		return nil, err
+	}
+	current, err := fields(after)
+	if err != nil {
+		return nil, err
+	}
+	changes := map[string]domain.AuditChange{}
+	for name, value := range old {
+		if !reflect.DeepEqual(value, current[name]) {
+			changes[name] = domain.AuditChange{Before: value, After: current[name]}
+		}
+	}
+	for name, value := range current {
+		if _, ok := old[name]; !ok && value != nil {
+			changes[name] = domain.AuditChange{After: value}
+		}
+	}
+	return changes, nil
+}
+
+// redact replaces the values of the changes to the given fields with their
+// digests.
+func (s *service) redact(changes map[string]domain.AuditChange, fields map[string]bool) {
+	for name, change := range changes {
+		if fields[name] {
+			changes[name] = domain.AuditChange{
+				Before:   s.digest(change.Before),
+				After:    s.digest(change.After),
+				Redacted: true,
+			}
+		}
+	}
+}
+
+// digest returns the HMAC-SHA256 of the JSON of value, or nil for no value.
+// The same value always has the same digest, so a known value can be
+// checked against it by who holds the key.
+func (s *service) digest(value interface{}) interface{} {
+	if value == nil {
+		return nil
+	}
+	content, _ := json.Marshal(value)
+	mac := hmac.New(sha256.New, s.key)
+	mac.Write(content)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func fields(value interface{}) (map[string]interface{}, error) {
+	result := map[string]interface{}{}
+	if value == nil {
+		return result, nil
+	}
+	content, err := json.Marshal(value)
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(content, &result); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
@@ -0,0 +1,18 @@
+package contacts
+
+import (
+	"context"
+
+	"github.com/ncondezo/final/internal/domain"
+)
+
+type Repository interface {
+	GetByPatientID(ctx context.Context, patientId int) (domain.PatientContact, error)
+	Save(ctx context.Context, contact domain.PatientContact) (domain.PatientContact, error)
+	AddConsent(ctx context.Context, patientId int, consent domain.ContactConsent) error
+}
+
+// Guardians looks up who is responsible for a dependent patient.
+type Guardians interface {
+	GetGuardians(ctx context.Context, dependentId int) ([]domain.PatientGuardian, error)
+}
@@ -0,0 +1,12 @@
+package contacts
+
+var (
+	QueryGetContactByPatient = `SELECT patients_id, phone, email, preferred_channel, quiet_hours_start, quiet_hours_end, timezone FROM patient_contacts WHERE patients_id = ?`
+	QuerySaveContact         = `INSERT INTO patient_contacts(patients_id, phone, email, preferred_channel, quiet_hours_start, quiet_hours_end, timezone) VALUES(?,?,?,?,?,?,?) ` +
+		`ON DUPLICATE KEY UPDATE phone = VALUES(phone), email = VALUES(email), preferred_channel = VALUES(preferred_channel), ` +
+		`quiet_hours_start = VALUES(quiet_hours_start), quiet_hours_end = VALUES(quiet_hours_end), timezone = VALUES(timezone)`
+	QueryInsertConsent = `INSERT INTO patient_consents(patients_id, channel, opted_in, guardian_id, dateup) VALUES(?,?,?,?,?)`
+	// Consents are append-only, the latest row of each channel is the current one.
+	QueryGetConsentsByPatient = `SELECT channel, opted_in, guardian_id, dateup FROM patient_consents WHERE id IN ` +
+		`(SELECT MAX(id) FROM patient_consents WHERE patients_id = ? GROUP BY channel) ORDER BY channel`
+)
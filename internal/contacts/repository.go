@@ -0,0 +1,118 @@
+package contacts
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+
+	"github.com/ncondezo/final/internal/domain"
+	"github.com/ncondezo/final/internal/patients"
+)
+
+var (
+	ErrPrepareStatement = errors.New("error prepare statement")
+	ErrExecStatement    = errors.New("error exec statement")
+)
+
+type repository struct {
+	db *sql.DB
+}
+
+func NewRepository(db *sql.DB) Repository {
+	return &repository{db: db}
+}
+
+// GetByPatientID is a method that returns the contact details of a patient.
+// A patient without contact details gets an empty contact.
+func (r *repository) GetByPatientID(ctx context.Context, patientId int) (domain.PatientContact, error) {
+	_, err := patients.NewRepository(r.db).GetByID(ctx, patientId)
+	if err != nil {
+		return domain.PatientContact{}, err
+	}
+
+	contact := domain.PatientContact{PatientId: patientId}
+	err = r.db.QueryRow(QueryGetContactByPatient, patientId).Scan(
+		&contact.PatientId,
+		&contact.Phone,
+		&contact.Email,
+		&contact.PreferredChannel,
+		&contact.QuietHoursStart,
+		&contact.QuietHoursEnd,
+		&contact.Timezone,
+	)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return domain.PatientContact{}, ErrExecStatement
+	}
+
+	contact.Consents, err = r.consents(patientId)
+	if err != nil {
+		return domain.PatientContact{}, err
+	}
+
+	return contact, nil
+}
+
+// Save is a method that creates or replaces the contact details of a patient.
+func (r *repository) Save(ctx context.Context, contact domain.PatientContact) (domain.PatientContact, error) {
+	statement, err := r.db.Prepare(QuerySaveContact)
+	if err != nil {
+		return domain.PatientContact{}, ErrPrepareStatement
+	}
+	defer statement.Close()
+
+	_, err = statement.Exec(
+		contact.PatientId,
+		contact.Phone,
+		contact.Email,
+		contact.PreferredChannel,
+		contact.QuietHoursStart,
+		contact.QuietHoursEnd,
+		contact.Timezone,
+	)
+	if err != nil {
+		return domain.PatientContact{}, ErrExecStatement
+	}
+
+	return contact, nil
+}
+
+// AddConsent is a method that records an opt-in or opt-out for a channel.
+func (r *repository) AddConsent(ctx context.Context, patientId int, consent domain.ContactConsent) error {
+	_, err := r.db.Exec(QueryInsertConsent,
+		patientId,
+		consent.Channel,
+		consent.OptedIn,
+		consent.GuardianId,
+		consent.DateUp,
+	)
+	if err != nil {
+		return ErrExecStatement
+	}
+	return nil
+}
+
+func (r *repository) consents(patientId int) ([]domain.ContactConsent, error) {
+	consents := make([]domain.ContactConsent, 0)
+
+	founds, err := r.db.Query(QueryGetConsentsByPatient, patientId)
+	if err != nil {
+		return []domain.ContactConsent{}, ErrExecStatement
+	}
+	defer founds.Close()
+
+	for founds.Next() {
+		var consent domain.ContactConsent
+		var guardianId sql.NullInt64
+		err := founds.Scan(&consent.Channel, &consent.OptedIn, &guardianId, &consent.DateUp)
+		if err != nil {
+			return []domain.ContactConsent{}, ErrExecStatement
+		}
+		if guardianId.Valid {
+			id := int(guardianId.Int64)
+			consent.GuardianId = &id
+		}
+		consents = append(consents, consent)
+	}
+
+	return consents, nil
+}
@@ -0,0 +1,227 @@
+package contacts
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/mail"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/ncondezo/final/internal/access"
+	"github.com/ncondezo/final/internal/domain"
+)
+
+const clockLayout = "15:04"
+
+var (
+	ErrInvalidPhone      = errors.New("error phone must be in E.164 format")
+	ErrInvalidEmail      = errors.New("error invalid email")
+	ErrInvalidChannel    = errors.New("error invalid channel")
+	ErrChannelNoAddress  = errors.New("error preferred channel has no contact address")
+	ErrInvalidQuietHours = errors.New("error quiet hours must be HH:MM")
+	ErrInvalidTimezone   = errors.New("error invalid timezone")
+	ErrGuardianRequired  = errors.New("error consent of a dependent must be signed by a guardian")
+	ErrNotGuardian       = errors.New("error patient is not a guardian of the dependent")
+)
+
+var e164 = regexp.MustCompile(`^\+[1-9][0-9]{6,14}$`)
+
+var channels = map[string]bool{
+	domain.ChannelSMS:      true,
+	domain.ChannelWhatsApp: true,
+	domain.ChannelEmail:    true,
+}
+
+type Service interface {
+	GetByPatientID(ctx context.Context, patientId int) (domain.PatientContact, error)
+	View(ctx context.Context, patientId int, purpose string) (domain.PatientContact, error)
+	Update(ctx context.Context, dto domain.PatientContactDTO, patientId int) (domain.PatientContact, error)
+	SetConsent(ctx context.Context, dto domain.ContactConsentDTO, patientId int, channel string) (domain.PatientContact, error)
+}
+
+type service struct {
+	repository Repository
+	guardians  Guardians
+	access     access.Guard
+}
+
+func NewContactService(repository Repository, guardians Guardians, access access.Guard) Service {
+	return &service{repository: repository, guardians: guardians, access: access}
+}
+
+// GetByPatientID is a method that return the contact details of a patient.
+func (s *service) GetByPatientID(ctx context.Context, patientId int) (domain.PatientContact, error) {
+	contact, err := s.repository.GetByPatientID(ctx, patientId)
+	if err != nil {
+		log.Println("[ContactsService][GetByPatientID] error getting contact", err)
+		return domain.PatientContact{}, err
+	}
+	return contact, nil
+}
+
+// View is a method that return the contact details of a patient to a reader,
+// and logs the read with its purpose.
+func (s *service) View(ctx context.Context, patientId int, purpose string) (domain.PatientContact, error) {
+	contact, err := s.GetByPatientID(ctx, patientId)
+	if err != nil {
+		return domain.PatientContact{}, err
+	}
+	if err := s.access.Check(ctx, patientId, domain.AccessResourceContact, patientId, purpose); err != nil {
+		return domain.PatientContact{}, err
+	}
+	return contact, nil
+}
+
+// Update is a method that validate and replace the contact details of a patient.
+func (s *service) Update(ctx context.Context, dto domain.PatientContactDTO, patientId int) (domain.PatientContact, error) {
+	contact, err := s.GetByPatientID(ctx, patientId)
+	if err != nil {
+		return domain.PatientContact{}, err
+	}
+
+	contact.Phone = strings.ReplaceAll(strings.TrimSpace(dto.Phone), " ", "")
+	contact.Email = strings.ToLower(strings.TrimSpace(dto.Email))
+	contact.PreferredChannel = dto.PreferredChannel
+	contact.QuietHoursStart = dto.QuietHoursStart
+	contact.QuietHoursEnd = dto.QuietHoursEnd
+	contact.Timezone = dto.Timezone
+	if err := validate(contact); err != nil {
+		return domain.PatientContact{}, err
+	}
+
+	_, err = s.repository.Save(ctx, contact)
+	if err != nil {
+		log.Println("[ContactsService][Update] error saving contact", err)
+		return domain.PatientContact{}, err
+	}
+	return contact, nil
+}
+
+// SetConsent is a method that record the opt-in or opt-out of a patient for a channel.
+func (s *service) SetConsent(ctx context.Context, dto domain.ContactConsentDTO, patientId int, channel string) (domain.PatientContact, error) {
+	if !channels[channel] {
+		return domain.PatientContact{}, ErrInvalidChannel
+	}
+	if _, err := s.GetByPatientID(ctx, patientId); err != nil {
+		return domain.PatientContact{}, err
+	}
+	guardianId, err := s.signer(ctx, patientId, dto.IdGuardian)
+	if err != nil {
+		return domain.PatientContact{}, err
+	}
+	consent := domain.ContactConsent{
+		Channel:    channel,
+		OptedIn:    dto.OptedIn,
+		GuardianId: guardianId,
+		DateUp:     time.Now(),
+	}
+	if err := s.repository.AddConsent(ctx, patientId, consent); err != nil {
+		log.Println("[ContactsService][SetConsent] error saving consent", err)
+		return domain.PatientContact{}, err
+	}
+	return s.GetByPatientID(ctx, patientId)
+}
+
+// signer checks who signs a consent. Patients with guardians cannot consent
+// themselves, one of their guardians has to sign for them.
+func (s *service) signer(ctx context.Context, patientId int, guardianId int) (*int, error) {
+	guardians, err := s.guardians.GetGuardians(ctx, patientId)
+	if err != nil {
+		log.Println("[ContactsService][SetConsent] error getting guardians", err)
+		return nil, err
+	}
+	if guardianId == 0 {
+		if len(guardians) > 0 {
+			return nil, ErrGuardianRequired
+		}
+		return nil, nil
+	}
+	for _, guardian := range guardians {
+		if guardian.GuardianId == guardianId {
+			return &guardianId, nil
+		}
+	}
+	return nil, ErrNotGuardian
+}
+
+// Address returns where a message sent through channel should go.
+func Address(contact domain.PatientContact, channel string) string {
+	if channel == domain.ChannelEmail {
+		return contact.Email
+	}
+	return contact.Phone
+}
+
+// OptedIn reports whether the patient currently accepts messages through channel.
+func OptedIn(contact domain.PatientContact, channel string) bool {
+	for _, consent := range contact.Consents {
+		if consent.Channel == channel {
+			return consent.OptedIn
+		}
+	}
+	return false
+}
+
+// QuietUntil returns the end of the patient's quiet hours when now falls
+// inside them, or the zero time when messages can be sent right away.
+func QuietUntil(contact domain.PatientContact, now time.Time) time.Time {
+	start, errStart := time.Parse(clockLayout, contact.QuietHoursStart)
+	end, errEnd := time.Parse(clockLayout, contact.QuietHoursEnd)
+	if errStart != nil || errEnd != nil || start.Equal(end) {
+		return time.Time{}
+	}
+	if location, err := time.LoadLocation(contact.Timezone); err == nil && contact.Timezone != "" {
+		now = now.In(location)
+	}
+
+	minute := now.Hour()*60 + now.Minute()
+	from := start.Hour()*60 + start.Minute()
+	to := end.Hour()*60 + end.Minute()
+	quiet := (from < to && minute >= from && minute < to) ||
+		(from > to && (minute >= from || minute < to))
+	if !quiet {
+		return time.Time{}
+	}
+
+	until := time.Date(now.Year(), now.Month(), now.Day(), end.Hour(), end.Minute(), 0, 0, now.Location())
+	if !until.After(now) {
+		until = until.AddDate(0, 0, 1)
+	}
+	return until
+}
+
+func validate(contact domain.PatientContact) error {
+	if contact.Phone != "" && !e164.MatchString(contact.Phone) {
+		return ErrInvalidPhone
+	}
+	if contact.Email != "" {
+		address, err := mail.ParseAddress(contact.Email)
+		if err != nil || address.Address != contact.Email {
+			return ErrInvalidEmail
+		}
+	}
+	if contact.PreferredChannel != "" {
+		if !channels[contact.PreferredChannel] {
+			return ErrInvalidChannel
+		}
+		if Address(contact, contact.PreferredChannel) == "" {
+			return ErrChannelNoAddress
+		}
+	}
+	if (contact.QuietHoursStart == "") != (contact.QuietHoursEnd == "") {
+		return ErrInvalidQuietHours
+	}
+	for _, clock := range []string{contact.QuietHoursStart, contact.QuietHoursEnd} {
+		if _, err := time.Parse(clockLayout, clock); clock != "" && err != nil {
+			return ErrInvalidQuietHours
+		}
+	}
+	if contact.Timezone != "" {
+		if _, err := time.LoadLocation(contact.Timezone); err != nil {
+			return ErrInvalidTimezone
+		}
+	}
+	return nil
+}
@@ -10,6 +10,14 @@ type Repository interface {
 	Create(ctx context.Context, dentist domain.Dentist) (domain.Dentist, error)
 	GetByID(ctx context.Context, id int) (domain.Dentist, error)
 	Update(ctx context.Context, dentist domain.Dentist, id int) (domain.Dentist, error)
-	Patch(ctx context.Context, dentist domain.Dentist, id int) (domain.Dentist, error)
+	Patch(ctx context.Context, changes map[string]interface{}, id int) error
 	Delete(ctx context.Context, id int) error
+	List(ctx context.Context, filter domain.DentistFilter) ([]domain.Dentist, int, error)
+	SetActive(ctx context.Context, id int, active bool) error
+	CreateSpecialty(ctx context.Context, specialty domain.Specialty) (domain.Specialty, error)
+	GetSpecialty(ctx context.Context, code string) (domain.Specialty, error)
+	GetSpecialties(ctx context.Context) ([]domain.Specialty, error)
+	GetSpecialtiesByDentist(ctx context.Context, dentistId int) ([]domain.Specialty, error)
+	SetSpecialties(ctx context.Context, dentistId int, codes []string) error
+	HasSpecialty(ctx context.Context, dentistId int, code string) (bool, error)
 }
@@ -4,6 +4,25 @@ var (
 	QueryInsertDentist  = `INSERT INTO dentists(name, lastname, registry) VALUES(?,?,?)`
 	QueryGetDentistById = `SELECT * FROM dentists WHERE id = ?`
 	QueryUpdateDentist  = `UPDATE dentists SET name = ?, lastname = ?, registry = ? WHERE id = ?`
-	QueryPatchDentist   = `UPDATE dentists SET registry = ? WHERE id = ?`
+	QueryPatchDentist   = `UPDATE dentists SET %s WHERE id = ?`
 	QueryDeleteDentist  = `DELETE FROM dentists WHERE id = ?`
+	// The list queries take the ORDER BY clause from a whitelist, never from the request.
+	QueryListDentists = `SELECT DISTINCT dentists.id, dentists.name, dentists.lastname, dentists.registry, dentists.active FROM dentists ` +
+		`LEFT JOIN dentist_specialties ON dentist_specialties.dentists_id = dentists.id WHERE ` + dentistFilter +
+		` ORDER BY %s LIMIT ? OFFSET ?`
+	QueryCountDentists = `SELECT COUNT(DISTINCT dentists.id) FROM dentists ` +
+		`LEFT JOIN dentist_specialties ON dentist_specialties.dentists_id = dentists.id WHERE ` + dentistFilter
+	QuerySetDentistActive = `UPDATE dentists SET active = ? WHERE id = ?`
+
+	QueryInsertSpecialty          = `INSERT INTO specialties(code, name) VALUES(?,?)`
+	QueryGetSpecialty             = `SELECT code, name FROM specialties WHERE code = ?`
+	QueryGetSpecialties           = `SELECT code, name FROM specialties ORDER BY name`
+	QueryGetSpecialtiesByDentist  = `SELECT specialties.code, specialties.name FROM dentist_specialties INNER JOIN specialties ON specialties.code = dentist_specialties.specialties_code WHERE dentist_specialties.dentists_id = ? ORDER BY specialties.name`
+	QueryDeleteDentistSpecialties = `DELETE FROM dentist_specialties WHERE dentists_id = ?`
+	QueryInsertDentistSpecialty   = `INSERT IGNORE INTO dentist_specialties(dentists_id, specialties_code) VALUES(?,?)`
+	QueryHasSpecialty             = `SELECT COUNT(*) FROM dentist_specialties WHERE dentists_id = ? AND specialties_code = ?`
 )
+
+const dentistFilter = `(? = '' OR dentist_specialties.specialties_code = ?) ` +
+	`AND (? = '' OR CONCAT(dentists.name, ' ', dentists.lastname) LIKE ? OR dentists.registry LIKE ?) ` +
+	`AND (? OR dentists.active)`
@@ -4,9 +4,12 @@ import (
 	"context"
 	"database/sql"
 	"errors"
+	"fmt"
+	"strings"
 
 	"github.com/go-sql-driver/mysql"
 	"github.com/ncondezo/final/internal/domain"
+	"github.com/ncondezo/final/pkg/patch"
 )
 
 var (
@@ -15,8 +18,13 @@ var (
 	ErrLastInsertedId   = errors.New("error last inserted id")
 	ErrNotFound         = errors.New("error not found dentist")
 	ErrAlreadyExists    = errors.New("error dentist already exists")
+
+	ErrSpecialtyNotFound      = errors.New("error not found specialty")
+	ErrSpecialtyAlreadyExists = errors.New("error specialty already exists")
 )
 
+var likeEscaper = strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`)
+
 type repository struct {
 	db *sql.DB
 }
@@ -71,6 +79,7 @@ func (r *repository) GetByID(ctx context.Context, id int) (domain.Dentist, error
 		&dentist.Name,
 		&dentist.LastName,
 		&dentist.Registration,
+		&dentist.Active,
 	)
 	if err == sql.ErrNoRows {
 		return domain.Dentist{}, ErrNotFound
@@ -104,21 +113,26 @@ func (r *repository) Update(ctx context.Context, dentist domain.Dentist, id int)
 	return dentist, nil
 }
 
-// Patch is a method that updates a dentist registry by ID.
-func (r *repository) Patch(ctx context.Context, dentist domain.Dentist, id int) (domain.Dentist, error) {
-	statement, err := r.db.Prepare(QueryPatchDentist)
+// Patch is a method that updates only the changed columns of a dentist by ID.
+func (r *repository) Patch(ctx context.Context, changes map[string]interface{}, id int) error {
+	var mysqlError *mysql.MySQLError
+
+	assignments, args := patch.SetClause(changes)
+	statement, err := r.db.Prepare(fmt.Sprintf(QueryPatchDentist, assignments))
 	if err != nil {
-		return domain.Dentist{}, ErrPrepareStatement
+		return ErrPrepareStatement
 	}
 	defer statement.Close()
 
-	_, err = statement.Exec(dentist.Registration, id)
-
+	_, err = statement.Exec(append(args, id)...)
+	if errors.As(err, &mysqlError) && mysqlError.Number == 1062 {
+		return ErrAlreadyExists
+	}
 	if err != nil {
-		return domain.Dentist{}, ErrExecStatement
+		return ErrExecStatement
 	}
 
-	return dentist, nil
+	return nil
 }
 
 // Delete is a method that deletes a patient by ID.
@@ -139,3 +153,147 @@ func (r *repository) Delete(ctx context.Context, id int) error {
 
 	return nil
 }
+
+// List is a method that returns one page of the dentists matching a filter,
+// along with the total count of matches.
+func (r *repository) List(ctx context.Context, filter domain.DentistFilter) ([]domain.Dentist, int, error) {
+	like := "%" + likeEscaper.Replace(filter.Q) + "%"
+	args := []interface{}{filter.Specialty, filter.Specialty, filter.Q, like, like, filter.IncludeInactive}
+
+	var total int
+	if err := r.db.QueryRow(QueryCountDentists, args...).Scan(&total); err != nil {
+		return []domain.Dentist{}, 0, ErrExecStatement
+	}
+
+	dentists := make([]domain.Dentist, 0)
+	orderBy := fmt.Sprintf("dentists.%s %s, dentists.id %s", filter.Sort, filter.Order, filter.Order)
+	args = append(args, filter.PageSize, (filter.Page-1)*filter.PageSize)
+	founds, err := r.db.Query(fmt.Sprintf(QueryListDentists, orderBy), args...)
+	if err != nil {
+		return []domain.Dentist{}, 0, ErrExecStatement
+	}
+	defer founds.Close()
+
+	for founds.Next() {
+		var dentist domain.Dentist
+		err := founds.Scan(
+			&dentist.Id,
+			&dentist.Name,
+			&dentist.LastName,
+			&dentist.Registration,
+			&dentist.Active,
+		)
+		if err != nil {
+			return []domain.Dentist{}, 0, ErrExecStatement
+		}
+		dentists = append(dentists, dentist)
+	}
+
+	return dentists, total, nil
+}
+
+// SetActive is a method that activates or deactivates a dentist by ID.
+func (r *repository) SetActive(ctx context.Context, id int, active bool) error {
+	_, err := r.db.Exec(QuerySetDentistActive, active, id)
+	if err != nil {
+		return ErrExecStatement
+	}
+	return nil
+}
+
+// CreateSpecialty is a method that creates a new specialty.
+func (r *repository) CreateSpecialty(ctx context.Context, specialty domain.Specialty) (domain.Specialty, error) {
+	var mysqlError *mysql.MySQLError
+
+	_, err := r.db.Exec(QueryInsertSpecialty, specialty.Code, specialty.Name)
+	if errors.As(err, &mysqlError) && mysqlError.Number == 1062 {
+		return domain.Specialty{}, ErrSpecialtyAlreadyExists
+	}
+	if err != nil {
+		return domain.Specialty{}, ErrExecStatement
+	}
+
+	return specialty, nil
+}
+
+// GetSpecialty is a method that returns a specialty by code.
+func (r *repository) GetSpecialty(ctx context.Context, code string) (domain.Specialty, error) {
+	var specialty domain.Specialty
+	err := r.db.QueryRow(QueryGetSpecialty, code).Scan(&specialty.Code, &specialty.Name)
+	if err == sql.ErrNoRows {
+		return domain.Specialty{}, ErrSpecialtyNotFound
+	}
+	if err != nil {
+		return domain.Specialty{}, ErrExecStatement
+	}
+
+	return specialty, nil
+}
+
+// GetSpecialties is a method that returns every specialty.
+func (r *repository) GetSpecialties(ctx context.Context) ([]domain.Specialty, error) {
+	return r.specialties(QueryGetSpecialties)
+}
+
+// GetSpecialtiesByDentist is a method that returns the specialties of a dentist.
+func (r *repository) GetSpecialtiesByDentist(ctx context.Context, dentistId int) ([]domain.Specialty, error) {
+	return r.specialties(QueryGetSpecialtiesByDentist, dentistId)
+}
+
+// SetSpecialties is a method that replaces the specialties of a dentist.
+func (r *repository) SetSpecialties(ctx context.Context, dentistId int, codes []string) error {
+	for _, code := range codes {
+		if _, err := r.GetSpecialty(ctx, code); err != nil {
+			return err
+		}
+	}
+
+	tx, err := r.db.Begin()
+	if err != nil {
+		return ErrExecStatement
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(QueryDeleteDentistSpecialties, dentistId); err != nil {
+		return ErrExecStatement
+	}
+	for _, code := range codes {
+		if _, err := tx.Exec(QueryInsertDentistSpecialty, dentistId, code); err != nil {
+			return ErrExecStatement
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return ErrExecStatement
+	}
+	return nil
+}
+
+// HasSpecialty is a method that reports whether a dentist has a specialty.
+func (r *repository) HasSpecialty(ctx context.Context, dentistId int, code string) (bool, error) {
+	var count int
+	if err := r.db.QueryRow(QueryHasSpecialty, dentistId, code).Scan(&count); err != nil {
+		return false, ErrExecStatement
+	}
+	return count > 0, nil
+}
+
+func (r *repository) specialties(query string, args ...interface{}) ([]domain.Specialty, error) {
+	specialties := make([]domain.Specialty, 0)
+
+	founds, err := r.db.Query(query, args...)
+	if err != nil {
+		return []domain.Specialty{}, ErrExecStatement
+	}
+	defer founds.Close()
+
+	for founds.Next() {
+		var specialty domain.Specialty
+		if err := founds.Scan(&specialty.Code, &specialty.Name); err != nil {
+			return []domain.Specialty{}, ErrExecStatement
+		}
+		specialties = append(specialties, specialty)
+	}
+
+	return specialties, nil
+}
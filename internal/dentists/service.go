@@ -2,25 +2,59 @@ package dentists
 
 import (
 	"context"
+	"errors"
 	"log"
+	"regexp"
+	"strings"
 
+	"github.com/ncondezo/final/internal/audit"
 	"github.com/ncondezo/final/internal/domain"
+	"github.com/ncondezo/final/pkg/patch"
+	"github.com/ncondezo/final/pkg/web"
 )
 
+const (
+	DefaultPageSize = 20
+	MaxPageSize     = 100
+)
+
+var (
+	ErrInvalidSpecialtyCode = errors.New("error specialty code must be lowercase letters and underscores")
+	ErrInvalidSort          = errors.New("error invalid sort field")
+	ErrInvalidOrder         = errors.New("error order must be asc or desc")
+	ErrInvalidPage          = errors.New("error invalid page")
+)
+
+// Columns the dentist list can be sorted by.
+var sortFields = map[string]bool{
+	"id":       true,
+	"name":     true,
+	"lastname": true,
+	"registry": true,
+}
+
+var specialtyCode = regexp.MustCompile(`^[a-z_]{2,30}$`)
+
 type Service interface {
 	Create(ctx context.Context, dto domain.DentistDTO) (domain.Dentist, error)
 	GetByID(ctx context.Context, id int) (domain.Dentist, error)
 	Update(ctx context.Context, dto domain.DentistDTO, id int) (domain.Dentist, error)
-	Patch(ctx context.Context, dto domain.DentistRegistryDTO, id int) (domain.Dentist, error)
+	Patch(ctx context.Context, document []byte, contentType string, id int) (domain.Dentist, error)
 	Delete(ctx context.Context, id int) error
+	List(ctx context.Context, filter domain.DentistFilter) (domain.DentistPage, error)
+	SetActive(ctx context.Context, dto domain.DentistStatusDTO, id int) (domain.Dentist, error)
+	SetSpecialties(ctx context.Context, dto domain.DentistSpecialtiesDTO, id int) (domain.Dentist, error)
+	CreateSpecialty(ctx context.Context, specialty domain.Specialty) (domain.Specialty, error)
+	GetSpecialties(ctx context.Context) ([]domain.Specialty, error)
 }
 
 type service struct {
 	repository Repository
+	audit      audit.Recorder
 }
 
-func NewDentistService(repository Repository) Service {
-	return &service{repository: repository}
+func NewDentistService(repository Repository, audit audit.Recorder) Service {
+	return &service{repository: repository, audit: audit}
 }
 
 // Create is a method that create a new dentist.
@@ -29,12 +63,14 @@ func (s *service) Create(ctx context.Context, dto domain.DentistDTO) (domain.Den
 		Name:         dto.Name,
 		LastName:     dto.LastName,
 		Registration: dto.Registration,
+		Active:       true,
 	}
 	dentist, err := s.repository.Create(ctx, dentist)
 	if err != nil {
 		log.Println("[DentistService][Create] error creating dentist", err)
 		return domain.Dentist{}, err
 	}
+	s.audit.Record(ctx, domain.AuditActionCreate, domain.AuditEntityDentist, dentist.Id, nil, dentist)
 	return dentist, nil
 }
 
@@ -45,6 +81,11 @@ func (s *service) GetByID(ctx context.Context, id int) (domain.Dentist, error) {
 		log.Println("[DentistService][GetById] error getting dentist", err)
 		return domain.Dentist{}, err
 	}
+	dentist.Specialties, err = s.repository.GetSpecialtiesByDentist(ctx, id)
+	if err != nil {
+		log.Println("[DentistService][GetById] error getting specialties", err)
+		return domain.Dentist{}, err
+	}
 	return dentist, nil
 }
 
@@ -54,6 +95,7 @@ func (s *service) Update(ctx context.Context, dto domain.DentistDTO, id int) (do
 	if err != nil {
 		return domain.Dentist{}, err
 	}
+	before := dentist
 	dentist.Name = dto.Name
 	dentist.LastName = dto.LastName
 	dentist.Registration = dto.Registration
@@ -62,30 +104,191 @@ func (s *service) Update(ctx context.Context, dto domain.DentistDTO, id int) (do
 		log.Println("[DentistService][Update] error updating dentist", err)
 		return domain.Dentist{}, err
 	}
+	s.audit.Record(ctx, domain.AuditActionUpdate, domain.AuditEntityDentist, id, before, dentist)
 	return dentist, nil
 }
 
-// Patch is a method that update a dentist registry by ID.
-func (s *service) Patch(ctx context.Context, dto domain.DentistRegistryDTO, id int) (domain.Dentist, error) {
+// Patch is a method that apply a merge patch or JSON patch to a dentist by ID.
+// Only the fields that end up changed are written.
+func (s *service) Patch(ctx context.Context, document []byte, contentType string, id int) (domain.Dentist, error) {
 	dentist, err := s.GetByID(ctx, id)
 	if err != nil {
 		return domain.Dentist{}, err
 	}
-	dentist.Registration = dto.Registration
-	dentist, err = s.repository.Patch(ctx, dentist, id)
-	if err != nil {
+
+	current := domain.DentistDTO{
+		Name:         dentist.Name,
+		LastName:     dentist.LastName,
+		Registration: dentist.Registration,
+	}
+	var patched domain.DentistDTO
+	if err := patch.Apply(current, document, contentType, &patched); err != nil {
+		return domain.Dentist{}, err
+	}
+	if reason := web.RequestJsonValidation(patched); reason != "" {
+		return domain.Dentist{}, &patch.ResultError{Reason: reason}
+	}
+
+	changes := map[string]interface{}{}
+	if patched.Name != current.Name {
+		changes["name"] = patched.Name
+	}
+	if patched.LastName != current.LastName {
+		changes["lastname"] = patched.LastName
+	}
+	if patched.Registration != current.Registration {
+		changes["registry"] = patched.Registration
+	}
+	if len(changes) == 0 {
+		return dentist, nil
+	}
+
+	if err := s.repository.Patch(ctx, changes, id); err != nil {
 		log.Println("[DentistService][Patch] error patching dentist", err)
 		return domain.Dentist{}, err
 	}
-	return dentist, nil
+	return s.changed(ctx, dentist)
 }
 
 // Delete is a method that delete a dentist by ID.
 func (s *service) Delete(ctx context.Context, id int) error {
-	err := s.repository.Delete(ctx, id)
+	dentist, err := s.GetByID(ctx, id)
+	if err != nil {
+		return err
+	}
+	err = s.repository.Delete(ctx, id)
 	if err != nil {
 		log.Println("[DentistService][Delete] error deleting dentist", err)
 		return err
 	}
+	s.audit.Record(ctx, domain.AuditActionDelete, domain.AuditEntityDentist, id, dentist, nil)
 	return nil
 }
+
+// List is a method that return a page of dentists, optionally filtered by
+// specialty and by a part of the name or registry. Inactive dentists are
+// left out unless the filter asks for them.
+func (s *service) List(ctx context.Context, filter domain.DentistFilter) (domain.DentistPage, error) {
+	filter, err := normalizeFilter(filter)
+	if err != nil {
+		return domain.DentistPage{}, err
+	}
+	if filter.Specialty != "" {
+		if _, err := s.repository.GetSpecialty(ctx, filter.Specialty); err != nil {
+			log.Println("[DentistService][List] error getting specialty", err)
+			return domain.DentistPage{}, err
+		}
+	}
+
+	dentists, total, err := s.repository.List(ctx, filter)
+	if err != nil {
+		log.Println("[DentistService][List] error listing dentists", err)
+		return domain.DentistPage{}, err
+	}
+	for i := range dentists {
+		dentists[i].Specialties, err = s.repository.GetSpecialtiesByDentist(ctx, dentists[i].Id)
+		if err != nil {
+			log.Println("[DentistService][List] error getting specialties", err)
+			return domain.DentistPage{}, err
+		}
+	}
+
+	return domain.DentistPage{
+		Items:      dentists,
+		Page:       filter.Page,
+		PageSize:   filter.PageSize,
+		Total:      total,
+		TotalPages: (total + filter.PageSize - 1) / filter.PageSize,
+	}, nil
+}
+
+// SetActive is a method that activate or deactivate a dentist by ID.
+func (s *service) SetActive(ctx context.Context, dto domain.DentistStatusDTO, id int) (domain.Dentist, error) {
+	dentist, err := s.GetByID(ctx, id)
+	if err != nil {
+		return domain.Dentist{}, err
+	}
+	if err := s.repository.SetActive(ctx, id, dto.Active); err != nil {
+		log.Println("[DentistService][SetActive] error updating dentist", err)
+		return domain.Dentist{}, err
+	}
+	return s.changed(ctx, dentist)
+}
+
+// SetSpecialties is a method that replace the specialties of a dentist.
+func (s *service) SetSpecialties(ctx context.Context, dto domain.DentistSpecialtiesDTO, id int) (domain.Dentist, error) {
+	dentist, err := s.GetByID(ctx, id)
+	if err != nil {
+		return domain.Dentist{}, err
+	}
+	err = s.repository.SetSpecialties(ctx, id, dto.Specialties)
+	if err != nil {
+		log.Println("[DentistService][SetSpecialties] error setting specialties", err)
+		return domain.Dentist{}, err
+	}
+	return s.changed(ctx, dentist)
+}
+
+// changed reads the dentist again after a change and audits it.
+func (s *service) changed(ctx context.Context, before domain.Dentist) (domain.Dentist, error) {
+	dentist, err := s.GetByID(ctx, before.Id)
+	if err != nil {
+		return domain.Dentist{}, err
+	}
+	s.audit.Record(ctx, domain.AuditActionUpdate, domain.AuditEntityDentist, dentist.Id, before, dentist)
+	return dentist, nil
+}
+
+// CreateSpecialty is a method that create a new specialty.
+func (s *service) CreateSpecialty(ctx context.Context, specialty domain.Specialty) (domain.Specialty, error) {
+	if !specialtyCode.MatchString(specialty.Code) {
+		return domain.Specialty{}, ErrInvalidSpecialtyCode
+	}
+	specialty, err := s.repository.CreateSpecialty(ctx, specialty)
+	if err != nil {
+		log.Println("[DentistService][CreateSpecialty] error creating specialty", err)
+		return domain.Specialty{}, err
+	}
+	return specialty, nil
+}
+
+// GetSpecialties is a method that return every specialty.
+func (s *service) GetSpecialties(ctx context.Context) ([]domain.Specialty, error) {
+	specialties, err := s.repository.GetSpecialties(ctx)
+	if err != nil {
+		log.Println("[DentistService][GetSpecialties] error getting specialties", err)
+		return []domain.Specialty{}, err
+	}
+	return specialties, nil
+}
+
+func normalizeFilter(filter domain.DentistFilter) (domain.DentistFilter, error) {
+	filter.Q = strings.TrimSpace(filter.Q)
+	filter.Sort = strings.ToLower(filter.Sort)
+	filter.Order = strings.ToLower(filter.Order)
+
+	if filter.Sort == "" {
+		filter.Sort = "lastname"
+	}
+	if !sortFields[filter.Sort] {
+		return domain.DentistFilter{}, ErrInvalidSort
+	}
+	if filter.Order == "" {
+		filter.Order = "asc"
+	}
+	if filter.Order != "asc" && filter.Order != "desc" {
+		return domain.DentistFilter{}, ErrInvalidOrder
+	}
+
+	if filter.Page == 0 {
+		filter.Page = 1
+	}
+	if filter.PageSize == 0 {
+		filter.PageSize = DefaultPageSize
+	}
+	if filter.Page < 0 || filter.PageSize < 0 || filter.PageSize > MaxPageSize {
+		return domain.DentistFilter{}, ErrInvalidPage
+	}
+
+	return filter, nil
+}
@@ -0,0 +1,84 @@
+package domain
+
+import "time"
+
+// Purposes a reader can declare, in the X-Access-Purpose header, for reading
+// the data of a patient.
+const (
+	PurposeUnspecified    = "unspecified"
+	PurposeTreatment      = "treatment"
+	PurposeScheduling     = "scheduling"
+	PurposeBilling        = "billing"
+	PurposeAdministration = "administration"
+	PurposeEmergency      = "emergency"
+)
+
+var accessPurposes = map[string]bool{
+	PurposeTreatment:      true,
+	PurposeScheduling:     true,
+	PurposeBilling:        true,
+	PurposeAdministration: true,
+	PurposeEmergency:      true,
+}
+
+// IsAccessPurpose reports whether purpose is one a reader can declare.
+func IsAccessPurpose(purpose string) bool {
+	return accessPurposes[purpose]
+}
+
+// Resources whose reads are logged.
+const (
+	AccessResourcePatient      = "patient"
+	AccessResourceTurn         = "turn"
+	AccessResourcePatientTurns = "patient_turns"
+
+	AccessResourceAttachment         = "attachment"
+	AccessResourcePatientAttachments = "patient_attachments"
+	AccessResourceTurnAttachments    = "turn_attachments"
+	AccessResourceContact            = "contact"
+	AccessResourceCoverages          = "coverages"
+	AccessResourceQuote              = "quote"
+	AccessResourceTurnCoverage       = "turn_coverage"
+	AccessResourceFamily             = "family"
+	AccessResourceFamilyTurns        = "family_turns"
+	AccessResourceGuardians          = "guardians"
+)
+
+// PatientAccess records one read of the data of a patient. Denied reads are
+// recorded too, with Granted false.
+type PatientAccess struct {
+	Id         int64     `json:"id"`
+	PatientId  int       `json:"id_patient"`
+	Actor      string    `json:"actor"`
+	Resource   string    `json:"resource"`
+	ResourceId int       `json:"resource_id"`
+	Purpose    string    `json:"purpose"`
+	Granted    bool      `json:"granted"`
+	BreakGlass bool      `json:"break_glass"`
+	RequestId  string    `json:"request_id"`
+	DateUp     time.Time `json:"dateup"`
+}
+
+// BreakGlass lets a dentist read a patient they have no turns with, for a
+// limited time, after stating why. Each one should be reviewed.
+type BreakGlass struct {
+	Id        int       `json:"id"`
+	PatientId int       `json:"id_patient"`
+	Actor     string    `json:"actor"`
+	DentistId int       `json:"id_dentist"`
+	Reason    string    `json:"reason"`
+	ExpiresAt time.Time `json:"expires_at"`
+	DateUp    time.Time `json:"dateup"`
+}
+
+type BreakGlassDTO struct {
+	Reason string `json:"reason"`
+}
+
+// PatientAccessReport is who read the data of a patient, the newest reads
+// first, and the break-the-glass accesses to it.
+type PatientAccessReport struct {
+	PatientId  int             `json:"id_patient"`
+	Accesses   []PatientAccess `json:"accesses"`
+	BreakGlass []BreakGlass    `json:"break_glass"`
+}
@@ -0,0 +1,27 @@
+package domain
+
+import "time"
+
+type ApiKey struct {
+	Id          int        `json:"id"`
+	Name        string     `json:"name"`
+	Prefix      string     `json:"prefix"`
+	Hash        string     `json:"-"`
+	Permissions []string   `json:"permissions"`
+	CreatedBy   *string    `json:"created_by,omitempty"`
+	LastUsedAt  *time.Time `json:"last_used_at,omitempty"`
+	RevokedAt   *time.Time `json:"revoked_at,omitempty"`
+	DateUp      time.Time  `json:"dateup"`
+}
+
+// IssuedApiKey is returned once, when a key is created or rotated. The key
+// itself is not stored and cannot be shown again.
+type IssuedApiKey struct {
+	ApiKey
+	Key string `json:"key"`
+}
+
+type ApiKeyDTO struct {
+	Name        string   `json:"name"`
+	Permissions []string `json:"permissions"`
+}
@@ -0,0 +1,36 @@
+package domain
+
+import "time"
+
+type Attachment struct {
+	Id          int         `json:"id"`
+	PatientId   int         `json:"id_patient"`
+	TurnId      *int        `json:"id_turn,omitempty"`
+	Kind        string      `json:"kind"`
+	Filename    string      `json:"filename"`
+	ContentType string      `json:"content_type"`
+	Size        int64       `json:"size"`
+	Checksum    string      `json:"checksum"`
+	StorageKey  string      `json:"-"`
+	DateUp      time.Time   `json:"dateup"`
+	Radiograph  *Radiograph `json:"radiograph,omitempty"`
+}
+
+type AttachmentDTO struct {
+	Kind      string
+	Filename  string
+	IdPatient int
+	IdTurn    int
+}
+
+type Radiograph struct {
+	Modality        string     `json:"modality"`
+	AcquisitionDate *time.Time `json:"acquisition_date,omitempty"`
+	PatientName     string     `json:"patient_name"`
+	PatientIdentity string     `json:"patient_identity"`
+	Region          string     `json:"region"`
+	Rows            int        `json:"rows"`
+	Columns         int        `json:"columns"`
+	HasPreview      bool       `json:"has_preview"`
+	PreviewKey      string     `json:"-"`
+}
@@ -0,0 +1,89 @@
+package domain
+
+import (
+	"context"
+	"time"
+)
+
+const (
+	AuditActionCreate = "create"
+	AuditActionUpdate = "update"
+	AuditActionDelete = "delete"
+	AuditActionMerge  = "merge"
+	AuditActionErase  = "erase"
+)
+
+const (
+	AuditEntityPatient = "patient"
+	AuditEntityDentist = "dentist"
+	AuditEntityTurn    = "turn"
+)
+
+// AuditEntry records one change to an entity. Every entry is chained to the
+// previous one by its Hash, so editing or removing an entry breaks the chain
+// from there on.
+type AuditEntry struct {
+	Id        int64     `json:"id"`
+	Actor     string    `json:"actor"`
+	Action    string    `json:"action"`
+	Entity    string    `json:"entity"`
+	EntityId  int       `json:"entity_id"`
+	RequestId string    `json:"request_id"`
+	Diff      string    `json:"-"`
+	PrevHash  string    `json:"prev_hash"`
+	Hash      string    `json:"hash"`
+	DateUp    time.Time `json:"dateup"`
+	// Changes is Diff decoded, for the responses.
+	Changes map[string]AuditChange `json:"changes"`
+}
+
+// AuditChange is the value of a field before and after a change. Before is
+// null for created entities and After for deleted ones. Personal data is
+// never kept, the log cannot be erased: its changes are Redacted and carry
+// keyed digests of the values instead.
+type AuditChange struct {
+	Before   interface{} `json:"before"`
+	After    interface{} `json:"after"`
+	Redacted bool        `json:"redacted,omitempty"`
+}
+
+type AuditFilter struct {
+	Entity   string
+	EntityId int
+	Actor    string
+	Action   string
+	From     time.Time
+	To       time.Time
+	Page     int
+	PageSize int
+}
+
+type AuditPage struct {
+	Items      []AuditEntry `json:"items"`
+	Page       int          `json:"page"`
+	PageSize   int          `json:"page_size"`
+	Total      int          `json:"total"`
+	TotalPages int          `json:"total_pages"`
+}
+
+// AuditVerification is the result of checking the hash chain. BrokenAt is
+// the first entry that does not match, when Valid is false.
+type AuditVerification struct {
+	Valid    bool   `json:"valid"`
+	Entries  int    `json:"entries"`
+	BrokenAt *int64 `json:"broken_at,omitempty"`
+}
+
+type requestIdKey struct{}
+
+// ContextWithRequestId returns a copy of ctx that carries the id of the
+// request, see middleware.RequestId.
+func ContextWithRequestId(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestIdKey{}, id)
+}
+
+// RequestIdFrom returns the id of the request of ctx, or "" outside requests.
+func RequestIdFrom(ctx context.Context) string {
+	id, _ := ctx.Value(requestIdKey{}).(string)
+	return id
+}
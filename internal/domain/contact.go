@@ -0,0 +1,41 @@
+package domain
+
+import "time"
+
+const (
+	ChannelSMS      = "sms"
+	ChannelWhatsApp = "whatsapp"
+	ChannelEmail    = "email"
+)
+
+type PatientContact struct {
+	PatientId        int              `json:"id_patient"`
+	Phone            string           `json:"phone"`
+	Email            string           `json:"email"`
+	PreferredChannel string           `json:"preferred_channel"`
+	QuietHoursStart  string           `json:"quiet_hours_start"`
+	QuietHoursEnd    string           `json:"quiet_hours_end"`
+	Timezone         string           `json:"timezone"`
+	Consents         []ContactConsent `json:"consents"`
+}
+
+type ContactConsent struct {
+	Channel    string    `json:"channel"`
+	OptedIn    bool      `json:"opted_in"`
+	GuardianId *int      `json:"id_guardian,omitempty"`
+	DateUp     time.Time `json:"dateup"`
+}
+
+type PatientContactDTO struct {
+	Phone            string `json:"phone"`
+	Email            string `json:"email"`
+	PreferredChannel string `json:"preferred_channel"`
+	QuietHoursStart  string `json:"quiet_hours_start"`
+	QuietHoursEnd    string `json:"quiet_hours_end"`
+	Timezone         string `json:"timezone"`
+}
+
+type ContactConsentDTO struct {
+	OptedIn    bool `json:"opted_in"`
+	IdGuardian int  `json:"id_guardian" optional:"true"`
+}
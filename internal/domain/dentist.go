@@ -1,10 +1,12 @@
 package domain
 
 type Dentist struct {
-	Id           int    `json:"id"`
-	Name         string `json:"name"`
-	LastName     string `json:"lastname"`
-	Registration string `json:"registry"`
+	Id           int         `json:"id"`
+	Name         string      `json:"name"`
+	LastName     string      `json:"lastname"`
+	Registration string      `json:"registry"`
+	Active       bool        `json:"active"`
+	Specialties  []Specialty `json:"specialties,omitempty"`
 }
 
 type DentistDTO struct {
@@ -13,6 +15,33 @@ type DentistDTO struct {
 	Registration string `json:"registry"`
 }
 
-type DentistRegistryDTO struct {
-	Registration string `json:"registry"`
+type Specialty struct {
+	Code string `json:"code"`
+	Name string `json:"name"`
+}
+
+type DentistSpecialtiesDTO struct {
+	Specialties []string `json:"specialties"`
+}
+
+type DentistStatusDTO struct {
+	Active bool `json:"active"`
+}
+
+type DentistFilter struct {
+	Specialty       string
+	Q               string
+	IncludeInactive bool
+	Sort            string
+	Order           string
+	Page            int
+	PageSize        int
+}
+
+type DentistPage struct {
+	Items      []Dentist `json:"items"`
+	Page       int       `json:"page"`
+	PageSize   int       `json:"page_size"`
+	Total      int       `json:"total"`
+	TotalPages int       `json:"total_pages"`
 }
@@ -0,0 +1,35 @@
+package domain
+
+import "time"
+
+const (
+	RelationshipParent        = "parent"
+	RelationshipLegalGuardian = "legal_guardian"
+	RelationshipRelative      = "relative"
+)
+
+type PatientGuardian struct {
+	Id           int       `json:"id"`
+	GuardianId   int       `json:"id_guardian"`
+	DependentId  int       `json:"id_dependent"`
+	Relationship string    `json:"relationship"`
+	Notify       bool      `json:"notify"`
+	DateUp       time.Time `json:"dateup"`
+}
+
+type PatientGuardianDTO struct {
+	IdDependent  int    `json:"id_dependent"`
+	Relationship string `json:"relationship"`
+	Notify       bool   `json:"notify"`
+}
+
+type FamilyMember struct {
+	Patient      Patient `json:"patient"`
+	Relationship string  `json:"relationship"`
+	Notify       bool    `json:"notify"`
+}
+
+type Family struct {
+	Guardian   Patient        `json:"guardian"`
+	Dependents []FamilyMember `json:"dependents"`
+}
@@ -0,0 +1,87 @@
+package domain
+
+import "time"
+
+// Procedure is also the appointment type of a turn. When it names a
+// specialty only dentists with that specialty can perform it.
+type Procedure struct {
+	Code      string `json:"code"`
+	Name      string `json:"name"`
+	Price     Money  `json:"price"`
+	Specialty string `json:"specialty,omitempty" optional:"true"`
+}
+
+type Insurer struct {
+	Id   int    `json:"id"`
+	Name string `json:"name"`
+}
+
+type InsurerDTO struct {
+	Name string `json:"name"`
+}
+
+type InsurancePlan struct {
+	Id        int    `json:"id"`
+	InsurerId int    `json:"id_insurer"`
+	Name      string `json:"name"`
+}
+
+type InsurancePlanDTO struct {
+	Name string `json:"name"`
+}
+
+type CoverageRule struct {
+	Id          int     `json:"id"`
+	PlanId      int     `json:"id_plan"`
+	Procedure   string  `json:"procedure"`
+	Percentage  float64 `json:"percentage"`
+	Copay       Money   `json:"copay"`
+	AnnualLimit int     `json:"annual_limit"`
+	AnnualCap   Money   `json:"annual_cap"`
+}
+
+type CoverageRuleDTO struct {
+	Procedure   string  `json:"procedure"`
+	Percentage  float64 `json:"percentage"`
+	Copay       Money   `json:"copay" optional:"true"`
+	AnnualLimit int     `json:"annual_limit" optional:"true"`
+	AnnualCap   Money   `json:"annual_cap" optional:"true"`
+}
+
+type PatientCoverage struct {
+	Id              int           `json:"id"`
+	PatientId       int           `json:"id_patient"`
+	Plan            InsurancePlan `json:"plan"`
+	AffiliateNumber string        `json:"affiliate_number"`
+	ValidFrom       time.Time     `json:"valid_from"`
+	ValidTo         time.Time     `json:"valid_to"`
+}
+
+type PatientCoverageDTO struct {
+	IdPlan          int       `json:"id_plan"`
+	AffiliateNumber string    `json:"affiliate_number"`
+	ValidFrom       time.Time `json:"valid_from"`
+	ValidTo         time.Time `json:"valid_to"`
+}
+
+type Eligibility struct {
+	Eligible bool   `json:"eligible"`
+	Reason   string `json:"reason,omitempty"`
+}
+
+type CoverageUsage struct {
+	Count   int
+	Covered Money
+}
+
+type CoverageQuote struct {
+	Procedure       string `json:"procedure"`
+	Price           Money  `json:"price"`
+	Covered         bool   `json:"covered"`
+	Reason          string `json:"reason,omitempty"`
+	CoverageId      int    `json:"id_coverage,omitempty"`
+	AffiliateNumber string `json:"affiliate_number,omitempty"`
+	InsurerAmount   Money  `json:"insurer_amount"`
+	Copay           Money  `json:"copay"`
+	PatientAmount   Money  `json:"patient_amount"`
+}
@@ -0,0 +1,94 @@
+package domain
+
+import (
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+var ErrInvalidMoney = errors.New("error invalid amount of money")
+
+var moneyFormat = regexp.MustCompile(`^-?[0-9]+(\.[0-9]{1,2})?$`)
+
+// Money is an amount in cents. It is written in JSON as a decimal number
+// with two decimals and read from DECIMAL columns without going through
+// float64, so amounts are never rounded on the way.
+type Money int64
+
+// ParseMoney reads an amount written as a decimal number with up to two
+// decimals, such as "1500" or "1500.5".
+func ParseMoney(value string) (Money, error) {
+	if !moneyFormat.MatchString(value) {
+		return 0, ErrInvalidMoney
+	}
+	negative := strings.HasPrefix(value, "-")
+	units, fraction, _ := strings.Cut(strings.TrimPrefix(value, "-"), ".")
+	fraction = (fraction + "00")[:2]
+
+	whole, err := strconv.ParseInt(units, 10, 64)
+	if err != nil || whole > math.MaxInt64/100-1 {
+		return 0, ErrInvalidMoney
+	}
+	cents, _ := strconv.ParseInt(fraction, 10, 64)
+	amount := Money(whole*100 + cents)
+	if negative {
+		amount = -amount
+	}
+	return amount, nil
+}
+
+func (m Money) String() string {
+	sign := ""
+	cents := int64(m)
+	if cents < 0 {
+		sign = "-"
+		cents = -cents
+	}
+	return fmt.Sprintf("%s%d.%02d", sign, cents/100, cents%100)
+}
+
+func (m Money) MarshalJSON() ([]byte, error) {
+	return []byte(m.String()), nil
+}
+
+// UnmarshalJSON reads a JSON number, or a string holding one.
+func (m *Money) UnmarshalJSON(data []byte) error {
+	value := strings.Trim(string(data), `"`)
+	if value == "null" {
+		return nil
+	}
+	amount, err := ParseMoney(value)
+	if err != nil {
+		return err
+	}
+	*m = amount
+	return nil
+}
+
+// Scan reads a DECIMAL column, which the driver returns as text.
+func (m *Money) Scan(src interface{}) error {
+	switch value := src.(type) {
+	case nil:
+		*m = 0
+	case int64:
+		*m = Money(value * 100)
+	case []byte:
+		amount, err := ParseMoney(string(value))
+		if err != nil {
+			return err
+		}
+		*m = amount
+	default:
+		return fmt.Errorf("%w: cannot scan %T", ErrInvalidMoney, src)
+	}
+	return nil
+}
+
+// Value writes the amount as the decimal text DECIMAL columns take.
+func (m Money) Value() (driver.Value, error) {
+	return m.String(), nil
+}
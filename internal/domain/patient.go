@@ -18,6 +18,22 @@ type PatientDTO struct {
 	Dni      string `json:"dni"`
 }
 
-type PatientDniDTO struct {
-	Dni string `json:"dni"`
+type PatientDuplicate struct {
+	Patient   Patient   `json:"patient"`
+	Duplicate Patient   `json:"duplicate"`
+	Score     float64   `json:"score"`
+	Reasons   []string  `json:"reasons"`
+	DateUp    time.Time `json:"dateup"`
+}
+
+type PatientMerge struct {
+	Id         int       `json:"id"`
+	SurvivorId int       `json:"id_survivor"`
+	MergedId   int       `json:"id_merged"`
+	Snapshot   string    `json:"snapshot"`
+	DateUp     time.Time `json:"dateup"`
+}
+
+type PatientMergeDTO struct {
+	IdDuplicate int `json:"id_duplicate"`
 }
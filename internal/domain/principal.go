@@ -0,0 +1,68 @@
+package domain
+
+import (
+	"context"
+	"fmt"
+)
+
+// Principal is the authenticated user acting in a request. Machine clients
+// authenticated with an api key have no roles, only the Permissions of the key.
+type Principal struct {
+	UserId      string   `json:"id_user"`
+	Email       string   `json:"email"`
+	Roles       []string `json:"roles"`
+	Permissions []string `json:"permissions,omitempty"`
+	DentistId   int      `json:"id_dentist,omitempty"`
+	PatientId   int      `json:"id_patient,omitempty"`
+	Tenant      string   `json:"tenant,omitempty"`
+}
+
+type principalKey struct{}
+
+// ContextWithPrincipal returns a copy of ctx that carries principal.
+func ContextWithPrincipal(ctx context.Context, principal Principal) context.Context {
+	return context.WithValue(ctx, principalKey{}, principal)
+}
+
+// PrincipalFrom returns the principal of ctx. ok is false for anonymous
+// requests and background jobs.
+func PrincipalFrom(ctx context.Context) (principal Principal, ok bool) {
+	principal, ok = ctx.Value(principalKey{}).(Principal)
+	return principal, ok
+}
+
+// ActorFrom returns the user id to record in created_by and updated_by, or
+// nil when nobody is logged in.
+func ActorFrom(ctx context.Context) *string {
+	principal, ok := PrincipalFrom(ctx)
+	if !ok || principal.UserId == "" {
+		return nil
+	}
+	return &principal.UserId
+}
+
+func (p Principal) Can(permission string) bool {
+	for _, granted := range p.Permissions {
+		if granted == permission {
+			return true
+		}
+	}
+	return HasPermission(p.Roles, permission)
+}
+
+func (p Principal) HasRole(role string) bool {
+	for _, granted := range p.Roles {
+		if granted == role {
+			return true
+		}
+	}
+	return false
+}
+
+// String identifies the principal in log lines.
+func (p Principal) String() string {
+	if p.Tenant != "" {
+		return fmt.Sprintf("user=%s email=%s tenant=%s", p.UserId, p.Email, p.Tenant)
+	}
+	return fmt.Sprintf("user=%s email=%s", p.UserId, p.Email)
+}
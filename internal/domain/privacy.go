@@ -0,0 +1,26 @@
+package domain
+
+import "time"
+
+// PatientExport is everything held about a patient: its records, the
+// changes made to them and who read them.
+type PatientExport struct {
+	ExportedAt  time.Time         `json:"exported_at"`
+	Patient     Patient           `json:"patient"`
+	Contact     PatientContact    `json:"contact"`
+	Guardians   []PatientGuardian `json:"guardians"`
+	Dependents  []FamilyMember    `json:"dependents"`
+	Coverages   []PatientCoverage `json:"coverages"`
+	Turns       []Turn            `json:"turns"`
+	Attachments []Attachment      `json:"attachments"`
+	Merges      []PatientMerge    `json:"merges"`
+	AuditLog    []AuditEntry      `json:"audit_log"`
+	Accesses    []PatientAccess   `json:"accesses"`
+	BreakGlass  []BreakGlass      `json:"break_glass"`
+}
+
+type PatientErasure struct {
+	PatientId   int       `json:"id_patient"`
+	StorageKeys []string  `json:"-"`
+	DateUp      time.Time `json:"dateup"`
+}
@@ -0,0 +1,76 @@
+package domain
+
+const (
+	RoleAdmin        = "admin"
+	RoleReceptionist = "receptionist"
+	RoleDentist      = "dentist"
+	RolePatient      = "patient"
+)
+
+const (
+	PermissionUsersManage    = "users:manage"
+	PermissionDentistsWrite  = "dentists:write"
+	PermissionPatientsRead   = "patients:read"
+	PermissionPatientsWrite  = "patients:write"
+	PermissionPatientsManage = "patients:manage"
+	PermissionTurnsWrite     = "turns:write"
+	PermissionRecordsRead    = "records:read"
+	PermissionRecordsWrite   = "records:write"
+	PermissionInsuranceWrite = "insurance:write"
+	PermissionAgendaRead     = "agenda:read"
+	PermissionApiKeysManage  = "apikeys:manage"
+	PermissionAuditRead      = "audit:read"
+	PermissionFamilyRead     = "family:read"
+	PermissionFamilyWrite    = "family:write"
+)
+
+// RolePermissions lists what each role is allowed to do. Merging, exporting
+// and erasing patients, and reading the audit log, is kept to admins.
+// Patients only reach the family of the patient their user is linked to.
+var RolePermissions = map[string][]string{
+	RoleAdmin: {
+		PermissionUsersManage, PermissionDentistsWrite, PermissionPatientsRead, PermissionPatientsWrite,
+		PermissionPatientsManage, PermissionTurnsWrite, PermissionRecordsRead, PermissionRecordsWrite,
+		PermissionInsuranceWrite, PermissionApiKeysManage, PermissionAuditRead,
+	},
+	RoleReceptionist: {
+		PermissionPatientsRead, PermissionPatientsWrite, PermissionTurnsWrite, PermissionRecordsRead,
+		PermissionRecordsWrite, PermissionInsuranceWrite,
+	},
+	RoleDentist: {
+		PermissionPatientsRead, PermissionTurnsWrite, PermissionRecordsRead, PermissionRecordsWrite,
+		PermissionAgendaRead,
+	},
+	RolePatient: {
+		PermissionFamilyRead, PermissionFamilyWrite,
+	},
+}
+
+// IsPermission reports whether permission is one of the permissions roles
+// can grant.
+func IsPermission(permission string) bool {
+	for _, granted := range RolePermissions {
+		for _, known := range granted {
+			if known == permission {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// HasPermission reports whether any of roles grants permission.
+func HasPermission(roles []string, permission string) bool {
+	for _, role := range roles {
+		for _, granted := range RolePermissions[role] {
+			if granted == permission {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+type UserRolesDTO struct {
+	Roles []string `json:"roles"`
+}
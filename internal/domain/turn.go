@@ -3,11 +3,15 @@ package domain
 import "time"
 
 type Turn struct {
-	Id          int       `json:"id"`
-	Date        time.Time `json:"date"`
-	Description string    `json:"description"`
-	Patient     Patient   `json:"patient"`
-	Dentist     Dentist   `json:"dentist"`
+	Id          int            `json:"id"`
+	Date        time.Time      `json:"date"`
+	Description string         `json:"description"`
+	Procedure   string         `json:"procedure,omitempty"`
+	Patient     Patient        `json:"patient"`
+	Dentist     Dentist        `json:"dentist"`
+	Coverage    *CoverageQuote `json:"coverage,omitempty"`
+	CreatedBy   *string        `json:"created_by,omitempty"`
+	UpdatedBy   *string        `json:"updated_by,omitempty"`
 }
 
 type TurnDTO struct {
@@ -15,4 +19,5 @@ type TurnDTO struct {
 	Description string    `json:"description"`
 	IdPatient   int       `json:"id_patient"`
 	IdDentist   int       `json:"id_dentist"`
+	Procedure   string    `json:"procedure" optional:"true"`
 }
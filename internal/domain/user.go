@@ -1,28 +1,221 @@
 package domain
 
-import "github.com/golang-jwt/jwt"
+import (
+	"time"
+
+	"github.com/golang-jwt/jwt"
+)
 
 type User struct {
-	Id       string `json:"id"`
-	Name     string `json:"name"`
-	Surname  string `json:"surname"`
-	Email    string `json:"email"`
-	Password string `json:"-"`
+	Id        string   `json:"id"`
+	Name      string   `json:"name"`
+	Surname   string   `json:"surname"`
+	Email     string   `json:"email"`
+	Password  string   `json:"-"`
+	DentistId *int     `json:"id_dentist,omitempty"`
+	PatientId *int     `json:"id_patient,omitempty"`
+	Roles     []string `json:"roles"`
+	Verified  bool     `json:"verified"`
 }
 
 type Claim struct {
-	Email string `json:"email"`
+	Email     string   `json:"email"`
+	DentistId int      `json:"id_dentist,omitempty"`
+	PatientId int      `json:"id_patient,omitempty"`
+	Roles     []string `json:"roles"`
+	Tenant    string   `json:"tenant,omitempty"`
 	jwt.StandardClaims
 }
 
+// Principal is who the claim authenticates.
+func (c *Claim) Principal() Principal {
+	return Principal{
+		UserId:    c.Subject,
+		Email:     c.Email,
+		Roles:     c.Roles,
+		DentistId: c.DentistId,
+		PatientId: c.PatientId,
+		Tenant:    c.Tenant,
+	}
+}
+
 type LoginDTO struct {
 	Email    string `json:"email"`
 	Password string `json:"password"`
 }
 
 type SignupDTO struct {
-	Name     string `json:"name"`
-	Surname  string `json:"surname"`
-	Email    string `json:"email"`
+	Name            string `json:"name"`
+	Surname         string `json:"surname"`
+	Email           string `json:"email"`
+	Password        string `json:"password"`
+	InvitationToken string `json:"invitation_token" optional:"true"`
+}
+
+type UserDentistDTO struct {
+	IdDentist int `json:"id_dentist"`
+}
+
+type UserPatientDTO struct {
+	IdPatient int `json:"id_patient"`
+}
+
+type RefreshToken struct {
+	Id            string
+	UserId        string
+	FamilyId      string
+	TokenHash     string
+	AccessJti     string
+	AccessExpires time.Time
+	ExpiresAt     time.Time
+	UsedAt        *time.Time
+	RevokedAt     *time.Time
+}
+
+type RefreshDTO struct {
+	RefreshToken string `json:"refresh_token"`
+}
+
+type PasswordReset struct {
+	Id        string
+	UserId    string
+	TokenHash string
+	ExpiresAt time.Time
+	UsedAt    *time.Time
+}
+
+type ForgotPasswordDTO struct {
+	Email string `json:"email"`
+}
+
+type ResetPasswordDTO struct {
+	Token    string `json:"token"`
 	Password string `json:"password"`
 }
+
+type Invitation struct {
+	Id         string     `json:"id"`
+	Email      string     `json:"email"`
+	Role       string     `json:"role"`
+	TokenHash  string     `json:"-"`
+	InvitedBy  *string    `json:"invited_by,omitempty"`
+	ExpiresAt  time.Time  `json:"expires_at"`
+	AcceptedAt *time.Time `json:"accepted_at,omitempty"`
+	DateUp     time.Time  `json:"dateup"`
+}
+
+type InvitationDTO struct {
+	Email string `json:"email"`
+	Role  string `json:"role"`
+}
+
+type EmailVerification struct {
+	Id        string
+	UserId    string
+	TokenHash string
+	ExpiresAt time.Time
+	UsedAt    *time.Time
+}
+
+type VerifyEmailDTO struct {
+	Token string `json:"token"`
+}
+
+type ResendVerificationDTO struct {
+	Email string `json:"email"`
+}
+
+const (
+	AuthEventLoginFailed     = "login_failed"
+	AuthEventLoginSucceeded  = "login_succeeded"
+	AuthEventAccountLocked   = "account_locked"
+	AuthEventIpLocked        = "ip_locked"
+	AuthEventAccountUnlocked = "account_unlocked"
+)
+
+type Throttle struct {
+	Key          string
+	Failures     int
+	LastFailedAt time.Time
+	LockedUntil  *time.Time
+}
+
+type AuthEvent struct {
+	Event  string
+	Email  string
+	Ip     string
+	Actor  *string
+	DateUp time.Time
+}
+
+const (
+	AuthEventMfaFailed        = "mfa_failed"
+	AuthEventMfaSucceeded     = "mfa_succeeded"
+	AuthEventRecoveryCodeUsed = "recovery_code_used"
+	AuthEventMfaEnabled       = "mfa_enabled"
+	AuthEventMfaDisabled      = "mfa_disabled"
+)
+
+// Totp is the authenticator app of a user. It protects logins once confirmed
+// with a first code.
+type Totp struct {
+	UserId      string
+	Secret      string
+	ConfirmedAt *time.Time
+	LastStep    int64
+}
+
+// MfaChallenge is the second step of a login whose password was right. When
+// Enroll is set the user must first set up an authenticator app.
+type MfaChallenge struct {
+	Id        string
+	UserId    string
+	TokenHash string
+	Enroll    bool
+	Attempts  int
+	ExpiresAt time.Time
+	UsedAt    *time.Time
+}
+
+type MfaEnrollment struct {
+	Secret string `json:"secret"`
+	URI    string `json:"uri"`
+	QRCode string `json:"qr_code"`
+}
+
+type MfaChallengeDTO struct {
+	MfaToken string `json:"mfa_token"`
+}
+
+type MfaVerifyDTO struct {
+	MfaToken string `json:"mfa_token"`
+	Code     string `json:"code"`
+}
+
+type MfaCodeDTO struct {
+	Code string `json:"code"`
+}
+
+type MfaPolicyDTO struct {
+	Roles []string `json:"roles"`
+}
+
+type RecoveryCodes struct {
+	Codes []string `json:"recovery_codes"`
+}
+
+// SsoState is a login started at the identity provider, kept until it
+// redirects back.
+type SsoState struct {
+	Id        string
+	StateHash string
+	Nonce     string
+	Verifier  string
+	ExpiresAt time.Time
+	UsedAt    *time.Time
+}
+
+type SsoCallbackDTO struct {
+	Code  string `form:"code"`
+	State string `form:"state"`
+}
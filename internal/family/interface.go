@@ -0,0 +1,14 @@
+package family
+
+import (
+	"context"
+
+	"github.com/ncondezo/final/internal/domain"
+)
+
+type Repository interface {
+	Create(ctx context.Context, guardian domain.PatientGuardian) (domain.PatientGuardian, error)
+	GetGuardians(ctx context.Context, dependentId int) ([]domain.PatientGuardian, error)
+	GetDependents(ctx context.Context, guardianId int) ([]domain.FamilyMember, error)
+	Delete(ctx context.Context, guardianId int, dependentId int) error
+}
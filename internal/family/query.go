@@ -0,0 +1,10 @@
+package family
+
+var (
+	QueryInsertGuardian        = `INSERT INTO patient_guardians(guardian_id, dependent_id, relationship, notify, dateup) VALUES(?,?,?,?,?)`
+	QueryGetGuardiansByPatient = `SELECT id, guardian_id, dependent_id, relationship, notify, dateup FROM patient_guardians WHERE dependent_id = ? ORDER BY id`
+	QueryGetDependents         = `SELECT patients.id, patients.name, patients.lastname, patients.address, patients.dni, patients.dateup, ` +
+		`patient_guardians.relationship, patient_guardians.notify FROM patient_guardians ` +
+		`INNER JOIN patients ON patients.id = patient_guardians.dependent_id WHERE patient_guardians.guardian_id = ? ORDER BY patients.id`
+	QueryDeleteGuardian = `DELETE FROM patient_guardians WHERE guardian_id = ? AND dependent_id = ?`
+)
@@ -0,0 +1,145 @@
+package family
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/ncondezo/final/internal/domain"
+	"github.com/ncondezo/final/internal/patients"
+)
+
+var (
+	ErrPrepareStatement = errors.New("error prepare statement")
+	ErrExecStatement    = errors.New("error exec statement")
+	ErrLastInsertedId   = errors.New("error last inserted id")
+	ErrNotFound         = errors.New("error not found guardian relation")
+	ErrAlreadyExists    = errors.New("error guardian relation already exists")
+)
+
+type repository struct {
+	db *sql.DB
+}
+
+func NewRepository(db *sql.DB) Repository {
+	return &repository{db: db}
+}
+
+// Create is a method that links a guardian to a dependent patient.
+func (r *repository) Create(ctx context.Context, guardian domain.PatientGuardian) (domain.PatientGuardian, error) {
+	patientRepository := patients.NewRepository(r.db)
+	if _, err := patientRepository.GetByID(ctx, guardian.GuardianId); err != nil {
+		return domain.PatientGuardian{}, err
+	}
+	if _, err := patientRepository.GetByID(ctx, guardian.DependentId); err != nil {
+		return domain.PatientGuardian{}, err
+	}
+
+	statement, err := r.db.Prepare(QueryInsertGuardian)
+	if err != nil {
+		return domain.PatientGuardian{}, ErrPrepareStatement
+	}
+	defer statement.Close()
+
+	result, err := statement.Exec(
+		guardian.GuardianId,
+		guardian.DependentId,
+		guardian.Relationship,
+		guardian.Notify,
+		guardian.DateUp,
+	)
+	if err != nil {
+		var mysqlError *mysql.MySQLError
+		if errors.As(err, &mysqlError) && mysqlError.Number == 1062 {
+			return domain.PatientGuardian{}, ErrAlreadyExists
+		}
+		return domain.PatientGuardian{}, ErrExecStatement
+	}
+
+	lastId, err := result.LastInsertId()
+	if err != nil {
+		return domain.PatientGuardian{}, ErrLastInsertedId
+	}
+	guardian.Id = int(lastId)
+
+	return guardian, nil
+}
+
+// GetGuardians is a method that returns the guardians of a dependent patient.
+func (r *repository) GetGuardians(ctx context.Context, dependentId int) ([]domain.PatientGuardian, error) {
+	guardians := make([]domain.PatientGuardian, 0)
+
+	founds, err := r.db.Query(QueryGetGuardiansByPatient, dependentId)
+	if err != nil {
+		return []domain.PatientGuardian{}, ErrExecStatement
+	}
+	defer founds.Close()
+
+	for founds.Next() {
+		var guardian domain.PatientGuardian
+		err := founds.Scan(
+			&guardian.Id,
+			&guardian.GuardianId,
+			&guardian.DependentId,
+			&guardian.Relationship,
+			&guardian.Notify,
+			&guardian.DateUp,
+		)
+		if err != nil {
+			return []domain.PatientGuardian{}, ErrExecStatement
+		}
+		guardians = append(guardians, guardian)
+	}
+
+	return guardians, nil
+}
+
+// GetDependents is a method that returns the dependents of a guardian.
+func (r *repository) GetDependents(ctx context.Context, guardianId int) ([]domain.FamilyMember, error) {
+	members := make([]domain.FamilyMember, 0)
+
+	founds, err := r.db.Query(QueryGetDependents, guardianId)
+	if err != nil {
+		return []domain.FamilyMember{}, ErrExecStatement
+	}
+	defer founds.Close()
+
+	for founds.Next() {
+		var member domain.FamilyMember
+		err := founds.Scan(
+			&member.Patient.Id,
+			&member.Patient.Name,
+			&member.Patient.Lastname,
+			&member.Patient.Address,
+			&member.Patient.Dni,
+			&member.Patient.DateUp,
+			&member.Relationship,
+			&member.Notify,
+		)
+		if err != nil {
+			return []domain.FamilyMember{}, ErrExecStatement
+		}
+		members = append(members, member)
+	}
+
+	return members, nil
+}
+
+// Delete is a method that unlinks a guardian from a dependent patient.
+func (r *repository) Delete(ctx context.Context, guardianId int, dependentId int) error {
+	result, err := r.db.Exec(QueryDeleteGuardian, guardianId, dependentId)
+	if err != nil {
+		return ErrExecStatement
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return ErrExecStatement
+	}
+	if rowsAffected < 1 {
+		return ErrNotFound
+	}
+
+	return nil
+}
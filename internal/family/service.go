@@ -0,0 +1,202 @@
+package family
+
+import (
+	"context"
+	"errors"
+	"log"
+	"sort"
+	"time"
+
+	"github.com/ncondezo/final/internal/access"
+	"github.com/ncondezo/final/internal/domain"
+	"github.com/ncondezo/final/internal/patients"
+	"github.com/ncondezo/final/internal/turns"
+)
+
+var (
+	ErrSelfRelation        = errors.New("error patient cannot be its own guardian")
+	ErrCircularRelation    = errors.New("error dependent is already a guardian of the patient")
+	ErrInvalidRelationship = errors.New("error invalid relationship")
+	ErrNotFamilyMember     = errors.New("error patient is not part of the family")
+)
+
+var relationships = map[string]bool{
+	domain.RelationshipParent:        true,
+	domain.RelationshipLegalGuardian: true,
+	domain.RelationshipRelative:      true,
+}
+
+type Service interface {
+	AddDependent(ctx context.Context, dto domain.PatientGuardianDTO, guardianId int) (domain.PatientGuardian, error)
+	RemoveDependent(ctx context.Context, guardianId int, dependentId int) error
+	GetFamily(ctx context.Context, guardianId int, purpose string) (domain.Family, error)
+	GetGuardians(ctx context.Context, dependentId int, purpose string) ([]domain.PatientGuardian, error)
+	GetFamilyTurns(ctx context.Context, guardianId int, purpose string) ([]domain.Turn, error)
+	BookTurn(ctx context.Context, dto domain.TurnDTO, guardianId int) (domain.Turn, error)
+}
+
+type service struct {
+	repository Repository
+	patients   patients.Repository
+	turns      turns.Service
+	access     access.Guard
+}
+
+func NewFamilyService(repository Repository, patients patients.Repository, turns turns.Service, access access.Guard) Service {
+	return &service{repository: repository, patients: patients, turns: turns, access: access}
+}
+
+// AddDependent is a method that makes a patient responsible for another one.
+func (s *service) AddDependent(ctx context.Context, dto domain.PatientGuardianDTO, guardianId int) (domain.PatientGuardian, error) {
+	if !relationships[dto.Relationship] {
+		return domain.PatientGuardian{}, ErrInvalidRelationship
+	}
+	if dto.IdDependent == guardianId {
+		return domain.PatientGuardian{}, ErrSelfRelation
+	}
+
+	guardians, err := s.repository.GetGuardians(ctx, guardianId)
+	if err != nil {
+		log.Println("[FamilyService][AddDependent] error getting guardians", err)
+		return domain.PatientGuardian{}, err
+	}
+	for _, guardian := range guardians {
+		if guardian.GuardianId == dto.IdDependent {
+			return domain.PatientGuardian{}, ErrCircularRelation
+		}
+	}
+
+	guardian, err := s.repository.Create(ctx, domain.PatientGuardian{
+		GuardianId:   guardianId,
+		DependentId:  dto.IdDependent,
+		Relationship: dto.Relationship,
+		Notify:       dto.Notify,
+		DateUp:       time.Now(),
+	})
+	if err != nil {
+		log.Println("[FamilyService][AddDependent] error creating guardian", err)
+		return domain.PatientGuardian{}, err
+	}
+	return guardian, nil
+}
+
+// RemoveDependent is a method that unlinks a dependent from its guardian.
+func (s *service) RemoveDependent(ctx context.Context, guardianId int, dependentId int) error {
+	err := s.repository.Delete(ctx, guardianId, dependentId)
+	if err != nil {
+		log.Println("[FamilyService][RemoveDependent] error deleting guardian", err)
+		return err
+	}
+	return nil
+}
+
+// GetFamily is a method that returns a guardian together with its
+// dependents, and logs the read of each of them with its purpose.
+func (s *service) GetFamily(ctx context.Context, guardianId int, purpose string) (domain.Family, error) {
+	family, err := s.family(ctx, guardianId)
+	if err != nil {
+		return domain.Family{}, err
+	}
+	if err := s.check(ctx, family, domain.AccessResourceFamily, purpose); err != nil {
+		return domain.Family{}, err
+	}
+	return family, nil
+}
+
+// GetGuardians is a method that returns the guardians of a patient, and
+// logs the read with its purpose.
+func (s *service) GetGuardians(ctx context.Context, dependentId int, purpose string) ([]domain.PatientGuardian, error) {
+	if _, err := s.patients.GetByID(ctx, dependentId); err != nil {
+		log.Println("[FamilyService][GetGuardians] error getting patient", err)
+		return []domain.PatientGuardian{}, err
+	}
+	if err := s.access.Check(ctx, dependentId, domain.AccessResourceGuardians, dependentId, purpose); err != nil {
+		return []domain.PatientGuardian{}, err
+	}
+
+	guardians, err := s.repository.GetGuardians(ctx, dependentId)
+	if err != nil {
+		log.Println("[FamilyService][GetGuardians] error getting guardians", err)
+		return []domain.PatientGuardian{}, err
+	}
+	return guardians, nil
+}
+
+// GetFamilyTurns is a method that returns the turns of a guardian and all
+// of its dependents, ordered by date, and logs the read of each of them with
+// its purpose.
+func (s *service) GetFamilyTurns(ctx context.Context, guardianId int, purpose string) ([]domain.Turn, error) {
+	family, err := s.family(ctx, guardianId)
+	if err != nil {
+		return []domain.Turn{}, err
+	}
+	if err := s.check(ctx, family, domain.AccessResourceFamilyTurns, purpose); err != nil {
+		return []domain.Turn{}, err
+	}
+
+	familyTurns := make([]domain.Turn, 0)
+	for _, member := range members(family) {
+		memberTurns, err := s.turns.GetByPatientID(ctx, member)
+		if err != nil {
+			return []domain.Turn{}, err
+		}
+		familyTurns = append(familyTurns, memberTurns...)
+	}
+
+	sort.SliceStable(familyTurns, func(i, j int) bool {
+		return familyTurns[i].Date.Before(familyTurns[j].Date)
+	})
+	return familyTurns, nil
+}
+
+// BookTurn is a method that lets a guardian book a turn for itself or for
+// one of its dependents.
+func (s *service) BookTurn(ctx context.Context, dto domain.TurnDTO, guardianId int) (domain.Turn, error) {
+	family, err := s.family(ctx, guardianId)
+	if err != nil {
+		return domain.Turn{}, err
+	}
+
+	for _, member := range members(family) {
+		if member == dto.IdPatient {
+			return s.turns.Create(ctx, dto)
+		}
+	}
+	return domain.Turn{}, ErrNotFamilyMember
+}
+
+// family returns a guardian together with its dependents.
+func (s *service) family(ctx context.Context, guardianId int) (domain.Family, error) {
+	guardian, err := s.patients.GetByID(ctx, guardianId)
+	if err != nil {
+		log.Println("[FamilyService][family] error getting guardian", err)
+		return domain.Family{}, err
+	}
+
+	dependents, err := s.repository.GetDependents(ctx, guardianId)
+	if err != nil {
+		log.Println("[FamilyService][family] error getting dependents", err)
+		return domain.Family{}, err
+	}
+
+	return domain.Family{Guardian: guardian, Dependents: dependents}, nil
+}
+
+// check logs the read of every member of a family, the guardian is the
+// resource read. It fails on the first member the reader may not read.
+func (s *service) check(ctx context.Context, family domain.Family, resource string, purpose string) error {
+	for _, member := range members(family) {
+		if err := s.access.Check(ctx, member, resource, family.Guardian.Id, purpose); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func members(family domain.Family) []int {
+	ids := []int{family.Guardian.Id}
+	for _, dependent := range family.Dependents {
+		ids = append(ids, dependent.Patient.Id)
+	}
+	return ids
+}
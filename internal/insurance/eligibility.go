@@ -0,0 +1,36 @@
+package insurance
+
+import (
+	"context"
+	"time"
+
+	"github.com/ncondezo/final/internal/domain"
+)
+
+type localEligibilityChecker struct {
+	suspended map[string]bool
+}
+
+// NewLocalEligibilityChecker returns a fake EligibilityChecker that only
+// looks at the validity dates of the coverage. Affiliate numbers listed in
+// suspended are always rejected, which is handy to exercise denials.
+func NewLocalEligibilityChecker(suspended ...string) EligibilityChecker {
+	checker := &localEligibilityChecker{suspended: make(map[string]bool)}
+	for _, affiliate := range suspended {
+		checker.suspended[affiliate] = true
+	}
+	return checker
+}
+
+// Check is a method that decides eligibility without calling the insurer.
+func (c *localEligibilityChecker) Check(ctx context.Context, coverage domain.PatientCoverage, date time.Time) (domain.Eligibility, error) {
+	switch {
+	case c.suspended[coverage.AffiliateNumber]:
+		return domain.Eligibility{Reason: "affiliate_suspended"}, nil
+	case date.Before(coverage.ValidFrom):
+		return domain.Eligibility{Reason: "coverage_not_started"}, nil
+	case date.After(coverage.ValidTo):
+		return domain.Eligibility{Reason: "coverage_expired"}, nil
+	}
+	return domain.Eligibility{Eligible: true}, nil
+}
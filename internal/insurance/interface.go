@@ -0,0 +1,34 @@
+package insurance
+
+import (
+	"context"
+	"time"
+
+	"github.com/ncondezo/final/internal/domain"
+)
+
+type Repository interface {
+	CreateProcedure(ctx context.Context, procedure domain.Procedure) (domain.Procedure, error)
+	GetProcedure(ctx context.Context, code string) (domain.Procedure, error)
+	GetProcedures(ctx context.Context) ([]domain.Procedure, error)
+	CreateInsurer(ctx context.Context, insurer domain.Insurer) (domain.Insurer, error)
+	GetInsurers(ctx context.Context) ([]domain.Insurer, error)
+	CreatePlan(ctx context.Context, plan domain.InsurancePlan) (domain.InsurancePlan, error)
+	GetPlansByInsurer(ctx context.Context, insurerId int) ([]domain.InsurancePlan, error)
+	CreateRule(ctx context.Context, rule domain.CoverageRule) (domain.CoverageRule, error)
+	GetRulesByPlan(ctx context.Context, planId int) ([]domain.CoverageRule, error)
+	GetRule(ctx context.Context, planId int, procedure string) (domain.CoverageRule, error)
+	CreateCoverage(ctx context.Context, coverage domain.PatientCoverage) (domain.PatientCoverage, error)
+	GetCoveragesByPatient(ctx context.Context, patientId int) ([]domain.PatientCoverage, error)
+	GetActiveCoverage(ctx context.Context, patientId int, date time.Time) (domain.PatientCoverage, error)
+	GetUsage(ctx context.Context, coverageId int, procedure string, year int, excludedTurnId int) (domain.CoverageUsage, error)
+	SaveTurnCoverage(ctx context.Context, turnId int, quote domain.CoverageQuote) error
+	GetTurnCoverage(ctx context.Context, turnId int) (domain.CoverageQuote, error)
+	DeleteTurnCoverage(ctx context.Context, turnId int) error
+	GetTurnPatient(ctx context.Context, turnId int) (int, error)
+}
+
+// EligibilityChecker asks the insurer whether a coverage can be used on a date.
+type EligibilityChecker interface {
+	Check(ctx context.Context, coverage domain.PatientCoverage, date time.Time) (domain.Eligibility, error)
+}
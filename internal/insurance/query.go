@@ -0,0 +1,37 @@
+package insurance
+
+var (
+	QueryInsertProcedure = `INSERT INTO procedures(code, name, price, specialties_code) VALUES(?,?,?,?)`
+	QueryGetProcedure    = `SELECT code, name, price, specialties_code FROM procedures WHERE code = ?`
+	QueryGetProcedures   = `SELECT code, name, price, specialties_code FROM procedures ORDER BY code`
+
+	QueryInsertInsurer = `INSERT INTO insurers(name) VALUES(?)`
+	QueryGetInsurers   = `SELECT id, name FROM insurers ORDER BY name`
+	QueryGetInsurer    = `SELECT id, name FROM insurers WHERE id = ?`
+
+	QueryInsertPlan        = `INSERT INTO insurance_plans(insurers_id, name) VALUES(?,?)`
+	QueryGetPlan           = `SELECT id, insurers_id, name FROM insurance_plans WHERE id = ?`
+	QueryGetPlansByInsurer = `SELECT id, insurers_id, name FROM insurance_plans WHERE insurers_id = ? ORDER BY name`
+
+	QueryInsertRule     = `INSERT INTO coverage_rules(insurance_plans_id, procedures_code, percentage, copay, annual_limit, annual_cap) VALUES(?,?,?,?,?,?)`
+	QueryGetRulesByPlan = `SELECT id, insurance_plans_id, procedures_code, percentage, copay, annual_limit, annual_cap FROM coverage_rules WHERE insurance_plans_id = ? ORDER BY procedures_code`
+	QueryGetRule        = `SELECT id, insurance_plans_id, procedures_code, percentage, copay, annual_limit, annual_cap FROM coverage_rules WHERE insurance_plans_id = ? AND procedures_code = ?`
+
+	QueryInsertCoverage = `INSERT INTO patient_coverages(patients_id, insurance_plans_id, affiliate_number, valid_from, valid_to) VALUES(?,?,?,?,?)`
+	querySelectCoverage = `SELECT patient_coverages.id, patient_coverages.patients_id, patient_coverages.affiliate_number, patient_coverages.valid_from, patient_coverages.valid_to, ` +
+		`insurance_plans.id, insurance_plans.insurers_id, insurance_plans.name ` +
+		`FROM patient_coverages INNER JOIN insurance_plans ON insurance_plans.id = patient_coverages.insurance_plans_id`
+	QueryGetCoveragesByPatient = querySelectCoverage + ` WHERE patient_coverages.patients_id = ? ORDER BY patient_coverages.valid_from DESC`
+	QueryGetActiveCoverage     = querySelectCoverage + ` WHERE patient_coverages.patients_id = ? AND patient_coverages.valid_from <= ? AND patient_coverages.valid_to >= ? ORDER BY patient_coverages.valid_from DESC LIMIT 1`
+
+	QueryGetUsage = `SELECT COUNT(*), COALESCE(SUM(turn_coverages.insurer_amount), 0) FROM turn_coverages INNER JOIN turns ON turns.id = turn_coverages.turns_id ` +
+		`WHERE turn_coverages.patient_coverages_id = ? AND turn_coverages.procedures_code = ? AND turn_coverages.covered = TRUE AND YEAR(turns.date) = ? AND turn_coverages.turns_id <> ?`
+	QuerySaveTurnCoverage = `INSERT INTO turn_coverages(turns_id, patient_coverages_id, procedures_code, price, covered, reason, insurer_amount, copay, patient_amount) VALUES(?,?,?,?,?,?,?,?,?) ` +
+		`ON DUPLICATE KEY UPDATE patient_coverages_id = VALUES(patient_coverages_id), procedures_code = VALUES(procedures_code), price = VALUES(price), covered = VALUES(covered), ` +
+		`reason = VALUES(reason), insurer_amount = VALUES(insurer_amount), copay = VALUES(copay), patient_amount = VALUES(patient_amount)`
+	QueryGetTurnCoverage = `SELECT turn_coverages.procedures_code, turn_coverages.price, turn_coverages.covered, turn_coverages.reason, turn_coverages.patient_coverages_id, ` +
+		`COALESCE(patient_coverages.affiliate_number, ''), turn_coverages.insurer_amount, turn_coverages.copay, turn_coverages.patient_amount ` +
+		`FROM turn_coverages LEFT JOIN patient_coverages ON patient_coverages.id = turn_coverages.patient_coverages_id WHERE turn_coverages.turns_id = ?`
+	QueryDeleteTurnCoverage = `DELETE FROM turn_coverages WHERE turns_id = ?`
+	QueryGetTurnPatient     = `SELECT patients_id FROM turns WHERE id = ?`
+)
@@ -0,0 +1,408 @@
+package insurance
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/ncondezo/final/internal/dentists"
+	"github.com/ncondezo/final/internal/domain"
+	"github.com/ncondezo/final/internal/patients"
+)
+
+var (
+	ErrPrepareStatement  = errors.New("error prepare statement")
+	ErrExecStatement     = errors.New("error exec statement")
+	ErrLastInsertedId    = errors.New("error last inserted id")
+	ErrAlreadyExists     = errors.New("error insurance record already exists")
+	ErrProcedureNotFound = errors.New("error not found procedure")
+	ErrInsurerNotFound   = errors.New("error not found insurer")
+	ErrPlanNotFound      = errors.New("error not found insurance plan")
+	ErrRuleNotFound      = errors.New("error not found coverage rule")
+	ErrCoverageNotFound  = errors.New("error not found coverage")
+)
+
+type repository struct {
+	db *sql.DB
+}
+
+func NewRepository(db *sql.DB) Repository {
+	return &repository{db: db}
+}
+
+// CreateProcedure is a method that creates a new procedure.
+func (r *repository) CreateProcedure(ctx context.Context, procedure domain.Procedure) (domain.Procedure, error) {
+	specialty := sql.NullString{String: procedure.Specialty, Valid: procedure.Specialty != ""}
+	if specialty.Valid {
+		if _, err := dentists.NewRepository(r.db).GetSpecialty(ctx, procedure.Specialty); err != nil {
+			return domain.Procedure{}, err
+		}
+	}
+
+	_, err := r.insert(QueryInsertProcedure, procedure.Code, procedure.Name, procedure.Price, specialty)
+	if err != nil {
+		return domain.Procedure{}, err
+	}
+	return procedure, nil
+}
+
+// GetProcedure is a method that returns a procedure by code.
+func (r *repository) GetProcedure(ctx context.Context, code string) (domain.Procedure, error) {
+	var procedure domain.Procedure
+	var specialty sql.NullString
+	err := r.db.QueryRow(QueryGetProcedure, code).Scan(&procedure.Code, &procedure.Name, &procedure.Price, &specialty)
+	procedure.Specialty = specialty.String
+	if errors.Is(err, sql.ErrNoRows) {
+		return domain.Procedure{}, ErrProcedureNotFound
+	}
+	if err != nil {
+		return domain.Procedure{}, ErrExecStatement
+	}
+	return procedure, nil
+}
+
+// GetProcedures is a method that returns every procedure.
+func (r *repository) GetProcedures(ctx context.Context) ([]domain.Procedure, error) {
+	procedures := make([]domain.Procedure, 0)
+	err := r.list(func(rows *sql.Rows) error {
+		var procedure domain.Procedure
+		var specialty sql.NullString
+		err := rows.Scan(&procedure.Code, &procedure.Name, &procedure.Price, &specialty)
+		procedure.Specialty = specialty.String
+		procedures = append(procedures, procedure)
+		return err
+	}, QueryGetProcedures)
+	if err != nil {
+		return []domain.Procedure{}, err
+	}
+	return procedures, nil
+}
+
+// CreateInsurer is a method that creates a new insurer.
+func (r *repository) CreateInsurer(ctx context.Context, insurer domain.Insurer) (domain.Insurer, error) {
+	id, err := r.insert(QueryInsertInsurer, insurer.Name)
+	if err != nil {
+		return domain.Insurer{}, err
+	}
+	insurer.Id = id
+	return insurer, nil
+}
+
+// GetInsurers is a method that returns every insurer.
+func (r *repository) GetInsurers(ctx context.Context) ([]domain.Insurer, error) {
+	insurers := make([]domain.Insurer, 0)
+	err := r.list(func(rows *sql.Rows) error {
+		var insurer domain.Insurer
+		err := rows.Scan(&insurer.Id, &insurer.Name)
+		insurers = append(insurers, insurer)
+		return err
+	}, QueryGetInsurers)
+	if err != nil {
+		return []domain.Insurer{}, err
+	}
+	return insurers, nil
+}
+
+// CreatePlan is a method that creates a new plan for an insurer.
+func (r *repository) CreatePlan(ctx context.Context, plan domain.InsurancePlan) (domain.InsurancePlan, error) {
+	var insurer domain.Insurer
+	err := r.db.QueryRow(QueryGetInsurer, plan.InsurerId).Scan(&insurer.Id, &insurer.Name)
+	if errors.Is(err, sql.ErrNoRows) {
+		return domain.InsurancePlan{}, ErrInsurerNotFound
+	}
+	if err != nil {
+		return domain.InsurancePlan{}, ErrExecStatement
+	}
+
+	id, err := r.insert(QueryInsertPlan, plan.InsurerId, plan.Name)
+	if err != nil {
+		return domain.InsurancePlan{}, err
+	}
+	plan.Id = id
+	return plan, nil
+}
+
+// GetPlansByInsurer is a method that returns the plans of an insurer.
+func (r *repository) GetPlansByInsurer(ctx context.Context, insurerId int) ([]domain.InsurancePlan, error) {
+	plans := make([]domain.InsurancePlan, 0)
+	err := r.list(func(rows *sql.Rows) error {
+		var plan domain.InsurancePlan
+		err := rows.Scan(&plan.Id, &plan.InsurerId, &plan.Name)
+		plans = append(plans, plan)
+		return err
+	}, QueryGetPlansByInsurer, insurerId)
+	if err != nil {
+		return []domain.InsurancePlan{}, err
+	}
+	return plans, nil
+}
+
+// CreateRule is a method that creates a coverage rule for a plan and procedure.
+func (r *repository) CreateRule(ctx context.Context, rule domain.CoverageRule) (domain.CoverageRule, error) {
+	if _, err := r.plan(rule.PlanId); err != nil {
+		return domain.CoverageRule{}, err
+	}
+	if _, err := r.GetProcedure(ctx, rule.Procedure); err != nil {
+		return domain.CoverageRule{}, err
+	}
+
+	id, err := r.insert(QueryInsertRule,
+		rule.PlanId,
+		rule.Procedure,
+		rule.Percentage,
+		rule.Copay,
+		rule.AnnualLimit,
+		rule.AnnualCap,
+	)
+	if err != nil {
+		return domain.CoverageRule{}, err
+	}
+	rule.Id = id
+	return rule, nil
+}
+
+// GetRulesByPlan is a method that returns the coverage rules of a plan.
+func (r *repository) GetRulesByPlan(ctx context.Context, planId int) ([]domain.CoverageRule, error) {
+	if _, err := r.plan(planId); err != nil {
+		return []domain.CoverageRule{}, err
+	}
+
+	rules := make([]domain.CoverageRule, 0)
+	err := r.list(func(rows *sql.Rows) error {
+		rule, err := scanRule(rows)
+		rules = append(rules, rule)
+		return err
+	}, QueryGetRulesByPlan, planId)
+	if err != nil {
+		return []domain.CoverageRule{}, err
+	}
+	return rules, nil
+}
+
+// GetRule is a method that returns the rule of a plan for a procedure.
+func (r *repository) GetRule(ctx context.Context, planId int, procedure string) (domain.CoverageRule, error) {
+	rule, err := scanRule(r.db.QueryRow(QueryGetRule, planId, procedure))
+	if errors.Is(err, sql.ErrNoRows) {
+		return domain.CoverageRule{}, ErrRuleNotFound
+	}
+	if err != nil {
+		return domain.CoverageRule{}, ErrExecStatement
+	}
+	return rule, nil
+}
+
+// CreateCoverage is a method that affiliates a patient to a plan.
+func (r *repository) CreateCoverage(ctx context.Context, coverage domain.PatientCoverage) (domain.PatientCoverage, error) {
+	if _, err := patients.NewRepository(r.db).GetByID(ctx, coverage.PatientId); err != nil {
+		return domain.PatientCoverage{}, err
+	}
+	plan, err := r.plan(coverage.Plan.Id)
+	if err != nil {
+		return domain.PatientCoverage{}, err
+	}
+
+	id, err := r.insert(QueryInsertCoverage,
+		coverage.PatientId,
+		coverage.Plan.Id,
+		coverage.AffiliateNumber,
+		coverage.ValidFrom,
+		coverage.ValidTo,
+	)
+	if err != nil {
+		return domain.PatientCoverage{}, err
+	}
+	coverage.Id = id
+	coverage.Plan = plan
+	return coverage, nil
+}
+
+// GetCoveragesByPatient is a method that returns the coverages of a patient.
+func (r *repository) GetCoveragesByPatient(ctx context.Context, patientId int) ([]domain.PatientCoverage, error) {
+	if _, err := patients.NewRepository(r.db).GetByID(ctx, patientId); err != nil {
+		return []domain.PatientCoverage{}, err
+	}
+
+	coverages := make([]domain.PatientCoverage, 0)
+	err := r.list(func(rows *sql.Rows) error {
+		coverage, err := scanCoverage(rows)
+		coverages = append(coverages, coverage)
+		return err
+	}, QueryGetCoveragesByPatient, patientId)
+	if err != nil {
+		return []domain.PatientCoverage{}, err
+	}
+	return coverages, nil
+}
+
+// GetActiveCoverage is a method that returns the coverage valid on a date.
+func (r *repository) GetActiveCoverage(ctx context.Context, patientId int, date time.Time) (domain.PatientCoverage, error) {
+	coverage, err := scanCoverage(r.db.QueryRow(QueryGetActiveCoverage, patientId, date, date))
+	if errors.Is(err, sql.ErrNoRows) {
+		return domain.PatientCoverage{}, ErrCoverageNotFound
+	}
+	if err != nil {
+		return domain.PatientCoverage{}, ErrExecStatement
+	}
+	return coverage, nil
+}
+
+// GetUsage is a method that returns how much of a rule a coverage used in a year.
+func (r *repository) GetUsage(ctx context.Context, coverageId int, procedure string, year int, excludedTurnId int) (domain.CoverageUsage, error) {
+	var usage domain.CoverageUsage
+	err := r.db.QueryRow(QueryGetUsage, coverageId, procedure, year, excludedTurnId).Scan(&usage.Count, &usage.Covered)
+	if err != nil {
+		return domain.CoverageUsage{}, ErrExecStatement
+	}
+	return usage, nil
+}
+
+// SaveTurnCoverage is a method that stores the coverage applied to a turn.
+func (r *repository) SaveTurnCoverage(ctx context.Context, turnId int, quote domain.CoverageQuote) error {
+	_, err := r.db.Exec(QuerySaveTurnCoverage,
+		turnId,
+		sql.NullInt64{Int64: int64(quote.CoverageId), Valid: quote.CoverageId > 0},
+		quote.Procedure,
+		quote.Price,
+		quote.Covered,
+		quote.Reason,
+		quote.InsurerAmount,
+		quote.Copay,
+		quote.PatientAmount,
+	)
+	if err != nil {
+		return ErrExecStatement
+	}
+	return nil
+}
+
+// DeleteTurnCoverage is a method that removes the coverage applied to a turn.
+func (r *repository) DeleteTurnCoverage(ctx context.Context, turnId int) error {
+	if _, err := r.db.Exec(QueryDeleteTurnCoverage, turnId); err != nil {
+		return ErrExecStatement
+	}
+	return nil
+}
+
+// GetTurnCoverage is a method that returns the coverage applied to a turn.
+func (r *repository) GetTurnCoverage(ctx context.Context, turnId int) (domain.CoverageQuote, error) {
+	var quote domain.CoverageQuote
+	var coverageId sql.NullInt64
+	err := r.db.QueryRow(QueryGetTurnCoverage, turnId).Scan(
+		&quote.Procedure,
+		&quote.Price,
+		&quote.Covered,
+		&quote.Reason,
+		&coverageId,
+		&quote.AffiliateNumber,
+		&quote.InsurerAmount,
+		&quote.Copay,
+		&quote.PatientAmount,
+	)
+	if errors.Is(err, sql.ErrNoRows) {
+		return domain.CoverageQuote{}, ErrCoverageNotFound
+	}
+	if err != nil {
+		return domain.CoverageQuote{}, ErrExecStatement
+	}
+	quote.CoverageId = int(coverageId.Int64)
+	return quote, nil
+}
+
+// GetTurnPatient is a method that returns the patient a turn was booked for.
+func (r *repository) GetTurnPatient(ctx context.Context, turnId int) (int, error) {
+	var patientId int
+	err := r.db.QueryRow(QueryGetTurnPatient, turnId).Scan(&patientId)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, ErrCoverageNotFound
+	}
+	if err != nil {
+		return 0, ErrExecStatement
+	}
+	return patientId, nil
+}
+
+func (r *repository) plan(id int) (domain.InsurancePlan, error) {
+	var plan domain.InsurancePlan
+	err := r.db.QueryRow(QueryGetPlan, id).Scan(&plan.Id, &plan.InsurerId, &plan.Name)
+	if errors.Is(err, sql.ErrNoRows) {
+		return domain.InsurancePlan{}, ErrPlanNotFound
+	}
+	if err != nil {
+		return domain.InsurancePlan{}, ErrExecStatement
+	}
+	return plan, nil
+}
+
+func (r *repository) insert(query string, args ...interface{}) (int, error) {
+	var mysqlError *mysql.MySQLError
+
+	statement, err := r.db.Prepare(query)
+	if err != nil {
+		return 0, ErrPrepareStatement
+	}
+	defer statement.Close()
+
+	result, err := statement.Exec(args...)
+	if errors.As(err, &mysqlError) && mysqlError.Number == 1062 {
+		return 0, ErrAlreadyExists
+	}
+	if err != nil {
+		return 0, ErrExecStatement
+	}
+
+	lastId, err := result.LastInsertId()
+	if err != nil {
+		return 0, ErrLastInsertedId
+	}
+	return int(lastId), nil
+}
+
+func (r *repository) list(scan func(rows *sql.Rows) error, query string, args ...interface{}) error {
+	founds, err := r.db.Query(query, args...)
+	if err != nil {
+		return ErrExecStatement
+	}
+	defer founds.Close()
+
+	for founds.Next() {
+		if err := scan(founds); err != nil {
+			return ErrExecStatement
+		}
+	}
+	return nil
+}
+
+type scanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanRule(scanner scanner) (domain.CoverageRule, error) {
+	var rule domain.CoverageRule
+	err := scanner.Scan(
+		&rule.Id,
+		&rule.PlanId,
+		&rule.Procedure,
+		&rule.Percentage,
+		&rule.Copay,
+		&rule.AnnualLimit,
+		&rule.AnnualCap,
+	)
+	return rule, err
+}
+
+func scanCoverage(scanner scanner) (domain.PatientCoverage, error) {
+	var coverage domain.PatientCoverage
+	err := scanner.Scan(
+		&coverage.Id,
+		&coverage.PatientId,
+		&coverage.AffiliateNumber,
+		&coverage.ValidFrom,
+		&coverage.ValidTo,
+		&coverage.Plan.Id,
+		&coverage.Plan.InsurerId,
+		&coverage.Plan.Name,
+	)
+	return coverage, err
+}
@@ -0,0 +1,314 @@
+package insurance
+
+import (
+	"context"
+	"errors"
+	"log"
+	"math"
+	"time"
+
+	"github.com/ncondezo/final/internal/access"
+	"github.com/ncondezo/final/internal/domain"
+)
+
+var (
+	ErrInvalidPercentage = errors.New("error coverage percentage must be between 0 and 100")
+	ErrInvalidAmount     = errors.New("error amounts cannot be negative")
+	ErrInvalidValidity   = errors.New("error coverage validity ends before it starts")
+)
+
+type Service interface {
+	CreateProcedure(ctx context.Context, procedure domain.Procedure) (domain.Procedure, error)
+	GetProcedures(ctx context.Context) ([]domain.Procedure, error)
+	CreateInsurer(ctx context.Context, dto domain.InsurerDTO) (domain.Insurer, error)
+	GetInsurers(ctx context.Context) ([]domain.Insurer, error)
+	CreatePlan(ctx context.Context, dto domain.InsurancePlanDTO, insurerId int) (domain.InsurancePlan, error)
+	GetPlansByInsurer(ctx context.Context, insurerId int) ([]domain.InsurancePlan, error)
+	CreateRule(ctx context.Context, dto domain.CoverageRuleDTO, planId int) (domain.CoverageRule, error)
+	GetRulesByPlan(ctx context.Context, planId int) ([]domain.CoverageRule, error)
+	CreateCoverage(ctx context.Context, dto domain.PatientCoverageDTO, patientId int) (domain.PatientCoverage, error)
+	GetCoveragesByPatient(ctx context.Context, patientId int, purpose string) ([]domain.PatientCoverage, error)
+	Quote(ctx context.Context, patientId int, procedure string, date time.Time, purpose string) (domain.CoverageQuote, error)
+	Apply(ctx context.Context, turn domain.Turn) (domain.CoverageQuote, error)
+	Clear(ctx context.Context, turnId int) error
+	GetTurnCoverage(ctx context.Context, turnId int, purpose string) (domain.CoverageQuote, error)
+}
+
+type service struct {
+	repository  Repository
+	eligibility EligibilityChecker
+	access      access.Guard
+}
+
+func NewInsuranceService(repository Repository, eligibility EligibilityChecker, access access.Guard) Service {
+	return &service{repository: repository, eligibility: eligibility, access: access}
+}
+
+// CreateProcedure is a method that create a new procedure.
+func (s *service) CreateProcedure(ctx context.Context, procedure domain.Procedure) (domain.Procedure, error) {
+	if procedure.Price < 0 {
+		return domain.Procedure{}, ErrInvalidAmount
+	}
+	procedure, err := s.repository.CreateProcedure(ctx, procedure)
+	if err != nil {
+		log.Println("[InsuranceService][CreateProcedure] error creating procedure", err)
+		return domain.Procedure{}, err
+	}
+	return procedure, nil
+}
+
+// GetProcedures is a method that return every procedure.
+func (s *service) GetProcedures(ctx context.Context) ([]domain.Procedure, error) {
+	procedures, err := s.repository.GetProcedures(ctx)
+	if err != nil {
+		log.Println("[InsuranceService][GetProcedures] error getting procedures", err)
+		return []domain.Procedure{}, err
+	}
+	return procedures, nil
+}
+
+// CreateInsurer is a method that create a new insurer.
+func (s *service) CreateInsurer(ctx context.Context, dto domain.InsurerDTO) (domain.Insurer, error) {
+	insurer, err := s.repository.CreateInsurer(ctx, domain.Insurer{Name: dto.Name})
+	if err != nil {
+		log.Println("[InsuranceService][CreateInsurer] error creating insurer", err)
+		return domain.Insurer{}, err
+	}
+	return insurer, nil
+}
+
+// GetInsurers is a method that return every insurer.
+func (s *service) GetInsurers(ctx context.Context) ([]domain.Insurer, error) {
+	insurers, err := s.repository.GetInsurers(ctx)
+	if err != nil {
+		log.Println("[InsuranceService][GetInsurers] error getting insurers", err)
+		return []domain.Insurer{}, err
+	}
+	return insurers, nil
+}
+
+// CreatePlan is a method that create a new plan for an insurer.
+func (s *service) CreatePlan(ctx context.Context, dto domain.InsurancePlanDTO, insurerId int) (domain.InsurancePlan, error) {
+	plan, err := s.repository.CreatePlan(ctx, domain.InsurancePlan{InsurerId: insurerId, Name: dto.Name})
+	if err != nil {
+		log.Println("[InsuranceService][CreatePlan] error creating plan", err)
+		return domain.InsurancePlan{}, err
+	}
+	return plan, nil
+}
+
+// GetPlansByInsurer is a method that return the plans of an insurer.
+func (s *service) GetPlansByInsurer(ctx context.Context, insurerId int) ([]domain.InsurancePlan, error) {
+	plans, err := s.repository.GetPlansByInsurer(ctx, insurerId)
+	if err != nil {
+		log.Println("[InsuranceService][GetPlansByInsurer] error getting plans", err)
+		return []domain.InsurancePlan{}, err
+	}
+	return plans, nil
+}
+
+// CreateRule is a method that create a coverage rule for a plan.
+func (s *service) CreateRule(ctx context.Context, dto domain.CoverageRuleDTO, planId int) (domain.CoverageRule, error) {
+	if dto.Percentage < 0 || dto.Percentage > 100 {
+		return domain.CoverageRule{}, ErrInvalidPercentage
+	}
+	if dto.Copay < 0 || dto.AnnualCap < 0 || dto.AnnualLimit < 0 {
+		return domain.CoverageRule{}, ErrInvalidAmount
+	}
+	rule, err := s.repository.CreateRule(ctx, domain.CoverageRule{
+		PlanId:      planId,
+		Procedure:   dto.Procedure,
+		Percentage:  dto.Percentage,
+		Copay:       dto.Copay,
+		AnnualLimit: dto.AnnualLimit,
+		AnnualCap:   dto.AnnualCap,
+	})
+	if err != nil {
+		log.Println("[InsuranceService][CreateRule] error creating rule", err)
+		return domain.CoverageRule{}, err
+	}
+	return rule, nil
+}
+
+// GetRulesByPlan is a method that return the coverage rules of a plan.
+func (s *service) GetRulesByPlan(ctx context.Context, planId int) ([]domain.CoverageRule, error) {
+	rules, err := s.repository.GetRulesByPlan(ctx, planId)
+	if err != nil {
+		log.Println("[InsuranceService][GetRulesByPlan] error getting rules", err)
+		return []domain.CoverageRule{}, err
+	}
+	return rules, nil
+}
+
+// CreateCoverage is a method that affiliate a patient to a plan.
+func (s *service) CreateCoverage(ctx context.Context, dto domain.PatientCoverageDTO, patientId int) (domain.PatientCoverage, error) {
+	if dto.ValidTo.Before(dto.ValidFrom) {
+		return domain.PatientCoverage{}, ErrInvalidValidity
+	}
+	coverage, err := s.repository.CreateCoverage(ctx, domain.PatientCoverage{
+		PatientId:       patientId,
+		Plan:            domain.InsurancePlan{Id: dto.IdPlan},
+		AffiliateNumber: dto.AffiliateNumber,
+		ValidFrom:       dto.ValidFrom,
+		ValidTo:         dto.ValidTo,
+	})
+	if err != nil {
+		log.Println("[InsuranceService][CreateCoverage] error creating coverage", err)
+		return domain.PatientCoverage{}, err
+	}
+	return coverage, nil
+}
+
+// GetCoveragesByPatient is a method that return the coverages of a patient,
+// and logs the read with its purpose.
+func (s *service) GetCoveragesByPatient(ctx context.Context, patientId int, purpose string) ([]domain.PatientCoverage, error) {
+	coverages, err := s.repository.GetCoveragesByPatient(ctx, patientId)
+	if err != nil {
+		log.Println("[InsuranceService][GetCoveragesByPatient] error getting coverages", err)
+		return []domain.PatientCoverage{}, err
+	}
+	if err := s.access.Check(ctx, patientId, domain.AccessResourceCoverages, patientId, purpose); err != nil {
+		return []domain.PatientCoverage{}, err
+	}
+	return coverages, nil
+}
+
+// Quote is a method that compute how a procedure on a date would be paid,
+// and logs the read of the patient's coverage with its purpose.
+func (s *service) Quote(ctx context.Context, patientId int, procedure string, date time.Time, purpose string) (domain.CoverageQuote, error) {
+	if err := s.access.Check(ctx, patientId, domain.AccessResourceQuote, patientId, purpose); err != nil {
+		return domain.CoverageQuote{}, err
+	}
+	return s.quote(ctx, patientId, procedure, date, 0)
+}
+
+// Apply is a method that compute and store the coverage of a booked turn.
+func (s *service) Apply(ctx context.Context, turn domain.Turn) (domain.CoverageQuote, error) {
+	quote, err := s.quote(ctx, turn.Patient.Id, turn.Procedure, turn.Date, turn.Id)
+	if err != nil {
+		return domain.CoverageQuote{}, err
+	}
+	err = s.repository.SaveTurnCoverage(ctx, turn.Id, quote)
+	if err != nil {
+		log.Println("[InsuranceService][Apply] error saving turn coverage", err)
+		return domain.CoverageQuote{}, err
+	}
+	return quote, nil
+}
+
+// Clear is a method that removes the coverage applied to a turn.
+func (s *service) Clear(ctx context.Context, turnId int) error {
+	err := s.repository.DeleteTurnCoverage(ctx, turnId)
+	if err != nil {
+		log.Println("[InsuranceService][Clear] error deleting turn coverage", err)
+		return err
+	}
+	return nil
+}
+
+// GetTurnCoverage is a method that return the coverage applied to a turn,
+// and logs the read of its patient with its purpose.
+func (s *service) GetTurnCoverage(ctx context.Context, turnId int, purpose string) (domain.CoverageQuote, error) {
+	quote, err := s.repository.GetTurnCoverage(ctx, turnId)
+	if err != nil {
+		log.Println("[InsuranceService][GetTurnCoverage] error getting turn coverage", err)
+		return domain.CoverageQuote{}, err
+	}
+	patientId, err := s.repository.GetTurnPatient(ctx, turnId)
+	if err != nil {
+		log.Println("[InsuranceService][GetTurnCoverage] error getting patient of turn", err)
+		return domain.CoverageQuote{}, err
+	}
+	if err := s.access.Check(ctx, patientId, domain.AccessResourceTurnCoverage, turnId, purpose); err != nil {
+		return domain.CoverageQuote{}, err
+	}
+	return quote, nil
+}
+
+func (s *service) quote(ctx context.Context, patientId int, code string, date time.Time, turnId int) (domain.CoverageQuote, error) {
+	procedure, err := s.repository.GetProcedure(ctx, code)
+	if err != nil {
+		return domain.CoverageQuote{}, err
+	}
+	quote := domain.CoverageQuote{
+		Procedure:     procedure.Code,
+		Price:         procedure.Price,
+		PatientAmount: procedure.Price,
+	}
+
+	coverage, err := s.repository.GetActiveCoverage(ctx, patientId, date)
+	if errors.Is(err, ErrCoverageNotFound) {
+		quote.Reason = "no_coverage"
+		return quote, nil
+	}
+	if err != nil {
+		return domain.CoverageQuote{}, err
+	}
+	quote.CoverageId = coverage.Id
+	quote.AffiliateNumber = coverage.AffiliateNumber
+
+	eligibility, err := s.eligibility.Check(ctx, coverage, date)
+	if err != nil {
+		log.Println("[InsuranceService][quote] error checking eligibility", err)
+		return domain.CoverageQuote{}, err
+	}
+	if !eligibility.Eligible {
+		quote.Reason = eligibility.Reason
+		return quote, nil
+	}
+
+	rule, err := s.repository.GetRule(ctx, coverage.Plan.Id, procedure.Code)
+	if errors.Is(err, ErrRuleNotFound) {
+		quote.Reason = "procedure_not_covered"
+		return quote, nil
+	}
+	if err != nil {
+		return domain.CoverageQuote{}, err
+	}
+
+	usage, err := s.repository.GetUsage(ctx, coverage.Id, procedure.Code, date.Year(), turnId)
+	if err != nil {
+		return domain.CoverageQuote{}, err
+	}
+	if rule.AnnualLimit > 0 && usage.Count >= rule.AnnualLimit {
+		quote.Reason = "annual_limit_reached"
+		return quote, nil
+	}
+
+	quote.Copay = min(rule.Copay, procedure.Price)
+	insurerAmount := percentOf(procedure.Price-quote.Copay, rule.Percentage)
+	if rule.AnnualCap > 0 {
+		insurerAmount = max(0, min(insurerAmount, rule.AnnualCap-usage.Covered))
+		if insurerAmount == 0 {
+			quote.Copay = 0
+			quote.Reason = "annual_cap_reached"
+			return quote, nil
+		}
+	}
+
+	quote.Covered = true
+	quote.InsurerAmount = insurerAmount
+	quote.PatientAmount = procedure.Price - quote.InsurerAmount
+	return quote, nil
+}
+
+// percentOf returns percentage of amount, rounded half up to the cent. The
+// percentage has two decimals, as stored, so the product is exact.
+func percentOf(amount domain.Money, percentage float64) domain.Money {
+	basisPoints := int64(math.Round(percentage * 100))
+	return domain.Money((int64(amount)*basisPoints + 5000) / 10000)
+}
+
+func min(first, second domain.Money) domain.Money {
+	if first < second {
+		return first
+	}
+	return second
+}
+
+func max(first, second domain.Money) domain.Money {
+	if first > second {
+		return first
+	}
+	return second
+}
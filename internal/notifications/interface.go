@@ -0,0 +1,15 @@
+package notifications
+
+import (
+	"context"
+	"time"
+)
+
+// Repository keeps the messages waiting for the quiet hours of their
+// recipient to end.
+type Repository interface {
+	Enqueue(ctx context.Context, queued QueuedMessage) (QueuedMessage, error)
+	GetDue(ctx context.Context, now time.Time, limit int) ([]QueuedMessage, error)
+	Reschedule(ctx context.Context, id int, sendAfter time.Time, attempts int) error
+	MarkSent(ctx context.Context, id int, sentAt time.Time) error
+}
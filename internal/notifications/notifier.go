@@ -0,0 +1,239 @@
+package notifications
+
+import (
+	"context"
+	"errors"
+	"log"
+	"time"
+
+	"github.com/ncondezo/final/internal/contacts"
+	"github.com/ncondezo/final/internal/domain"
+)
+
+var ErrNoChannel = errors.New("error patient has no consented channel")
+
+const (
+	// DefaultFlushInterval is how often the queued messages are looked at.
+	DefaultFlushInterval = time.Minute
+	// Messages that could not be sent are retried after retryDelay, up to
+	// maxAttempts times.
+	retryDelay  = time.Minute * 15
+	maxAttempts = 5
+	flushBatch  = 100
+)
+
+// Channels tried when the preferred one cannot be used, in order.
+var fallbackChannels = []string{domain.ChannelEmail, domain.ChannelWhatsApp, domain.ChannelSMS}
+
+type Message struct {
+	PatientId int
+	Subject   string
+	Body      string
+}
+
+// QueuedMessage is a message kept until the quiet hours of its recipient
+// end.
+type QueuedMessage struct {
+	Message
+	Id        int
+	SendAfter time.Time
+	Attempts  int
+	DateUp    time.Time
+}
+
+// Delivery tells where a message went. Messages that reach the recipient in
+// quiet hours are queued, they only have QueuedUntil.
+type Delivery struct {
+	PatientId   int        `json:"id_patient"`
+	Channel     string     `json:"channel,omitempty"`
+	Address     string     `json:"address,omitempty"`
+	SentAt      time.Time  `json:"sent_at"`
+	QueuedUntil *time.Time `json:"queued_until,omitempty"`
+}
+
+// Sender delivers a message through one channel.
+type Sender interface {
+	Send(ctx context.Context, address string, message Message) error
+}
+
+// Notifier is the single way to send outbound messages to patients. It
+// honours the patient's consents, preferred channel and quiet hours.
+// Messages for a dependent go to the guardians that asked to be notified.
+type Notifier interface {
+	Notify(ctx context.Context, message Message) (Delivery, error)
+	// Flush sends the queued messages whose quiet hours ended.
+	Flush(ctx context.Context) error
+}
+
+type notifier struct {
+	contacts  contacts.Repository
+	guardians contacts.Guardians
+	queue     Repository
+	senders   map[string]Sender
+}
+
+func NewNotifier(contacts contacts.Repository, guardians contacts.Guardians, queue Repository, senders map[string]Sender) Notifier {
+	return &notifier{contacts: contacts, guardians: guardians, queue: queue, senders: senders}
+}
+
+// Notify is a method that sends a message through the best allowed channel
+// of every recipient, or queues it until their quiet hours end. It succeeds
+// when at least one recipient got it or will get it.
+func (n *notifier) Notify(ctx context.Context, message Message) (Delivery, error) {
+	recipients, err := n.recipients(ctx, message.PatientId)
+	if err != nil {
+		return Delivery{}, err
+	}
+
+	var delivered Delivery
+	for _, recipient := range recipients {
+		delivery, errDeliver := n.deliver(ctx, recipient, message)
+		if errDeliver != nil {
+			err = errDeliver
+			continue
+		}
+		if delivered.PatientId == 0 {
+			delivered = delivery
+		}
+	}
+	if delivered.PatientId == 0 {
+		return Delivery{}, err
+	}
+
+	return delivered, nil
+}
+
+func (n *notifier) recipients(ctx context.Context, patientId int) ([]int, error) {
+	guardians, err := n.guardians.GetGuardians(ctx, patientId)
+	if err != nil {
+		return nil, err
+	}
+
+	recipients := make([]int, 0, len(guardians))
+	for _, guardian := range guardians {
+		if guardian.Notify {
+			recipients = append(recipients, guardian.GuardianId)
+		}
+	}
+	if len(recipients) == 0 {
+		recipients = append(recipients, patientId)
+	}
+
+	return recipients, nil
+}
+
+// Flush is a method that sends the queued messages that are due. A message
+// whose recipient is in quiet hours again waits for them to end, one that
+// fails is retried later.
+func (n *notifier) Flush(ctx context.Context) error {
+	now := time.Now()
+	due, err := n.queue.GetDue(ctx, now, flushBatch)
+	if err != nil {
+		log.Println("[Notifier][Flush] error getting queued messages", err)
+		return err
+	}
+
+	for _, queued := range due {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		contact, err := n.contacts.GetByPatientID(ctx, queued.PatientId)
+		if err == nil {
+			if until := contacts.QuietUntil(contact, now); !until.IsZero() {
+				err = n.queue.Reschedule(ctx, queued.Id, until, queued.Attempts)
+				if err != nil {
+					log.Println("[Notifier][Flush] error rescheduling message", queued.Id, err)
+				}
+				continue
+			}
+			_, err = n.send(ctx, contact, queued.Message, now)
+		}
+		if err != nil {
+			log.Println("[Notifier][Flush] error sending queued message", queued.Id, err)
+			if err := n.queue.Reschedule(ctx, queued.Id, now.Add(retryDelay), queued.Attempts+1); err != nil {
+				log.Println("[Notifier][Flush] error rescheduling message", queued.Id, err)
+			}
+			continue
+		}
+
+		if err := n.queue.MarkSent(ctx, queued.Id, now); err != nil {
+			log.Println("[Notifier][Flush] error marking message as sent", queued.Id, err)
+		}
+	}
+
+	return nil
+}
+
+func (n *notifier) deliver(ctx context.Context, patientId int, message Message) (Delivery, error) {
+	contact, err := n.contacts.GetByPatientID(ctx, patientId)
+	if err != nil {
+		return Delivery{}, err
+	}
+
+	now := time.Now()
+	if until := contacts.QuietUntil(contact, now); !until.IsZero() {
+		_, err := n.queue.Enqueue(ctx, QueuedMessage{
+			Message:   Message{PatientId: patientId, Subject: message.Subject, Body: message.Body},
+			SendAfter: until,
+			DateUp:    now,
+		})
+		if err != nil {
+			log.Println("[Notifier][Notify] error queueing message", err)
+			return Delivery{}, err
+		}
+		log.Println("[Notifier][Notify] patient in quiet hours, message queued until", patientId, until)
+		return Delivery{PatientId: patientId, QueuedUntil: &until}, nil
+	}
+
+	return n.send(ctx, contact, message, now)
+}
+
+// send sends a message to the contact through its preferred channel, or
+// the first fallback channel it opted in to.
+func (n *notifier) send(ctx context.Context, contact domain.PatientContact, message Message, now time.Time) (Delivery, error) {
+	patientId := contact.PatientId
+	for _, channel := range append([]string{contact.PreferredChannel}, fallbackChannels...) {
+		sender, ok := n.senders[channel]
+		address := contacts.Address(contact, channel)
+		if !ok || address == "" || !contacts.OptedIn(contact, channel) {
+			continue
+		}
+		if err := sender.Send(ctx, address, message); err != nil {
+			log.Println("[Notifier][Notify] error sending through", channel, err)
+			return Delivery{}, err
+		}
+		return Delivery{PatientId: patientId, Channel: channel, Address: address, SentAt: now}, nil
+	}
+
+	return Delivery{}, ErrNoChannel
+}
+
+// FlushJob periodically sends the queued messages that are due.
+type FlushJob struct {
+	notifier Notifier
+	interval time.Duration
+}
+
+func NewFlushJob(notifier Notifier, interval time.Duration) *FlushJob {
+	if interval <= 0 {
+		interval = DefaultFlushInterval
+	}
+	return &FlushJob{notifier: notifier, interval: interval}
+}
+
+// Run is a method that flushes the queue on every tick until ctx is done.
+func (job *FlushJob) Run(ctx context.Context) {
+	ticker := time.NewTicker(job.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		if err := job.notifier.Flush(ctx); err != nil && ctx.Err() == nil {
+			log.Println("[FlushJob][Run] error flushing queued messages", err)
+		}
+	}
+}
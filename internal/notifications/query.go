@@ -0,0 +1,9 @@
+package notifications
+
+var (
+	QueryInsertQueued = `INSERT INTO notification_queue(patients_id, subject, body, send_after, attempts, dateup) VALUES(?,?,?,?,?,?)`
+	QueryGetDue       = `SELECT id, patients_id, subject, body, send_after, attempts FROM notification_queue ` +
+		`WHERE sent_at IS NULL AND send_after <= ? AND attempts < ? ORDER BY send_after, id LIMIT ?`
+	QueryReschedule = `UPDATE notification_queue SET send_after = ?, attempts = ? WHERE id = ?`
+	QueryMarkSent   = `UPDATE notification_queue SET sent_at = ? WHERE id = ?`
+)
@@ -0,0 +1,97 @@
+package notifications
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+)
+
+var (
+	ErrPrepareStatement = errors.New("error prepare statement")
+	ErrExecStatement    = errors.New("error exec statement")
+	ErrLastInsertedId   = errors.New("error last inserted id")
+)
+
+type repository struct {
+	db *sql.DB
+}
+
+func NewRepository(db *sql.DB) Repository {
+	return &repository{db: db}
+}
+
+// Enqueue is a method that stores a message to be sent after its SendAfter.
+func (r *repository) Enqueue(ctx context.Context, queued QueuedMessage) (QueuedMessage, error) {
+	statement, err := r.db.Prepare(QueryInsertQueued)
+	if err != nil {
+		return QueuedMessage{}, ErrPrepareStatement
+	}
+	defer statement.Close()
+
+	result, err := statement.Exec(
+		queued.PatientId,
+		queued.Subject,
+		queued.Body,
+		queued.SendAfter,
+		queued.Attempts,
+		queued.DateUp,
+	)
+	if err != nil {
+		return QueuedMessage{}, ErrExecStatement
+	}
+
+	lastId, err := result.LastInsertId()
+	if err != nil {
+		return QueuedMessage{}, ErrLastInsertedId
+	}
+	queued.Id = int(lastId)
+
+	return queued, nil
+}
+
+// GetDue is a method that returns the oldest unsent messages whose time
+// came, leaving out the ones that failed too many times.
+func (r *repository) GetDue(ctx context.Context, now time.Time, limit int) ([]QueuedMessage, error) {
+	due := make([]QueuedMessage, 0)
+
+	founds, err := r.db.Query(QueryGetDue, now, maxAttempts, limit)
+	if err != nil {
+		return []QueuedMessage{}, ErrExecStatement
+	}
+	defer founds.Close()
+
+	for founds.Next() {
+		var queued QueuedMessage
+		err := founds.Scan(
+			&queued.Id,
+			&queued.PatientId,
+			&queued.Subject,
+			&queued.Body,
+			&queued.SendAfter,
+			&queued.Attempts,
+		)
+		if err != nil {
+			return []QueuedMessage{}, ErrExecStatement
+		}
+		due = append(due, queued)
+	}
+
+	return due, nil
+}
+
+// Reschedule is a method that moves a message to a later time.
+func (r *repository) Reschedule(ctx context.Context, id int, sendAfter time.Time, attempts int) error {
+	if _, err := r.db.Exec(QueryReschedule, sendAfter, attempts, id); err != nil {
+		return ErrExecStatement
+	}
+	return nil
+}
+
+// MarkSent is a method that records when a message was delivered.
+func (r *repository) MarkSent(ctx context.Context, id int, sentAt time.Time) error {
+	if _, err := r.db.Exec(QueryMarkSent, sentAt, id); err != nil {
+		return ErrExecStatement
+	}
+	return nil
+}
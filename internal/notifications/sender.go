@@ -0,0 +1,22 @@
+package notifications
+
+import (
+	"context"
+	"log"
+)
+
+type logSender struct {
+	channel string
+}
+
+// NewLogSender returns a Sender that only writes messages to the log. It
+// stands in for channels without a configured provider.
+func NewLogSender(channel string) Sender {
+	return &logSender{channel: channel}
+}
+
+// Send is a method that logs the message instead of delivering it.
+func (s *logSender) Send(ctx context.Context, address string, message Message) error {
+	log.Printf("[LogSender][Send] %s to %s: %s", s.channel, address, message.Subject)
+	return nil
+}
@@ -0,0 +1,227 @@
+package patients
+
+import (
+	"context"
+	"log"
+	"sort"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/ncondezo/final/internal/domain"
+)
+
+const (
+	DefaultDuplicateInterval = 24 * time.Hour
+
+	duplicateThreshold = 0.5
+	nameSimilarity     = 0.85
+	blockLength        = 4
+	namePrefixLength   = 3
+)
+
+var accents = strings.NewReplacer(
+	"á", "a", "é", "e", "í", "i", "ó", "o", "ú", "u", "ü", "u", "ñ", "n",
+)
+
+// DuplicateJob periodically refreshes the stored duplicate candidates.
+type DuplicateJob struct {
+	service  Service
+	interval time.Duration
+}
+
+func NewDuplicateJob(service Service, interval time.Duration) *DuplicateJob {
+	if interval <= 0 {
+		interval = DefaultDuplicateInterval
+	}
+	return &DuplicateJob{service: service, interval: interval}
+}
+
+// Run is a method that detects duplicates on every tick until ctx is done.
+func (job *DuplicateJob) Run(ctx context.Context) {
+	ticker := time.NewTicker(job.interval)
+	defer ticker.Stop()
+	for {
+		if _, err := job.service.DetectDuplicates(ctx); err != nil {
+			log.Println("[DuplicateJob][Run] error detecting duplicates", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// findDuplicates returns the pairs of patients that are likely the same
+// person, pointing from the oldest to the newest record. Only patients that
+// share a block, a part of the DNI or the start of a name, are compared, so
+// the cost grows with the size of the blocks and not with the square of the
+// patients.
+func findDuplicates(ctx context.Context, patients []domain.Patient, now time.Time) ([]domain.PatientDuplicate, error) {
+	blocks := make(map[string][]int)
+	for i, patient := range patients {
+		for _, key := range blockingKeys(patient) {
+			blocks[key] = append(blocks[key], i)
+		}
+	}
+
+	type pair struct{ first, second int }
+	compared := make(map[pair]bool)
+	duplicates := make([]domain.PatientDuplicate, 0)
+	for _, members := range blocks {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		for i := 0; i < len(members); i++ {
+			for j := i + 1; j < len(members); j++ {
+				candidate := pair{members[i], members[j]}
+				if compared[candidate] {
+					continue
+				}
+				compared[candidate] = true
+				score, reasons := duplicateScore(patients[candidate.first], patients[candidate.second])
+				if score < duplicateThreshold {
+					continue
+				}
+				duplicates = append(duplicates, domain.PatientDuplicate{
+					Patient:   patients[candidate.first],
+					Duplicate: patients[candidate.second],
+					Score:     score,
+					Reasons:   reasons,
+					DateUp:    now,
+				})
+			}
+		}
+	}
+
+	// The patients come ordered by id, the blocks in no order.
+	sort.Slice(duplicates, func(i, j int) bool {
+		if duplicates[i].Patient.Id != duplicates[j].Patient.Id {
+			return duplicates[i].Patient.Id < duplicates[j].Patient.Id
+		}
+		return duplicates[i].Duplicate.Id < duplicates[j].Duplicate.Id
+	})
+	return duplicates, nil
+}
+
+// blockingKeys returns the blocks of a patient. A DNI with one or two wrong
+// digits still shares its first or its last digits, and a misspelled name
+// usually keeps the start of the name or of the lastname.
+func blockingKeys(patient domain.Patient) []string {
+	keys := make([]string, 0, 4)
+	if dni := onlyDigits(patient.Dni); len(dni) >= blockLength {
+		keys = append(keys, "dni<"+dni[:blockLength], "dni>"+dni[len(dni)-blockLength:])
+	} else if dni != "" {
+		keys = append(keys, "dni="+dni)
+	}
+	if name := prefix(normalize(patient.Name)); name != "" {
+		keys = append(keys, "name="+name)
+	}
+	if lastname := prefix(normalize(patient.Lastname)); lastname != "" {
+		keys = append(keys, "lastname="+lastname)
+	}
+	return keys
+}
+
+func prefix(value string) string {
+	runes := []rune(value)
+	if len(runes) > namePrefixLength {
+		runes = runes[:namePrefixLength]
+	}
+	return string(runes)
+}
+
+func duplicateScore(first, second domain.Patient) (float64, []string) {
+	var score float64
+	reasons := make([]string, 0)
+
+	firstDni, secondDni := onlyDigits(first.Dni), onlyDigits(second.Dni)
+	if firstDni != "" && secondDni != "" {
+		switch distance := levenshtein(firstDni, secondDni); {
+		case distance == 0:
+			score += 0.6
+			reasons = append(reasons, "same_dni")
+		case distance == 1:
+			score += 0.45
+			reasons = append(reasons, "dni_distance_1")
+		case distance == 2 && len(firstDni) >= 7:
+			score += 0.25
+			reasons = append(reasons, "dni_distance_2")
+		}
+	}
+
+	firstName := normalize(first.Name + " " + first.Lastname)
+	secondName := normalize(second.Name + " " + second.Lastname)
+	if similarity := similarity(firstName, secondName); similarity >= nameSimilarity {
+		score += 0.3 * similarity
+		reasons = append(reasons, "similar_name")
+	}
+
+	if address := normalize(first.Address); address != "" && address == normalize(second.Address) {
+		score += 0.2
+		reasons = append(reasons, "same_address")
+	}
+
+	if score > 1 {
+		score = 1
+	}
+	return score, reasons
+}
+
+func normalize(value string) string {
+	value = accents.Replace(strings.ToLower(value))
+	return strings.Join(strings.FieldsFunc(value, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	}), " ")
+}
+
+func onlyDigits(value string) string {
+	return strings.Map(func(r rune) rune {
+		if unicode.IsDigit(r) {
+			return r
+		}
+		return -1
+	}, value)
+}
+
+func similarity(first, second string) float64 {
+	longest := len([]rune(first))
+	if length := len([]rune(second)); length > longest {
+		longest = length
+	}
+	if longest == 0 {
+		return 0
+	}
+	return 1 - float64(levenshtein(first, second))/float64(longest)
+}
+
+func levenshtein(first, second string) int {
+	a, b := []rune(first), []rune(second)
+	previous := make([]int, len(b)+1)
+	current := make([]int, len(b)+1)
+	for j := range previous {
+		previous[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		current[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			current[j] = minimum(previous[j]+1, current[j-1]+1, previous[j-1]+cost)
+		}
+		previous, current = current, previous
+	}
+	return previous[len(b)]
+}
+
+func minimum(first int, others ...int) int {
+	for _, other := range others {
+		if other < first {
+			first = other
+		}
+	}
+	return first
+}
@@ -10,6 +10,10 @@ type Repository interface {
 	Create(ctx context.Context, patient domain.Patient) (domain.Patient, error)
 	GetByID(ctx context.Context, id int) (domain.Patient, error)
 	Update(ctx context.Context, patient domain.Patient, id int) (domain.Patient, error)
-	Patch(ctx context.Context, patient domain.Patient, id int) (domain.Patient, error)
+	Patch(ctx context.Context, changes map[string]interface{}, id int) error
 	Delete(ctx context.Context, id int) error
+	GetAll(ctx context.Context) ([]domain.Patient, error)
+	SaveDuplicates(ctx context.Context, duplicates []domain.PatientDuplicate) error
+	GetDuplicates(ctx context.Context) ([]domain.PatientDuplicate, error)
+	Merge(ctx context.Context, merge domain.PatientMerge) error
 }
@@ -3,7 +3,31 @@ package patients
 var (
 	QueryInsertPatient  = `INSERT INTO patients(name, lastname, address, dni, dateup) VALUES(?,?,?,?,?)`
 	QueryGetPatientById = `SELECT * FROM patients WHERE id = ?`
+	QueryGetPatients    = `SELECT * FROM patients ORDER BY id`
 	QueryUpdatePatient  = `UPDATE patients SET name = ?, lastname = ?, address = ?, dni = ? WHERE id = ?`
-	QueryPatchPatient   = `UPDATE patients SET dni = ? WHERE id = ?`
+	QueryPatchPatient   = `UPDATE patients SET %s WHERE id = ?`
 	QueryDeletePatient  = `DELETE FROM patients WHERE id = ?`
+
+	QueryDeleteDuplicates = `DELETE FROM patient_duplicates`
+	QueryInsertDuplicate  = `INSERT INTO patient_duplicates(patients_id, duplicate_id, score, reasons, dateup) VALUES(?,?,?,?,?)`
+	QueryGetDuplicates    = `SELECT patient_duplicates.score, patient_duplicates.reasons, patient_duplicates.dateup, ` +
+		`p.id, p.name, p.lastname, p.address, p.dni, p.dateup, d.id, d.name, d.lastname, d.address, d.dni, d.dateup ` +
+		`FROM patient_duplicates INNER JOIN patients p ON p.id = patient_duplicates.patients_id ` +
+		`INNER JOIN patients d ON d.id = patient_duplicates.duplicate_id ORDER BY patient_duplicates.score DESC`
+
+	QueryMergeTurns            = `UPDATE turns SET patients_id = ? WHERE patients_id = ?`
+	QueryMergeAttachments      = `UPDATE attachments SET patients_id = ? WHERE patients_id = ?`
+	QueryMergeContacts         = `UPDATE IGNORE patient_contacts SET patients_id = ? WHERE patients_id = ?`
+	QueryMergeConsents         = `UPDATE patient_consents SET patients_id = ? WHERE patients_id = ?`
+	QueryMergeCoverages        = `UPDATE patient_coverages SET patients_id = ? WHERE patients_id = ?`
+	QueryMergeConsentGuardians = `UPDATE patient_consents SET guardian_id = ? WHERE guardian_id = ?`
+	QueryMergeGuardians        = `UPDATE IGNORE patient_guardians SET guardian_id = ? WHERE guardian_id = ?`
+	QueryMergeDependents       = `UPDATE IGNORE patient_guardians SET dependent_id = ? WHERE dependent_id = ?`
+	QueryMergeAccessLog        = `UPDATE patient_access_log SET patients_id = ? WHERE patients_id = ?`
+	QueryMergeBreakGlass       = `UPDATE break_glass_accesses SET patients_id = ? WHERE patients_id = ?`
+	QueryMergeUsers            = `UPDATE IGNORE users SET patients_id = ? WHERE patients_id = ?`
+	QueryMergeNotifications    = `UPDATE notification_queue SET patients_id = ? WHERE patients_id = ?`
+	QueryDeleteSelfGuardians   = `DELETE FROM patient_guardians WHERE guardian_id = dependent_id`
+	QueryDeleteMergeDuplicates = `DELETE FROM patient_duplicates WHERE patients_id = ? OR duplicate_id = ?`
+	QueryInsertMerge           = `INSERT INTO patient_merges(survivor_id, merged_id, snapshot, dateup) VALUES(?,?,?,?)`
 )
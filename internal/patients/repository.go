@@ -4,9 +4,12 @@ import (
 	"context"
 	"database/sql"
 	"errors"
+	"fmt"
+	"strings"
 
 	"github.com/go-sql-driver/mysql"
 	"github.com/ncondezo/final/internal/domain"
+	"github.com/ncondezo/final/pkg/patch"
 )
 
 var (
@@ -15,6 +18,7 @@ var (
 	ErrLastInsertedId   = errors.New("error last inserted id")
 	ErrNotFound         = errors.New("error not found patient")
 	ErrAlreadyExists    = errors.New("error patient already exists")
+	ErrHasRecords       = errors.New("error patient has turns, attachments or coverages")
 )
 
 type repository struct {
@@ -65,17 +69,7 @@ func (r *repository) Create(ctx context.Context, patient domain.Patient) (domain
 
 // GetByID is a method that returns a patient by ID.
 func (r *repository) GetByID(ctx context.Context, id int) (domain.Patient, error) {
-	row := r.db.QueryRow(QueryGetPatientById, id)
-
-	var patient domain.Patient
-	err := row.Scan(
-		&patient.Id,
-		&patient.Name,
-		&patient.Lastname,
-		&patient.Address,
-		&patient.Dni,
-		&patient.DateUp,
-	)
+	patient, err := scanPatient(r.db.QueryRow(QueryGetPatientById, id))
 	if err == sql.ErrNoRows {
 		return domain.Patient{}, ErrNotFound
 	}
@@ -109,26 +103,38 @@ func (r *repository) Update(ctx context.Context, patient domain.Patient, id int)
 	return patient, nil
 }
 
-// Patch is a method that updates a patient dni by ID.
-func (r *repository) Patch(ctx context.Context, patient domain.Patient, id int) (domain.Patient, error) {
-	statement, err := r.db.Prepare(QueryPatchPatient)
+// Patch is a method that updates only the changed columns of a patient by ID.
+func (r *repository) Patch(ctx context.Context, changes map[string]interface{}, id int) error {
+	var mysqlError *mysql.MySQLError
+
+	assignments, args := patch.SetClause(changes)
+	statement, err := r.db.Prepare(fmt.Sprintf(QueryPatchPatient, assignments))
 	if err != nil {
-		return domain.Patient{}, ErrPrepareStatement
+		return ErrPrepareStatement
 	}
 	defer statement.Close()
 
-	_, err = statement.Exec(patient.Dni, id)
-
+	_, err = statement.Exec(append(args, id)...)
+	if errors.As(err, &mysqlError) && mysqlError.Number == 1062 {
+		return ErrAlreadyExists
+	}
 	if err != nil {
-		return domain.Patient{}, ErrExecStatement
+		return ErrExecStatement
 	}
 
-	return patient, nil
+	return nil
 }
 
 // Delete is a method that deletes a patient by ID.
 func (r *repository) Delete(ctx context.Context, id int) error {
+	var mysqlError *mysql.MySQLError
+
 	result, err := r.db.Exec(QueryDeletePatient, id)
+	// Turns, attachments and coverages keep the patient, they are moved by
+	// a merge or anonymized by an erasure instead.
+	if errors.As(err, &mysqlError) && mysqlError.Number == 1451 {
+		return ErrHasRecords
+	}
 	if err != nil {
 		return ErrExecStatement
 	}
@@ -144,3 +150,182 @@ func (r *repository) Delete(ctx context.Context, id int) error {
 
 	return nil
 }
+
+// GetAll is a method that returns every patient.
+func (r *repository) GetAll(ctx context.Context) ([]domain.Patient, error) {
+	patients := make([]domain.Patient, 0)
+
+	founds, err := r.db.Query(QueryGetPatients)
+	if err != nil {
+		return []domain.Patient{}, ErrExecStatement
+	}
+	defer founds.Close()
+
+	for founds.Next() {
+		patient, err := scanPatient(founds)
+		if err != nil {
+			return []domain.Patient{}, ErrExecStatement
+		}
+		patients = append(patients, patient)
+	}
+
+	return patients, nil
+}
+
+// SaveDuplicates is a method that replaces the stored duplicate candidates.
+func (r *repository) SaveDuplicates(ctx context.Context, duplicates []domain.PatientDuplicate) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return ErrExecStatement
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(QueryDeleteDuplicates); err != nil {
+		return ErrExecStatement
+	}
+
+	for _, duplicate := range duplicates {
+		_, err := tx.Exec(QueryInsertDuplicate,
+			duplicate.Patient.Id,
+			duplicate.Duplicate.Id,
+			duplicate.Score,
+			strings.Join(duplicate.Reasons, ","),
+			duplicate.DateUp,
+		)
+		if err != nil {
+			return ErrExecStatement
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return ErrExecStatement
+	}
+
+	return nil
+}
+
+// GetDuplicates is a method that returns the stored duplicate candidates.
+func (r *repository) GetDuplicates(ctx context.Context) ([]domain.PatientDuplicate, error) {
+	duplicates := make([]domain.PatientDuplicate, 0)
+
+	founds, err := r.db.Query(QueryGetDuplicates)
+	if err != nil {
+		return []domain.PatientDuplicate{}, ErrExecStatement
+	}
+	defer founds.Close()
+
+	for founds.Next() {
+		var duplicate domain.PatientDuplicate
+		var reasons string
+		err := founds.Scan(
+			&duplicate.Score,
+			&reasons,
+			&duplicate.DateUp,
+			&duplicate.Patient.Id,
+			&duplicate.Patient.Name,
+			&duplicate.Patient.Lastname,
+			&duplicate.Patient.Address,
+			&duplicate.Patient.Dni,
+			&duplicate.Patient.DateUp,
+			&duplicate.Duplicate.Id,
+			&duplicate.Duplicate.Name,
+			&duplicate.Duplicate.Lastname,
+			&duplicate.Duplicate.Address,
+			&duplicate.Duplicate.Dni,
+			&duplicate.Duplicate.DateUp,
+		)
+		if err != nil {
+			return []domain.PatientDuplicate{}, ErrExecStatement
+		}
+		duplicate.Reasons = strings.Split(reasons, ",")
+		duplicates = append(duplicates, duplicate)
+	}
+
+	return duplicates, nil
+}
+
+// Merge is a method that moves the clinical data of a duplicate patient to
+// the surviving one, records the merge and deletes the duplicate, all in
+// one transaction.
+func (r *repository) Merge(ctx context.Context, merge domain.PatientMerge) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return ErrExecStatement
+	}
+	defer tx.Rollback()
+
+	mergeQueries := []string{
+		QueryMergeTurns,
+		QueryMergeAttachments,
+		QueryMergeContacts,
+		QueryMergeConsents,
+		QueryMergeCoverages,
+		QueryMergeConsentGuardians,
+		QueryMergeGuardians,
+		QueryMergeDependents,
+		QueryMergeAccessLog,
+		QueryMergeBreakGlass,
+		QueryMergeUsers,
+		QueryMergeNotifications,
+	}
+	for _, query := range mergeQueries {
+		if _, err := tx.Exec(query, merge.SurvivorId, merge.MergedId); err != nil {
+			return ErrExecStatement
+		}
+	}
+
+	// Merging a guardian with its dependent leaves a relation to itself.
+	if _, err := tx.Exec(QueryDeleteSelfGuardians); err != nil {
+		return ErrExecStatement
+	}
+
+	_, err = tx.Exec(QueryDeleteMergeDuplicates, merge.MergedId, merge.MergedId)
+	if err != nil {
+		return ErrExecStatement
+	}
+
+	_, err = tx.Exec(QueryInsertMerge,
+		merge.SurvivorId,
+		merge.MergedId,
+		merge.Snapshot,
+		merge.DateUp,
+	)
+	if err != nil {
+		return ErrExecStatement
+	}
+
+	result, err := tx.Exec(QueryDeletePatient, merge.MergedId)
+	if err != nil {
+		return ErrExecStatement
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected < 1 {
+		return ErrNotFound
+	}
+
+	if err := tx.Commit(); err != nil {
+		return ErrExecStatement
+	}
+
+	return nil
+}
+
+type scanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanPatient(scanner scanner) (domain.Patient, error) {
+	var patient domain.Patient
+	err := scanner.Scan(
+		&patient.Id,
+		&patient.Name,
+		&patient.Lastname,
+		&patient.Address,
+		&patient.Dni,
+		&patient.DateUp,
+	)
+	return patient, err
+}
@@ -2,26 +2,40 @@ package patients
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
 	"log"
 	"time"
 
+	"github.com/ncondezo/final/internal/access"
+	"github.com/ncondezo/final/internal/audit"
 	"github.com/ncondezo/final/internal/domain"
+	"github.com/ncondezo/final/pkg/patch"
+	"github.com/ncondezo/final/pkg/web"
 )
 
 type Service interface {
 	Create(ctx context.Context, dto domain.PatientDTO) (domain.Patient, error)
 	GetByID(ctx context.Context, id int) (domain.Patient, error)
+	View(ctx context.Context, id int, purpose string) (domain.Patient, error)
 	Update(ctx context.Context, dto domain.PatientDTO, id int) (domain.Patient, error)
-	Patch(ctx context.Context, dto domain.PatientDniDTO, id int) (domain.Patient, error)
+	Patch(ctx context.Context, document []byte, contentType string, id int) (domain.Patient, error)
 	Delete(ctx context.Context, id int) error
+	DetectDuplicates(ctx context.Context) ([]domain.PatientDuplicate, error)
+	GetDuplicates(ctx context.Context) ([]domain.PatientDuplicate, error)
+	Merge(ctx context.Context, dto domain.PatientMergeDTO, survivorId int) (domain.Patient, error)
 }
 
+var ErrSelfMerge = errors.New("error patient cannot be merged with itself")
+
 type service struct {
 	repository Repository
+	audit      audit.Recorder
+	access     access.Guard
 }
 
-func NewPatientService(repository Repository) Service {
-	return &service{repository: repository}
+func NewPatientService(repository Repository, audit audit.Recorder, access access.Guard) Service {
+	return &service{repository: repository, audit: audit, access: access}
 }
 
 // Create is a method that create a new patient.
@@ -38,6 +52,7 @@ func (s *service) Create(ctx context.Context, dto domain.PatientDTO) (domain.Pat
 		log.Println("[PatientsService][Create] error creating patient", err)
 		return domain.Patient{}, err
 	}
+	s.audit.Record(ctx, domain.AuditActionCreate, domain.AuditEntityPatient, patient.Id, nil, patient)
 	return patient, nil
 }
 
@@ -51,12 +66,26 @@ func (s *service) GetByID(ctx context.Context, id int) (domain.Patient, error) {
 	return patient, nil
 }
 
+// View is a method that return a patient by ID to a reader, and logs the
+// read with its purpose.
+func (s *service) View(ctx context.Context, id int, purpose string) (domain.Patient, error) {
+	patient, err := s.GetByID(ctx, id)
+	if err != nil {
+		return domain.Patient{}, err
+	}
+	if err := s.access.Check(ctx, id, domain.AccessResourcePatient, id, purpose); err != nil {
+		return domain.Patient{}, err
+	}
+	return patient, nil
+}
+
 // Update is a method that update a patient by ID.
 func (s *service) Update(ctx context.Context, dto domain.PatientDTO, id int) (domain.Patient, error) {
 	patient, err := s.GetByID(ctx, id)
 	if err != nil {
 		return domain.Patient{}, err
 	}
+	before := patient
 	patient.Name = dto.Name
 	patient.Lastname = dto.Lastname
 	patient.Address = dto.Address
@@ -66,30 +95,136 @@ func (s *service) Update(ctx context.Context, dto domain.PatientDTO, id int) (do
 		log.Println("[PatientsService][Update] error updating patient", err)
 		return domain.Patient{}, err
 	}
+	s.audit.Record(ctx, domain.AuditActionUpdate, domain.AuditEntityPatient, id, before, patient)
 	return patient, nil
 }
 
-// Patch is a method that update a patient dni by ID.
-func (s *service) Patch(ctx context.Context, dto domain.PatientDniDTO, id int) (domain.Patient, error) {
+// Patch is a method that apply a merge patch or JSON patch to a patient by ID.
+// Only the fields that end up changed are written.
+func (s *service) Patch(ctx context.Context, document []byte, contentType string, id int) (domain.Patient, error) {
 	patient, err := s.GetByID(ctx, id)
 	if err != nil {
 		return domain.Patient{}, err
 	}
-	patient.Dni = dto.Dni
-	patient, err = s.repository.Patch(ctx, patient, id)
-	if err != nil {
+
+	current := domain.PatientDTO{
+		Name:     patient.Name,
+		Lastname: patient.Lastname,
+		Address:  patient.Address,
+		Dni:      patient.Dni,
+	}
+	var patched domain.PatientDTO
+	if err := patch.Apply(current, document, contentType, &patched); err != nil {
+		return domain.Patient{}, err
+	}
+	if reason := web.RequestJsonValidation(patched); reason != "" {
+		return domain.Patient{}, &patch.ResultError{Reason: reason}
+	}
+
+	changes := map[string]interface{}{}
+	if patched.Name != current.Name {
+		changes["name"] = patched.Name
+	}
+	if patched.Lastname != current.Lastname {
+		changes["lastname"] = patched.Lastname
+	}
+	if patched.Address != current.Address {
+		changes["address"] = patched.Address
+	}
+	if patched.Dni != current.Dni {
+		changes["dni"] = patched.Dni
+	}
+	if len(changes) == 0 {
+		return patient, nil
+	}
+
+	if err := s.repository.Patch(ctx, changes, id); err != nil {
 		log.Println("[PatientsService][Patch] error patching patient", err)
 		return domain.Patient{}, err
 	}
-	return patient, nil
+	updated, err := s.GetByID(ctx, id)
+	if err != nil {
+		return domain.Patient{}, err
+	}
+	s.audit.Record(ctx, domain.AuditActionUpdate, domain.AuditEntityPatient, id, patient, updated)
+	return updated, nil
 }
 
 // Delete is a method that delete a patient by ID.
 func (s *service) Delete(ctx context.Context, id int) error {
-	err := s.repository.Delete(ctx, id)
+	patient, err := s.GetByID(ctx, id)
+	if err != nil {
+		return err
+	}
+	err = s.repository.Delete(ctx, id)
 	if err != nil {
 		log.Println("[PatientsService][Delete] error deleting patient", err)
 		return err
 	}
+	s.audit.Record(ctx, domain.AuditActionDelete, domain.AuditEntityPatient, id, patient, nil)
 	return nil
 }
+
+// DetectDuplicates is a method that searches and stores likely duplicate patients.
+func (s *service) DetectDuplicates(ctx context.Context) ([]domain.PatientDuplicate, error) {
+	patients, err := s.repository.GetAll(ctx)
+	if err != nil {
+		log.Println("[PatientsService][DetectDuplicates] error getting patients", err)
+		return []domain.PatientDuplicate{}, err
+	}
+	duplicates, err := findDuplicates(ctx, patients, time.Now())
+	if err != nil {
+		log.Println("[PatientsService][DetectDuplicates] detection stopped", err)
+		return []domain.PatientDuplicate{}, err
+	}
+	err = s.repository.SaveDuplicates(ctx, duplicates)
+	if err != nil {
+		log.Println("[PatientsService][DetectDuplicates] error saving duplicates", err)
+		return []domain.PatientDuplicate{}, err
+	}
+	return duplicates, nil
+}
+
+// GetDuplicates is a method that return the last detected duplicate patients.
+func (s *service) GetDuplicates(ctx context.Context) ([]domain.PatientDuplicate, error) {
+	duplicates, err := s.repository.GetDuplicates(ctx)
+	if err != nil {
+		log.Println("[PatientsService][GetDuplicates] error getting duplicates", err)
+		return []domain.PatientDuplicate{}, err
+	}
+	return duplicates, nil
+}
+
+// Merge is a method that merge a duplicate patient into the surviving one.
+func (s *service) Merge(ctx context.Context, dto domain.PatientMergeDTO, survivorId int) (domain.Patient, error) {
+	if dto.IdDuplicate == survivorId {
+		return domain.Patient{}, ErrSelfMerge
+	}
+	survivor, err := s.GetByID(ctx, survivorId)
+	if err != nil {
+		return domain.Patient{}, err
+	}
+	duplicate, err := s.GetByID(ctx, dto.IdDuplicate)
+	if err != nil {
+		return domain.Patient{}, err
+	}
+	snapshot, err := json.Marshal(duplicate)
+	if err != nil {
+		return domain.Patient{}, err
+	}
+	err = s.repository.Merge(ctx, domain.PatientMerge{
+		SurvivorId: survivor.Id,
+		MergedId:   duplicate.Id,
+		Snapshot:   string(snapshot),
+		DateUp:     time.Now(),
+	})
+	if err != nil {
+		log.Println("[PatientsService][Merge] error merging patients", err)
+		return domain.Patient{}, err
+	}
+	// The duplicate is gone, its turns and records now belong to the survivor.
+	s.audit.Record(ctx, domain.AuditActionMerge, domain.AuditEntityPatient, duplicate.Id, duplicate, nil)
+	s.audit.Record(ctx, domain.AuditActionMerge, domain.AuditEntityPatient, survivor.Id, nil,
+		map[string]interface{}{"merged_id": duplicate.Id})
+	return survivor, nil
+}
@@ -0,0 +1,12 @@
+package privacy
+
+import (
+	"context"
+
+	"github.com/ncondezo/final/internal/domain"
+)
+
+type Repository interface {
+	GetMergesByPatient(ctx context.Context, patientId int) ([]domain.PatientMerge, error)
+	Erase(ctx context.Context, erasure domain.PatientErasure) (domain.PatientErasure, error)
+}
@@ -0,0 +1,19 @@
+package privacy
+
+var (
+	QueryGetMergesByPatient = `SELECT id, survivor_id, merged_id, snapshot, dateup FROM patient_merges WHERE survivor_id = ? ORDER BY dateup`
+
+	QueryGetStorageKeys = `SELECT attachments.storage_key, attachment_radiographs.preview_key FROM attachments ` +
+		`LEFT JOIN attachment_radiographs ON attachment_radiographs.attachments_id = attachments.id WHERE attachments.patients_id = ?`
+	QueryAnonymizePatient    = `UPDATE patients SET name = ?, lastname = ?, address = '', dni = CONCAT('X', id) WHERE id = ?`
+	QueryClearTurns          = `UPDATE turns SET description = '' WHERE patients_id = ?`
+	QueryDeleteRadiographs   = `DELETE attachment_radiographs FROM attachment_radiographs INNER JOIN attachments ON attachments.id = attachment_radiographs.attachments_id WHERE attachments.patients_id = ?`
+	QueryDeleteAttachments   = `DELETE FROM attachments WHERE patients_id = ?`
+	QueryDeleteContact       = `DELETE FROM patient_contacts WHERE patients_id = ?`
+	QueryClearAffiliates     = `UPDATE patient_coverages SET affiliate_number = '' WHERE patients_id = ?`
+	QueryDeleteDuplicates    = `DELETE FROM patient_duplicates WHERE patients_id = ? OR duplicate_id = ?`
+	QueryClearMergeSnapshot  = `UPDATE patient_merges SET snapshot = '{}' WHERE survivor_id = ?`
+	QueryUnlinkUsers         = `UPDATE users SET patients_id = NULL WHERE patients_id = ?`
+	QueryDeleteNotifications = `DELETE FROM notification_queue WHERE patients_id = ?`
+	QueryInsertErasure       = `INSERT INTO patient_erasures(patients_id, dateup) VALUES(?,?)`
+)
@@ -0,0 +1,114 @@
+package privacy
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+
+	"github.com/ncondezo/final/internal/domain"
+	"github.com/ncondezo/final/internal/patients"
+)
+
+const anonymized = "ANONIMIZADO"
+
+var (
+	ErrExecStatement = errors.New("error exec statement")
+)
+
+type repository struct {
+	db *sql.DB
+}
+
+func NewRepository(db *sql.DB) Repository {
+	return &repository{db: db}
+}
+
+// GetMergesByPatient is a method that returns the merges into a patient.
+func (r *repository) GetMergesByPatient(ctx context.Context, patientId int) ([]domain.PatientMerge, error) {
+	merges := make([]domain.PatientMerge, 0)
+
+	founds, err := r.db.Query(QueryGetMergesByPatient, patientId)
+	if err != nil {
+		return []domain.PatientMerge{}, ErrExecStatement
+	}
+	defer founds.Close()
+
+	for founds.Next() {
+		var merge domain.PatientMerge
+		err := founds.Scan(
+			&merge.Id,
+			&merge.SurvivorId,
+			&merge.MergedId,
+			&merge.Snapshot,
+			&merge.DateUp,
+		)
+		if err != nil {
+			return []domain.PatientMerge{}, ErrExecStatement
+		}
+		merges = append(merges, merge)
+	}
+
+	return merges, nil
+}
+
+// Erase is a method that anonymizes the personal data of a patient in one
+// transaction. Turn dates, dentists and procedures are kept for statistics,
+// the users linked to the patient are unlinked. It returns the blob keys that have to be removed from the storage.
+func (r *repository) Erase(ctx context.Context, erasure domain.PatientErasure) (domain.PatientErasure, error) {
+	if _, err := patients.NewRepository(r.db).GetByID(ctx, erasure.PatientId); err != nil {
+		return domain.PatientErasure{}, err
+	}
+
+	tx, err := r.db.Begin()
+	if err != nil {
+		return domain.PatientErasure{}, ErrExecStatement
+	}
+	defer tx.Rollback()
+
+	keys, err := tx.Query(QueryGetStorageKeys, erasure.PatientId)
+	if err != nil {
+		return domain.PatientErasure{}, ErrExecStatement
+	}
+	for keys.Next() {
+		var key string
+		var previewKey sql.NullString
+		if err := keys.Scan(&key, &previewKey); err != nil {
+			keys.Close()
+			return domain.PatientErasure{}, ErrExecStatement
+		}
+		erasure.StorageKeys = append(erasure.StorageKeys, key)
+		if previewKey.Valid {
+			erasure.StorageKeys = append(erasure.StorageKeys, previewKey.String)
+		}
+	}
+	keys.Close()
+
+	id := erasure.PatientId
+	statements := []struct {
+		query string
+		args  []interface{}
+	}{
+		{QueryAnonymizePatient, []interface{}{anonymized, anonymized, id}},
+		{QueryClearTurns, []interface{}{id}},
+		{QueryDeleteRadiographs, []interface{}{id}},
+		{QueryDeleteAttachments, []interface{}{id}},
+		{QueryDeleteContact, []interface{}{id}},
+		{QueryClearAffiliates, []interface{}{id}},
+		{QueryDeleteDuplicates, []interface{}{id, id}},
+		{QueryClearMergeSnapshot, []interface{}{id}},
+		{QueryUnlinkUsers, []interface{}{id}},
+		{QueryDeleteNotifications, []interface{}{id}},
+		{QueryInsertErasure, []interface{}{id, erasure.DateUp}},
+	}
+	for _, statement := range statements {
+		if _, err := tx.Exec(statement.query, statement.args...); err != nil {
+			return domain.PatientErasure{}, ErrExecStatement
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return domain.PatientErasure{}, ErrExecStatement
+	}
+
+	return erasure, nil
+}
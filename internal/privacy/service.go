@@ -0,0 +1,263 @@
+package privacy
+
+import (
+	"archive/zip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"path"
+	"sort"
+	"time"
+
+	"github.com/ncondezo/final/internal/access"
+	"github.com/ncondezo/final/internal/attachments"
+	"github.com/ncondezo/final/internal/audit"
+	"github.com/ncondezo/final/internal/contacts"
+	"github.com/ncondezo/final/internal/domain"
+	"github.com/ncondezo/final/internal/family"
+	"github.com/ncondezo/final/internal/insurance"
+	"github.com/ncondezo/final/internal/patients"
+	"github.com/ncondezo/final/internal/turns"
+	"github.com/ncondezo/final/pkg/blob"
+)
+
+type Service interface {
+	Export(ctx context.Context, patientId int) (domain.PatientExport, error)
+	WriteArchive(ctx context.Context, export domain.PatientExport, w io.Writer) error
+	Erase(ctx context.Context, patientId int) (domain.Patient, error)
+}
+
+type service struct {
+	repository  Repository
+	patients    patients.Repository
+	turns       turns.Repository
+	contacts    contacts.Repository
+	family      family.Repository
+	insurance   insurance.Repository
+	attachments attachments.Repository
+	store       blob.BlobStore
+	audit       audit.Service
+	access      access.Repository
+}
+
+func NewPrivacyService(repository Repository, patients patients.Repository, turns turns.Repository,
+	contacts contacts.Repository, family family.Repository, insurance insurance.Repository, attachments attachments.Repository,
+	store blob.BlobStore, audit audit.Service, access access.Repository) Service {
+	return &service{
+		repository:  repository,
+		patients:    patients,
+		turns:       turns,
+		contacts:    contacts,
+		family:      family,
+		insurance:   insurance,
+		attachments: attachments,
+		store:       store,
+		audit:       audit,
+		access:      access,
+	}
+}
+
+// Export is a method that gathers everything held about a patient, with the
+// audit entries of the patient, of its turns and of the patients merged into
+// it, and the log of who read it.
+func (s *service) Export(ctx context.Context, patientId int) (domain.PatientExport, error) {
+	patient, err := s.patients.GetByID(ctx, patientId)
+	if err != nil {
+		log.Println("[PrivacyService][Export] error getting patient by id", err)
+		return domain.PatientExport{}, err
+	}
+
+	contact, err := s.contacts.GetByPatientID(ctx, patientId)
+	if err != nil {
+		log.Println("[PrivacyService][Export] error getting contact", err)
+		return domain.PatientExport{}, err
+	}
+
+	guardians, err := s.family.GetGuardians(ctx, patientId)
+	if err != nil {
+		log.Println("[PrivacyService][Export] error getting guardians", err)
+		return domain.PatientExport{}, err
+	}
+
+	dependents, err := s.family.GetDependents(ctx, patientId)
+	if err != nil {
+		log.Println("[PrivacyService][Export] error getting dependents", err)
+		return domain.PatientExport{}, err
+	}
+
+	coverages, err := s.insurance.GetCoveragesByPatient(ctx, patientId)
+	if err != nil {
+		log.Println("[PrivacyService][Export] error getting coverages", err)
+		return domain.PatientExport{}, err
+	}
+
+	patientTurns, err := s.turns.GetByPatientID(ctx, patientId)
+	if err != nil {
+		log.Println("[PrivacyService][Export] error getting turns", err)
+		return domain.PatientExport{}, err
+	}
+	for i := range patientTurns {
+		quote, err := s.insurance.GetTurnCoverage(ctx, patientTurns[i].Id)
+		if errors.Is(err, insurance.ErrCoverageNotFound) {
+			continue
+		}
+		if err != nil {
+			log.Println("[PrivacyService][Export] error getting turn coverage", err)
+			return domain.PatientExport{}, err
+		}
+		patientTurns[i].Coverage = &quote
+	}
+
+	files, err := s.attachments.GetByPatientID(ctx, patientId)
+	if err != nil {
+		log.Println("[PrivacyService][Export] error getting attachments", err)
+		return domain.PatientExport{}, err
+	}
+
+	merges, err := s.repository.GetMergesByPatient(ctx, patientId)
+	if err != nil {
+		log.Println("[PrivacyService][Export] error getting merges", err)
+		return domain.PatientExport{}, err
+	}
+
+	auditLog, err := s.history(ctx, patientId, patientTurns, merges)
+	if err != nil {
+		log.Println("[PrivacyService][Export] error getting audit entries", err)
+		return domain.PatientExport{}, err
+	}
+
+	accesses, err := s.access.GetByPatient(ctx, patientId)
+	if err != nil {
+		log.Println("[PrivacyService][Export] error getting accesses", err)
+		return domain.PatientExport{}, err
+	}
+
+	breakGlass, err := s.access.GetBreakGlassByPatient(ctx, patientId)
+	if err != nil {
+		log.Println("[PrivacyService][Export] error getting break-the-glass accesses", err)
+		return domain.PatientExport{}, err
+	}
+
+	return domain.PatientExport{
+		ExportedAt:  time.Now(),
+		Patient:     patient,
+		Contact:     contact,
+		Guardians:   guardians,
+		Dependents:  dependents,
+		Coverages:   coverages,
+		Turns:       patientTurns,
+		Attachments: files,
+		Merges:      merges,
+		AuditLog:    auditLog,
+		Accesses:    accesses,
+		BreakGlass:  breakGlass,
+	}, nil
+}
+
+// history returns the audit entries of a patient, of its turns and of the
+// patients merged into it, the oldest first.
+func (s *service) history(ctx context.Context, patientId int, patientTurns []domain.Turn, merges []domain.PatientMerge) ([]domain.AuditEntry, error) {
+	entries, err := s.audit.History(ctx, domain.AuditEntityPatient, patientId)
+	if err != nil {
+		return []domain.AuditEntry{}, err
+	}
+	for _, turn := range patientTurns {
+		turnEntries, err := s.audit.History(ctx, domain.AuditEntityTurn, turn.Id)
+		if err != nil {
+			return []domain.AuditEntry{}, err
+		}
+		entries = append(entries, turnEntries...)
+	}
+	for _, merge := range merges {
+		mergedEntries, err := s.audit.History(ctx, domain.AuditEntityPatient, merge.MergedId)
+		if err != nil {
+			return []domain.AuditEntry{}, err
+		}
+		entries = append(entries, mergedEntries...)
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].Id < entries[j].Id
+	})
+	return entries, nil
+}
+
+// WriteArchive is a method that writes an export as a zip with a
+// patient.json document and the content of every attachment.
+func (s *service) WriteArchive(ctx context.Context, export domain.PatientExport, w io.Writer) error {
+	archive := zip.NewWriter(w)
+
+	document, err := archive.Create("patient.json")
+	if err != nil {
+		return err
+	}
+	encoder := json.NewEncoder(document)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(export); err != nil {
+		return err
+	}
+
+	for _, attachment := range export.Attachments {
+		if err := s.writeAttachment(ctx, archive, attachment); err != nil {
+			log.Println("[PrivacyService][WriteArchive] error writing attachment", err)
+			return err
+		}
+	}
+
+	return archive.Close()
+}
+
+// Erase is a method that anonymizes a patient and removes its files.
+func (s *service) Erase(ctx context.Context, patientId int) (domain.Patient, error) {
+	before, err := s.patients.GetByID(ctx, patientId)
+	if err != nil {
+		log.Println("[PrivacyService][Erase] error getting patient by id", err)
+		return domain.Patient{}, err
+	}
+
+	erasure, err := s.repository.Erase(ctx, domain.PatientErasure{
+		PatientId: patientId,
+		DateUp:    time.Now(),
+	})
+	if err != nil {
+		log.Println("[PrivacyService][Erase] error erasing patient", err)
+		return domain.Patient{}, err
+	}
+
+	for _, key := range erasure.StorageKeys {
+		if err := s.store.Delete(ctx, key); err != nil && !errors.Is(err, blob.ErrNotFound) {
+			log.Println("[PrivacyService][Erase] error deleting blob", key, err)
+		}
+	}
+
+	patient, err := s.patients.GetByID(ctx, patientId)
+	if err != nil {
+		log.Println("[PrivacyService][Erase] error getting patient by id", err)
+		return domain.Patient{}, err
+	}
+	s.audit.Record(ctx, domain.AuditActionErase, domain.AuditEntityPatient, patientId, before, patient)
+	return patient, nil
+}
+
+func (s *service) writeAttachment(ctx context.Context, archive *zip.Writer, attachment domain.Attachment) error {
+	content, err := s.store.Get(ctx, attachment.StorageKey)
+	if err != nil {
+		return err
+	}
+	defer content.Close()
+
+	name := fmt.Sprintf("attachments/%d-%s", attachment.Id, path.Base(attachment.Filename))
+	file, err := archive.CreateHeader(&zip.FileHeader{
+		Name:     name,
+		Method:   zip.Deflate,
+		Modified: attachment.DateUp,
+	})
+	if err != nil {
+		return err
+	}
+
+	_, err = io.Copy(file, content)
+	return err
+}
@@ -2,6 +2,7 @@ package turns
 
 import (
 	"context"
+	"time"
 
 	"github.com/ncondezo/final/internal/domain"
 )
@@ -10,6 +11,9 @@ type Repository interface {
 	Create(ctx context.Context, turn domain.Turn) (domain.Turn, error)
 	GetByID(ctx context.Context, id int) (domain.Turn, error)
 	GetByPatientID(ctx context.Context, patientId int) ([]domain.Turn, error)
+	GetByDentistID(ctx context.Context, dentistId int, from time.Time, to time.Time) ([]domain.Turn, error)
+	GetPatientsByDentist(ctx context.Context, dentistId int) ([]domain.Patient, error)
 	Update(ctx context.Context, turn domain.Turn, id int) (domain.Turn, error)
+	Patch(ctx context.Context, changes map[string]interface{}, id int) error
 	Delete(ctx context.Context, id int) error
 }
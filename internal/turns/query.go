@@ -1,9 +1,20 @@
 package turns
 
+const (
+	turnColumns = `turns.id, turns.date, turns.description, turns.procedures_code, turns.created_by, turns.updated_by, ` +
+		`patients.id, patients.name, patients.lastname, patients.address, patients.dni, patients.dateup, ` +
+		`dentists.id, dentists.name, dentists.lastname, dentists.registry, dentists.active`
+	turnJoins = `FROM turns INNER JOIN patients ON patients.id = turns.patients_id INNER JOIN dentists ON dentists.id = turns.dentists_id`
+)
+
 var (
-	QueryInsertTurn       = `INSERT INTO turns(date, description, patients_id, dentists_id) VALUES (?,?,?,?)`
-	QueryGetTurnById      = `SELECT * FROM turns INNER JOIN patients ON patients.id = turns.patients_id INNER JOIN dentists ON dentists.id = turns.dentists_id WHERE turns.id = ?`
-	QueryGetTurnByPatient = `SELECT * FROM turns INNER JOIN patients ON patients.id = turns.patients_id INNER JOIN dentists ON dentists.id = turns.dentists_id WHERE turns.patients_id = ?`
-	QueryUpdateTurn       = `UPDATE turns SET date = ?, description = ?, dentists_id = ? WHERE id = ?`
-	QueryDeleteTurn       = `DELETE FROM turns WHERE id = ?`
+	QueryInsertTurn           = `INSERT INTO turns(date, description, patients_id, dentists_id, procedures_code, created_by, updated_by) VALUES (?,?,?,?,?,?,?)`
+	QueryGetTurnById          = `SELECT ` + turnColumns + ` ` + turnJoins + ` WHERE turns.id = ?`
+	QueryGetTurnByPatient     = `SELECT ` + turnColumns + ` ` + turnJoins + ` WHERE turns.patients_id = ?`
+	QueryGetTurnByDentist     = `SELECT ` + turnColumns + ` ` + turnJoins + ` WHERE turns.dentists_id = ? AND turns.date BETWEEN ? AND ? ORDER BY turns.date, turns.id`
+	QueryGetPatientsByDentist = `SELECT DISTINCT patients.id, patients.name, patients.lastname, patients.address, patients.dni, patients.dateup FROM patients ` +
+		`INNER JOIN turns ON turns.patients_id = patients.id WHERE turns.dentists_id = ? ORDER BY patients.lastname, patients.name`
+	QueryUpdateTurn = `UPDATE turns SET date = ?, description = ?, dentists_id = ?, procedures_code = ?, updated_by = ? WHERE id = ?`
+	QueryPatchTurn  = `UPDATE turns SET %s WHERE id = ?`
+	QueryDeleteTurn = `DELETE FROM turns WHERE id = ?`
 )
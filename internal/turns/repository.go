@@ -4,17 +4,24 @@ import (
 	"context"
 	"database/sql"
 	"errors"
+	"fmt"
+	"time"
 
 	"github.com/ncondezo/final/internal/dentists"
 	"github.com/ncondezo/final/internal/domain"
+	"github.com/ncondezo/final/internal/insurance"
 	"github.com/ncondezo/final/internal/patients"
+	"github.com/ncondezo/final/pkg/patch"
 )
 
 var (
-	ErrPrepareStatement = errors.New("error prepare statement")
-	ErrExecStatement    = errors.New("error exec statement")
-	ErrLastInsertedId   = errors.New("error last inserted id")
-	ErrNotFound         = errors.New("error not found turn")
+	ErrPrepareStatement  = errors.New("error prepare statement")
+	ErrExecStatement     = errors.New("error exec statement")
+	ErrLastInsertedId    = errors.New("error last inserted id")
+	ErrNotFound          = errors.New("error not found turn")
+	ErrSpecialtyMismatch = errors.New("error dentist lacks the specialty required by the procedure")
+	ErrDentistInactive   = errors.New("error dentist is inactive")
+	ErrInvalidDate       = errors.New("error turn date is missing or in the past")
 )
 
 type repository struct {
@@ -37,6 +44,13 @@ func (r *repository) Create(ctx context.Context, turn domain.Turn) (domain.Turn,
 	if err != nil {
 		return domain.Turn{}, err
 	}
+	if !dentist.Active {
+		return domain.Turn{}, ErrDentistInactive
+	}
+
+	if err := r.checkProcedure(ctx, turn.Procedure, turn.Dentist.Id); err != nil {
+		return domain.Turn{}, err
+	}
 
 	statement, err := r.db.Prepare(QueryInsertTurn)
 	if err != nil {
@@ -49,6 +63,9 @@ func (r *repository) Create(ctx context.Context, turn domain.Turn) (domain.Turn,
 		turn.Description,
 		turn.Patient.Id,
 		turn.Dentist.Id,
+		procedureCode(turn.Procedure),
+		domain.ActorFrom(ctx),
+		domain.ActorFrom(ctx),
 	)
 	if err != nil {
 		return domain.Turn{}, ErrExecStatement
@@ -60,6 +77,8 @@ func (r *repository) Create(ctx context.Context, turn domain.Turn) (domain.Turn,
 	}
 
 	turn.Id = int(lastId)
+	turn.CreatedBy = domain.ActorFrom(ctx)
+	turn.UpdatedBy = domain.ActorFrom(ctx)
 	turn.Patient = patient
 	turn.Dentist = dentist
 
@@ -68,28 +87,7 @@ func (r *repository) Create(ctx context.Context, turn domain.Turn) (domain.Turn,
 
 // GetByID is a method that returns a turn by ID.
 func (r *repository) GetByID(ctx context.Context, id int) (domain.Turn, error) {
-	var ignored int
-	var ignored2 int
-	row := r.db.QueryRow(QueryGetTurnById, id)
-
-	var turn domain.Turn
-	err := row.Scan(
-		&turn.Id,
-		&turn.Date,
-		&turn.Description,
-		&ignored,
-		&ignored2,
-		&turn.Patient.Id,
-		&turn.Patient.Name,
-		&turn.Patient.Lastname,
-		&turn.Patient.Address,
-		&turn.Patient.Dni,
-		&turn.Patient.DateUp,
-		&turn.Dentist.Id,
-		&turn.Dentist.Name,
-		&turn.Dentist.LastName,
-		&turn.Dentist.Registration,
-	)
+	turn, err := scanTurn(r.db.QueryRow(QueryGetTurnById, id))
 	if errors.Is(err, sql.ErrNoRows) {
 		return domain.Turn{}, ErrNotFound
 	}
@@ -102,39 +100,70 @@ func (r *repository) GetByID(ctx context.Context, id int) (domain.Turn, error) {
 
 // GetByPatientID is a method that returns a list of turns by PatientID.
 func (r *repository) GetByPatientID(ctx context.Context, patientId int) ([]domain.Turn, error) {
-	turns := make([]domain.Turn, 0)
-
 	_, err := patients.NewRepository(r.db).GetByID(ctx, patientId)
 	if err != nil {
 		return []domain.Turn{}, err
 	}
 
 	founds, err := r.db.Query(QueryGetTurnByPatient, patientId)
+	if err != nil {
+		return []domain.Turn{}, ErrExecStatement
+	}
 	defer founds.Close()
+
+	return scanTurns(founds)
+}
+
+// GetByDentistID is a method that returns the turns of a dentist between two dates.
+func (r *repository) GetByDentistID(ctx context.Context, dentistId int, from time.Time, to time.Time) ([]domain.Turn, error) {
+	_, err := dentists.NewRepository(r.db).GetByID(ctx, dentistId)
+	if err != nil {
+		return []domain.Turn{}, err
+	}
+
+	founds, err := r.db.Query(QueryGetTurnByDentist, dentistId, from, to)
 	if err != nil {
 		return []domain.Turn{}, ErrExecStatement
 	}
+	defer founds.Close()
+
+	return scanTurns(founds)
+}
+
+// GetPatientsByDentist is a method that returns the patients with turns with a dentist.
+func (r *repository) GetPatientsByDentist(ctx context.Context, dentistId int) ([]domain.Patient, error) {
+	dentistPatients := make([]domain.Patient, 0)
+
+	founds, err := r.db.Query(QueryGetPatientsByDentist, dentistId)
+	if err != nil {
+		return []domain.Patient{}, ErrExecStatement
+	}
+	defer founds.Close()
 
 	for founds.Next() {
-		var turn domain.Turn
-		var ignored int
+		var patient domain.Patient
 		err := founds.Scan(
-			&turn.Id,
-			&turn.Date,
-			&turn.Description,
-			&ignored,
-			&ignored,
-			&turn.Patient.Id,
-			&turn.Patient.Name,
-			&turn.Patient.Lastname,
-			&turn.Patient.Address,
-			&turn.Patient.Dni,
-			&turn.Patient.DateUp,
-			&turn.Dentist.Id,
-			&turn.Dentist.Name,
-			&turn.Dentist.LastName,
-			&turn.Dentist.Registration,
+			&patient.Id,
+			&patient.Name,
+			&patient.Lastname,
+			&patient.Address,
+			&patient.Dni,
+			&patient.DateUp,
 		)
+		if err != nil {
+			return []domain.Patient{}, ErrExecStatement
+		}
+		dentistPatients = append(dentistPatients, patient)
+	}
+
+	return dentistPatients, nil
+}
+
+func scanTurns(founds *sql.Rows) ([]domain.Turn, error) {
+	turns := make([]domain.Turn, 0)
+
+	for founds.Next() {
+		turn, err := scanTurn(founds)
 		if err != nil {
 			return []domain.Turn{}, ErrExecStatement
 		}
@@ -144,6 +173,45 @@ func (r *repository) GetByPatientID(ctx context.Context, patientId int) ([]domai
 	return turns, nil
 }
 
+type scanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanTurn(row scanner) (domain.Turn, error) {
+	var turn domain.Turn
+	var procedure, createdBy, updatedBy sql.NullString
+	err := row.Scan(
+		&turn.Id,
+		&turn.Date,
+		&turn.Description,
+		&procedure,
+		&createdBy,
+		&updatedBy,
+		&turn.Patient.Id,
+		&turn.Patient.Name,
+		&turn.Patient.Lastname,
+		&turn.Patient.Address,
+		&turn.Patient.Dni,
+		&turn.Patient.DateUp,
+		&turn.Dentist.Id,
+		&turn.Dentist.Name,
+		&turn.Dentist.LastName,
+		&turn.Dentist.Registration,
+		&turn.Dentist.Active,
+	)
+	if err != nil {
+		return domain.Turn{}, err
+	}
+	turn.Procedure = procedure.String
+	if createdBy.Valid {
+		turn.CreatedBy = &createdBy.String
+	}
+	if updatedBy.Valid {
+		turn.UpdatedBy = &updatedBy.String
+	}
+	return turn, nil
+}
+
 // Update is a method that updates a turn by ID.
 func (r *repository) Update(ctx context.Context, turn domain.Turn, id int) (domain.Turn, error) {
 	dentist, err := dentists.NewRepository(r.db).GetByID(ctx, turn.Dentist.Id)
@@ -151,6 +219,10 @@ func (r *repository) Update(ctx context.Context, turn domain.Turn, id int) (doma
 		return domain.Turn{}, err
 	}
 
+	if err := r.checkProcedure(ctx, turn.Procedure, turn.Dentist.Id); err != nil {
+		return domain.Turn{}, err
+	}
+
 	statement, err := r.db.Prepare(QueryUpdateTurn)
 	if err != nil {
 		return domain.Turn{}, ErrPrepareStatement
@@ -161,6 +233,8 @@ func (r *repository) Update(ctx context.Context, turn domain.Turn, id int) (doma
 		turn.Date,
 		turn.Description,
 		turn.Dentist.Id,
+		procedureCode(turn.Procedure),
+		domain.ActorFrom(ctx),
 		id,
 	)
 
@@ -169,10 +243,42 @@ func (r *repository) Update(ctx context.Context, turn domain.Turn, id int) (doma
 	}
 
 	turn.Dentist = dentist
+	turn.UpdatedBy = domain.ActorFrom(ctx)
 
 	return turn, nil
 }
 
+// Patch is a method that updates only the changed columns of a turn by ID.
+func (r *repository) Patch(ctx context.Context, changes map[string]interface{}, id int) error {
+	dentistId, ok := changes["dentists_id"].(int)
+	if ok {
+		if _, err := dentists.NewRepository(r.db).GetByID(ctx, dentistId); err != nil {
+			return err
+		}
+	}
+	if code, ok := changes["procedures_code"].(string); ok {
+		if err := r.checkProcedure(ctx, code, dentistId); err != nil {
+			return err
+		}
+		changes["procedures_code"] = procedureCode(code)
+	}
+
+	changes["updated_by"] = domain.ActorFrom(ctx)
+	assignments, args := patch.SetClause(changes)
+	statement, err := r.db.Prepare(fmt.Sprintf(QueryPatchTurn, assignments))
+	if err != nil {
+		return ErrPrepareStatement
+	}
+	defer statement.Close()
+
+	_, err = statement.Exec(append(args, id)...)
+	if err != nil {
+		return ErrExecStatement
+	}
+
+	return nil
+}
+
 // Delete is a method that deletes a turn by ID.
 func (r *repository) Delete(ctx context.Context, id int) error {
 	result, err := r.db.Exec(QueryDeleteTurn, id)
@@ -191,3 +297,30 @@ func (r *repository) Delete(ctx context.Context, id int) error {
 
 	return nil
 }
+
+// checkProcedure validates the procedure of a turn and, when the procedure
+// requires a specialty, that the dentist has it.
+func (r *repository) checkProcedure(ctx context.Context, code string, dentistId int) error {
+	if code == "" {
+		return nil
+	}
+	procedure, err := insurance.NewRepository(r.db).GetProcedure(ctx, code)
+	if err != nil {
+		return err
+	}
+	if procedure.Specialty == "" {
+		return nil
+	}
+	ok, err := dentists.NewRepository(r.db).HasSpecialty(ctx, dentistId, procedure.Specialty)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return ErrSpecialtyMismatch
+	}
+	return nil
+}
+
+func procedureCode(code string) sql.NullString {
+	return sql.NullString{String: code, Valid: code != ""}
+}
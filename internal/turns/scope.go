@@ -0,0 +1,20 @@
+package turns
+
+import (
+	"context"
+	"errors"
+
+	"github.com/ncondezo/final/internal/domain"
+)
+
+var ErrNotOwnTurn = errors.New("error turn belongs to another dentist")
+
+// checkScope fails when the principal of ctx is linked to a dentist other
+// than dentistId. Users not linked to a dentist keep clinic-wide access.
+func checkScope(ctx context.Context, dentistId int) error {
+	principal, ok := domain.PrincipalFrom(ctx)
+	if ok && principal.DentistId != 0 && principal.DentistId != dentistId {
+		return ErrNotOwnTurn
+	}
+	return nil
+}
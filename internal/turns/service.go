@@ -2,33 +2,57 @@ package turns
 
 import (
 	"context"
+	"fmt"
 	"log"
 	"time"
 
+	"github.com/ncondezo/final/internal/access"
+	"github.com/ncondezo/final/internal/audit"
 	"github.com/ncondezo/final/internal/domain"
+	"github.com/ncondezo/final/internal/insurance"
+	"github.com/ncondezo/final/internal/notifications"
+	"github.com/ncondezo/final/pkg/patch"
+	"github.com/ncondezo/final/pkg/web"
 )
 
 type Service interface {
 	Create(ctx context.Context, dto domain.TurnDTO) (domain.Turn, error)
 	GetByID(ctx context.Context, id int) (domain.Turn, error)
 	GetByPatientID(ctx context.Context, patientId int) ([]domain.Turn, error)
+	View(ctx context.Context, id int, purpose string) (domain.Turn, error)
+	ViewByPatientID(ctx context.Context, patientId int, purpose string) ([]domain.Turn, error)
 	Update(ctx context.Context, dto domain.TurnDTO, id int) (domain.Turn, error)
+	Patch(ctx context.Context, document []byte, contentType string, id int) (domain.Turn, error)
 	Delete(ctx context.Context, id int) error
+	GetAgenda(ctx context.Context, dentistId int, from time.Time, to time.Time) ([]domain.Turn, error)
+	GetPatientsByDentist(ctx context.Context, dentistId int) ([]domain.Patient, error)
 }
 
 type service struct {
 	repository Repository
+	notifier   notifications.Notifier
+	insurance  insurance.Service
+	audit      audit.Recorder
+	access     access.Guard
 }
 
-func NewTurnService(repository Repository) Service {
-	return &service{repository: repository}
+func NewTurnService(repository Repository, notifier notifications.Notifier, insurance insurance.Service,
+	audit audit.Recorder, access access.Guard) Service {
+	return &service{repository: repository, notifier: notifier, insurance: insurance, audit: audit, access: access}
 }
 
 // Create is a method that create a new turn.
 func (s *service) Create(ctx context.Context, dto domain.TurnDTO) (domain.Turn, error) {
+	if err := checkScope(ctx, dto.IdDentist); err != nil {
+		return domain.Turn{}, err
+	}
+	if err := checkDate(dto.Date, time.Now()); err != nil {
+		return domain.Turn{}, err
+	}
 	turn := domain.Turn{
-		Date:        time.Now(),
+		Date:        dto.Date,
 		Description: dto.Description,
+		Procedure:   dto.Procedure,
 		Patient: domain.Patient{
 			Id: dto.IdPatient,
 		},
@@ -38,9 +62,12 @@ func (s *service) Create(ctx context.Context, dto domain.TurnDTO) (domain.Turn,
 	}
 	turn, err := s.repository.Create(ctx, turn)
 	if err != nil {
-		log.Println("[TurnsService][Create] error creating turn", err)
+		log.Println("[TurnsService][Create] error creating turn", actor(ctx), err)
 		return domain.Turn{}, err
 	}
+	s.audit.Record(ctx, domain.AuditActionCreate, domain.AuditEntityTurn, turn.Id, nil, snapshot(turn))
+	s.applyCoverage(ctx, &turn)
+	s.confirm(ctx, turn)
 	return turn, nil
 }
 
@@ -64,32 +91,223 @@ func (s *service) GetByPatientID(ctx context.Context, patientId int) ([]domain.T
 	return turns, nil
 }
 
+// View is a method that return a turn by ID to a reader, and logs the read
+// of its patient with its purpose.
+func (s *service) View(ctx context.Context, id int, purpose string) (domain.Turn, error) {
+	turn, err := s.GetByID(ctx, id)
+	if err != nil {
+		return domain.Turn{}, err
+	}
+	if err := s.access.Check(ctx, turn.Patient.Id, domain.AccessResourceTurn, id, purpose); err != nil {
+		return domain.Turn{}, err
+	}
+	return turn, nil
+}
+
+// ViewByPatientID is a method that return the turns of a patient to a
+// reader, and logs the read with its purpose.
+func (s *service) ViewByPatientID(ctx context.Context, patientId int, purpose string) ([]domain.Turn, error) {
+	turns, err := s.GetByPatientID(ctx, patientId)
+	if err != nil {
+		return []domain.Turn{}, err
+	}
+	if err := s.access.Check(ctx, patientId, domain.AccessResourcePatientTurns, patientId, purpose); err != nil {
+		return []domain.Turn{}, err
+	}
+	return turns, nil
+}
+
 // Update is a method that update a turn by ID.
 func (s *service) Update(ctx context.Context, dto domain.TurnDTO, id int) (domain.Turn, error) {
 	turn, err := s.GetByID(ctx, id)
 	if err != nil {
 		return domain.Turn{}, err
 	}
+	if err := checkScope(ctx, turn.Dentist.Id); err != nil {
+		return domain.Turn{}, err
+	}
+	if err := checkScope(ctx, dto.IdDentist); err != nil {
+		return domain.Turn{}, err
+	}
+	if !dto.Date.Equal(turn.Date) {
+		if err := checkDate(dto.Date, time.Now()); err != nil {
+			return domain.Turn{}, err
+		}
+	}
+	before := snapshot(turn)
 	turn.Date = dto.Date
 	turn.Description = dto.Description
+	turn.Procedure = dto.Procedure
 	turn.Dentist = domain.Dentist{
 		Id: dto.IdDentist,
 	}
 
 	turn, err = s.repository.Update(ctx, turn, id)
 	if err != nil {
-		log.Println("[TurnsService][Update] error updating turn", err)
+		log.Println("[TurnsService][Update] error updating turn", actor(ctx), err)
+		return domain.Turn{}, err
+	}
+	s.audit.Record(ctx, domain.AuditActionUpdate, domain.AuditEntityTurn, id, before, snapshot(turn))
+	s.applyCoverage(ctx, &turn)
+	return turn, nil
+}
+
+// Patch is a method that apply a merge patch or JSON patch to a turn by ID.
+// Only the fields that end up changed are written, the patient cannot change.
+func (s *service) Patch(ctx context.Context, document []byte, contentType string, id int) (domain.Turn, error) {
+	turn, err := s.GetByID(ctx, id)
+	if err != nil {
+		return domain.Turn{}, err
+	}
+	if err := checkScope(ctx, turn.Dentist.Id); err != nil {
+		return domain.Turn{}, err
+	}
+
+	current := snapshot(turn)
+	var patched domain.TurnDTO
+	if err := patch.Apply(current, document, contentType, &patched); err != nil {
+		return domain.Turn{}, err
+	}
+	if reason := web.RequestJsonValidation(patched); reason != "" {
+		return domain.Turn{}, &patch.ResultError{Reason: reason}
+	}
+	if patched.IdPatient != current.IdPatient {
+		return domain.Turn{}, &patch.ResultError{Reason: "id_patient cannot be changed"}
+	}
+	if err := checkScope(ctx, patched.IdDentist); err != nil {
+		return domain.Turn{}, err
+	}
+
+	changes := map[string]interface{}{}
+	if !patched.Date.Equal(current.Date) {
+		if err := checkDate(patched.Date, time.Now()); err != nil {
+			return domain.Turn{}, err
+		}
+		changes["date"] = patched.Date
+	}
+	if patched.Description != current.Description {
+		changes["description"] = patched.Description
+	}
+	// The dentist and the procedure are checked together against the
+	// specialty the procedure requires.
+	if patched.IdDentist != current.IdDentist || patched.Procedure != current.Procedure {
+		changes["dentists_id"] = patched.IdDentist
+		changes["procedures_code"] = patched.Procedure
+	}
+	if len(changes) == 0 {
+		return turn, nil
+	}
+
+	if err := s.repository.Patch(ctx, changes, id); err != nil {
+		log.Println("[TurnsService][Patch] error patching turn", actor(ctx), err)
+		return domain.Turn{}, err
+	}
+
+	turn, err = s.GetByID(ctx, id)
+	if err != nil {
 		return domain.Turn{}, err
 	}
+	s.audit.Record(ctx, domain.AuditActionUpdate, domain.AuditEntityTurn, id, current, snapshot(turn))
+	s.applyCoverage(ctx, &turn)
 	return turn, nil
 }
 
 // Delete is a method that delete a turn by ID.
 func (s *service) Delete(ctx context.Context, id int) error {
-	err := s.repository.Delete(ctx, id)
+	turn, err := s.GetByID(ctx, id)
 	if err != nil {
-		log.Println("[TurnsService][Delete] error deleting turns", err)
 		return err
 	}
+	if err := checkScope(ctx, turn.Dentist.Id); err != nil {
+		return err
+	}
+	err = s.repository.Delete(ctx, id)
+	if err != nil {
+		log.Println("[TurnsService][Delete] error deleting turns", actor(ctx), err)
+		return err
+	}
+	s.audit.Record(ctx, domain.AuditActionDelete, domain.AuditEntityTurn, id, snapshot(turn), nil)
+	return nil
+}
+
+// GetAgenda is a method that return the turns of a dentist between two dates.
+func (s *service) GetAgenda(ctx context.Context, dentistId int, from time.Time, to time.Time) ([]domain.Turn, error) {
+	turns, err := s.repository.GetByDentistID(ctx, dentistId, from, to)
+	if err != nil {
+		log.Println("[TurnsService][GetAgenda] error getting turns by dentist", err)
+		return []domain.Turn{}, err
+	}
+	return turns, nil
+}
+
+// GetPatientsByDentist is a method that return the patients a dentist has turns with.
+func (s *service) GetPatientsByDentist(ctx context.Context, dentistId int) ([]domain.Patient, error) {
+	patients, err := s.repository.GetPatientsByDentist(ctx, dentistId)
+	if err != nil {
+		log.Println("[TurnsService][GetPatientsByDentist] error getting patients by dentist", err)
+		return []domain.Patient{}, err
+	}
+	return patients, nil
+}
+
+// confirm sends the booking confirmation. A failed delivery does not undo the booking.
+func (s *service) confirm(ctx context.Context, turn domain.Turn) {
+	_, err := s.notifier.Notify(ctx, notifications.Message{
+		PatientId: turn.Patient.Id,
+		Subject:   "Confirmación de turno",
+		Body: fmt.Sprintf("Su turno con %s %s quedó reservado para el %s.",
+			turn.Dentist.Name, turn.Dentist.LastName, turn.Date.Format("02/01/2006 15:04")),
+	})
+	if err != nil {
+		log.Println("[TurnsService][confirm] error notifying patient", err)
+	}
+}
+
+// applyCoverage prices the turn with the patient's insurance. The turn is
+// kept even if the coverage cannot be computed, it can be billed in full.
+// A turn without a procedure, or whose procedure cannot be priced, loses the
+// coverage of the procedure it had before.
+func (s *service) applyCoverage(ctx context.Context, turn *domain.Turn) {
+	if turn.Procedure != "" {
+		quote, err := s.insurance.Apply(ctx, *turn)
+		if err == nil {
+			turn.Coverage = &quote
+			return
+		}
+		log.Println("[TurnsService][applyCoverage] error applying coverage", err)
+	}
+	turn.Coverage = nil
+	if err := s.insurance.Clear(ctx, turn.Id); err != nil {
+		log.Println("[TurnsService][applyCoverage] error clearing coverage", err)
+	}
+}
+
+// checkDate fails when date is missing or falls before the day of now.
+// Turns are stored by day, a turn for earlier today is still valid.
+func checkDate(date time.Time, now time.Time) error {
+	year, month, day := now.Date()
+	if date.IsZero() || date.Before(time.Date(year, month, day, 0, 0, 0, 0, now.Location())) {
+		return ErrInvalidDate
+	}
 	return nil
 }
+
+// snapshot holds the fields of a turn that can be changed, which are the
+// ones audited.
+func snapshot(turn domain.Turn) domain.TurnDTO {
+	return domain.TurnDTO{
+		Date:        turn.Date,
+		Description: turn.Description,
+		IdPatient:   turn.Patient.Id,
+		IdDentist:   turn.Dentist.Id,
+		Procedure:   turn.Procedure,
+	}
+}
+
+// actor identifies who made the request in log lines.
+func actor(ctx context.Context) string {
+	if principal, ok := domain.PrincipalFrom(ctx); ok {
+		return principal.String()
+	}
+	return "anonymous"
+}
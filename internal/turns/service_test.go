@@ -0,0 +1,99 @@
+package turns
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/ncondezo/final/internal/domain"
+	"github.com/ncondezo/final/internal/insurance"
+	"github.com/ncondezo/final/internal/notifications"
+)
+
+// The fakes embed the interfaces they stand in for, a call to a method the
+// test does not expect panics.
+
+type fakeTurns struct {
+	Repository
+	created []domain.Turn
+}
+
+func (f *fakeTurns) Create(ctx context.Context, turn domain.Turn) (domain.Turn, error) {
+	turn.Id = len(f.created) + 1
+	f.created = append(f.created, turn)
+	return turn, nil
+}
+
+type fakeAudit struct{}
+
+func (fakeAudit) Record(ctx context.Context, action string, entity string, entityId int, before interface{}, after interface{}) {
+}
+
+type fakeNotifier struct {
+	notifications.Notifier
+	messages []notifications.Message
+}
+
+func (f *fakeNotifier) Notify(ctx context.Context, message notifications.Message) (notifications.Delivery, error) {
+	f.messages = append(f.messages, message)
+	return notifications.Delivery{}, nil
+}
+
+type fakeInsurance struct {
+	insurance.Service
+}
+
+func (fakeInsurance) Clear(ctx context.Context, turnId int) error {
+	return nil
+}
+
+func TestCreateBooksTheRequestedDate(t *testing.T) {
+	now := time.Now()
+	year, month, day := now.Date()
+	today := time.Date(year, month, day, 0, 0, 0, 0, now.Location())
+
+	tests := []struct {
+		name string
+		date time.Time
+		want error
+	}{
+		{name: "next week", date: today.AddDate(0, 0, 7), want: nil},
+		{name: "today", date: today, want: nil},
+		{name: "yesterday", date: today.AddDate(0, 0, -1), want: ErrInvalidDate},
+		{name: "last year", date: today.AddDate(-1, 0, 0), want: ErrInvalidDate},
+		{name: "missing", date: time.Time{}, want: ErrInvalidDate},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			repository := &fakeTurns{}
+			notifier := &fakeNotifier{}
+			service := NewTurnService(repository, notifier, fakeInsurance{}, fakeAudit{}, nil)
+
+			turn, err := service.Create(context.Background(), domain.TurnDTO{
+				Date:        test.date,
+				Description: "Control",
+				IdPatient:   1,
+				IdDentist:   2,
+			})
+			if !errors.Is(err, test.want) {
+				t.Fatalf("err = %v, want %v", err, test.want)
+			}
+			if test.want != nil {
+				if len(repository.created) > 0 || len(notifier.messages) > 0 {
+					t.Fatal("a rejected turn was booked")
+				}
+				return
+			}
+			if len(repository.created) != 1 || !repository.created[0].Date.Equal(test.date) {
+				t.Fatalf("stored turns = %+v, want one on %v", repository.created, test.date)
+			}
+			if !turn.Date.Equal(test.date) {
+				t.Errorf("turn date = %v, want %v", turn.Date, test.date)
+			}
+			if len(notifier.messages) != 1 {
+				t.Errorf("%d confirmations sent, want 1", len(notifier.messages))
+			}
+		})
+	}
+}
@@ -0,0 +1,95 @@
+package product
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/ncondezo/final/internal/domain"
+)
+
+const (
+	createInvitationQuery = "INSERT INTO invitations (id, email, role, token_hash, invited_by, expires_at, dateup) VALUES (?, ?, ?, ?, ?, ?, ?)"
+	findInvitationQuery   = "SELECT id, email, role, token_hash, invited_by, expires_at, accepted_at, dateup FROM invitations WHERE token_hash = ?"
+	acceptInvitationQuery = "UPDATE invitations SET accepted_at = ? WHERE id = ? AND accepted_at IS NULL"
+)
+
+var (
+	ErrorInvitationNotFound = errors.New("invitation not found")
+	ErrorInvitationAccepted = errors.New("invitation already accepted")
+)
+
+// InvitationRepository keeps the invitations to sign up, with their tokens
+// hashed.
+type InvitationRepository interface {
+	Create(invitation domain.Invitation) error
+	FindByHash(hash string) (*domain.Invitation, error)
+	MarkAccepted(id string) error
+}
+
+type invitationRepository struct {
+	db *sql.DB
+}
+
+func NewInvitationRepository(db *sql.DB) InvitationRepository {
+	return &invitationRepository{db}
+}
+
+func (repository *invitationRepository) Create(invitation domain.Invitation) error {
+	_, err := repository.db.Exec(createInvitationQuery,
+		invitation.Id,
+		invitation.Email,
+		invitation.Role,
+		invitation.TokenHash,
+		invitation.InvitedBy,
+		invitation.ExpiresAt,
+		invitation.DateUp,
+	)
+	return err
+}
+
+func (repository *invitationRepository) FindByHash(hash string) (*domain.Invitation, error) {
+	var invitation domain.Invitation
+	var invitedBy sql.NullString
+	var acceptedAt sql.NullTime
+	err := repository.db.QueryRow(findInvitationQuery, hash).Scan(
+		&invitation.Id,
+		&invitation.Email,
+		&invitation.Role,
+		&invitation.TokenHash,
+		&invitedBy,
+		&invitation.ExpiresAt,
+		&acceptedAt,
+		&invitation.DateUp,
+	)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrorInvitationNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	if invitedBy.Valid {
+		invitation.InvitedBy = &invitedBy.String
+	}
+	if acceptedAt.Valid {
+		invitation.AcceptedAt = &acceptedAt.Time
+	}
+	return &invitation, nil
+}
+
+// MarkAccepted fails with ErrorInvitationAccepted when the invitation was
+// already used.
+func (repository *invitationRepository) MarkAccepted(id string) error {
+	result, err := repository.db.Exec(acceptInvitationQuery, time.Now(), id)
+	if err != nil {
+		return err
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows < 1 {
+		return ErrorInvitationAccepted
+	}
+	return nil
+}
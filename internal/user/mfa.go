@@ -0,0 +1,257 @@
+package product
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/ncondezo/final/internal/domain"
+)
+
+const (
+	findTotpQuery = "SELECT users_id, secret, confirmed_at, last_step FROM user_totp WHERE users_id = ?"
+	saveTotpQuery = "INSERT INTO user_totp (users_id, secret, last_step, dateup) VALUES (?, ?, 0, ?) " +
+		"ON DUPLICATE KEY UPDATE secret = VALUES(secret), confirmed_at = NULL, last_step = 0, dateup = VALUES(dateup)"
+	confirmTotpQuery = "UPDATE user_totp SET confirmed_at = ?, last_step = ? " +
+		"WHERE users_id = ? AND confirmed_at IS NULL AND last_step < ?"
+	useTotpStepQuery        = "UPDATE user_totp SET last_step = ? WHERE users_id = ? AND last_step < ?"
+	deleteTotpQuery         = "DELETE FROM user_totp WHERE users_id = ?"
+	insertRecoveryCodeQuery = "INSERT INTO recovery_codes (users_id, code_hash, dateup) VALUES (?, ?, ?)"
+	deleteRecoveryCodeQuery = "DELETE FROM recovery_codes WHERE users_id = ?"
+	useRecoveryCodeQuery    = "UPDATE recovery_codes SET used_at = ? WHERE users_id = ? AND code_hash = ? AND used_at IS NULL"
+	createChallengeQuery    = "INSERT INTO mfa_challenges (id, users_id, token_hash, enroll, attempts, expires_at, dateup) " +
+		"VALUES (?, ?, ?, ?, 0, ?, ?)"
+	findChallengeQuery = "SELECT id, users_id, token_hash, enroll, attempts, expires_at, used_at " +
+		"FROM mfa_challenges WHERE token_hash = ?"
+	failChallengeQuery  = "UPDATE mfa_challenges SET attempts = attempts + 1 WHERE id = ?"
+	useChallengeQuery   = "UPDATE mfa_challenges SET used_at = ? WHERE id = ? AND used_at IS NULL"
+	findMfaRolesQuery   = "SELECT role FROM mfa_required_roles ORDER BY role"
+	insertMfaRoleQuery  = "INSERT INTO mfa_required_roles (role) VALUES (?)"
+	deleteMfaRolesQuery = "DELETE FROM mfa_required_roles"
+)
+
+var (
+	ErrorTotpNotFound         = errors.New("totp not found")
+	ErrorTotpStepUsed         = errors.New("totp code already used")
+	ErrorRecoveryCodeNotFound = errors.New("recovery code not found")
+	ErrorChallengeNotFound    = errors.New("mfa challenge not found")
+	ErrorChallengeUsed        = errors.New("mfa challenge already used")
+)
+
+// MfaRepository keeps the authenticator apps of the users, their hashed
+// recovery codes, the pending second steps of logins and the roles that must
+// use two factors.
+type MfaRepository interface {
+	GetTotp(userId string) (*domain.Totp, error)
+	SaveTotp(userId string, secret string) error
+	ConfirmTotp(userId string, step int64) error
+	UseStep(userId string, step int64) error
+	DeleteTotp(userId string) error
+	ReplaceRecoveryCodes(userId string, hashes []string) error
+	UseRecoveryCode(userId string, hash string) error
+	CreateChallenge(challenge domain.MfaChallenge) error
+	FindChallenge(hash string) (*domain.MfaChallenge, error)
+	FailChallenge(id string) error
+	UseChallenge(id string) error
+	GetRequiredRoles() ([]string, error)
+	SetRequiredRoles(roles []string) error
+}
+
+type mfaRepository struct {
+	db *sql.DB
+}
+
+func NewMfaRepository(db *sql.DB) MfaRepository {
+	return &mfaRepository{db}
+}
+
+func (repository *mfaRepository) GetTotp(userId string) (*domain.Totp, error) {
+	var totp domain.Totp
+	var confirmedAt sql.NullTime
+	err := repository.db.QueryRow(findTotpQuery, userId).Scan(
+		&totp.UserId,
+		&totp.Secret,
+		&confirmedAt,
+		&totp.LastStep,
+	)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrorTotpNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	if confirmedAt.Valid {
+		totp.ConfirmedAt = &confirmedAt.Time
+	}
+	return &totp, nil
+}
+
+// SaveTotp sets a new unconfirmed secret for the user.
+func (repository *mfaRepository) SaveTotp(userId string, secret string) error {
+	_, err := repository.db.Exec(saveTotpQuery, userId, secret, time.Now())
+	return err
+}
+
+// ConfirmTotp enables the pending secret with the step of its first code. It
+// fails with ErrorTotpStepUsed when the secret was confirmed meanwhile.
+func (repository *mfaRepository) ConfirmTotp(userId string, step int64) error {
+	err := expectRow(repository.db.Exec(confirmTotpQuery, time.Now(), step, userId, step))
+	if errors.Is(err, errNoRows) {
+		return ErrorTotpStepUsed
+	}
+	return err
+}
+
+// UseStep fails with ErrorTotpStepUsed when a code of step, or a later one,
+// was already accepted.
+func (repository *mfaRepository) UseStep(userId string, step int64) error {
+	err := expectRow(repository.db.Exec(useTotpStepQuery, step, userId, step))
+	if errors.Is(err, errNoRows) {
+		return ErrorTotpStepUsed
+	}
+	return err
+}
+
+// DeleteTotp removes the authenticator app and the recovery codes.
+func (repository *mfaRepository) DeleteTotp(userId string) error {
+	tx, err := repository.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if _, err := tx.Exec(deleteRecoveryCodeQuery, userId); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(deleteTotpQuery, userId); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (repository *mfaRepository) ReplaceRecoveryCodes(userId string, hashes []string) error {
+	now := time.Now()
+	tx, err := repository.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if _, err := tx.Exec(deleteRecoveryCodeQuery, userId); err != nil {
+		return err
+	}
+	for _, hash := range hashes {
+		if _, err := tx.Exec(insertRecoveryCodeQuery, userId, hash, now); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+func (repository *mfaRepository) UseRecoveryCode(userId string, hash string) error {
+	err := expectRow(repository.db.Exec(useRecoveryCodeQuery, time.Now(), userId, hash))
+	if errors.Is(err, errNoRows) {
+		return ErrorRecoveryCodeNotFound
+	}
+	return err
+}
+
+func (repository *mfaRepository) CreateChallenge(challenge domain.MfaChallenge) error {
+	_, err := repository.db.Exec(createChallengeQuery,
+		challenge.Id,
+		challenge.UserId,
+		challenge.TokenHash,
+		challenge.Enroll,
+		challenge.ExpiresAt,
+		time.Now(),
+	)
+	return err
+}
+
+func (repository *mfaRepository) FindChallenge(hash string) (*domain.MfaChallenge, error) {
+	var challenge domain.MfaChallenge
+	var usedAt sql.NullTime
+	err := repository.db.QueryRow(findChallengeQuery, hash).Scan(
+		&challenge.Id,
+		&challenge.UserId,
+		&challenge.TokenHash,
+		&challenge.Enroll,
+		&challenge.Attempts,
+		&challenge.ExpiresAt,
+		&usedAt,
+	)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrorChallengeNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	if usedAt.Valid {
+		challenge.UsedAt = &usedAt.Time
+	}
+	return &challenge, nil
+}
+
+func (repository *mfaRepository) FailChallenge(id string) error {
+	_, err := repository.db.Exec(failChallengeQuery, id)
+	return err
+}
+
+// UseChallenge fails with ErrorChallengeUsed when another request completed
+// the login first.
+func (repository *mfaRepository) UseChallenge(id string) error {
+	err := expectRow(repository.db.Exec(useChallengeQuery, time.Now(), id))
+	if errors.Is(err, errNoRows) {
+		return ErrorChallengeUsed
+	}
+	return err
+}
+
+func (repository *mfaRepository) GetRequiredRoles() ([]string, error) {
+	rows, err := repository.db.Query(findMfaRolesQuery)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	roles := []string{}
+	for rows.Next() {
+		var role string
+		if err := rows.Scan(&role); err != nil {
+			return nil, err
+		}
+		roles = append(roles, role)
+	}
+	return roles, rows.Err()
+}
+
+func (repository *mfaRepository) SetRequiredRoles(roles []string) error {
+	tx, err := repository.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if _, err := tx.Exec(deleteMfaRolesQuery); err != nil {
+		return err
+	}
+	for _, role := range roles {
+		if _, err := tx.Exec(insertMfaRoleQuery, role); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+var errNoRows = errors.New("no rows affected")
+
+// expectRow fails with errNoRows when the statement changed nothing.
+func expectRow(result sql.Result, err error) error {
+	if err != nil {
+		return err
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows < 1 {
+		return errNoRows
+	}
+	return nil
+}
@@ -0,0 +1,71 @@
+package product
+
+import (
+	"bufio"
+	"os"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// PasswordPolicyError tells why a new password was rejected.
+type PasswordPolicyError struct {
+	Reason string
+}
+
+func (e *PasswordPolicyError) Error() string {
+	return "password rejected: " + e.Reason
+}
+
+// PasswordPolicy is checked on every new password. Existing passwords keep
+// working until they are changed.
+type PasswordPolicy struct {
+	MinLength int
+	// MaxLength is in bytes, bcrypt ignores whatever follows the 72nd.
+	MaxLength int
+	// Breached holds known leaked passwords, in lower case.
+	Breached map[string]bool
+}
+
+// NewPasswordPolicy returns a policy of passwords between minLength
+// characters and maxLength bytes, that are not in the breached list file,
+// one password per line. An empty path skips the list.
+func NewPasswordPolicy(minLength int, maxLength int, breachedPath string) (PasswordPolicy, error) {
+	policy := PasswordPolicy{MinLength: minLength, MaxLength: maxLength, Breached: map[string]bool{}}
+	if breachedPath == "" {
+		return policy, nil
+	}
+	file, err := os.Open(breachedPath)
+	if err != nil {
+		return PasswordPolicy{}, err
+	}
+	defer file.Close()
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		if line := strings.TrimSpace(scanner.Text()); line != "" {
+			policy.Breached[strings.ToLower(line)] = true
+		}
+	}
+	return policy, scanner.Err()
+}
+
+// Check rejects passwords that are too short or too long, known to be
+// breached, or made from the email of the user.
+func (p PasswordPolicy) Check(password string, email string) error {
+	if utf8.RuneCountInString(password) < p.MinLength {
+		return &PasswordPolicyError{"La contraseña debe tener al menos " + strconv.Itoa(p.MinLength) + " caracteres"}
+	}
+	if p.MaxLength > 0 && len(password) > p.MaxLength {
+		return &PasswordPolicyError{"La contraseña no puede superar los " + strconv.Itoa(p.MaxLength) + " bytes"}
+	}
+	lower := strings.ToLower(password)
+	if p.Breached[lower] {
+		return &PasswordPolicyError{"La contraseña aparece en filtraciones conocidas, elija otra"}
+	}
+	email = strings.ToLower(email)
+	local, _, _ := strings.Cut(email, "@")
+	if email != "" && (strings.Contains(lower, email) || (len(local) >= 3 && strings.Contains(lower, local))) {
+		return &PasswordPolicyError{"La contraseña no puede contener el email"}
+	}
+	return nil
+}
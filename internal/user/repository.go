@@ -3,6 +3,7 @@ package product
 import (
 	"database/sql"
 	"errors"
+	"time"
 
 	"github.com/ncondezo/final/internal/domain"
 
@@ -11,17 +12,33 @@ import (
 
 const (
 	createUserQuery      = "INSERT INTO users (id, name, surname, email, password) VALUES (?, ?, ?, ?, ?)"
-	findUserByEmailQuery = "SELECT * FROM users WHERE email = ?"
+	findUserByEmailQuery = "SELECT id, name, surname, email, password, dentists_id, patients_id, verified_at FROM users WHERE email = ?"
+	findUserByIdQuery    = "SELECT id, name, surname, email, password, dentists_id, patients_id, verified_at FROM users WHERE id = ?"
+	verifyUserQuery      = "UPDATE users SET verified_at = ? WHERE id = ? AND verified_at IS NULL"
+	setUserDentistQuery  = "UPDATE users SET dentists_id = ? WHERE id = ?"
+	setUserPatientQuery  = "UPDATE users SET patients_id = ? WHERE id = ?"
+	setUserPasswordQuery = "UPDATE users SET password = ? WHERE id = ?"
+	insertUserRoleQuery  = "INSERT INTO user_roles (users_id, role) VALUES (?, ?)"
+	findUserRolesQuery   = "SELECT role FROM user_roles WHERE users_id = ? ORDER BY role"
+	deleteUserRolesQuery = "DELETE FROM user_roles WHERE users_id = ?"
 )
 
 var (
-	ErrorUserNotFound = errors.New("user not found")
-	ErrorUserExists   = errors.New("user already exists")
+	ErrorUserNotFound  = errors.New("user not found")
+	ErrorUserExists    = errors.New("user already exists")
+	ErrorDentistLinked = errors.New("dentist already linked to another user")
+	ErrorPatientLinked = errors.New("patient already linked to another user")
 )
 
 type Repository interface {
 	Create(product *domain.User) (*domain.User, error)
 	FindByEmail(email string) (*domain.User, error)
+	FindByID(id string) (*domain.User, error)
+	SetDentist(id string, dentistId *int) error
+	SetPatient(id string, patientId *int) error
+	SetRoles(id string, roles []string) error
+	SetPassword(id string, password string) error
+	MarkVerified(id string) error
 }
 
 type repository struct {
@@ -34,12 +51,12 @@ func NewRepository(db *sql.DB) Repository {
 
 func (repository *repository) Create(user *domain.User) (*domain.User, error) {
 	var mysqlError *mysql.MySQLError
-	stmt, err := repository.db.Prepare(createUserQuery)
-	defer stmt.Close()
+	tx, err := repository.db.Begin()
 	if err != nil {
 		return nil, err
 	}
-	_, err = stmt.Exec(
+	defer tx.Rollback()
+	_, err = tx.Exec(createUserQuery,
 		user.Id,
 		user.Name,
 		user.Surname,
@@ -55,6 +72,17 @@ func (repository *repository) Create(user *domain.User) (*domain.User, error) {
 			return nil, err
 		}
 	}
+	if err != nil {
+		return nil, err
+	}
+	for _, role := range user.Roles {
+		if _, err := tx.Exec(insertUserRoleQuery, user.Id, role); err != nil {
+			return nil, err
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
 	return user, nil
 }
 
@@ -68,21 +96,145 @@ func (repository *repository) FindByEmail(email string) (*domain.User, error) {
 	if found.Id == "" {
 		return nil, ErrorUserNotFound
 	}
+	found.Roles, err = repository.findRoles(found.Id)
+	if err != nil {
+		return nil, err
+	}
 	return found, nil
 }
 
+func (repository *repository) FindByID(id string) (*domain.User, error) {
+	stmt, err := repository.db.Prepare(findUserByIdQuery)
+	if err != nil {
+		return nil, err
+	}
+	defer stmt.Close()
+	found := scanUser(stmt.QueryRow(id))
+	if found.Id == "" {
+		return nil, ErrorUserNotFound
+	}
+	found.Roles, err = repository.findRoles(found.Id)
+	if err != nil {
+		return nil, err
+	}
+	return found, nil
+}
+
+func (repository *repository) SetDentist(id string, dentistId *int) error {
+	return repository.setLink(setUserDentistQuery, ErrorDentistLinked, id, dentistId)
+}
+
+func (repository *repository) SetPatient(id string, patientId *int) error {
+	return repository.setLink(setUserPatientQuery, ErrorPatientLinked, id, patientId)
+}
+
+// setLink links the user to the record linkedId, or unlinks it when nil.
+// linked is returned when the record is linked to another user.
+func (repository *repository) setLink(query string, linked error, id string, linkedId *int) error {
+	var mysqlError *mysql.MySQLError
+	result, err := repository.db.Exec(query, linkedId, id)
+	if errors.As(err, &mysqlError) && mysqlError.Number == 1062 {
+		return linked
+	}
+	if err != nil {
+		return err
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows < 1 {
+		if _, err := repository.FindByID(id); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (repository *repository) SetRoles(id string, roles []string) error {
+	if _, err := repository.FindByID(id); err != nil {
+		return err
+	}
+	tx, err := repository.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if _, err := tx.Exec(deleteUserRolesQuery, id); err != nil {
+		return err
+	}
+	for _, role := range roles {
+		if _, err := tx.Exec(insertUserRoleQuery, id, role); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+func (repository *repository) SetPassword(id string, password string) error {
+	result, err := repository.db.Exec(setUserPasswordQuery, password, id)
+	if err != nil {
+		return err
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows < 1 {
+		return ErrorUserNotFound
+	}
+	return nil
+}
+
+func (repository *repository) MarkVerified(id string) error {
+	_, err := repository.db.Exec(verifyUserQuery, time.Now(), id)
+	return err
+}
+
+func (repository *repository) findRoles(id string) ([]string, error) {
+	roles := make([]string, 0)
+	rows, err := repository.db.Query(findUserRolesQuery, id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var role string
+		if err := rows.Scan(&role); err != nil {
+			return nil, err
+		}
+		roles = append(roles, role)
+	}
+	return roles, rows.Err()
+}
+
 type scanner interface {
 	Scan(dest ...interface{}) error
 }
 
 func scanUser(scanner scanner) *domain.User {
 	userScanned := &domain.User{}
+	var dentistId sql.NullInt64
+	var patientId sql.NullInt64
+	var verifiedAt sql.NullTime
 	_ = scanner.Scan(
 		&userScanned.Id,
 		&userScanned.Name,
 		&userScanned.Surname,
 		&userScanned.Email,
 		&userScanned.Password,
+		&dentistId,
+		&patientId,
+		&verifiedAt,
 	)
+	userScanned.Verified = verifiedAt.Valid
+	if dentistId.Valid {
+		id := int(dentistId.Int64)
+		userScanned.DentistId = &id
+	}
+	if patientId.Valid {
+		id := int(patientId.Int64)
+		userScanned.PatientId = &id
+	}
 	return userScanned
 }
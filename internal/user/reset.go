@@ -0,0 +1,93 @@
+package product
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/ncondezo/final/internal/domain"
+)
+
+const (
+	createPasswordResetQuery = "INSERT INTO password_resets (id, users_id, token_hash, expires_at, dateup) VALUES (?, ?, ?, ?, ?)"
+	findPasswordResetQuery   = "SELECT id, users_id, token_hash, expires_at, used_at FROM password_resets WHERE token_hash = ?"
+	usePasswordResetQuery    = "UPDATE password_resets SET used_at = ? WHERE id = ? AND used_at IS NULL"
+	usePasswordResetsQuery   = "UPDATE password_resets SET used_at = ? WHERE users_id = ? AND used_at IS NULL"
+)
+
+var (
+	ErrorPasswordResetNotFound = errors.New("password reset not found")
+	ErrorPasswordResetUsed     = errors.New("password reset already used")
+)
+
+// ResetRepository keeps the hashed password reset tokens.
+type ResetRepository interface {
+	Create(reset domain.PasswordReset) error
+	FindByHash(hash string) (*domain.PasswordReset, error)
+	MarkUsed(id string) error
+	MarkUsedByUser(userId string) error
+}
+
+type resetRepository struct {
+	db *sql.DB
+}
+
+func NewResetRepository(db *sql.DB) ResetRepository {
+	return &resetRepository{db}
+}
+
+func (repository *resetRepository) Create(reset domain.PasswordReset) error {
+	_, err := repository.db.Exec(createPasswordResetQuery,
+		reset.Id,
+		reset.UserId,
+		reset.TokenHash,
+		reset.ExpiresAt,
+		time.Now(),
+	)
+	return err
+}
+
+func (repository *resetRepository) FindByHash(hash string) (*domain.PasswordReset, error) {
+	var reset domain.PasswordReset
+	var usedAt sql.NullTime
+	err := repository.db.QueryRow(findPasswordResetQuery, hash).Scan(
+		&reset.Id,
+		&reset.UserId,
+		&reset.TokenHash,
+		&reset.ExpiresAt,
+		&usedAt,
+	)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrorPasswordResetNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	if usedAt.Valid {
+		reset.UsedAt = &usedAt.Time
+	}
+	return &reset, nil
+}
+
+// MarkUsed fails with ErrorPasswordResetUsed when the token was already
+// redeemed.
+func (repository *resetRepository) MarkUsed(id string) error {
+	result, err := repository.db.Exec(usePasswordResetQuery, time.Now(), id)
+	if err != nil {
+		return err
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows < 1 {
+		return ErrorPasswordResetUsed
+	}
+	return nil
+}
+
+// MarkUsedByUser discards every pending reset token of the user.
+func (repository *resetRepository) MarkUsedByUser(userId string) error {
+	_, err := repository.db.Exec(usePasswordResetsQuery, time.Now(), userId)
+	return err
+}
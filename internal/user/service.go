@@ -1,77 +1,1279 @@
 package product
 
 import (
+	"context"
+	"encoding/base64"
 	"errors"
 	"log"
+	"strings"
+	"time"
 
+	"github.com/ncondezo/final/internal/dentists"
 	"github.com/ncondezo/final/internal/domain"
+	"github.com/ncondezo/final/internal/patients"
+	"github.com/ncondezo/final/pkg/mail"
+	"github.com/ncondezo/final/pkg/oidc"
 	"github.com/ncondezo/final/pkg/security"
 	"github.com/ncondezo/final/pkg/web"
 
 	"github.com/google/uuid"
-	"golang.org/x/crypto/bcrypt"
+	"github.com/skip2/go-qrcode"
 )
 
 var (
 	ErrorInvalidCredentials = errors.New("invalid credentials")
+	ErrorInvalidRole        = errors.New("invalid role")
+	ErrorInvalidRefresh     = errors.New("invalid refresh token")
+	ErrorRefreshReused      = errors.New("refresh token reused")
+	ErrorInvalidReset       = errors.New("invalid password reset token")
+	ErrorInvalidInvitation  = errors.New("invalid invitation")
+	ErrorInvalidVerify      = errors.New("invalid email verification token")
+	ErrorUnverified         = errors.New("email not verified")
+	ErrorInvalidChallenge   = errors.New("invalid mfa challenge")
+	ErrorInvalidMfaCode     = errors.New("invalid mfa code")
+	ErrorMfaEnabled         = errors.New("mfa already enabled")
+	ErrorMfaNotEnabled      = errors.New("mfa not enabled")
+	ErrorSsoDisabled        = errors.New("single sign-on is not configured")
+	ErrorInvalidSso         = errors.New("invalid single sign-on callback")
+	ErrorSsoNoAccount       = errors.New("no account for the single sign-on identity")
 )
 
+const (
+	passwordResetTTL     = time.Hour
+	invitationTTL        = time.Hour * 24 * 7
+	emailVerificationTTL = time.Hour * 24 * 2
+	mfaChallengeTTL      = time.Minute * 5
+	mfaChallengeAttempts = 5
+	recoveryCodeCount    = 10
+	totpIssuer           = "Clinica"
+	ssoStateTTL          = time.Minute * 10
+)
+
+// ThrottledError is returned while an account or an IP has to wait before
+// trying to log in again.
+type ThrottledError struct {
+	RetryAfter time.Duration
+}
+
+func (e *ThrottledError) Error() string {
+	return "too many failed logins, retry after " + e.RetryAfter.String()
+}
+
+// MfaRequiredError is returned by Login when the password is right and the
+// login goes on with a second factor.
+type MfaRequiredError struct {
+	Challenge web.ChallengeResponse
+}
+
+func (e *MfaRequiredError) Error() string {
+	return "second factor required"
+}
+
+// loginPolicy sets when failed logins start to be delayed, the delay doubling
+// with every further failure up to maxDelay, and when the key gets locked.
+type loginPolicy struct {
+	delayAfter int
+	maxDelay   time.Duration
+	lockAfter  int
+	lockFor    time.Duration
+	lockEvent  string
+}
+
+var (
+	accountPolicy = loginPolicy{delayAfter: 3, maxDelay: time.Second * 30, lockAfter: 10, lockFor: time.Minute * 15,
+		lockEvent: domain.AuthEventAccountLocked}
+	ipPolicy = loginPolicy{delayAfter: 20, maxDelay: time.Minute, lockAfter: 100, lockFor: time.Minute * 15,
+		lockEvent: domain.AuthEventIpLocked}
+)
+
+// Sso is the OpenID Connect provider staff log in with, and how its
+// identities map to users. Users are found by the subject linked on their
+// first login or by a verified email. With Provision unknown users are
+// created with the roles that RoleMap gives to the values of RoleClaim; when
+// mapped roles are found they replace those of the user on every login.
+type Sso struct {
+	Provider  *oidc.Provider
+	Provision bool
+	RoleClaim string
+	RoleMap   map[string]string
+}
+
+// Links are the pages the emailed tokens are appended to.
+type Links struct {
+	ResetURL      string
+	InvitationURL string
+	VerifyURL     string
+}
+
 type Service interface {
-	Signup(dto domain.SignupDTO) (*domain.User, error)
-	Login(dto domain.LoginDTO) (*web.LoginResponse, error)
+	GrantAdmins() error
+	Signup(ctx context.Context, dto domain.SignupDTO) (*domain.User, error)
+	Invite(ctx context.Context, dto domain.InvitationDTO) (*domain.Invitation, error)
+	VerifyEmail(dto domain.VerifyEmailDTO) error
+	ResendVerification(ctx context.Context, dto domain.ResendVerificationDTO) error
+	Login(ctx context.Context, dto domain.LoginDTO, ip string) (*web.LoginResponse, error)
+	Unlock(ctx context.Context, id string) error
+	VerifyMfa(ctx context.Context, dto domain.MfaVerifyDTO, ip string) (*web.LoginResponse, error)
+	StartMfaEnrollment(dto domain.MfaChallengeDTO) (*domain.MfaEnrollment, error)
+	EnrollMfa(ctx context.Context) (*domain.MfaEnrollment, error)
+	ConfirmMfa(ctx context.Context, dto domain.MfaCodeDTO) (*domain.RecoveryCodes, error)
+	DisableMfa(ctx context.Context, dto domain.MfaCodeDTO) error
+	RegenerateRecoveryCodes(ctx context.Context, dto domain.MfaCodeDTO) (*domain.RecoveryCodes, error)
+	ResetMfa(ctx context.Context, id string) error
+	GetMfaPolicy() (*domain.MfaPolicyDTO, error)
+	SetMfaPolicy(dto domain.MfaPolicyDTO) (*domain.MfaPolicyDTO, error)
+	StartSso(ctx context.Context) (string, string, error)
+	FinishSso(ctx context.Context, dto domain.SsoCallbackDTO, ip string) (*web.LoginResponse, error)
+	Refresh(dto domain.RefreshDTO) (*web.LoginResponse, error)
+	Logout(claim *domain.Claim, dto domain.RefreshDTO) error
+	FindByEmail(email string) (*domain.User, error)
+	LinkDentist(ctx context.Context, id string, dto domain.UserDentistDTO) (*domain.User, error)
+	UnlinkDentist(ctx context.Context, id string) (*domain.User, error)
+	LinkPatient(ctx context.Context, id string, dto domain.UserPatientDTO) (*domain.User, error)
+	UnlinkPatient(ctx context.Context, id string) (*domain.User, error)
+	SetRoles(ctx context.Context, id string, dto domain.UserRolesDTO) (*domain.User, error)
+	ForgotPassword(ctx context.Context, dto domain.ForgotPasswordDTO) error
+	ResetPassword(dto domain.ResetPasswordDTO) error
 }
 
 type service struct {
-	repository Repository
+	repository    Repository
+	tokens        TokenRepository
+	resets        ResetRepository
+	invitations   InvitationRepository
+	verifications VerificationRepository
+	mailer        mail.Mailer
+	links         Links
+	policy        PasswordPolicy
+	throttles     ThrottleRepository
+	events        EventRepository
+	mfa           MfaRepository
+	ssoStates     SsoRepository
+	sso           *Sso
+	dentists      dentists.Repository
+	patients      patients.Repository
+	admins        map[string]bool
+	// dummyHash is compared against when the email is unknown, so that both
+	// cases take the time of a password comparison.
+	dummyHash string
 }
 
-func NewService(repository Repository) Service {
-	return &service{repository}
+// NewService returns the user service. Signing up requires an invitation,
+// except for the admins emails that bootstrap the clinic as admins. sso is
+// nil when single sign-on is not configured.
+func NewService(repository Repository, tokens TokenRepository, resets ResetRepository,
+	invitations InvitationRepository, verifications VerificationRepository, mailer mail.Mailer, links Links,
+	policy PasswordPolicy, throttles ThrottleRepository, events EventRepository, mfa MfaRepository, ssoStates SsoRepository, sso *Sso,
+	dentists dentists.Repository, patients patients.Repository, admins ...string) Service {
+	emails := make(map[string]bool, len(admins))
+	for _, email := range admins {
+		emails[strings.ToLower(strings.TrimSpace(email))] = true
+	}
+	dummyHash, err := security.HashPassword("dummy-password")
+	if err != nil {
+		log.Println("[UserService][NewService] error hashing dummy password", err)
+	}
+	return &service{repository, tokens, resets, invitations, verifications, mailer, links, policy, throttles,
+		events, mfa, ssoStates, sso, dentists, patients, emails, dummyHash}
+}
+
+// GrantAdmins gives the admin role to the existing accounts of the admins
+// emails that have no role, such as the accounts created before roles
+// existed. Without it nobody could assign roles to them.
+func (service *service) GrantAdmins() error {
+	for email := range service.admins {
+		user, err := service.repository.FindByEmail(email)
+		if errors.Is(err, ErrorUserNotFound) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		if len(user.Roles) > 0 {
+			continue
+		}
+		if err := service.repository.SetRoles(user.Id, []string{domain.RoleAdmin}); err != nil {
+			return err
+		}
+		log.Println("[UserService][GrantAdmins] admin role granted to", user.Id)
+	}
+	return nil
 }
 
-func (service *service) Signup(dto domain.SignupDTO) (*domain.User, error) {
-	passwordEncrypted, err := passwordEncrypt(dto.Password)
+// Signup creates an unverified account with the role of the invitation and
+// emails the link to verify it.
+func (service *service) Signup(ctx context.Context, dto domain.SignupDTO) (*domain.User, error) {
+	role := domain.RoleAdmin
+	var invitation *domain.Invitation
+	if !service.admins[strings.ToLower(dto.Email)] {
+		var err error
+		invitation, err = service.invitations.FindByHash(security.HashToken(dto.InvitationToken))
+		if errors.Is(err, ErrorInvitationNotFound) {
+			return nil, ErrorInvalidInvitation
+		}
+		if err != nil {
+			return nil, err
+		}
+		if invitation.AcceptedAt != nil || time.Now().After(invitation.ExpiresAt) ||
+			!strings.EqualFold(invitation.Email, dto.Email) {
+			return nil, ErrorInvalidInvitation
+		}
+		role = invitation.Role
+	}
+	if err := service.policy.Check(dto.Password, dto.Email); err != nil {
+		return nil, err
+	}
+	passwordEncrypted, err := security.HashPassword(dto.Password)
 	if err != nil {
 		return nil, err
 	}
 	userData := domain.User{
-		uuid.New().String(),
-		dto.Name,
-		dto.Surname,
-		dto.Email,
-		passwordEncrypted,
+		Id:       uuid.New().String(),
+		Name:     dto.Name,
+		Surname:  dto.Surname,
+		Email:    dto.Email,
+		Password: passwordEncrypted,
+		Roles:    []string{role},
+	}
+	created, err := service.repository.Create(&userData)
+	if err != nil {
+		return nil, err
+	}
+	if invitation != nil {
+		if err := service.invitations.MarkAccepted(invitation.Id); err != nil {
+			return nil, err
+		}
+	}
+	if err := service.sendVerification(ctx, created); err != nil {
+		log.Println("[UserService][Signup] error sending verification email", err)
+	}
+	return created, nil
+}
+
+// Invite emails a link to sign up with role.
+func (service *service) Invite(ctx context.Context, dto domain.InvitationDTO) (*domain.Invitation, error) {
+	if _, ok := domain.RolePermissions[dto.Role]; !ok {
+		return nil, ErrorInvalidRole
+	}
+	_, err := service.repository.FindByEmail(dto.Email)
+	if err == nil {
+		return nil, ErrorUserExists
+	}
+	if !errors.Is(err, ErrorUserNotFound) {
+		return nil, err
+	}
+	token, hash, err := security.GenerateOpaqueToken()
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	invitation := domain.Invitation{
+		Id:        uuid.New().String(),
+		Email:     dto.Email,
+		Role:      dto.Role,
+		TokenHash: hash,
+		InvitedBy: domain.ActorFrom(ctx),
+		ExpiresAt: now.Add(invitationTTL),
+		DateUp:    now,
+	}
+	if err := service.invitations.Create(invitation); err != nil {
+		return nil, err
+	}
+	err = service.mailer.Send(ctx, mail.Message{
+		To:      invitation.Email,
+		Subject: "Invitación a la clínica",
+		Body: "Fue invitado a crear una cuenta. Para registrarse ingrese a " + service.links.InvitationURL + token +
+			"\n\nLa invitación vence en siete días.",
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &invitation, nil
+}
+
+// VerifyEmail marks the account of a verification link as verified.
+func (service *service) VerifyEmail(dto domain.VerifyEmailDTO) error {
+	verification, err := service.verifications.FindByHash(security.HashToken(dto.Token))
+	if errors.Is(err, ErrorVerificationNotFound) {
+		return ErrorInvalidVerify
+	}
+	if err != nil {
+		return err
+	}
+	if verification.UsedAt != nil || time.Now().After(verification.ExpiresAt) {
+		return ErrorInvalidVerify
 	}
-	return service.repository.Create(&userData)
+	err = service.verifications.MarkUsed(verification.Id)
+	if errors.Is(err, ErrorVerificationUsed) {
+		return ErrorInvalidVerify
+	}
+	if err != nil {
+		return err
+	}
+	return service.repository.MarkVerified(verification.UserId)
 }
 
-func (service *service) Login(dto domain.LoginDTO) (*web.LoginResponse, error) {
+// ResendVerification emails a new verification link. Unknown and already
+// verified emails are ignored so the response does not reveal accounts.
+func (service *service) ResendVerification(ctx context.Context, dto domain.ResendVerificationDTO) error {
+	user, err := service.repository.FindByEmail(dto.Email)
+	if errors.Is(err, ErrorUserNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if user.Verified {
+		return nil
+	}
+	return service.sendVerification(ctx, user)
+}
+
+// Login checks the credentials. Unknown emails and wrong passwords fail the
+// same way, and repeated failures of an account or an IP are delayed and
+// then locked for a while. Users with an authenticator app, or whose roles
+// require one, get a MfaRequiredError to finish with VerifyMfa.
+func (service *service) Login(ctx context.Context, dto domain.LoginDTO, ip string) (*web.LoginResponse, error) {
+	now := time.Now()
+	accountKey := "email:" + strings.ToLower(dto.Email)
+	ipKey := "ip:" + ip
+	if err := service.checkThrottle(accountKey, accountPolicy, now); err != nil {
+		return nil, err
+	}
+	if err := service.checkThrottle(ipKey, ipPolicy, now); err != nil {
+		return nil, err
+	}
+
 	user, err := service.repository.FindByEmail(dto.Email)
+	if errors.Is(err, ErrorUserNotFound) {
+		security.VerifyPassword(dto.Password, service.dummyHash)
+		return nil, service.failLogin(dto.Email, ip, accountKey, ipKey, now)
+	}
+	if err != nil {
+		return nil, err
+	}
+	matches, rehash, err := security.VerifyPassword(dto.Password, user.Password)
+	if err != nil {
+		log.Println("[UserService][Login] error verifying password of", user.Id, err)
+	}
+	if !matches {
+		return nil, service.failLogin(dto.Email, ip, accountKey, ipKey, now)
+	}
+	if rehash {
+		service.rehash(user, dto.Password)
+	}
+
+	if err := service.throttles.Reset(accountKey); err != nil {
+		return nil, err
+	}
+	if !user.Verified {
+		return nil, ErrorUnverified
+	}
+	challenge, err := service.challenge(user)
+	if err != nil {
+		return nil, err
+	}
+	if challenge != nil {
+		return nil, &MfaRequiredError{Challenge: *challenge}
+	}
+	service.audit(domain.AuthEvent{Event: domain.AuthEventLoginSucceeded, Email: user.Email, Ip: ip, DateUp: now})
+	return service.issue(user, uuid.New().String())
+}
+
+// VerifyMfa finishes a login with a code of the authenticator app or a
+// recovery code. On an enrollment challenge the code confirms the new app and
+// the response carries the recovery codes.
+func (service *service) VerifyMfa(ctx context.Context, dto domain.MfaVerifyDTO, ip string) (*web.LoginResponse, error) {
+	challenge, err := service.openChallenge(dto.MfaToken)
+	if err != nil {
+		return nil, err
+	}
+	user, err := service.repository.FindByID(challenge.UserId)
+	if err != nil {
+		return nil, err
+	}
+	totp, err := service.mfa.GetTotp(user.Id)
+	if errors.Is(err, ErrorTotpNotFound) {
+		return nil, ErrorInvalidMfaCode
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	var codes []string
+	if totp.ConfirmedAt == nil {
+		codes, err = service.confirm(user, totp, dto.Code)
+	} else {
+		err = service.checkCode(user, totp, dto.Code, ip)
+	}
+	if errors.Is(err, ErrorInvalidMfaCode) {
+		service.audit(domain.AuthEvent{Event: domain.AuthEventMfaFailed, Email: user.Email, Ip: ip, DateUp: now})
+		if err := service.mfa.FailChallenge(challenge.Id); err != nil {
+			return nil, err
+		}
+		return nil, ErrorInvalidMfaCode
+	}
+	if err != nil {
+		return nil, err
+	}
+	err = service.mfa.UseChallenge(challenge.Id)
+	if errors.Is(err, ErrorChallengeUsed) {
+		return nil, ErrorInvalidChallenge
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	service.audit(domain.AuthEvent{Event: domain.AuthEventMfaSucceeded, Email: user.Email, Ip: ip, DateUp: now})
+	service.audit(domain.AuthEvent{Event: domain.AuthEventLoginSucceeded, Email: user.Email, Ip: ip, DateUp: now})
+	response, err := service.issue(user, uuid.New().String())
+	if err != nil {
+		return nil, err
+	}
+	response.RecoveryCodes = codes
+	return response, nil
+}
+
+// StartMfaEnrollment sets up the authenticator app of a user whose role
+// requires two factors, with the challenge of the login.
+func (service *service) StartMfaEnrollment(dto domain.MfaChallengeDTO) (*domain.MfaEnrollment, error) {
+	challenge, err := service.openChallenge(dto.MfaToken)
+	if err != nil {
+		return nil, err
+	}
+	if !challenge.Enroll {
+		return nil, ErrorInvalidChallenge
+	}
+	user, err := service.repository.FindByID(challenge.UserId)
+	if err != nil {
+		return nil, err
+	}
+	return service.enroll(user)
+}
+
+// EnrollMfa sets up a new authenticator app for the logged in user. It is
+// not enabled until ConfirmMfa.
+func (service *service) EnrollMfa(ctx context.Context) (*domain.MfaEnrollment, error) {
+	user, err := service.currentUser(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return service.enroll(user)
+}
+
+// ConfirmMfa enables the pending authenticator app with its first code and
+// returns the recovery codes, which are not shown again.
+func (service *service) ConfirmMfa(ctx context.Context, dto domain.MfaCodeDTO) (*domain.RecoveryCodes, error) {
+	user, err := service.currentUser(ctx)
+	if err != nil {
+		return nil, err
+	}
+	totp, err := service.mfa.GetTotp(user.Id)
+	if errors.Is(err, ErrorTotpNotFound) {
+		return nil, ErrorMfaNotEnabled
+	}
+	if err != nil {
+		return nil, err
+	}
+	if totp.ConfirmedAt != nil {
+		return nil, ErrorMfaEnabled
+	}
+	codes, err := service.confirm(user, totp, dto.Code)
+	if err != nil {
+		return nil, err
+	}
+	return &domain.RecoveryCodes{Codes: codes}, nil
+}
+
+// DisableMfa removes the authenticator app of the logged in user, who proves
+// to hold it with a code. If a role requires two factors the next login asks
+// to enroll again.
+func (service *service) DisableMfa(ctx context.Context, dto domain.MfaCodeDTO) error {
+	user, totp, err := service.currentTotp(ctx)
+	if err != nil {
+		return err
+	}
+	if err := service.checkCode(user, totp, dto.Code, ""); err != nil {
+		return err
+	}
+	if err := service.mfa.DeleteTotp(user.Id); err != nil {
+		return err
+	}
+	service.audit(domain.AuthEvent{Event: domain.AuthEventMfaDisabled, Email: user.Email,
+		Actor: domain.ActorFrom(ctx), DateUp: time.Now()})
+	return nil
+}
+
+// RegenerateRecoveryCodes replaces every recovery code of the logged in user.
+func (service *service) RegenerateRecoveryCodes(ctx context.Context, dto domain.MfaCodeDTO) (*domain.RecoveryCodes, error) {
+	user, totp, err := service.currentTotp(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if err := service.checkCode(user, totp, dto.Code, ""); err != nil {
+		return nil, err
+	}
+	codes, err := service.newRecoveryCodes(user.Id)
+	if err != nil {
+		return nil, err
+	}
+	return &domain.RecoveryCodes{Codes: codes}, nil
+}
+
+// ResetMfa removes the authenticator app of a user who lost it.
+func (service *service) ResetMfa(ctx context.Context, id string) error {
+	user, err := service.repository.FindByID(id)
+	if err != nil {
+		return err
+	}
+	if err := service.mfa.DeleteTotp(user.Id); err != nil {
+		return err
+	}
+	service.audit(domain.AuthEvent{Event: domain.AuthEventMfaDisabled, Email: user.Email,
+		Actor: domain.ActorFrom(ctx), DateUp: time.Now()})
+	return nil
+}
+
+// GetMfaPolicy returns the roles that must log in with two factors.
+func (service *service) GetMfaPolicy() (*domain.MfaPolicyDTO, error) {
+	roles, err := service.mfa.GetRequiredRoles()
+	if err != nil {
+		return nil, err
+	}
+	return &domain.MfaPolicyDTO{Roles: roles}, nil
+}
+
+// SetMfaPolicy replaces the roles that must log in with two factors. Their
+// users without an authenticator app enroll one on their next login.
+func (service *service) SetMfaPolicy(dto domain.MfaPolicyDTO) (*domain.MfaPolicyDTO, error) {
+	roles := make([]string, 0, len(dto.Roles))
+	seen := map[string]bool{}
+	for _, role := range dto.Roles {
+		if _, ok := domain.RolePermissions[role]; !ok {
+			return nil, ErrorInvalidRole
+		}
+		if !seen[role] {
+			seen[role] = true
+			roles = append(roles, role)
+		}
+	}
+	if err := service.mfa.SetRequiredRoles(roles); err != nil {
+		return nil, err
+	}
+	return service.GetMfaPolicy()
+}
+
+// StartSso returns the page of the identity provider to log in at and the
+// state it sends back, which the browser has to present with the callback.
+func (service *service) StartSso(ctx context.Context) (string, string, error) {
+	if service.sso == nil {
+		return "", "", ErrorSsoDisabled
+	}
+	state, hash, err := security.GenerateOpaqueToken()
+	if err != nil {
+		return "", "", err
+	}
+	nonce, _, err := security.GenerateOpaqueToken()
+	if err != nil {
+		return "", "", err
+	}
+	verifier, err := oidc.NewVerifier()
+	if err != nil {
+		return "", "", err
+	}
+	url, err := service.sso.Provider.AuthCodeURL(ctx, state, nonce, verifier)
+	if err != nil {
+		return "", "", err
+	}
+	err = service.ssoStates.CreateState(domain.SsoState{
+		Id:        uuid.New().String(),
+		StateHash: hash,
+		Nonce:     nonce,
+		Verifier:  verifier,
+		ExpiresAt: time.Now().Add(ssoStateTTL),
+	})
+	if err != nil {
+		return "", "", err
+	}
+	return url, state, nil
+}
+
+// FinishSso logs in the user of the identity provider callback. Like Login,
+// it returns a MfaRequiredError when the user has to give a second factor.
+func (service *service) FinishSso(ctx context.Context, dto domain.SsoCallbackDTO, ip string) (*web.LoginResponse, error) {
+	if service.sso == nil {
+		return nil, ErrorSsoDisabled
+	}
+	state, err := service.ssoStates.FindState(security.HashToken(dto.State))
+	if errors.Is(err, ErrorSsoStateNotFound) {
+		return nil, ErrorInvalidSso
+	}
+	if err != nil {
+		return nil, err
+	}
+	if state.UsedAt != nil || time.Now().After(state.ExpiresAt) {
+		return nil, ErrorInvalidSso
+	}
+	err = service.ssoStates.UseState(state.Id)
+	if errors.Is(err, ErrorSsoStateUsed) {
+		return nil, ErrorInvalidSso
+	}
+	if err != nil {
+		return nil, err
+	}
+	claims, err := service.sso.Provider.Exchange(ctx, dto.Code, state.Verifier, state.Nonce)
+	if err != nil {
+		log.Println("[UserService][FinishSso] error exchanging code", err)
+		return nil, ErrorInvalidSso
+	}
+
+	user, err := service.ssoUser(claims)
+	if err != nil {
+		return nil, err
+	}
+	if roles := service.sso.roles(claims); len(roles) > 0 && !sameRoles(roles, user.Roles) {
+		if err := service.repository.SetRoles(user.Id, roles); err != nil {
+			return nil, err
+		}
+		user.Roles = roles
+	}
+	challenge, err := service.challenge(user)
+	if err != nil {
+		return nil, err
+	}
+	if challenge != nil {
+		return nil, &MfaRequiredError{Challenge: *challenge}
+	}
+	service.audit(domain.AuthEvent{Event: domain.AuthEventLoginSucceeded, Email: user.Email, Ip: ip,
+		DateUp: time.Now()})
+	return service.issue(user, uuid.New().String())
+}
+
+// ssoUser finds, links or provisions the user of the claims.
+func (service *service) ssoUser(claims *oidc.Claims) (*domain.User, error) {
+	issuer := service.sso.Provider.Issuer()
+	userId, err := service.ssoStates.FindIdentity(issuer, claims.Subject)
+	if err == nil {
+		return service.repository.FindByID(userId)
+	}
+	if !errors.Is(err, ErrorIdentityNotFound) {
+		return nil, err
+	}
+	// Only an email the provider verified can claim an account.
+	if claims.Email == "" || !claims.EmailVerified {
+		return nil, ErrorSsoNoAccount
+	}
+
+	user, err := service.repository.FindByEmail(claims.Email)
+	if errors.Is(err, ErrorUserNotFound) {
+		user, err = service.provision(claims)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if !user.Verified {
+		if err := service.repository.MarkVerified(user.Id); err != nil {
+			return nil, err
+		}
+		user.Verified = true
+	}
+	if err := service.ssoStates.CreateIdentity(issuer, claims.Subject, user.Id); err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+// provision creates the user of the claims. Its password is random, the
+// user logs in through the provider or resets it.
+func (service *service) provision(claims *oidc.Claims) (*domain.User, error) {
+	roles := service.sso.roles(claims)
+	if !service.sso.Provision || len(roles) == 0 {
+		return nil, ErrorSsoNoAccount
+	}
+	password, _, err := security.GenerateOpaqueToken()
+	if err != nil {
+		return nil, err
+	}
+	passwordEncrypted, err := security.HashPassword(password)
+	if err != nil {
+		return nil, err
+	}
+	name, surname := claims.GivenName, claims.FamilyName
+	if name == "" {
+		name = claims.Name
+	}
+	if name == "" {
+		name = strings.Split(claims.Email, "@")[0]
+	}
+	return service.repository.Create(&domain.User{
+		Id:       uuid.New().String(),
+		Name:     truncate(name, 25),
+		Surname:  truncate(surname, 25),
+		Email:    claims.Email,
+		Password: passwordEncrypted,
+		Roles:    roles,
+	})
+}
+
+// roles maps the values of the role claim to roles.
+func (sso *Sso) roles(claims *oidc.Claims) []string {
+	roles := []string{}
+	seen := map[string]bool{}
+	for _, value := range claims.Strings(sso.RoleClaim) {
+		role, ok := sso.RoleMap[value]
+		if ok && !seen[role] {
+			seen[role] = true
+			roles = append(roles, role)
+		}
+	}
+	return roles
+}
+
+func sameRoles(roles []string, others []string) bool {
+	if len(roles) != len(others) {
+		return false
+	}
+	for _, role := range roles {
+		if !hasAnyRole(others, []string{role}) {
+			return false
+		}
+	}
+	return true
+}
+
+func truncate(value string, length int) string {
+	runes := []rune(value)
+	if len(runes) > length {
+		return string(runes[:length])
+	}
+	return value
+}
+
+// challenge starts the second step of the login of user, or returns nil when
+// the user logs in with the password alone.
+func (service *service) challenge(user *domain.User) (*web.ChallengeResponse, error) {
+	totp, err := service.mfa.GetTotp(user.Id)
+	if err != nil && !errors.Is(err, ErrorTotpNotFound) {
+		return nil, err
+	}
+	enabled := totp != nil && totp.ConfirmedAt != nil
+	if !enabled {
+		required, err := service.mfa.GetRequiredRoles()
+		if err != nil {
+			return nil, err
+		}
+		if !hasAnyRole(user.Roles, required) {
+			return nil, nil
+		}
+	}
+
+	token, hash, err := security.GenerateOpaqueToken()
+	if err != nil {
+		return nil, err
+	}
+	err = service.mfa.CreateChallenge(domain.MfaChallenge{
+		Id:        uuid.New().String(),
+		UserId:    user.Id,
+		TokenHash: hash,
+		Enroll:    !enabled,
+		ExpiresAt: time.Now().Add(mfaChallengeTTL),
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &web.ChallengeResponse{
+		MfaToken:  token,
+		Enroll:    !enabled,
+		ExpiresIn: int(mfaChallengeTTL.Seconds()),
+	}, nil
+}
+
+// openChallenge returns the challenge of token while it can still be
+// answered.
+func (service *service) openChallenge(token string) (*domain.MfaChallenge, error) {
+	challenge, err := service.mfa.FindChallenge(security.HashToken(token))
+	if errors.Is(err, ErrorChallengeNotFound) {
+		return nil, ErrorInvalidChallenge
+	}
+	if err != nil {
+		return nil, err
+	}
+	if challenge.UsedAt != nil || time.Now().After(challenge.ExpiresAt) ||
+		challenge.Attempts >= mfaChallengeAttempts {
+		return nil, ErrorInvalidChallenge
+	}
+	return challenge, nil
+}
+
+// enroll saves a new pending secret for user. A confirmed app has to be
+// disabled first, so a stolen session cannot replace it.
+func (service *service) enroll(user *domain.User) (*domain.MfaEnrollment, error) {
+	totp, err := service.mfa.GetTotp(user.Id)
+	if err != nil && !errors.Is(err, ErrorTotpNotFound) {
+		return nil, err
+	}
+	if totp != nil && totp.ConfirmedAt != nil {
+		return nil, ErrorMfaEnabled
+	}
+	secret, err := security.GenerateTOTPSecret()
+	if err != nil {
+		return nil, err
+	}
+	if err := service.mfa.SaveTotp(user.Id, secret); err != nil {
+		return nil, err
+	}
+	uri := security.TOTPURI(totpIssuer, user.Email, secret)
+	png, err := qrcode.Encode(uri, qrcode.Medium, 256)
+	if err != nil {
+		return nil, err
+	}
+	return &domain.MfaEnrollment{
+		Secret: secret,
+		URI:    uri,
+		QRCode: "data:image/png;base64," + base64.StdEncoding.EncodeToString(png),
+	}, nil
+}
+
+// confirm enables the pending app of user with its first code.
+func (service *service) confirm(user *domain.User, totp *domain.Totp, code string) ([]string, error) {
+	step, ok := security.ValidateTOTP(totp.Secret, code, time.Now())
+	if !ok {
+		return nil, ErrorInvalidMfaCode
+	}
+	err := service.mfa.ConfirmTotp(user.Id, step)
+	if errors.Is(err, ErrorTotpStepUsed) {
+		return nil, ErrorInvalidMfaCode
+	}
+	if err != nil {
+		return nil, err
+	}
+	codes, err := service.newRecoveryCodes(user.Id)
+	if err != nil {
+		return nil, err
+	}
+	service.audit(domain.AuthEvent{Event: domain.AuthEventMfaEnabled, Email: user.Email, DateUp: time.Now()})
+	return codes, nil
+}
+
+// checkCode accepts a code of the confirmed app, once, or an unused
+// recovery code.
+func (service *service) checkCode(user *domain.User, totp *domain.Totp, code string, ip string) error {
+	if step, ok := security.ValidateTOTP(totp.Secret, code, time.Now()); ok {
+		err := service.mfa.UseStep(user.Id, step)
+		if errors.Is(err, ErrorTotpStepUsed) {
+			return ErrorInvalidMfaCode
+		}
+		return err
+	}
+	err := service.mfa.UseRecoveryCode(user.Id, security.HashRecoveryCode(code))
+	if errors.Is(err, ErrorRecoveryCodeNotFound) {
+		return ErrorInvalidMfaCode
+	}
+	if err != nil {
+		return err
+	}
+	service.audit(domain.AuthEvent{Event: domain.AuthEventRecoveryCodeUsed, Email: user.Email, Ip: ip,
+		DateUp: time.Now()})
+	return nil
+}
+
+func (service *service) newRecoveryCodes(userId string) ([]string, error) {
+	codes := make([]string, recoveryCodeCount)
+	hashes := make([]string, recoveryCodeCount)
+	for i := range codes {
+		code, err := security.GenerateRecoveryCode()
+		if err != nil {
+			return nil, err
+		}
+		codes[i] = code
+		hashes[i] = security.HashRecoveryCode(code)
+	}
+	if err := service.mfa.ReplaceRecoveryCodes(userId, hashes); err != nil {
+		return nil, err
+	}
+	return codes, nil
+}
+
+// currentUser is the user of the access token of the request.
+func (service *service) currentUser(ctx context.Context) (*domain.User, error) {
+	principal, ok := domain.PrincipalFrom(ctx)
+	if !ok {
+		return nil, ErrorUserNotFound
+	}
+	return service.repository.FindByID(principal.UserId)
+}
+
+// currentTotp is the confirmed app of the user of the request.
+func (service *service) currentTotp(ctx context.Context) (*domain.User, *domain.Totp, error) {
+	user, err := service.currentUser(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+	totp, err := service.mfa.GetTotp(user.Id)
+	if errors.Is(err, ErrorTotpNotFound) {
+		return nil, nil, ErrorMfaNotEnabled
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	if totp.ConfirmedAt == nil {
+		return nil, nil, ErrorMfaNotEnabled
+	}
+	return user, totp, nil
+}
+
+func hasAnyRole(roles []string, wanted []string) bool {
+	for _, role := range roles {
+		for _, other := range wanted {
+			if role == other {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// rehash stores the password with the present hashing algorithm and
+// parameters. The login goes on if it fails, the old hash still works.
+func (service *service) rehash(user *domain.User, password string) {
+	hash, err := security.HashPassword(password)
+	if err == nil {
+		err = service.repository.SetPassword(user.Id, hash)
+	}
+	if err != nil {
+		log.Println("[UserService][rehash] error rehashing password of", user.Id, err)
+	}
+}
+
+// Unlock clears the failed logins of an account.
+func (service *service) Unlock(ctx context.Context, id string) error {
+	user, err := service.repository.FindByID(id)
+	if err != nil {
+		return err
+	}
+	if err := service.throttles.Reset("email:" + strings.ToLower(user.Email)); err != nil {
+		return err
+	}
+	service.audit(domain.AuthEvent{
+		Event:  domain.AuthEventAccountUnlocked,
+		Email:  user.Email,
+		Actor:  domain.ActorFrom(ctx),
+		DateUp: time.Now(),
+	})
+	return nil
+}
+
+func (service *service) checkThrottle(key string, policy loginPolicy, now time.Time) error {
+	throttle, err := service.throttles.Get(key)
+	if err != nil {
+		return err
+	}
+	if throttle.LockedUntil != nil && now.Before(*throttle.LockedUntil) {
+		return &ThrottledError{RetryAfter: throttle.LockedUntil.Sub(now)}
+	}
+	if throttle.LockedUntil != nil {
+		// The lock expired, the key starts over.
+		return service.throttles.Reset(key)
+	}
+	if wait := throttle.LastFailedAt.Add(policy.delay(throttle.Failures)).Sub(now); wait > 0 {
+		return &ThrottledError{RetryAfter: wait}
+	}
+	return nil
+}
+
+func (service *service) failLogin(email string, ip string, accountKey string, ipKey string, now time.Time) error {
+	service.audit(domain.AuthEvent{Event: domain.AuthEventLoginFailed, Email: email, Ip: ip, DateUp: now})
+	for key, policy := range map[string]loginPolicy{accountKey: accountPolicy, ipKey: ipPolicy} {
+		throttle, err := service.throttles.Fail(key, now)
+		if err != nil {
+			return err
+		}
+		if throttle.Failures == policy.lockAfter {
+			if err := service.throttles.Lock(key, now.Add(policy.lockFor)); err != nil {
+				return err
+			}
+			service.audit(domain.AuthEvent{Event: policy.lockEvent, Email: email, Ip: ip, DateUp: now})
+		}
+	}
+	return ErrorInvalidCredentials
+}
+
+// audit records an authentication event. A failed record does not change
+// the outcome of the login.
+func (service *service) audit(event domain.AuthEvent) {
+	if err := service.events.Create(event); err != nil {
+		log.Println("[UserService][audit] error recording", event.Event, err)
+	}
+}
+
+// delay is how long to wait after the last of failures.
+func (p loginPolicy) delay(failures int) time.Duration {
+	if failures < p.delayAfter {
+		return 0
+	}
+	delay := time.Second << uint(failures-p.delayAfter)
+	if delay > p.maxDelay || delay <= 0 {
+		return p.maxDelay
+	}
+	return delay
+}
+
+// Refresh rotates a refresh token. Presenting a token that was already
+// rotated means it leaked, so its whole family is revoked.
+func (service *service) Refresh(dto domain.RefreshDTO) (*web.LoginResponse, error) {
+	token, err := service.tokens.FindByHash(security.HashToken(dto.RefreshToken))
+	if errors.Is(err, ErrorRefreshTokenNotFound) {
+		return nil, ErrorInvalidRefresh
+	}
+	if err != nil {
+		return nil, err
+	}
+	if token.RevokedAt != nil || time.Now().After(token.ExpiresAt) {
+		return nil, ErrorInvalidRefresh
+	}
+	if token.UsedAt != nil {
+		return nil, service.reused(token)
+	}
+	err = service.tokens.MarkUsed(token.Id)
+	if errors.Is(err, ErrorRefreshTokenUsed) {
+		return nil, service.reused(token)
+	}
+	if err != nil {
+		return nil, err
+	}
+	user, err := service.repository.FindByID(token.UserId)
+	if err != nil {
+		return nil, err
+	}
+	return service.issue(user, token.FamilyId)
+}
+
+// Logout revokes the access token of claim and, when given, the family of
+// the refresh token.
+func (service *service) Logout(claim *domain.Claim, dto domain.RefreshDTO) error {
+	if dto.RefreshToken != "" {
+		token, err := service.tokens.FindByHash(security.HashToken(dto.RefreshToken))
+		if errors.Is(err, ErrorRefreshTokenNotFound) {
+			return ErrorInvalidRefresh
+		}
+		if err != nil {
+			return err
+		}
+		if token.UserId != claim.Subject {
+			return ErrorInvalidRefresh
+		}
+		if err := service.tokens.RevokeFamily(token.FamilyId); err != nil {
+			return err
+		}
+	}
+	return service.tokens.RevokeAccess(claim.Id, time.Unix(claim.ExpiresAt, 0))
+}
+
+func (service *service) issue(user *domain.User, familyId string) (*web.LoginResponse, error) {
+	jti := uuid.New().String()
+	access, err := security.GenerateToken(user, jti)
 	if err != nil {
 		return nil, err
 	}
-	if !passwordCompare(dto.Password, user.Password) {
-		return nil, ErrorInvalidCredentials
+	refresh, hash, err := security.GenerateOpaqueToken()
+	if err != nil {
+		return nil, err
 	}
-	token, err := security.GenerateToken(&dto)
+	now := time.Now()
+	err = service.tokens.Create(domain.RefreshToken{
+		Id:            uuid.New().String(),
+		UserId:        user.Id,
+		FamilyId:      familyId,
+		TokenHash:     hash,
+		AccessJti:     jti,
+		AccessExpires: now.Add(security.AccessTokenTTL),
+		ExpiresAt:     now.Add(security.RefreshTokenTTL),
+	})
 	if err != nil {
 		return nil, err
 	}
-	return &web.LoginResponse{token}, nil
+	return &web.LoginResponse{
+		Token:        access,
+		RefreshToken: refresh,
+		ExpiresIn:    int(security.AccessTokenTTL.Seconds()),
+	}, nil
+}
+
+func (service *service) reused(token *domain.RefreshToken) error {
+	log.Println("[UserService][Refresh] refresh token reused, revoking family", token.FamilyId)
+	if err := service.tokens.RevokeFamily(token.FamilyId); err != nil {
+		return err
+	}
+	return ErrorRefreshReused
+}
+
+func (service *service) FindByEmail(email string) (*domain.User, error) {
+	return service.repository.FindByEmail(email)
+}
+
+// LinkDentist links the user to a dentist. Its sessions are ended, the
+// tokens it holds do not carry the dentist.
+func (service *service) LinkDentist(ctx context.Context, id string, dto domain.UserDentistDTO) (*domain.User, error) {
+	if _, err := service.dentists.GetByID(ctx, dto.IdDentist); err != nil {
+		return nil, err
+	}
+	if err := service.repository.SetDentist(id, &dto.IdDentist); err != nil {
+		return nil, err
+	}
+	return service.revoked(id)
+}
+
+// UnlinkDentist unlinks the user from its dentist and ends its sessions,
+// the tokens it holds would still be scoped to the dentist.
+func (service *service) UnlinkDentist(ctx context.Context, id string) (*domain.User, error) {
+	if err := service.repository.SetDentist(id, nil); err != nil {
+		return nil, err
+	}
+	return service.revoked(id)
+}
+
+// LinkPatient links the user to a patient, the user then acts as the
+// guardian of its family. Its sessions are ended, the tokens it holds do not
+// carry the patient.
+func (service *service) LinkPatient(ctx context.Context, id string, dto domain.UserPatientDTO) (*domain.User, error) {
+	if _, err := service.patients.GetByID(ctx, dto.IdPatient); err != nil {
+		return nil, err
+	}
+	if err := service.repository.SetPatient(id, &dto.IdPatient); err != nil {
+		return nil, err
+	}
+	return service.revoked(id)
+}
+
+// UnlinkPatient unlinks the user from its patient and ends its sessions,
+// the tokens it holds would still act for the family of the patient.
+func (service *service) UnlinkPatient(ctx context.Context, id string) (*domain.User, error) {
+	if err := service.repository.SetPatient(id, nil); err != nil {
+		return nil, err
+	}
+	return service.revoked(id)
+}
+
+// SetRoles replaces the roles of the user and ends its sessions, the tokens
+// it holds would keep the permissions of the old roles.
+func (service *service) SetRoles(ctx context.Context, id string, dto domain.UserRolesDTO) (*domain.User, error) {
+	roles := make([]string, 0, len(dto.Roles))
+	seen := map[string]bool{}
+	for _, role := range dto.Roles {
+		if _, ok := domain.RolePermissions[role]; !ok {
+			return nil, ErrorInvalidRole
+		}
+		if !seen[role] {
+			seen[role] = true
+			roles = append(roles, role)
+		}
+	}
+	if err := service.repository.SetRoles(id, roles); err != nil {
+		return nil, err
+	}
+	return service.revoked(id)
+}
+
+// revoked ends the sessions of a user whose access changed and returns it.
+func (service *service) revoked(id string) (*domain.User, error) {
+	if err := service.tokens.RevokeUser(id); err != nil {
+		log.Println("[UserService][revoked] error revoking tokens of user", id, err)
+		return nil, err
+	}
+	return service.repository.FindByID(id)
 }
 
-func passwordEncrypt(password string) (string, error) {
-	passwordBytes := []byte(password)
-	log.Println(passwordBytes)
-	encrypted, err := bcrypt.GenerateFromPassword(passwordBytes, bcrypt.DefaultCost)
+// ForgotPassword emails a one-time reset link. Unknown emails are ignored
+// so the response does not reveal which accounts exist.
+func (service *service) ForgotPassword(ctx context.Context, dto domain.ForgotPasswordDTO) error {
+	user, err := service.repository.FindByEmail(dto.Email)
+	if errors.Is(err, ErrorUserNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	token, hash, err := security.GenerateOpaqueToken()
+	if err != nil {
+		return err
+	}
+	err = service.resets.Create(domain.PasswordReset{
+		Id:        uuid.New().String(),
+		UserId:    user.Id,
+		TokenHash: hash,
+		ExpiresAt: time.Now().Add(passwordResetTTL),
+	})
+	if err != nil {
+		return err
+	}
+	return service.mailer.Send(ctx, mail.Message{
+		To:      user.Email,
+		Subject: "Restablecer contraseña",
+		Body: "Para elegir una nueva contraseña ingrese a " + service.links.ResetURL + token +
+			"\n\nEl enlace vence en una hora. Si no lo pidió, ignore este correo.",
+	})
+}
+
+// ResetPassword sets a new password with a reset token and ends every open
+// session of the user.
+func (service *service) ResetPassword(dto domain.ResetPasswordDTO) error {
+	reset, err := service.resets.FindByHash(security.HashToken(dto.Token))
+	if errors.Is(err, ErrorPasswordResetNotFound) {
+		return ErrorInvalidReset
+	}
+	if err != nil {
+		return err
+	}
+	if reset.UsedAt != nil || time.Now().After(reset.ExpiresAt) {
+		return ErrorInvalidReset
+	}
+	user, err := service.repository.FindByID(reset.UserId)
+	if err != nil {
+		return err
+	}
+	// A rejected password does not spend the token.
+	if err := service.policy.Check(dto.Password, user.Email); err != nil {
+		return err
+	}
+	err = service.resets.MarkUsed(reset.Id)
+	if errors.Is(err, ErrorPasswordResetUsed) {
+		return ErrorInvalidReset
+	}
+	if err != nil {
+		return err
+	}
+	passwordEncrypted, err := security.HashPassword(dto.Password)
 	if err != nil {
-		return "", err
+		return err
 	}
-	return string(encrypted), nil
+	if err := service.repository.SetPassword(reset.UserId, passwordEncrypted); err != nil {
+		return err
+	}
+	if err := service.resets.MarkUsedByUser(reset.UserId); err != nil {
+		return err
+	}
+	return service.tokens.RevokeUser(reset.UserId)
 }
 
-func passwordCompare(password, hashed string) bool {
-	passwordBytes := []byte(password)
-	hashedBytes := []byte(hashed)
-	err := bcrypt.CompareHashAndPassword(hashedBytes, passwordBytes)
-	return err == nil
+func (service *service) sendVerification(ctx context.Context, user *domain.User) error {
+	token, hash, err := security.GenerateOpaqueToken()
+	if err != nil {
+		return err
+	}
+	err = service.verifications.Create(domain.EmailVerification{
+		Id:        uuid.New().String(),
+		UserId:    user.Id,
+		TokenHash: hash,
+		ExpiresAt: time.Now().Add(emailVerificationTTL),
+	})
+	if err != nil {
+		return err
+	}
+	return service.mailer.Send(ctx, mail.Message{
+		To:      user.Email,
+		Subject: "Verificar email",
+		Body: "Para activar su cuenta ingrese a " + service.links.VerifyURL + token +
+			"\n\nEl enlace vence en dos días.",
+	})
 }
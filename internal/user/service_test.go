@@ -0,0 +1,331 @@
+package product
+
+import (
+	"crypto/ed25519"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/x509"
+	"encoding/base32"
+	"encoding/binary"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/ncondezo/final/internal/domain"
+	"github.com/ncondezo/final/pkg/security"
+)
+
+// The fakes embed the interfaces they stand in for, a call to a method the
+// test does not expect panics.
+
+type fakeUsers struct {
+	Repository
+	users map[string]*domain.User
+}
+
+func (f *fakeUsers) FindByID(id string) (*domain.User, error) {
+	user, ok := f.users[id]
+	if !ok {
+		return nil, ErrorUserNotFound
+	}
+	return user, nil
+}
+
+// fakeMfa keeps the last accepted step and the unused recovery codes the way
+// the queries of mfaRepository do.
+type fakeMfa struct {
+	MfaRepository
+	lastStep int64
+	codes    map[string]bool
+}
+
+func (f *fakeMfa) UseStep(userId string, step int64) error {
+	if step <= f.lastStep {
+		return ErrorTotpStepUsed
+	}
+	f.lastStep = step
+	return nil
+}
+
+func (f *fakeMfa) UseRecoveryCode(userId string, hash string) error {
+	if !f.codes[hash] {
+		return ErrorRecoveryCodeNotFound
+	}
+	f.codes[hash] = false
+	return nil
+}
+
+type fakeEvents struct {
+	events []string
+}
+
+func (f *fakeEvents) Create(event domain.AuthEvent) error {
+	f.events = append(f.events, event.Event)
+	return nil
+}
+
+type fakeTokens struct {
+	TokenRepository
+	tokens  map[string]*domain.RefreshToken
+	created []domain.RefreshToken
+	revoked []string
+	// raceUsed makes MarkUsed fail as if another request rotated the token.
+	raceUsed bool
+}
+
+func (f *fakeTokens) FindByHash(hash string) (*domain.RefreshToken, error) {
+	token, ok := f.tokens[hash]
+	if !ok {
+		return nil, ErrorRefreshTokenNotFound
+	}
+	return token, nil
+}
+
+func (f *fakeTokens) MarkUsed(id string) error {
+	if f.raceUsed {
+		return ErrorRefreshTokenUsed
+	}
+	for _, token := range f.tokens {
+		if token.Id == id {
+			now := time.Now()
+			token.UsedAt = &now
+		}
+	}
+	return nil
+}
+
+func (f *fakeTokens) RevokeFamily(familyId string) error {
+	f.revoked = append(f.revoked, familyId)
+	return nil
+}
+
+func (f *fakeTokens) Create(token domain.RefreshToken) error {
+	f.created = append(f.created, token)
+	return nil
+}
+
+const totpSecret = "JBSWY3DPEHPK3PXPJBSWY3DPEHPK3PXP"
+
+// totpCode is the code an authenticator app shows for secret at at.
+func totpCode(t *testing.T, secret string, at time.Time) string {
+	t.Helper()
+	key, err := base32.StdEncoding.WithPadding(base32.NoPadding).DecodeString(secret)
+	if err != nil {
+		t.Fatal(err)
+	}
+	counter := make([]byte, 8)
+	binary.BigEndian.PutUint64(counter, uint64(at.Unix()/30))
+	mac := hmac.New(sha1.New, key)
+	mac.Write(counter)
+	sum := mac.Sum(nil)
+	offset := sum[len(sum)-1] & 0x0f
+	value := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+	return fmt.Sprintf("%06d", value%1000000)
+}
+
+func TestCheckCodeRejectsReplayedTotp(t *testing.T) {
+	user := &domain.User{Id: "user-1", Email: "user@clinic.test"}
+	totp := &domain.Totp{UserId: user.Id, Secret: totpSecret}
+	now := time.Now()
+
+	tests := []struct {
+		name     string
+		lastStep int64
+		code     string
+		want     error
+	}{
+		{name: "fresh code", lastStep: 0, code: totpCode(t, totpSecret, now), want: nil},
+		{name: "code of the step already used", lastStep: now.Unix() / 30, code: totpCode(t, totpSecret, now), want: ErrorInvalidMfaCode},
+		{name: "code older than the step used", lastStep: now.Unix()/30 + 1, code: totpCode(t, totpSecret, now), want: ErrorInvalidMfaCode},
+		{name: "code outside the window", lastStep: 0, code: totpCode(t, totpSecret, now.Add(-5*time.Minute)), want: ErrorInvalidMfaCode},
+		{name: "not a code", lastStep: 0, code: "abc", want: ErrorInvalidMfaCode},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			mfa := &fakeMfa{lastStep: test.lastStep, codes: map[string]bool{}}
+			service := &service{mfa: mfa, events: &fakeEvents{}}
+
+			err := service.checkCode(user, totp, test.code, "127.0.0.1")
+			if !errors.Is(err, test.want) {
+				t.Fatalf("err = %v, want %v", err, test.want)
+			}
+		})
+	}
+}
+
+func TestCheckCodeAcceptsTotpOnce(t *testing.T) {
+	user := &domain.User{Id: "user-1", Email: "user@clinic.test"}
+	totp := &domain.Totp{UserId: user.Id, Secret: totpSecret}
+	service := &service{mfa: &fakeMfa{codes: map[string]bool{}}, events: &fakeEvents{}}
+
+	code := totpCode(t, totpSecret, time.Now())
+	if err := service.checkCode(user, totp, code, "127.0.0.1"); err != nil {
+		t.Fatalf("first use: %v", err)
+	}
+	if err := service.checkCode(user, totp, code, "127.0.0.1"); !errors.Is(err, ErrorInvalidMfaCode) {
+		t.Fatalf("replay: err = %v, want %v", err, ErrorInvalidMfaCode)
+	}
+}
+
+func TestCheckCodeUsesRecoveryCodesOnce(t *testing.T) {
+	user := &domain.User{Id: "user-1", Email: "user@clinic.test"}
+	totp := &domain.Totp{UserId: user.Id, Secret: totpSecret}
+	first, err := security.GenerateRecoveryCode()
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := security.GenerateRecoveryCode()
+	if err != nil {
+		t.Fatal(err)
+	}
+	events := &fakeEvents{}
+	mfa := &fakeMfa{codes: map[string]bool{
+		security.HashRecoveryCode(first):  true,
+		security.HashRecoveryCode(second): true,
+	}}
+	service := &service{mfa: mfa, events: events}
+
+	steps := []struct {
+		name string
+		code string
+		want error
+	}{
+		{name: "first code", code: first, want: nil},
+		{name: "first code again", code: first, want: ErrorInvalidMfaCode},
+		{name: "first code typed differently", code: first[:5] + first[6:], want: ErrorInvalidMfaCode},
+		{name: "second code without dash", code: second[:5] + second[6:], want: nil},
+		{name: "second code again", code: second, want: ErrorInvalidMfaCode},
+		{name: "unknown code", code: "aaaaa-bbbbb", want: ErrorInvalidMfaCode},
+	}
+	for _, step := range steps {
+		if err := service.checkCode(user, totp, step.code, "127.0.0.1"); !errors.Is(err, step.want) {
+			t.Fatalf("%s: err = %v, want %v", step.name, err, step.want)
+		}
+	}
+
+	used := 0
+	for _, event := range events.events {
+		if event == domain.AuthEventRecoveryCodeUsed {
+			used++
+		}
+	}
+	if used != 2 {
+		t.Fatalf("%d recovery code uses recorded, want 2", used)
+	}
+}
+
+// loadTestKeys makes security sign access tokens with a throwaway key.
+func loadTestKeys(t *testing.T) {
+	t.Helper()
+	_, private, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, err := x509.MarshalPKCS8PrivateKey(private)
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), "signing.pem")
+	if err := os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), 0600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("TOKEN_SIGNING_KEY_FILE", path)
+	t.Setenv("TOKEN_VERIFICATION_KEY_FILES", "")
+	if err := security.LoadKeys(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestRefreshRevokesTheFamilyOnReuse(t *testing.T) {
+	loadTestKeys(t)
+
+	now := time.Now()
+	used := now.Add(-time.Minute)
+	revoked := now.Add(-time.Minute)
+	tests := []struct {
+		name      string
+		token     domain.RefreshToken
+		raceUsed  bool
+		want      error
+		revokes   bool
+		issuesNew bool
+	}{
+		{
+			name:      "unused token rotates within its family",
+			token:     domain.RefreshToken{ExpiresAt: now.Add(time.Hour)},
+			issuesNew: true,
+		},
+		{
+			name:    "reused token revokes its family",
+			token:   domain.RefreshToken{ExpiresAt: now.Add(time.Hour), UsedAt: &used},
+			want:    ErrorRefreshReused,
+			revokes: true,
+		},
+		{
+			name:     "token rotated by a concurrent request revokes its family",
+			token:    domain.RefreshToken{ExpiresAt: now.Add(time.Hour)},
+			raceUsed: true,
+			want:     ErrorRefreshReused,
+			revokes:  true,
+		},
+		{
+			name:  "revoked token is rejected",
+			token: domain.RefreshToken{ExpiresAt: now.Add(time.Hour), RevokedAt: &revoked},
+			want:  ErrorInvalidRefresh,
+		},
+		{
+			name:  "expired token is rejected",
+			token: domain.RefreshToken{ExpiresAt: now.Add(-time.Second)},
+			want:  ErrorInvalidRefresh,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			refresh := "refresh-token"
+			token := test.token
+			token.Id = "token-1"
+			token.UserId = "user-1"
+			token.FamilyId = "family-1"
+			tokens := &fakeTokens{
+				tokens:   map[string]*domain.RefreshToken{security.HashToken(refresh): &token},
+				raceUsed: test.raceUsed,
+			}
+			service := &service{
+				repository: &fakeUsers{users: map[string]*domain.User{"user-1": {Id: "user-1"}}},
+				tokens:     tokens,
+			}
+
+			response, err := service.Refresh(domain.RefreshDTO{RefreshToken: refresh})
+			if !errors.Is(err, test.want) {
+				t.Fatalf("err = %v, want %v", err, test.want)
+			}
+			if test.revokes != (len(tokens.revoked) == 1 && tokens.revoked[0] == "family-1") {
+				t.Errorf("revoked families = %v, want family revoked %v", tokens.revoked, test.revokes)
+			}
+			if !test.issuesNew {
+				if response != nil || len(tokens.created) > 0 {
+					t.Errorf("tokens were issued")
+				}
+				return
+			}
+			if response == nil || len(tokens.created) != 1 {
+				t.Fatalf("no tokens were issued")
+			}
+			if tokens.created[0].FamilyId != "family-1" {
+				t.Errorf("new token family = %s, want family-1", tokens.created[0].FamilyId)
+			}
+		})
+	}
+
+	t.Run("unknown token is rejected", func(t *testing.T) {
+		service := &service{tokens: &fakeTokens{tokens: map[string]*domain.RefreshToken{}}}
+		if _, err := service.Refresh(domain.RefreshDTO{RefreshToken: "unknown"}); !errors.Is(err, ErrorInvalidRefresh) {
+			t.Fatalf("err = %v, want %v", err, ErrorInvalidRefresh)
+		}
+	})
+}
@@ -0,0 +1,102 @@
+package product
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/ncondezo/final/internal/domain"
+)
+
+const (
+	createSsoStateQuery = "INSERT INTO sso_states (id, state_hash, nonce, verifier, expires_at, dateup) " +
+		"VALUES (?, ?, ?, ?, ?, ?)"
+	findSsoStateQuery   = "SELECT id, state_hash, nonce, verifier, expires_at, used_at FROM sso_states WHERE state_hash = ?"
+	useSsoStateQuery    = "UPDATE sso_states SET used_at = ? WHERE id = ? AND used_at IS NULL"
+	findIdentityQuery   = "SELECT users_id FROM user_identities WHERE issuer = ? AND subject = ?"
+	createIdentityQuery = "INSERT INTO user_identities (issuer, subject, users_id, dateup) VALUES (?, ?, ?, ?)"
+)
+
+var (
+	ErrorSsoStateNotFound = errors.New("sso state not found")
+	ErrorSsoStateUsed     = errors.New("sso state already used")
+	ErrorIdentityNotFound = errors.New("identity not found")
+)
+
+// SsoRepository keeps the logins started at the identity provider and the
+// subjects of the provider linked to each user.
+type SsoRepository interface {
+	CreateState(state domain.SsoState) error
+	FindState(hash string) (*domain.SsoState, error)
+	UseState(id string) error
+	FindIdentity(issuer string, subject string) (string, error)
+	CreateIdentity(issuer string, subject string, userId string) error
+}
+
+type ssoRepository struct {
+	db *sql.DB
+}
+
+func NewSsoRepository(db *sql.DB) SsoRepository {
+	return &ssoRepository{db}
+}
+
+func (repository *ssoRepository) CreateState(state domain.SsoState) error {
+	_, err := repository.db.Exec(createSsoStateQuery,
+		state.Id,
+		state.StateHash,
+		state.Nonce,
+		state.Verifier,
+		state.ExpiresAt,
+		time.Now(),
+	)
+	return err
+}
+
+func (repository *ssoRepository) FindState(hash string) (*domain.SsoState, error) {
+	var state domain.SsoState
+	var usedAt sql.NullTime
+	err := repository.db.QueryRow(findSsoStateQuery, hash).Scan(
+		&state.Id,
+		&state.StateHash,
+		&state.Nonce,
+		&state.Verifier,
+		&state.ExpiresAt,
+		&usedAt,
+	)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrorSsoStateNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	if usedAt.Valid {
+		state.UsedAt = &usedAt.Time
+	}
+	return &state, nil
+}
+
+// UseState fails with ErrorSsoStateUsed when the callback was already
+// handled.
+func (repository *ssoRepository) UseState(id string) error {
+	err := expectRow(repository.db.Exec(useSsoStateQuery, time.Now(), id))
+	if errors.Is(err, errNoRows) {
+		return ErrorSsoStateUsed
+	}
+	return err
+}
+
+// FindIdentity returns the id of the user linked to the subject.
+func (repository *ssoRepository) FindIdentity(issuer string, subject string) (string, error) {
+	var userId string
+	err := repository.db.QueryRow(findIdentityQuery, issuer, subject).Scan(&userId)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", ErrorIdentityNotFound
+	}
+	return userId, err
+}
+
+func (repository *ssoRepository) CreateIdentity(issuer string, subject string, userId string) error {
+	_, err := repository.db.Exec(createIdentityQuery, issuer, subject, userId, time.Now())
+	return err
+}
@@ -0,0 +1,97 @@
+package product
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/ncondezo/final/internal/domain"
+)
+
+const (
+	findThrottleQuery = "SELECT throttle_key, failures, last_failed_at, locked_until FROM login_throttles WHERE throttle_key = ?"
+	failThrottleQuery = "INSERT INTO login_throttles (throttle_key, failures, last_failed_at) VALUES (?, 1, ?) " +
+		"ON DUPLICATE KEY UPDATE failures = failures + 1, last_failed_at = VALUES(last_failed_at)"
+	lockThrottleQuery  = "UPDATE login_throttles SET locked_until = ? WHERE throttle_key = ?"
+	resetThrottleQuery = "DELETE FROM login_throttles WHERE throttle_key = ?"
+	createEventQuery   = "INSERT INTO auth_events (event, email, ip, actor, dateup) VALUES (?, ?, ?, ?, ?)"
+)
+
+// ThrottleRepository counts the failed logins of an account or an IP.
+type ThrottleRepository interface {
+	Get(key string) (domain.Throttle, error)
+	Fail(key string, at time.Time) (domain.Throttle, error)
+	Lock(key string, until time.Time) error
+	Reset(key string) error
+}
+
+// EventRepository keeps the audit trail of logins, lockouts and unlocks.
+type EventRepository interface {
+	Create(event domain.AuthEvent) error
+}
+
+type throttleRepository struct {
+	db *sql.DB
+}
+
+func NewThrottleRepository(db *sql.DB) ThrottleRepository {
+	return &throttleRepository{db}
+}
+
+// Get returns an empty throttle for keys without failures.
+func (repository *throttleRepository) Get(key string) (domain.Throttle, error) {
+	throttle := domain.Throttle{Key: key}
+	var lockedUntil sql.NullTime
+	err := repository.db.QueryRow(findThrottleQuery, key).Scan(
+		&throttle.Key,
+		&throttle.Failures,
+		&throttle.LastFailedAt,
+		&lockedUntil,
+	)
+	if errors.Is(err, sql.ErrNoRows) {
+		return throttle, nil
+	}
+	if err != nil {
+		return domain.Throttle{}, err
+	}
+	if lockedUntil.Valid {
+		throttle.LockedUntil = &lockedUntil.Time
+	}
+	return throttle, nil
+}
+
+func (repository *throttleRepository) Fail(key string, at time.Time) (domain.Throttle, error) {
+	if _, err := repository.db.Exec(failThrottleQuery, key, at); err != nil {
+		return domain.Throttle{}, err
+	}
+	return repository.Get(key)
+}
+
+func (repository *throttleRepository) Lock(key string, until time.Time) error {
+	_, err := repository.db.Exec(lockThrottleQuery, until, key)
+	return err
+}
+
+func (repository *throttleRepository) Reset(key string) error {
+	_, err := repository.db.Exec(resetThrottleQuery, key)
+	return err
+}
+
+type eventRepository struct {
+	db *sql.DB
+}
+
+func NewEventRepository(db *sql.DB) EventRepository {
+	return &eventRepository{db}
+}
+
+func (repository *eventRepository) Create(event domain.AuthEvent) error {
+	_, err := repository.db.Exec(createEventQuery,
+		event.Event,
+		event.Email,
+		event.Ip,
+		event.Actor,
+		event.DateUp,
+	)
+	return err
+}
@@ -0,0 +1,162 @@
+package product
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/ncondezo/final/internal/domain"
+)
+
+const (
+	createRefreshTokenQuery = "INSERT INTO refresh_tokens (id, users_id, family_id, token_hash, access_jti, access_expires, expires_at, dateup) " +
+		"VALUES (?, ?, ?, ?, ?, ?, ?, ?)"
+	findRefreshTokenQuery = "SELECT id, users_id, family_id, token_hash, access_jti, access_expires, expires_at, used_at, revoked_at " +
+		"FROM refresh_tokens WHERE token_hash = ?"
+	useRefreshTokenQuery    = "UPDATE refresh_tokens SET used_at = ? WHERE id = ? AND used_at IS NULL"
+	revokeFamilyAccessQuery = "INSERT IGNORE INTO revoked_tokens (jti, expires_at) " +
+		"SELECT access_jti, access_expires FROM refresh_tokens WHERE family_id = ? AND access_expires > ?"
+	revokeFamilyQuery     = "UPDATE refresh_tokens SET revoked_at = ? WHERE family_id = ? AND revoked_at IS NULL"
+	revokeUserAccessQuery = "INSERT IGNORE INTO revoked_tokens (jti, expires_at) " +
+		"SELECT access_jti, access_expires FROM refresh_tokens WHERE users_id = ? AND access_expires > ?"
+	revokeUserQuery   = "UPDATE refresh_tokens SET revoked_at = ? WHERE users_id = ? AND revoked_at IS NULL"
+	revokeAccessQuery = "INSERT IGNORE INTO revoked_tokens (jti, expires_at) VALUES (?, ?)"
+	findRevokedQuery  = "SELECT COUNT(*) FROM revoked_tokens WHERE jti = ?"
+	purgeRevokedQuery = "DELETE FROM revoked_tokens WHERE expires_at < ?"
+)
+
+var (
+	ErrorRefreshTokenNotFound = errors.New("refresh token not found")
+	ErrorRefreshTokenUsed     = errors.New("refresh token already used")
+)
+
+// TokenRepository keeps the hashed refresh tokens and the access tokens
+// revoked before they expire.
+type TokenRepository interface {
+	Create(token domain.RefreshToken) error
+	FindByHash(hash string) (*domain.RefreshToken, error)
+	MarkUsed(id string) error
+	RevokeFamily(familyId string) error
+	RevokeUser(userId string) error
+	RevokeAccess(jti string, expiresAt time.Time) error
+	IsRevoked(jti string) (bool, error)
+}
+
+type tokenRepository struct {
+	db *sql.DB
+}
+
+func NewTokenRepository(db *sql.DB) TokenRepository {
+	return &tokenRepository{db}
+}
+
+func (repository *tokenRepository) Create(token domain.RefreshToken) error {
+	_, err := repository.db.Exec(createRefreshTokenQuery,
+		token.Id,
+		token.UserId,
+		token.FamilyId,
+		token.TokenHash,
+		token.AccessJti,
+		token.AccessExpires,
+		token.ExpiresAt,
+		time.Now(),
+	)
+	return err
+}
+
+func (repository *tokenRepository) FindByHash(hash string) (*domain.RefreshToken, error) {
+	var token domain.RefreshToken
+	var usedAt, revokedAt sql.NullTime
+	err := repository.db.QueryRow(findRefreshTokenQuery, hash).Scan(
+		&token.Id,
+		&token.UserId,
+		&token.FamilyId,
+		&token.TokenHash,
+		&token.AccessJti,
+		&token.AccessExpires,
+		&token.ExpiresAt,
+		&usedAt,
+		&revokedAt,
+	)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrorRefreshTokenNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	if usedAt.Valid {
+		token.UsedAt = &usedAt.Time
+	}
+	if revokedAt.Valid {
+		token.RevokedAt = &revokedAt.Time
+	}
+	return &token, nil
+}
+
+// MarkUsed fails with ErrorRefreshTokenUsed when another request rotated the
+// token first.
+func (repository *tokenRepository) MarkUsed(id string) error {
+	result, err := repository.db.Exec(useRefreshTokenQuery, time.Now(), id)
+	if err != nil {
+		return err
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows < 1 {
+		return ErrorRefreshTokenUsed
+	}
+	return nil
+}
+
+// RevokeFamily revokes every refresh token of the family and the access
+// tokens issued with them that have not expired yet.
+func (repository *tokenRepository) RevokeFamily(familyId string) error {
+	now := time.Now()
+	tx, err := repository.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if _, err := tx.Exec(revokeFamilyAccessQuery, familyId, now); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(revokeFamilyQuery, now, familyId); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// RevokeUser ends every session of the user.
+func (repository *tokenRepository) RevokeUser(userId string) error {
+	now := time.Now()
+	tx, err := repository.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if _, err := tx.Exec(revokeUserAccessQuery, userId, now); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(revokeUserQuery, now, userId); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (repository *tokenRepository) RevokeAccess(jti string, expiresAt time.Time) error {
+	if _, err := repository.db.Exec(purgeRevokedQuery, time.Now()); err != nil {
+		return err
+	}
+	_, err := repository.db.Exec(revokeAccessQuery, jti, expiresAt)
+	return err
+}
+
+func (repository *tokenRepository) IsRevoked(jti string) (bool, error) {
+	var count int
+	if err := repository.db.QueryRow(findRevokedQuery, jti).Scan(&count); err != nil {
+		return false, err
+	}
+	return count > 0, nil
+}
@@ -0,0 +1,85 @@
+package product
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/ncondezo/final/internal/domain"
+)
+
+const (
+	createVerificationQuery = "INSERT INTO email_verifications (id, users_id, token_hash, expires_at, dateup) VALUES (?, ?, ?, ?, ?)"
+	findVerificationQuery   = "SELECT id, users_id, token_hash, expires_at, used_at FROM email_verifications WHERE token_hash = ?"
+	useVerificationQuery    = "UPDATE email_verifications SET used_at = ? WHERE id = ? AND used_at IS NULL"
+)
+
+var (
+	ErrorVerificationNotFound = errors.New("email verification not found")
+	ErrorVerificationUsed     = errors.New("email verification already used")
+)
+
+// VerificationRepository keeps the hashed tokens of the email verification
+// links.
+type VerificationRepository interface {
+	Create(verification domain.EmailVerification) error
+	FindByHash(hash string) (*domain.EmailVerification, error)
+	MarkUsed(id string) error
+}
+
+type verificationRepository struct {
+	db *sql.DB
+}
+
+func NewVerificationRepository(db *sql.DB) VerificationRepository {
+	return &verificationRepository{db}
+}
+
+func (repository *verificationRepository) Create(verification domain.EmailVerification) error {
+	_, err := repository.db.Exec(createVerificationQuery,
+		verification.Id,
+		verification.UserId,
+		verification.TokenHash,
+		verification.ExpiresAt,
+		time.Now(),
+	)
+	return err
+}
+
+func (repository *verificationRepository) FindByHash(hash string) (*domain.EmailVerification, error) {
+	var verification domain.EmailVerification
+	var usedAt sql.NullTime
+	err := repository.db.QueryRow(findVerificationQuery, hash).Scan(
+		&verification.Id,
+		&verification.UserId,
+		&verification.TokenHash,
+		&verification.ExpiresAt,
+		&usedAt,
+	)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrorVerificationNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	if usedAt.Valid {
+		verification.UsedAt = &usedAt.Time
+	}
+	return &verification, nil
+}
+
+// MarkUsed fails with ErrorVerificationUsed when the link was already used.
+func (repository *verificationRepository) MarkUsed(id string) error {
+	result, err := repository.db.Exec(useVerificationQuery, time.Now(), id)
+	if err != nil {
+		return err
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows < 1 {
+		return ErrorVerificationUsed
+	}
+	return nil
+}
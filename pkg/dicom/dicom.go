@@ -0,0 +1,166 @@
+package dicom
+
+import (
+	"encoding/binary"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	preambleLength = 128
+	magic          = "DICM"
+	dateLayout     = "20060102"
+
+	undefinedLength uint32 = 0xFFFFFFFF
+
+	ImplicitVRLittleEndian = "1.2.840.10008.1.2"
+	ExplicitVRLittleEndian = "1.2.840.10008.1.2.1"
+	DeflatedLittleEndian   = "1.2.840.10008.1.2.1.99"
+	ExplicitVRBigEndian    = "1.2.840.10008.1.2.2"
+)
+
+var (
+	ErrNotDicom               = errors.New("content is not a DICOM file")
+	ErrMalformed              = errors.New("malformed DICOM content")
+	ErrUnsupportedSyntax      = errors.New("unsupported DICOM transfer syntax")
+	ErrPreviewUnsupported     = errors.New("DICOM pixel data cannot be previewed")
+	ErrMissingPixelData       = errors.New("DICOM file has no pixel data")
+	ErrInvalidImageAttributes = errors.New("invalid DICOM image attributes")
+)
+
+type Tag struct {
+	Group   uint16
+	Element uint16
+}
+
+var (
+	TagTransferSyntax            = Tag{0x0002, 0x0010}
+	TagStudyDate                 = Tag{0x0008, 0x0020}
+	TagAcquisitionDate           = Tag{0x0008, 0x0022}
+	TagContentDate               = Tag{0x0008, 0x0023}
+	TagModality                  = Tag{0x0008, 0x0060}
+	TagCodeMeaning               = Tag{0x0008, 0x0104}
+	TagAnatomicRegionSequence    = Tag{0x0008, 0x2218}
+	TagPrimaryAnatomicStructure  = Tag{0x0008, 0x2228}
+	TagPatientName               = Tag{0x0010, 0x0010}
+	TagPatientID                 = Tag{0x0010, 0x0020}
+	TagBodyPartExamined          = Tag{0x0018, 0x0015}
+	TagSamplesPerPixel           = Tag{0x0028, 0x0002}
+	TagPhotometricInterpretation = Tag{0x0028, 0x0004}
+	TagPlanarConfiguration       = Tag{0x0028, 0x0006}
+	TagRows                      = Tag{0x0028, 0x0010}
+	TagColumns                   = Tag{0x0028, 0x0011}
+	TagBitsAllocated             = Tag{0x0028, 0x0100}
+	TagBitsStored                = Tag{0x0028, 0x0101}
+	TagPixelRepresentation       = Tag{0x0028, 0x0103}
+	TagWindowCenter              = Tag{0x0028, 0x1050}
+	TagWindowWidth               = Tag{0x0028, 0x1051}
+	TagRescaleIntercept          = Tag{0x0028, 0x1052}
+	TagRescaleSlope              = Tag{0x0028, 0x1053}
+	TagPixelData                 = Tag{0x7FE0, 0x0010}
+	tagItem                      = Tag{0xFFFE, 0xE000}
+	tagItemDelimitation          = Tag{0xFFFE, 0xE00D}
+	tagSequenceDelimitation      = Tag{0xFFFE, 0xE0DD}
+)
+
+type Element struct {
+	Tag       Tag
+	VR        string
+	Value     []byte
+	Items     []Dataset
+	Fragments [][]byte
+}
+
+type Dataset map[Tag]*Element
+
+// File is a parsed DICOM Part 10 file.
+type File struct {
+	TransferSyntax string
+	Meta           Dataset
+	Dataset        Dataset
+	order          binary.ByteOrder
+}
+
+// Header holds the attributes of a radiograph that matter to the clinic.
+type Header struct {
+	Modality        string
+	AcquisitionDate time.Time
+	PatientName     string
+	PatientID       string
+	BodyPart        string
+	Region          string
+	Rows            int
+	Columns         int
+}
+
+// IsDicom reports whether content starts with a DICOM Part 10 preamble.
+func IsDicom(content []byte) bool {
+	return len(content) >= preambleLength+len(magic) &&
+		string(content[preambleLength:preambleLength+len(magic)]) == magic
+}
+
+// Header is a method that extracts the clinic relevant attributes.
+func (f *File) Header() Header {
+	header := Header{
+		Modality:    f.Dataset.String(TagModality),
+		PatientName: f.Dataset.String(TagPatientName),
+		PatientID:   f.Dataset.String(TagPatientID),
+		BodyPart:    f.Dataset.String(TagBodyPartExamined),
+		Rows:        f.Dataset.Uint(TagRows, f.order),
+		Columns:     f.Dataset.Uint(TagColumns, f.order),
+	}
+	for _, tag := range []Tag{TagAcquisitionDate, TagContentDate, TagStudyDate} {
+		if date, err := time.Parse(dateLayout, f.Dataset.String(tag)); err == nil {
+			header.AcquisitionDate = date
+			break
+		}
+	}
+	for _, tag := range []Tag{TagPrimaryAnatomicStructure, TagAnatomicRegionSequence} {
+		if element, ok := f.Dataset[tag]; ok && len(element.Items) > 0 {
+			header.Region = element.Items[0].String(TagCodeMeaning)
+			if header.Region != "" {
+				break
+			}
+		}
+	}
+	return header
+}
+
+// String is a method that returns the first value of a text element.
+func (d Dataset) String(tag Tag) string {
+	element, ok := d[tag]
+	if !ok {
+		return ""
+	}
+	value := strings.TrimRight(string(element.Value), " \x00")
+	first, _, _ := strings.Cut(value, `\`)
+	return strings.TrimSpace(first)
+}
+
+// Uint is a method that returns the value of an unsigned short element.
+func (d Dataset) Uint(tag Tag, order binary.ByteOrder) int {
+	element, ok := d[tag]
+	if !ok || len(element.Value) < 2 {
+		return 0
+	}
+	return int(order.Uint16(element.Value))
+}
+
+// Float is a method that returns the first value of a decimal string element.
+func (d Dataset) Float(tag Tag) (float64, bool) {
+	value, err := strconv.ParseFloat(d.String(tag), 64)
+	return value, err == nil
+}
+
+// SplitPersonName returns the family and given name of a PN value.
+func SplitPersonName(name string) (family, given string) {
+	alphabetic, _, _ := strings.Cut(name, "=")
+	parts := strings.Split(alphabetic, "^")
+	family = strings.TrimSpace(parts[0])
+	if len(parts) > 1 {
+		given = strings.TrimSpace(parts[1])
+	}
+	return family, given
+}
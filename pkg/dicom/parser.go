@@ -0,0 +1,253 @@
+package dicom
+
+import (
+	"encoding/binary"
+)
+
+// Long explicit VRs use two reserved bytes and a 32 bit length.
+var longVRs = map[string]bool{
+	"OB": true, "OD": true, "OF": true, "OL": true, "OV": true, "OW": true,
+	"SQ": true, "SV": true, "UC": true, "UN": true, "UR": true, "UT": true, "UV": true,
+}
+
+// Sequences that must be recognised when the VR is implicit.
+var implicitSequences = map[Tag]bool{
+	TagAnatomicRegionSequence:   true,
+	TagPrimaryAnatomicStructure: true,
+}
+
+type parser struct {
+	data     []byte
+	pos      int
+	explicit bool
+	order    binary.ByteOrder
+}
+
+// Parse decodes a DICOM Part 10 file held in memory.
+func Parse(content []byte) (*File, error) {
+	if !IsDicom(content) {
+		return nil, ErrNotDicom
+	}
+
+	meta := &parser{
+		data:     content,
+		pos:      preambleLength + len(magic),
+		explicit: true,
+		order:    binary.LittleEndian,
+	}
+	metaSet := Dataset{}
+	for meta.pos+2 <= len(content) && meta.order.Uint16(content[meta.pos:]) == 0x0002 {
+		element, err := meta.readElement()
+		if err != nil {
+			return nil, err
+		}
+		metaSet[element.Tag] = element
+	}
+
+	file := &File{Meta: metaSet, TransferSyntax: metaSet.String(TagTransferSyntax)}
+	body := &parser{data: content, pos: meta.pos, explicit: true, order: binary.LittleEndian}
+	switch file.TransferSyntax {
+	case ImplicitVRLittleEndian:
+		body.explicit = false
+	case ExplicitVRBigEndian:
+		body.order = binary.BigEndian
+	case DeflatedLittleEndian:
+		return nil, ErrUnsupportedSyntax
+	}
+	file.order = body.order
+
+	dataset, err := body.readDataset(len(content), false)
+	if err != nil {
+		return nil, err
+	}
+	file.Dataset = dataset
+
+	return file, nil
+}
+
+func (p *parser) readDataset(end int, untilDelimiter bool) (Dataset, error) {
+	dataset := Dataset{}
+	for p.pos < end {
+		tag, err := p.peekTag()
+		if err != nil {
+			return nil, err
+		}
+		if tag == tagItemDelimitation {
+			p.pos += 8
+			if untilDelimiter {
+				return dataset, nil
+			}
+			continue
+		}
+		element, err := p.readElement()
+		if err != nil {
+			return nil, err
+		}
+		dataset[element.Tag] = element
+	}
+	if untilDelimiter {
+		return nil, ErrMalformed
+	}
+	return dataset, nil
+}
+
+func (p *parser) readElement() (*Element, error) {
+	tag, err := p.readTag()
+	if err != nil {
+		return nil, err
+	}
+	element := &Element{Tag: tag}
+
+	var length uint32
+	if p.explicit && tag.Group != 0xFFFE {
+		if !p.has(2) {
+			return nil, ErrMalformed
+		}
+		element.VR = string(p.data[p.pos : p.pos+2])
+		p.pos += 2
+		if longVRs[element.VR] {
+			p.pos += 2
+			length, err = p.readUint32()
+		} else {
+			var short uint16
+			short, err = p.readUint16()
+			length = uint32(short)
+		}
+	} else {
+		length, err = p.readUint32()
+		if implicitSequences[tag] || (length == undefinedLength && tag != TagPixelData) {
+			element.VR = "SQ"
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	switch {
+	case tag == TagPixelData && length == undefinedLength:
+		element.Fragments, err = p.readFragments()
+	case element.VR == "SQ" || length == undefinedLength:
+		element.VR = "SQ"
+		element.Items, err = p.readItems(length)
+	default:
+		if !p.has(int(length)) {
+			return nil, ErrMalformed
+		}
+		element.Value = p.data[p.pos : p.pos+int(length)]
+		p.pos += int(length)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return element, nil
+}
+
+func (p *parser) readItems(length uint32) ([]Dataset, error) {
+	end := len(p.data)
+	if length != undefinedLength {
+		if !p.has(int(length)) {
+			return nil, ErrMalformed
+		}
+		end = p.pos + int(length)
+	}
+
+	items := make([]Dataset, 0)
+	for p.pos < end {
+		tag, err := p.readTag()
+		if err != nil {
+			return nil, err
+		}
+		itemLength, err := p.readUint32()
+		if err != nil {
+			return nil, err
+		}
+		if tag == tagSequenceDelimitation {
+			return items, nil
+		}
+		if tag != tagItem {
+			return nil, ErrMalformed
+		}
+
+		var item Dataset
+		if itemLength == undefinedLength {
+			item, err = p.readDataset(end, true)
+		} else if p.has(int(itemLength)) {
+			item, err = p.readDataset(p.pos+int(itemLength), false)
+		} else {
+			err = ErrMalformed
+		}
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, item)
+	}
+	if length == undefinedLength {
+		return nil, ErrMalformed
+	}
+	return items, nil
+}
+
+func (p *parser) readFragments() ([][]byte, error) {
+	fragments := make([][]byte, 0)
+	for {
+		tag, err := p.readTag()
+		if err != nil {
+			return nil, err
+		}
+		length, err := p.readUint32()
+		if err != nil {
+			return nil, err
+		}
+		if tag == tagSequenceDelimitation {
+			return fragments, nil
+		}
+		if tag != tagItem || !p.has(int(length)) {
+			return nil, ErrMalformed
+		}
+		fragments = append(fragments, p.data[p.pos:p.pos+int(length)])
+		p.pos += int(length)
+	}
+}
+
+func (p *parser) peekTag() (Tag, error) {
+	tag, err := p.readTag()
+	if err == nil {
+		p.pos -= 4
+	}
+	return tag, err
+}
+
+func (p *parser) readTag() (Tag, error) {
+	group, err := p.readUint16()
+	if err != nil {
+		return Tag{}, err
+	}
+	element, err := p.readUint16()
+	if err != nil {
+		return Tag{}, err
+	}
+	return Tag{Group: group, Element: element}, nil
+}
+
+func (p *parser) readUint16() (uint16, error) {
+	if !p.has(2) {
+		return 0, ErrMalformed
+	}
+	value := p.order.Uint16(p.data[p.pos:])
+	p.pos += 2
+	return value, nil
+}
+
+func (p *parser) readUint32() (uint32, error) {
+	if !p.has(4) {
+		return 0, ErrMalformed
+	}
+	value := p.order.Uint32(p.data[p.pos:])
+	p.pos += 4
+	return value, nil
+}
+
+func (p *parser) has(length int) bool {
+	return length >= 0 && p.pos+length <= len(p.data)
+}
@@ -0,0 +1,214 @@
+package dicom
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"testing"
+	"time"
+)
+
+// explicit encodes an explicit VR little endian element.
+func explicit(tag Tag, vr string, value []byte) []byte {
+	var buffer bytes.Buffer
+	binary.Write(&buffer, binary.LittleEndian, tag.Group)
+	binary.Write(&buffer, binary.LittleEndian, tag.Element)
+	buffer.WriteString(vr)
+	if longVRs[vr] {
+		buffer.Write([]byte{0, 0})
+		binary.Write(&buffer, binary.LittleEndian, uint32(len(value)))
+	} else {
+		binary.Write(&buffer, binary.LittleEndian, uint16(len(value)))
+	}
+	buffer.Write(value)
+	return buffer.Bytes()
+}
+
+// header encodes a tag followed by a 32 bit length, as items, delimiters
+// and elements of undefined length are.
+func header(tag Tag, vr string, length uint32) []byte {
+	var buffer bytes.Buffer
+	binary.Write(&buffer, binary.LittleEndian, tag.Group)
+	binary.Write(&buffer, binary.LittleEndian, tag.Element)
+	if vr != "" {
+		buffer.WriteString(vr)
+		buffer.Write([]byte{0, 0})
+	}
+	binary.Write(&buffer, binary.LittleEndian, length)
+	return buffer.Bytes()
+}
+
+func uint16Value(value uint16) []byte {
+	encoded := make([]byte, 2)
+	binary.LittleEndian.PutUint16(encoded, value)
+	return encoded
+}
+
+// file builds a DICOM Part 10 file with syntax as transfer syntax and body
+// as its dataset.
+func file(syntax string, body ...[]byte) []byte {
+	content := make([]byte, preambleLength)
+	content = append(content, magic...)
+	if len(syntax)%2 == 1 {
+		syntax += "\x00"
+	}
+	content = append(content, explicit(TagTransferSyntax, "UI", []byte(syntax))...)
+	for _, part := range body {
+		content = append(content, part...)
+	}
+	return content
+}
+
+func join(parts ...[]byte) []byte {
+	return bytes.Join(parts, nil)
+}
+
+func TestParseHeader(t *testing.T) {
+	region := join(
+		header(TagAnatomicRegionSequence, "SQ", undefinedLength),
+		header(tagItem, "", undefinedLength),
+		explicit(TagCodeMeaning, "LO", []byte("Maxilla ")),
+		header(tagItemDelimitation, "", 0),
+		header(tagSequenceDelimitation, "", 0),
+	)
+	content := file(ExplicitVRLittleEndian,
+		explicit(TagStudyDate, "DA", []byte("20240105")),
+		explicit(TagModality, "CS", []byte("IO")),
+		explicit(TagPatientName, "PN", []byte("Perez^Juan")),
+		explicit(TagPatientID, "LO", []byte("30123456")),
+		region,
+		explicit(TagRows, "US", uint16Value(2)),
+		explicit(TagColumns, "US", uint16Value(3)),
+	)
+
+	parsed, err := Parse(content)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := parsed.Header()
+	want := Header{
+		Modality:        "IO",
+		AcquisitionDate: time.Date(2024, 1, 5, 0, 0, 0, 0, time.UTC),
+		PatientName:     "Perez^Juan",
+		PatientID:       "30123456",
+		Region:          "Maxilla",
+		Rows:            2,
+		Columns:         3,
+	}
+	if got != want {
+		t.Fatalf("header = %+v, want %+v", got, want)
+	}
+}
+
+func TestParseRejectsMalformedInput(t *testing.T) {
+	valid := file(ExplicitVRLittleEndian, explicit(TagModality, "CS", []byte("IO")))
+
+	tests := []struct {
+		name    string
+		content []byte
+		want    error
+	}{
+		{name: "empty", content: nil, want: ErrNotDicom},
+		{name: "preamble only", content: make([]byte, preambleLength), want: ErrNotDicom},
+		{name: "wrong magic", content: append(make([]byte, preambleLength), "DICN"...), want: ErrNotDicom},
+		{name: "plain image", content: append([]byte("\x89PNG\r\n\x1a\n"), make([]byte, 200)...), want: ErrNotDicom},
+		{name: "truncated meta element", content: valid[:preambleLength+len(magic)+6], want: ErrMalformed},
+		{name: "meta length past the end", content: join(make([]byte, preambleLength), []byte(magic),
+			header(TagTransferSyntax, "", 0)[:4], []byte("UI"), uint16Value(200)), want: ErrMalformed},
+		{name: "deflated syntax", content: file(DeflatedLittleEndian), want: ErrUnsupportedSyntax},
+		{name: "truncated tag", content: join(valid, []byte{0x08}), want: ErrMalformed},
+		{name: "missing VR", content: join(valid, []byte{0x08, 0x00, 0x60, 0x00}), want: ErrMalformed},
+		{name: "missing length", content: join(valid, []byte{0x08, 0x00, 0x60, 0x00, 'C', 'S'}), want: ErrMalformed},
+		{name: "value past the end", content: file(ExplicitVRLittleEndian,
+			explicit(TagModality, "CS", []byte("IO"))[:6], uint16Value(10), []byte("IO")), want: ErrMalformed},
+		{name: "long value past the end", content: file(ExplicitVRLittleEndian,
+			header(TagPatientName, "UT", 0xFFFFFFF0), []byte("Perez")), want: ErrMalformed},
+		{name: "truncated long length", content: file(ExplicitVRLittleEndian,
+			header(TagPatientName, "UT", 0)[:8]), want: ErrMalformed},
+		{name: "sequence without delimiter", content: file(ExplicitVRLittleEndian,
+			header(TagAnatomicRegionSequence, "SQ", undefinedLength),
+			header(tagItem, "", undefinedLength),
+			explicit(TagCodeMeaning, "LO", []byte("Maxilla "))), want: ErrMalformed},
+		{name: "sequence item with another tag", content: file(ExplicitVRLittleEndian,
+			header(TagAnatomicRegionSequence, "SQ", undefinedLength),
+			header(TagModality, "", 0)), want: ErrMalformed},
+		{name: "sequence length past the end", content: file(ExplicitVRLittleEndian,
+			header(TagAnatomicRegionSequence, "SQ", 64),
+			header(tagItem, "", 0)), want: ErrMalformed},
+		{name: "item length past the end", content: file(ExplicitVRLittleEndian,
+			header(TagAnatomicRegionSequence, "SQ", undefinedLength),
+			header(tagItem, "", 64)), want: ErrMalformed},
+		{name: "fragments without delimiter", content: file(ExplicitVRLittleEndian,
+			header(TagPixelData, "OB", undefinedLength),
+			header(tagItem, "", 0)), want: ErrMalformed},
+		{name: "fragment past the end", content: file(ExplicitVRLittleEndian,
+			header(TagPixelData, "OB", undefinedLength),
+			header(tagItem, "", 16), []byte{1, 2}), want: ErrMalformed},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			parsed, err := Parse(test.content)
+			if !errors.Is(err, test.want) {
+				t.Fatalf("err = %v, want %v", err, test.want)
+			}
+			if parsed != nil {
+				t.Fatal("a file was returned")
+			}
+		})
+	}
+}
+
+func TestPreviewRejectsBadPixelData(t *testing.T) {
+	attributes := func(rows, columns, bits uint16) []byte {
+		return join(
+			explicit(TagRows, "US", uint16Value(rows)),
+			explicit(TagColumns, "US", uint16Value(columns)),
+			explicit(TagBitsAllocated, "US", uint16Value(bits)),
+		)
+	}
+
+	tests := []struct {
+		name    string
+		content []byte
+		want    error
+	}{
+		{name: "no pixel data", content: file(ExplicitVRLittleEndian, attributes(2, 2, 8)), want: ErrMissingPixelData},
+		{name: "no rows", content: file(ExplicitVRLittleEndian, attributes(0, 2, 8),
+			explicit(TagPixelData, "OB", make([]byte, 4))), want: ErrInvalidImageAttributes},
+		{name: "unsupported bits", content: file(ExplicitVRLittleEndian, attributes(2, 2, 12),
+			explicit(TagPixelData, "OB", make([]byte, 8))), want: ErrInvalidImageAttributes},
+		{name: "pixel data too short", content: file(ExplicitVRLittleEndian, attributes(2, 2, 16),
+			explicit(TagPixelData, "OW", make([]byte, 6))), want: ErrMalformed},
+		{name: "compressed fragments", content: file(ExplicitVRLittleEndian, attributes(2, 2, 8),
+			header(TagPixelData, "OB", undefinedLength),
+			header(tagItem, "", 0),
+			header(tagItem, "", 4), []byte{1, 2, 3, 4},
+			header(tagSequenceDelimitation, "", 0)), want: ErrPreviewUnsupported},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			parsed, err := Parse(test.content)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, err := parsed.Preview(64); !errors.Is(err, test.want) {
+				t.Fatalf("err = %v, want %v", err, test.want)
+			}
+		})
+	}
+
+	t.Run("valid grayscale", func(t *testing.T) {
+		parsed, err := Parse(file(ExplicitVRLittleEndian, attributes(2, 3, 8),
+			explicit(TagPixelData, "OB", []byte{0, 50, 100, 150, 200, 250})))
+		if err != nil {
+			t.Fatal(err)
+		}
+		preview, err := parsed.Preview(64)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if bounds := preview.Bounds(); bounds.Dx() != 3 || bounds.Dy() != 2 {
+			t.Fatalf("preview is %dx%d, want 3x2", bounds.Dx(), bounds.Dy())
+		}
+	})
+}
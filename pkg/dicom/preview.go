@@ -0,0 +1,129 @@
+package dicom
+
+import (
+	"image"
+	"image/color"
+	"math"
+)
+
+// Preview is a method that renders the first frame of uncompressed pixel
+// data as an 8 bit image no larger than maxSide pixels on each side.
+func (f *File) Preview(maxSide int) (image.Image, error) {
+	pixels, ok := f.Dataset[TagPixelData]
+	if !ok {
+		return nil, ErrMissingPixelData
+	}
+	if len(pixels.Fragments) > 0 || pixels.Value == nil {
+		return nil, ErrPreviewUnsupported
+	}
+
+	rows := f.Dataset.Uint(TagRows, f.order)
+	columns := f.Dataset.Uint(TagColumns, f.order)
+	samples := f.Dataset.Uint(TagSamplesPerPixel, f.order)
+	bitsAllocated := f.Dataset.Uint(TagBitsAllocated, f.order)
+	if samples == 0 {
+		samples = 1
+	}
+	if rows == 0 || columns == 0 || (bitsAllocated != 8 && bitsAllocated != 16) {
+		return nil, ErrInvalidImageAttributes
+	}
+	bytesPerSample := bitsAllocated / 8
+	if len(pixels.Value) < rows*columns*samples*bytesPerSample {
+		return nil, ErrMalformed
+	}
+
+	scale := 1
+	for columns/scale > maxSide || rows/scale > maxSide {
+		scale++
+	}
+	bounds := image.Rect(0, 0, columns/scale, rows/scale)
+
+	switch samples {
+	case 1:
+		return f.grayscale(pixels.Value, rows, columns, scale, bounds), nil
+	case 3:
+		if bitsAllocated != 8 {
+			return nil, ErrPreviewUnsupported
+		}
+		return f.rgb(pixels.Value, rows, columns, scale, bounds), nil
+	default:
+		return nil, ErrPreviewUnsupported
+	}
+}
+
+func (f *File) grayscale(data []byte, rows, columns, scale int, bounds image.Rectangle) image.Image {
+	bitsAllocated := f.Dataset.Uint(TagBitsAllocated, f.order)
+	bitsStored := f.Dataset.Uint(TagBitsStored, f.order)
+	signed := f.Dataset.Uint(TagPixelRepresentation, f.order) == 1
+	if bitsStored == 0 || bitsStored > bitsAllocated {
+		bitsStored = bitsAllocated
+	}
+	slope, ok := f.Dataset.Float(TagRescaleSlope)
+	if !ok || slope == 0 {
+		slope = 1
+	}
+	intercept, _ := f.Dataset.Float(TagRescaleIntercept)
+
+	sample := func(index int) float64 {
+		var raw int64
+		if bitsAllocated == 8 {
+			raw = int64(data[index])
+		} else {
+			raw = int64(f.order.Uint16(data[index*2:]))
+		}
+		raw &= (1 << bitsStored) - 1
+		if signed && raw&(1<<(bitsStored-1)) != 0 {
+			raw -= 1 << bitsStored
+		}
+		return float64(raw)*slope + intercept
+	}
+
+	low, high := math.Inf(1), math.Inf(-1)
+	center, hasCenter := f.Dataset.Float(TagWindowCenter)
+	width, hasWidth := f.Dataset.Float(TagWindowWidth)
+	if hasCenter && hasWidth && width > 1 {
+		low, high = center-width/2, center+width/2
+	} else {
+		for index := 0; index < rows*columns; index++ {
+			value := sample(index)
+			low, high = math.Min(low, value), math.Max(high, value)
+		}
+	}
+	if high <= low {
+		high = low + 1
+	}
+
+	invert := f.Dataset.String(TagPhotometricInterpretation) == "MONOCHROME1"
+	preview := image.NewGray(bounds)
+	for y := 0; y < bounds.Dy(); y++ {
+		for x := 0; x < bounds.Dx(); x++ {
+			value := (sample(y*scale*columns+x*scale) - low) / (high - low)
+			value = math.Max(0, math.Min(1, value))
+			if invert {
+				value = 1 - value
+			}
+			preview.SetGray(x, y, color.Gray{Y: uint8(value * 255)})
+		}
+	}
+	return preview
+}
+
+func (f *File) rgb(data []byte, rows, columns, scale int, bounds image.Rectangle) image.Image {
+	planar := f.Dataset.Uint(TagPlanarConfiguration, f.order) == 1
+	plane := rows * columns
+
+	preview := image.NewRGBA(bounds)
+	for y := 0; y < bounds.Dy(); y++ {
+		for x := 0; x < bounds.Dx(); x++ {
+			index := y*scale*columns + x*scale
+			var r, g, b uint8
+			if planar {
+				r, g, b = data[index], data[plane+index], data[2*plane+index]
+			} else {
+				r, g, b = data[index*3], data[index*3+1], data[index*3+2]
+			}
+			preview.SetRGBA(x, y, color.RGBA{R: r, G: g, B: b, A: 0xFF})
+		}
+	}
+	return preview
+}
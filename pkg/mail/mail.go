@@ -0,0 +1,16 @@
+package mail
+
+import "context"
+
+// Message is an email with a plain text body.
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+// Mailer abstracts how emails are delivered, so the account flows do not
+// depend on a concrete provider.
+type Mailer interface {
+	Send(ctx context.Context, message Message) error
+}
@@ -0,0 +1,41 @@
+package mail
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/smtp"
+	"strings"
+)
+
+type smtpMailer struct {
+	addr string
+	from string
+	auth smtp.Auth
+}
+
+// NewSMTPMailer returns a Mailer that delivers through the SMTP server at
+// addr. Without username no authentication is attempted, which is what local
+// stand-ins such as MailHog expect.
+func NewSMTPMailer(addr string, from string, username string, password string) Mailer {
+	var auth smtp.Auth
+	if username != "" {
+		host, _, _ := net.SplitHostPort(addr)
+		auth = smtp.PlainAuth("", username, password, host)
+	}
+	return &smtpMailer{addr: addr, from: from, auth: auth}
+}
+
+// Send is a method that delivers the message.
+func (m *smtpMailer) Send(ctx context.Context, message Message) error {
+	if strings.ContainsAny(message.To, "\r\n") || strings.ContainsAny(message.Subject, "\r\n") {
+		return fmt.Errorf("mail: invalid header in message to %q", message.To)
+	}
+	body := "From: " + m.from + "\r\n" +
+		"To: " + message.To + "\r\n" +
+		"Subject: " + message.Subject + "\r\n" +
+		"MIME-Version: 1.0\r\n" +
+		"Content-Type: text/plain; charset=UTF-8\r\n" +
+		"\r\n" + message.Body
+	return smtp.SendMail(m.addr, m.auth, m.from, []string{message.To}, []byte(body))
+}
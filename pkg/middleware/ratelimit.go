@@ -0,0 +1,135 @@
+package middleware
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ncondezo/final/pkg/web"
+
+	"github.com/gin-gonic/gin"
+)
+
+const rateLimitKey = "rate_limit"
+
+// Limit allows Requests per Period, spent from a bucket that holds at most
+// Requests tokens. A zero Limit does not restrict anything.
+type Limit struct {
+	Requests int
+	Period   time.Duration
+}
+
+// ParseLimit reads limits written as "10/s", "60/m" or "1000/h". An empty
+// value is the zero Limit.
+func ParseLimit(value string) (Limit, error) {
+	if value == "" {
+		return Limit{}, nil
+	}
+	parts := strings.SplitN(value, "/", 2)
+	if len(parts) != 2 {
+		return Limit{}, fmt.Errorf("invalid rate limit %q", value)
+	}
+	requests, err := strconv.Atoi(parts[0])
+	if err != nil || requests < 0 {
+		return Limit{}, fmt.Errorf("invalid rate limit %q", value)
+	}
+	periods := map[string]time.Duration{"s": time.Second, "m": time.Minute, "h": time.Hour}
+	period, ok := periods[parts[1]]
+	if !ok {
+		return Limit{}, fmt.Errorf("invalid rate limit %q", value)
+	}
+	return Limit{Requests: requests, Period: period}, nil
+}
+
+func (l Limit) enabled() bool {
+	return l.Requests > 0 && l.Period > 0
+}
+
+// RateResult is the state of a bucket after taking a token from it.
+type RateResult struct {
+	Allowed    bool
+	Remaining  int
+	Reset      time.Duration
+	RetryAfter time.Duration
+}
+
+// RateLimitStore keeps the buckets. The in-memory store serves a single
+// instance; a shared backend can implement the same interface.
+type RateLimitStore interface {
+	Take(ctx context.Context, key string, limit Limit, now time.Time) (RateResult, error)
+}
+
+// RateLimits are the limits of a route group. PerIP applies to every request,
+// PerUser to the requests Authorization lets through.
+type RateLimits struct {
+	PerIP   Limit
+	PerUser Limit
+}
+
+type rateLimiter struct {
+	store  RateLimitStore
+	group  string
+	limits RateLimits
+}
+
+// RateLimit limits the requests of the route group by client IP and by
+// authenticated user. Groups are counted apart, so a nested group adds its
+// limits to the ones of its parent.
+func RateLimit(store RateLimitStore, group string, limits RateLimits) gin.HandlerFunc {
+	limiter := &rateLimiter{store: store, group: group, limits: limits}
+	return func(ctx *gin.Context) {
+		if !limiter.allow(ctx, "ip:"+ctx.ClientIP(), limits.PerIP) {
+			return
+		}
+		limiters, _ := ctx.Value(rateLimitKey).([]*rateLimiter)
+		ctx.Set(rateLimitKey, append(limiters, limiter))
+		ctx.Next()
+	}
+}
+
+// limitUser applies the per user limits of the groups the request went
+// through. It reports false when the request was aborted.
+func limitUser(ctx *gin.Context, userId string) bool {
+	limiters, _ := ctx.Value(rateLimitKey).([]*rateLimiter)
+	for _, limiter := range limiters {
+		if !limiter.allow(ctx, "user:"+userId, limiter.limits.PerUser) {
+			return false
+		}
+	}
+	return true
+}
+
+func (l *rateLimiter) allow(ctx *gin.Context, key string, limit Limit) bool {
+	if !limit.enabled() {
+		return true
+	}
+	result, err := l.store.Take(ctx, l.group+":"+key, limit, time.Now())
+	if err != nil {
+		// An unavailable store does not take the API down with it.
+		log.Println("[RateLimit] error taking token", err)
+		return true
+	}
+	ctx.Header("RateLimit-Limit", strconv.Itoa(limit.Requests))
+	ctx.Header("RateLimit-Remaining", strconv.Itoa(result.Remaining))
+	ctx.Header("RateLimit-Reset", seconds(result.Reset))
+	if result.Allowed {
+		return true
+	}
+	ctx.Header("Retry-After", seconds(result.RetryAfter))
+	ctx.AbortWithStatusJSON(
+		http.StatusTooManyRequests,
+		web.ErrorResponse{
+			Status:  http.StatusTooManyRequests,
+			Message: "Demasiadas solicitudes, intente nuevamente más tarde.",
+		})
+	return false
+}
+
+func seconds(duration time.Duration) string {
+	return strconv.Itoa(int(math.Ceil(duration.Seconds())))
+}
@@ -0,0 +1,40 @@
+package middleware
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"regexp"
+
+	"github.com/ncondezo/final/internal/domain"
+
+	"github.com/gin-gonic/gin"
+)
+
+const RequestIdHeader = "X-Request-ID"
+
+// requestIdFormat keeps ids sent by clients and proxies printable and short,
+// they end up in the logs and the audit log.
+var requestIdFormat = regexp.MustCompile(`^[A-Za-z0-9._:-]{1,64}$`)
+
+// RequestId takes the id of the request from the X-Request-ID header, or
+// makes a new one, and puts it into the request context and the response.
+func RequestId() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		id := ctx.GetHeader(RequestIdHeader)
+		if !requestIdFormat.MatchString(id) {
+			id = newRequestId()
+		}
+		ctx.Header(RequestIdHeader, id)
+		ctx.Request = ctx.Request.WithContext(
+			domain.ContextWithRequestId(ctx.Request.Context(), id))
+		ctx.Next()
+	}
+}
+
+func newRequestId() string {
+	bytes := make([]byte, 16)
+	if _, err := rand.Read(bytes); err != nil {
+		return "unknown"
+	}
+	return hex.EncodeToString(bytes)
+}
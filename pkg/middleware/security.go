@@ -1,39 +1,111 @@
 package middleware
 
 import (
+	"context"
 	"net/http"
 	"strings"
 
+	"github.com/ncondezo/final/internal/domain"
 	"github.com/ncondezo/final/pkg/security"
 	"github.com/ncondezo/final/pkg/web"
 
 	"github.com/gin-gonic/gin"
 )
 
-func Authorization() gin.HandlerFunc {
+// ClaimKey is where Authorization leaves the claims of a valid token. The
+// principal they authenticate goes into the request context, see
+// domain.PrincipalFrom.
+const ClaimKey = "claim"
+
+// ApiKeyAuthenticator resolves the principal of an api key.
+type ApiKeyAuthenticator interface {
+	Authenticate(ctx context.Context, key string) (domain.Principal, error)
+}
+
+var apiKeys ApiKeyAuthenticator
+
+// UseApiKeys makes Authorization accept the api keys of authenticator, sent
+// as "X-API-Key: <key>" or "Authorization: ApiKey <key>".
+func UseApiKeys(authenticator ApiKeyAuthenticator) {
+	apiKeys = authenticator
+}
+
+// Authorization requires a valid access token or api key that grants every
+// one of permissions. Without permissions any authenticated caller is let
+// through.
+func Authorization(permissions ...string) gin.HandlerFunc {
 	return func(ctx *gin.Context) {
-		token := ctx.GetHeader("Authorization")
-		if !strings.HasPrefix(token, "Bearer ") {
-			ctx.AbortWithStatusJSON(
-				http.StatusForbidden,
-				web.ErrorResponse{
-					http.StatusForbidden,
-					"Se requiere un token de acceso.",
-				})
+		principal, claim, ok := authenticate(ctx)
+		if !ok {
 			return
 		}
-		token = strings.TrimPrefix(token, "Bearer ")
-		_, err := security.ValidateToken(token)
-		if err != nil {
-			ctx.AbortWithStatusJSON(
-				http.StatusForbidden,
-				web.ErrorResponse{
-					http.StatusForbidden,
-					"Token de acceso inválido.",
-				})
+		for _, permission := range permissions {
+			if !principal.Can(permission) {
+				forbidden(ctx, "Falta el permiso "+permission+".")
+				return
+			}
+		}
+		if !limitUser(ctx, principal.UserId) {
 			return
 		}
+		if claim != nil {
+			ctx.Set(ClaimKey, claim)
+		}
+		ctx.Request = ctx.Request.WithContext(
+			domain.ContextWithPrincipal(ctx.Request.Context(), principal))
 		ctx.Next()
-		return
 	}
 }
+
+// authenticate returns the principal of the api key or bearer token of the
+// request, and the claims of the token. It aborts the request when neither
+// is valid.
+func authenticate(ctx *gin.Context) (domain.Principal, *domain.Claim, bool) {
+	header := ctx.GetHeader("Authorization")
+	key := ctx.GetHeader("X-API-Key")
+	if strings.HasPrefix(header, "ApiKey ") {
+		key = strings.TrimPrefix(header, "ApiKey ")
+	}
+	if key != "" && apiKeys != nil {
+		principal, err := apiKeys.Authenticate(ctx, key)
+		if err != nil {
+			forbidden(ctx, "Clave de API inválida.")
+			return domain.Principal{}, nil, false
+		}
+		return principal, nil, true
+	}
+
+	if !strings.HasPrefix(header, "Bearer ") {
+		forbidden(ctx, "Se requiere un token de acceso.")
+		return domain.Principal{}, nil, false
+	}
+	claim, err := security.ValidateToken(strings.TrimPrefix(header, "Bearer "))
+	if err != nil {
+		forbidden(ctx, "Token de acceso inválido.")
+		return domain.Principal{}, nil, false
+	}
+	principal := claim.Principal()
+	// A token signed with a key shared by several clinics only opens the
+	// one it was issued for.
+	if principal.Tenant != security.Tenant() {
+		forbidden(ctx, "Token de acceso de otra clínica.")
+		return domain.Principal{}, nil, false
+	}
+	return principal, claim, true
+}
+
+func forbidden(ctx *gin.Context, message string) {
+	ctx.AbortWithStatusJSON(
+		http.StatusForbidden,
+		web.ErrorResponse{
+			Status:  http.StatusForbidden,
+			Message: message,
+		})
+}
+
+// Claim returns the claims of the authorized request, or nil when the route
+// is not behind Authorization.
+func Claim(ctx *gin.Context) *domain.Claim {
+	claim, _ := ctx.Value(ClaimKey).(*domain.Claim)
+	return claim
+}
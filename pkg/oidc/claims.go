@@ -0,0 +1,56 @@
+package oidc
+
+import (
+	"github.com/golang-jwt/jwt"
+)
+
+// Claims are the claims of a verified id token.
+type Claims struct {
+	Subject       string
+	Email         string
+	EmailVerified bool
+	Name          string
+	GivenName     string
+	FamilyName    string
+	raw           jwt.MapClaims
+}
+
+func newClaims(raw jwt.MapClaims) *Claims {
+	claims := &Claims{raw: raw}
+	claims.Subject = claims.stringClaim("sub")
+	claims.Email = claims.stringClaim("email")
+	claims.Name = claims.stringClaim("name")
+	claims.GivenName = claims.stringClaim("given_name")
+	claims.FamilyName = claims.stringClaim("family_name")
+	// Some providers send email_verified as a string.
+	switch verified := raw["email_verified"].(type) {
+	case bool:
+		claims.EmailVerified = verified
+	case string:
+		claims.EmailVerified = verified == "true"
+	}
+	return claims
+}
+
+// Strings returns a claim holding a string or a list of strings, such as
+// groups or roles.
+func (c *Claims) Strings(name string) []string {
+	switch value := c.raw[name].(type) {
+	case string:
+		return []string{value}
+	case []interface{}:
+		values := make([]string, 0, len(value))
+		for _, item := range value {
+			if text, ok := item.(string); ok {
+				values = append(values, text)
+			}
+		}
+		return values
+	}
+	return nil
+}
+
+func (c *Claims) stringClaim(name string) string {
+	value, _ := c.raw[name].(string)
+	return value
+}
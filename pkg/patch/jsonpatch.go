@@ -0,0 +1,253 @@
+package patch
+
+import (
+	"encoding/json"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+type operation struct {
+	Op    string           `json:"op"`
+	Path  string           `json:"path"`
+	From  string           `json:"from"`
+	Value *json.RawMessage `json:"value"`
+}
+
+// JSONPatch applies an RFC 6902 patch to a JSON document. Operations run
+// in order and the whole patch fails if any of them does.
+func JSONPatch(document []byte, patch []byte) ([]byte, error) {
+	var root interface{}
+	if err := json.Unmarshal(document, &root); err != nil {
+		return nil, err
+	}
+
+	var operations []operation
+	if err := json.Unmarshal(patch, &operations); err != nil {
+		return nil, ErrInvalidPatch
+	}
+
+	for _, op := range operations {
+		var err error
+		root, err = applyOperation(root, op)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return json.Marshal(root)
+}
+
+func applyOperation(root interface{}, op operation) (interface{}, error) {
+	path, err := parsePointer(op.Path)
+	if err != nil {
+		return nil, err
+	}
+
+	switch op.Op {
+	case "add", "replace", "test":
+		if op.Value == nil {
+			return nil, ErrInvalidPatch
+		}
+		var value interface{}
+		if err := json.Unmarshal(*op.Value, &value); err != nil {
+			return nil, ErrInvalidPatch
+		}
+		switch op.Op {
+		case "add":
+			return add(root, path, value)
+		case "replace":
+			if len(path) == 0 {
+				return value, nil
+			}
+			if _, err := get(root, path); err != nil {
+				return nil, err
+			}
+			if root, err = remove(root, path); err != nil {
+				return nil, err
+			}
+			return add(root, path, value)
+		default:
+			current, err := get(root, path)
+			if err != nil {
+				return nil, err
+			}
+			if !reflect.DeepEqual(current, value) {
+				return nil, ErrTestFailed
+			}
+			return root, nil
+		}
+	case "remove":
+		return remove(root, path)
+	case "move", "copy":
+		from, err := parsePointer(op.From)
+		if err != nil {
+			return nil, err
+		}
+		value, err := get(root, from)
+		if err != nil {
+			return nil, err
+		}
+		if op.Op == "move" {
+			if strings.HasPrefix(op.Path+"/", op.From+"/") && op.Path != op.From {
+				return nil, ErrInvalidPatch
+			}
+			if root, err = remove(root, from); err != nil {
+				return nil, err
+			}
+		} else {
+			value = deepCopy(value)
+		}
+		return add(root, path, value)
+	}
+	return nil, ErrInvalidPatch
+}
+
+// parsePointer splits an RFC 6901 JSON pointer into its unescaped tokens.
+func parsePointer(pointer string) ([]string, error) {
+	if pointer == "" {
+		return []string{}, nil
+	}
+	if !strings.HasPrefix(pointer, "/") {
+		return nil, ErrInvalidPatch
+	}
+	tokens := strings.Split(pointer[1:], "/")
+	for i, token := range tokens {
+		token = strings.ReplaceAll(token, "~1", "/")
+		tokens[i] = strings.ReplaceAll(token, "~0", "~")
+	}
+	return tokens, nil
+}
+
+func get(node interface{}, path []string) (interface{}, error) {
+	for _, token := range path {
+		switch current := node.(type) {
+		case map[string]interface{}:
+			value, ok := current[token]
+			if !ok {
+				return nil, ErrInvalidPatch
+			}
+			node = value
+		case []interface{}:
+			index, err := arrayIndex(token, len(current)-1)
+			if err != nil {
+				return nil, err
+			}
+			node = current[index]
+		default:
+			return nil, ErrInvalidPatch
+		}
+	}
+	return node, nil
+}
+
+func add(root interface{}, path []string, value interface{}) (interface{}, error) {
+	if len(path) == 0 {
+		return value, nil
+	}
+	parent, err := get(root, path[:len(path)-1])
+	if err != nil {
+		return nil, err
+	}
+	last := path[len(path)-1]
+
+	switch current := parent.(type) {
+	case map[string]interface{}:
+		current[last] = value
+		return root, nil
+	case []interface{}:
+		index := len(current)
+		if last != "-" {
+			if index, err = arrayIndex(last, len(current)); err != nil {
+				return nil, err
+			}
+		}
+		current = append(current, nil)
+		copy(current[index+1:], current[index:])
+		current[index] = value
+		return replaceParent(root, path[:len(path)-1], current)
+	}
+	return nil, ErrInvalidPatch
+}
+
+func remove(root interface{}, path []string) (interface{}, error) {
+	if len(path) == 0 {
+		return nil, ErrInvalidPatch
+	}
+	parent, err := get(root, path[:len(path)-1])
+	if err != nil {
+		return nil, err
+	}
+	last := path[len(path)-1]
+
+	switch current := parent.(type) {
+	case map[string]interface{}:
+		if _, ok := current[last]; !ok {
+			return nil, ErrInvalidPatch
+		}
+		delete(current, last)
+		return root, nil
+	case []interface{}:
+		index, err := arrayIndex(last, len(current)-1)
+		if err != nil {
+			return nil, err
+		}
+		current = append(current[:index], current[index+1:]...)
+		return replaceParent(root, path[:len(path)-1], current)
+	}
+	return nil, ErrInvalidPatch
+}
+
+// replaceParent stores a resized array back into its container, since
+// appending may have moved it.
+func replaceParent(root interface{}, path []string, array []interface{}) (interface{}, error) {
+	if len(path) == 0 {
+		return array, nil
+	}
+	container, err := get(root, path[:len(path)-1])
+	if err != nil {
+		return nil, err
+	}
+	last := path[len(path)-1]
+
+	switch current := container.(type) {
+	case map[string]interface{}:
+		current[last] = array
+	case []interface{}:
+		index, err := arrayIndex(last, len(current)-1)
+		if err != nil {
+			return nil, err
+		}
+		current[index] = array
+	}
+	return root, nil
+}
+
+func arrayIndex(token string, max int) (int, error) {
+	if token == "" || (len(token) > 1 && token[0] == '0') {
+		return 0, ErrInvalidPatch
+	}
+	index, err := strconv.Atoi(token)
+	if err != nil || index < 0 || index > max {
+		return 0, ErrInvalidPatch
+	}
+	return index, nil
+}
+
+func deepCopy(value interface{}) interface{} {
+	switch current := value.(type) {
+	case map[string]interface{}:
+		object := make(map[string]interface{}, len(current))
+		for name, member := range current {
+			object[name] = deepCopy(member)
+		}
+		return object
+	case []interface{}:
+		array := make([]interface{}, len(current))
+		for i, member := range current {
+			array[i] = deepCopy(member)
+		}
+		return array
+	}
+	return value
+}
@@ -0,0 +1,93 @@
+// Package patch applies partial updates to JSON documents, following
+// RFC 7396 (JSON Merge Patch) and RFC 6902 (JSON Patch).
+package patch
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"mime"
+	"sort"
+	"strings"
+)
+
+const (
+	MediaTypeMergePatch = "application/merge-patch+json"
+	MediaTypeJSONPatch  = "application/json-patch+json"
+)
+
+var (
+	ErrInvalidPatch         = errors.New("error invalid patch document")
+	ErrUnsupportedMediaType = errors.New("error unsupported patch media type")
+	ErrTestFailed           = errors.New("error patch test operation failed")
+)
+
+// ResultError reports a patch that applies cleanly but leaves the resource
+// in an invalid state.
+type ResultError struct {
+	Reason string
+}
+
+func (e *ResultError) Error() string {
+	return "error invalid patch result: " + e.Reason
+}
+
+// Apply patches the JSON representation of document and decodes the result
+// into target. Plain application/json bodies are read as merge patches.
+func Apply(document interface{}, patch []byte, contentType string, target interface{}) error {
+	original, err := json.Marshal(document)
+	if err != nil {
+		return err
+	}
+
+	var patched []byte
+	switch mediaType(contentType) {
+	case MediaTypeMergePatch, "application/json", "":
+		patched, err = MergePatch(original, patch)
+	case MediaTypeJSONPatch:
+		patched, err = JSONPatch(original, patch)
+	default:
+		return ErrUnsupportedMediaType
+	}
+	if err != nil {
+		return err
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(patched))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(target); err != nil {
+		return &ResultError{Reason: err.Error()}
+	}
+	return nil
+}
+
+// SetClause builds the assignments of an UPDATE statement from the changed
+// columns, in a stable order. Column names must come from code, never from
+// the request.
+func SetClause(changes map[string]interface{}) (string, []interface{}) {
+	columns := make([]string, 0, len(changes))
+	for column := range changes {
+		columns = append(columns, column)
+	}
+	sort.Strings(columns)
+
+	assignments := make([]string, 0, len(columns))
+	args := make([]interface{}, 0, len(columns))
+	for _, column := range columns {
+		assignments = append(assignments, fmt.Sprintf("%s = ?", column))
+		args = append(args, changes[column])
+	}
+	return strings.Join(assignments, ", "), args
+}
+
+func mediaType(contentType string) string {
+	if contentType == "" {
+		return ""
+	}
+	parsed, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return contentType
+	}
+	return parsed
+}
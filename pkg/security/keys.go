@@ -0,0 +1,223 @@
+package security
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"strings"
+
+	"github.com/golang-jwt/jwt"
+)
+
+const minRSABits = 2048
+
+var (
+	ErrNoSigningKey  = errors.New("TOKEN_SIGNING_KEY_FILE is not set")
+	ErrKeyType       = errors.New("key must be RSA or Ed25519")
+	ErrKeySize       = fmt.Errorf("RSA key must have at least %d bits", minRSABits)
+	ErrKeysNotLoaded = errors.New("token keys are not loaded")
+)
+
+// key is an asymmetric key identified by the thumbprint of its public half
+// (RFC 7638), which is sent as the kid header of the tokens it signs.
+type key struct {
+	id      string
+	method  jwt.SigningMethod
+	public  crypto.PublicKey
+	private crypto.PrivateKey
+}
+
+// JWK is the public form of a verification key.
+type JWK struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	N   string `json:"n,omitempty"`
+	E   string `json:"e,omitempty"`
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+}
+
+type JWKSet struct {
+	Keys []JWK `json:"keys"`
+}
+
+var (
+	signing      *key
+	verification map[string]*key
+)
+
+// LoadKeys reads the private key access tokens are signed with from
+// TOKEN_SIGNING_KEY_FILE, and the public keys of previous signing keys that
+// are still accepted from TOKEN_VERIFICATION_KEY_FILES, separated by comma.
+// Keys are PEM encoded, RSA (RS256) or Ed25519 (EdDSA).
+//
+// To rotate, sign with the new key and keep the previous public key among
+// the verification keys until the tokens it signed have expired.
+func LoadKeys() error {
+	path := os.Getenv("TOKEN_SIGNING_KEY_FILE")
+	if path == "" {
+		return ErrNoSigningKey
+	}
+	current, err := readKey(path)
+	if err != nil {
+		return err
+	}
+	if current.private == nil {
+		return fmt.Errorf("%s: signing key must be a private key", path)
+	}
+
+	keys := map[string]*key{current.id: current}
+	paths := strings.FieldsFunc(os.Getenv("TOKEN_VERIFICATION_KEY_FILES"),
+		func(r rune) bool { return r == ',' })
+	for _, path := range paths {
+		previous, err := readKey(strings.TrimSpace(path))
+		if err != nil {
+			return err
+		}
+		// Only the current key signs.
+		previous.private = nil
+		if _, ok := keys[previous.id]; !ok {
+			keys[previous.id] = previous
+		}
+	}
+
+	signing = current
+	verification = keys
+	return nil
+}
+
+// JWKS returns the keys that verify the access tokens, for the clients that
+// validate them on their own.
+func JWKS() JWKSet {
+	set := JWKSet{Keys: []JWK{}}
+	if signing != nil {
+		set.Keys = append(set.Keys, signing.jwk())
+	}
+	for id, key := range verification {
+		if signing != nil && id == signing.id {
+			continue
+		}
+		set.Keys = append(set.Keys, key.jwk())
+	}
+	return set
+}
+
+// sign returns a token of claims signed with the current signing key.
+func sign(claims jwt.Claims) (string, error) {
+	if signing == nil {
+		return "", ErrKeysNotLoaded
+	}
+	token := jwt.NewWithClaims(signing.method, claims)
+	token.Header["kid"] = signing.id
+	return token.SignedString(signing.private)
+}
+
+// verificationKey is the jwt.Keyfunc that finds the key of a token by its kid.
+// The algorithm must be the one of the key, so that a public key is never
+// used as an HMAC secret.
+func verificationKey(token *jwt.Token) (interface{}, error) {
+	id, _ := token.Header["kid"].(string)
+	key, ok := verification[id]
+	if !ok {
+		return nil, fmt.Errorf("unknown key %q", id)
+	}
+	if token.Method.Alg() != key.method.Alg() {
+		return nil, fmt.Errorf("unexpected signing method %s", token.Method.Alg())
+	}
+	return key.public, nil
+}
+
+// readKey reads a PEM file holding a private key or a public key.
+func readKey(path string) (*key, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("%s: no PEM data", path)
+	}
+
+	var private crypto.PrivateKey
+	var public crypto.PublicKey
+	switch block.Type {
+	case "RSA PRIVATE KEY":
+		private, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "PRIVATE KEY":
+		private, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	case "PUBLIC KEY":
+		public, err = x509.ParsePKIXPublicKey(block.Bytes)
+	default:
+		err = fmt.Errorf("unsupported PEM block %q", block.Type)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	if signer, ok := private.(crypto.Signer); ok {
+		public = signer.Public()
+	}
+
+	result := &key{public: public, private: private}
+	switch public := public.(type) {
+	case *rsa.PublicKey:
+		if public.N.BitLen() < minRSABits {
+			return nil, fmt.Errorf("%s: %w", path, ErrKeySize)
+		}
+		result.method = jwt.SigningMethodRS256
+	case ed25519.PublicKey:
+		result.method = jwt.SigningMethodEdDSA
+	default:
+		return nil, fmt.Errorf("%s: %w", path, ErrKeyType)
+	}
+	result.id = result.thumbprint()
+	return result, nil
+}
+
+func (k *key) jwk() JWK {
+	jwk := JWK{Kid: k.id, Use: "sig", Alg: k.method.Alg()}
+	switch public := k.public.(type) {
+	case *rsa.PublicKey:
+		jwk.Kty = "RSA"
+		jwk.N = base64.RawURLEncoding.EncodeToString(public.N.Bytes())
+		jwk.E = base64.RawURLEncoding.EncodeToString(big.NewInt(int64(public.E)).Bytes())
+	case ed25519.PublicKey:
+		jwk.Kty = "OKP"
+		jwk.Crv = "Ed25519"
+		jwk.X = base64.RawURLEncoding.EncodeToString(public)
+	}
+	return jwk
+}
+
+// thumbprint is the RFC 7638 thumbprint of the key: the hash of its required
+// JWK members in lexicographic order.
+func (k *key) thumbprint() string {
+	jwk := k.jwk()
+	var members interface{}
+	if jwk.Kty == "RSA" {
+		members = struct {
+			E   string `json:"e"`
+			Kty string `json:"kty"`
+			N   string `json:"n"`
+		}{jwk.E, jwk.Kty, jwk.N}
+	} else {
+		members = struct {
+			Crv string `json:"crv"`
+			Kty string `json:"kty"`
+			X   string `json:"x"`
+		}{jwk.Crv, jwk.Kty, jwk.X}
+	}
+	data, _ := json.Marshal(members)
+	sum := sha256.Sum256(data)
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
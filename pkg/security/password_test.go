@@ -0,0 +1,141 @@
+package security
+
+import (
+	"errors"
+	"testing"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Cheap parameters keep the tests fast, the hashers do not care.
+var (
+	fastArgon2id  = Argon2idParams{Memory: 1024, Time: 1, Threads: 1}
+	otherArgon2id = Argon2idParams{Memory: 2048, Time: 1, Threads: 1}
+)
+
+func TestVerifyPasswordRehash(t *testing.T) {
+	defer UsePasswordHasher(passwordHasher)
+
+	const password = "correct horse battery staple"
+	tests := []struct {
+		name       string
+		hashedWith PasswordHasher
+		configured PasswordHasher
+		password   string
+		matches    bool
+		rehash     bool
+	}{
+		{
+			name:       "bcrypt with the configured cost",
+			hashedWith: NewBcryptHasher(bcrypt.MinCost),
+			configured: NewBcryptHasher(bcrypt.MinCost),
+			password:   password,
+			matches:    true,
+			rehash:     false,
+		},
+		{
+			name:       "bcrypt with another cost",
+			hashedWith: NewBcryptHasher(bcrypt.MinCost),
+			configured: NewBcryptHasher(bcrypt.MinCost + 1),
+			password:   password,
+			matches:    true,
+			rehash:     true,
+		},
+		{
+			name:       "bcrypt after switching to argon2id",
+			hashedWith: NewBcryptHasher(bcrypt.MinCost),
+			configured: NewArgon2idHasher(fastArgon2id),
+			password:   password,
+			matches:    true,
+			rehash:     true,
+		},
+		{
+			name:       "argon2id with the configured parameters",
+			hashedWith: NewArgon2idHasher(fastArgon2id),
+			configured: NewArgon2idHasher(fastArgon2id),
+			password:   password,
+			matches:    true,
+			rehash:     false,
+		},
+		{
+			name:       "argon2id with other parameters",
+			hashedWith: NewArgon2idHasher(fastArgon2id),
+			configured: NewArgon2idHasher(otherArgon2id),
+			password:   password,
+			matches:    true,
+			rehash:     true,
+		},
+		{
+			name:       "argon2id after switching to bcrypt",
+			hashedWith: NewArgon2idHasher(fastArgon2id),
+			configured: NewBcryptHasher(bcrypt.MinCost),
+			password:   password,
+			matches:    true,
+			rehash:     true,
+		},
+		{
+			name:       "wrong password is never rehashed",
+			hashedWith: NewBcryptHasher(bcrypt.MinCost),
+			configured: NewArgon2idHasher(fastArgon2id),
+			password:   "wrong password",
+			matches:    false,
+			rehash:     false,
+		},
+		{
+			name:       "wrong argon2id password is never rehashed",
+			hashedWith: NewArgon2idHasher(fastArgon2id),
+			configured: NewArgon2idHasher(otherArgon2id),
+			password:   "wrong password",
+			matches:    false,
+			rehash:     false,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			hash, err := test.hashedWith.Hash(password)
+			if err != nil {
+				t.Fatal(err)
+			}
+			UsePasswordHasher(test.configured)
+
+			matches, rehash, err := VerifyPassword(test.password, hash)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if matches != test.matches {
+				t.Errorf("matches = %v, want %v", matches, test.matches)
+			}
+			if rehash != test.rehash {
+				t.Errorf("rehash = %v, want %v", rehash, test.rehash)
+			}
+		})
+	}
+}
+
+func TestVerifyPasswordRejectsUnknownHashes(t *testing.T) {
+	tests := []struct {
+		name string
+		hash string
+	}{
+		{name: "empty", hash: ""},
+		{name: "plain text", hash: "secret"},
+		{name: "unknown algorithm", hash: "$scrypt$ln=15,r=8,p=1$c2FsdA$a2V5"},
+		{name: "argon2i", hash: "$argon2i$v=19$m=1024,t=1,p=1$c2FsdHNhbHQ$a2V5"},
+		{name: "argon2id missing key", hash: "$argon2id$v=19$m=1024,t=1,p=1$c2FsdHNhbHQ"},
+		{name: "argon2id empty key", hash: "$argon2id$v=19$m=1024,t=1,p=1$c2FsdHNhbHQ$"},
+		{name: "argon2id other version", hash: "$argon2id$v=16$m=1024,t=1,p=1$c2FsdHNhbHQ$a2V5"},
+		{name: "argon2id bad parameters", hash: "$argon2id$v=19$m=x,t=1,p=1$c2FsdHNhbHQ$a2V5"},
+		{name: "argon2id bad salt", hash: "$argon2id$v=19$m=1024,t=1,p=1$!!$a2V5"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			matches, rehash, err := VerifyPassword("secret", test.hash)
+			if !errors.Is(err, ErrUnknownPasswordHash) {
+				t.Errorf("err = %v, want %v", err, ErrUnknownPasswordHash)
+			}
+			if matches || rehash {
+				t.Errorf("matches = %v, rehash = %v, want both false", matches, rehash)
+			}
+		})
+	}
+}
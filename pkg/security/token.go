@@ -1,7 +1,10 @@
 package security
 
 import (
-	"os"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
 	"time"
 
 	"github.com/ncondezo/final/internal/domain"
@@ -9,31 +12,91 @@ import (
 	"github.com/golang-jwt/jwt"
 )
 
-var secretKey = os.Getenv("TOKEN_SECRET_KEY")
+const (
+	AccessTokenTTL  = time.Minute * 15
+	RefreshTokenTTL = time.Hour * 24 * 30
+)
+
+var tenant string
+
+// UseTenant sets the clinic the access tokens are issued for. Tokens of
+// another tenant are rejected, see Tenant.
+func UseTenant(id string) {
+	tenant = id
+}
+
+// Tenant is the clinic set with UseTenant, "" when there is only one.
+func Tenant() string {
+	return tenant
+}
+
+// RevocationList tells whether an access token was revoked before it expired.
+type RevocationList interface {
+	IsRevoked(jti string) (bool, error)
+}
 
-func GenerateToken(dto *domain.LoginDTO) (string, error) {
+var revocations RevocationList
+
+// UseRevocationList makes ValidateToken reject the tokens revoked in list.
+func UseRevocationList(list RevocationList) {
+	revocations = list
+}
+
+func GenerateToken(user *domain.User, jti string) (string, error) {
 	claims := &domain.Claim{
-		dto.Email,
-		jwt.StandardClaims{
+		Email:  user.Email,
+		Roles:  user.Roles,
+		Tenant: tenant,
+		StandardClaims: jwt.StandardClaims{
+			Id:        jti,
+			Subject:   user.Id,
 			Issuer:    "desafio2-backend",
-			ExpiresAt: time.Now().Add(time.Minute * 15).Unix(),
+			ExpiresAt: time.Now().Add(AccessTokenTTL).Unix(),
 		},
 	}
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	return token.SignedString([]byte(secretKey))
+	if user.DentistId != nil {
+		claims.DentistId = *user.DentistId
+	}
+	if user.PatientId != nil {
+		claims.PatientId = *user.PatientId
+	}
+	return sign(claims)
 }
 
 func ValidateToken(token string) (*domain.Claim, error) {
 	claim := &domain.Claim{}
-	tkn, err := jwt.ParseWithClaims(token, claim,
-		func(token *jwt.Token) (interface{}, error) {
-			return []byte(secretKey), nil
-		})
+	tkn, err := jwt.ParseWithClaims(token, claim, verificationKey)
 	if err != nil {
 		return nil, err
 	}
-	if tkn.Valid {
-		return claim, nil
+	if !tkn.Valid {
+		return nil, jwt.NewValidationError("Invalid token.", 0)
 	}
-	return nil, jwt.NewValidationError("Invalid token.", 0)
+	if revocations != nil {
+		revoked, err := revocations.IsRevoked(claim.Id)
+		if err != nil {
+			return nil, err
+		}
+		if revoked {
+			return nil, jwt.NewValidationError("Revoked token.", jwt.ValidationErrorId)
+		}
+	}
+	return claim, nil
+}
+
+// GenerateOpaqueToken returns a random token for refresh tokens and emailed
+// links, and the hash to store in its place.
+func GenerateOpaqueToken() (string, string, error) {
+	bytes := make([]byte, 32)
+	if _, err := rand.Read(bytes); err != nil {
+		return "", "", err
+	}
+	token := base64.RawURLEncoding.EncodeToString(bytes)
+	return token, HashToken(token), nil
+}
+
+// HashToken is the server side form of an opaque token.
+func HashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
 }
@@ -0,0 +1,120 @@
+package security
+
+import (
+	"encoding/base32"
+	"strings"
+	"testing"
+	"time"
+)
+
+// rfcSecret is the SHA1 key of the RFC 6238 test vectors, "12345678901234567890".
+var rfcSecret = base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString([]byte("12345678901234567890"))
+
+func TestTOTPMatchesRFC6238(t *testing.T) {
+	tests := []struct {
+		at   int64
+		code string
+	}{
+		{at: 59, code: "287082"},
+		{at: 1111111109, code: "081804"},
+		{at: 1111111111, code: "050471"},
+		{at: 1234567890, code: "005924"},
+		{at: 2000000000, code: "279037"},
+	}
+	for _, test := range tests {
+		step, ok := ValidateTOTP(rfcSecret, test.code, time.Unix(test.at, 0))
+		if !ok {
+			t.Errorf("code %s at %d was rejected", test.code, test.at)
+			continue
+		}
+		if step != test.at/totpPeriod {
+			t.Errorf("code %s at %d: step = %d, want %d", test.code, test.at, step, test.at/totpPeriod)
+		}
+	}
+}
+
+func TestValidateTOTPStepWindow(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	current := now.Unix() / totpPeriod
+	key, err := totpEncoding.DecodeString(rfcSecret)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name   string
+		offset int64
+		valid  bool
+	}{
+		{name: "two steps behind", offset: -2, valid: false},
+		{name: "one step behind", offset: -1, valid: true},
+		{name: "current step", offset: 0, valid: true},
+		{name: "one step ahead", offset: 1, valid: true},
+		{name: "two steps ahead", offset: 2, valid: false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			code := totp(key, current+test.offset)
+			step, ok := ValidateTOTP(rfcSecret, code, now)
+			if ok != test.valid {
+				t.Fatalf("valid = %v, want %v", ok, test.valid)
+			}
+			if ok && step != current+test.offset {
+				t.Fatalf("step = %d, want %d", step, current+test.offset)
+			}
+		})
+	}
+}
+
+func TestValidateTOTPRejectsMalformedInput(t *testing.T) {
+	now := time.Unix(59, 0)
+	tests := []struct {
+		name   string
+		secret string
+		code   string
+	}{
+		{name: "empty code", secret: rfcSecret, code: ""},
+		{name: "short code", secret: rfcSecret, code: "28708"},
+		{name: "long code", secret: rfcSecret, code: "2870820"},
+		{name: "wrong code", secret: rfcSecret, code: "287083"},
+		{name: "secret not base32", secret: "not-a-secret!", code: "287082"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if _, ok := ValidateTOTP(test.secret, test.code, now); ok {
+				t.Fatal("code was accepted")
+			}
+		})
+	}
+}
+
+func TestHashRecoveryCodeIgnoresFormatting(t *testing.T) {
+	code, err := GenerateRecoveryCode()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(code) != 11 || code[5] != '-' {
+		t.Fatalf("code %q is not xxxxx-xxxxx", code)
+	}
+
+	want := HashRecoveryCode(code)
+	for _, typed := range []string{
+		code,
+		code[:5] + code[6:],
+		code[:5] + " " + code[6:],
+		" " + code + " ",
+		strings.ToUpper(code),
+	} {
+		if got := HashRecoveryCode(typed); got != want {
+			t.Errorf("hash of %q differs from the hash of %q", typed, code)
+		}
+	}
+
+	other, err := GenerateRecoveryCode()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if other != code && HashRecoveryCode(other) == want {
+		t.Error("different codes have the same hash")
+	}
+}
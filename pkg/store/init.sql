@@ -1,25 +1,13 @@
 CREATE DATABASE IF NOT EXISTS `dental_clinic`;
 USE `dental_clinic`;
 
-CREATE TABLE IF NOT EXISTS users
-(
-    id       VARCHAR(100) NOT NULL,
-    name     VARCHAR(25)  NOT NULL,
-    surname  VARCHAR(25)  NOT NULL,
-    email    VARCHAR(100) NOT NULL,
-    password VARCHAR(100) NOT NULL,
-    CONSTRAINT users_id
-        PRIMARY KEY (id),
-    CONSTRAINT users_email
-        UNIQUE (email)
-);
-
 CREATE TABLE IF NOT EXISTS dentists
 (
     id       INT NOT NULL AUTO_INCREMENT,
     name     VARCHAR(25)  NOT NULL,
     lastname VARCHAR(25)  NOT NULL,
     registry VARCHAR(10)  NOT NULL,
+    active   BOOLEAN      NOT NULL DEFAULT TRUE,
     CONSTRAINT dentists_id
         PRIMARY KEY (id),
     CONSTRAINT dentists_registry
@@ -41,6 +29,277 @@ CREATE TABLE IF NOT EXISTS patients
         
 );
 
+CREATE TABLE IF NOT EXISTS users
+(
+    id          VARCHAR(100) NOT NULL,
+    name        VARCHAR(25)  NOT NULL,
+    surname     VARCHAR(25)  NOT NULL,
+    email       VARCHAR(100) NOT NULL,
+    password    VARCHAR(100) NOT NULL,
+    dentists_id INT          NULL,
+    patients_id INT          NULL,
+    verified_at DATETIME     NULL,
+    CONSTRAINT users_id
+        PRIMARY KEY (id),
+    CONSTRAINT users_email
+        UNIQUE (email),
+    CONSTRAINT users_dentists_id
+        UNIQUE (dentists_id),
+    CONSTRAINT users_dentists_id_fk
+        FOREIGN KEY (dentists_id) REFERENCES dentists (id) ON DELETE SET NULL,
+    CONSTRAINT users_patients_id
+        UNIQUE (patients_id),
+    CONSTRAINT users_patients_id_fk
+        FOREIGN KEY (patients_id) REFERENCES patients (id) ON DELETE SET NULL
+);
+
+CREATE TABLE IF NOT EXISTS user_roles
+(
+    users_id VARCHAR(100) NOT NULL,
+    role     VARCHAR(20)  NOT NULL,
+    CONSTRAINT user_roles_id
+        PRIMARY KEY (users_id, role),
+    CONSTRAINT user_roles_users_id
+        FOREIGN KEY (users_id) REFERENCES users (id) ON DELETE CASCADE
+);
+
+CREATE TABLE IF NOT EXISTS refresh_tokens
+(
+    id             VARCHAR(36)  NOT NULL,
+    users_id       VARCHAR(100) NOT NULL,
+    family_id      VARCHAR(36)  NOT NULL,
+    token_hash     CHAR(64)     NOT NULL,
+    access_jti     VARCHAR(36)  NOT NULL,
+    access_expires DATETIME     NOT NULL,
+    expires_at     DATETIME     NOT NULL,
+    used_at        DATETIME     NULL,
+    revoked_at     DATETIME     NULL,
+    dateup         DATETIME     NOT NULL,
+    CONSTRAINT refresh_tokens_id
+        PRIMARY KEY (id),
+    CONSTRAINT refresh_tokens_token_hash
+        UNIQUE (token_hash),
+    INDEX refresh_tokens_family_id (family_id),
+    CONSTRAINT refresh_tokens_users_id
+        FOREIGN KEY (users_id) REFERENCES users (id) ON DELETE CASCADE
+);
+
+CREATE TABLE IF NOT EXISTS password_resets
+(
+    id         VARCHAR(36)  NOT NULL,
+    users_id   VARCHAR(100) NOT NULL,
+    token_hash CHAR(64)     NOT NULL,
+    expires_at DATETIME     NOT NULL,
+    used_at    DATETIME     NULL,
+    dateup     DATETIME     NOT NULL,
+    CONSTRAINT password_resets_id
+        PRIMARY KEY (id),
+    CONSTRAINT password_resets_token_hash
+        UNIQUE (token_hash),
+    CONSTRAINT password_resets_users_id
+        FOREIGN KEY (users_id) REFERENCES users (id) ON DELETE CASCADE
+);
+
+CREATE TABLE IF NOT EXISTS invitations
+(
+    id          VARCHAR(36)  NOT NULL,
+    email       VARCHAR(100) NOT NULL,
+    role        VARCHAR(20)  NOT NULL,
+    token_hash  CHAR(64)     NOT NULL,
+    invited_by  VARCHAR(100) NULL,
+    expires_at  DATETIME     NOT NULL,
+    accepted_at DATETIME     NULL,
+    dateup      DATETIME     NOT NULL,
+    CONSTRAINT invitations_id
+        PRIMARY KEY (id),
+    CONSTRAINT invitations_token_hash
+        UNIQUE (token_hash)
+);
+
+CREATE TABLE IF NOT EXISTS email_verifications
+(
+    id         VARCHAR(36)  NOT NULL,
+    users_id   VARCHAR(100) NOT NULL,
+    token_hash CHAR(64)     NOT NULL,
+    expires_at DATETIME     NOT NULL,
+    used_at    DATETIME     NULL,
+    dateup     DATETIME     NOT NULL,
+    CONSTRAINT email_verifications_id
+        PRIMARY KEY (id),
+    CONSTRAINT email_verifications_token_hash
+        UNIQUE (token_hash),
+    CONSTRAINT email_verifications_users_id
+        FOREIGN KEY (users_id) REFERENCES users (id) ON DELETE CASCADE
+);
+
+CREATE TABLE IF NOT EXISTS login_throttles
+(
+    throttle_key   VARCHAR(150) NOT NULL,
+    failures       INT          NOT NULL,
+    last_failed_at DATETIME     NOT NULL,
+    locked_until   DATETIME     NULL,
+    CONSTRAINT login_throttles_key
+        PRIMARY KEY (throttle_key)
+);
+
+CREATE TABLE IF NOT EXISTS auth_events
+(
+    id     INT NOT NULL AUTO_INCREMENT,
+    event  VARCHAR(30)  NOT NULL,
+    email  VARCHAR(100) NOT NULL,
+    ip     VARCHAR(45)  NOT NULL,
+    actor  VARCHAR(100) NULL,
+    dateup DATETIME     NOT NULL,
+    CONSTRAINT auth_events_id
+        PRIMARY KEY (id),
+    INDEX auth_events_email (email)
+);
+
+CREATE TABLE IF NOT EXISTS user_totp
+(
+    users_id     VARCHAR(100) NOT NULL,
+    secret       VARCHAR(64)  NOT NULL,
+    confirmed_at DATETIME     NULL,
+    last_step    BIGINT       NOT NULL,
+    dateup       DATETIME     NOT NULL,
+    CONSTRAINT user_totp_id
+        PRIMARY KEY (users_id),
+    CONSTRAINT user_totp_users_id
+        FOREIGN KEY (users_id) REFERENCES users (id) ON DELETE CASCADE
+);
+
+CREATE TABLE IF NOT EXISTS recovery_codes
+(
+    id        INT NOT NULL AUTO_INCREMENT,
+    users_id  VARCHAR(100) NOT NULL,
+    code_hash CHAR(64)     NOT NULL,
+    used_at   DATETIME     NULL,
+    dateup    DATETIME     NOT NULL,
+    CONSTRAINT recovery_codes_id
+        PRIMARY KEY (id),
+    INDEX recovery_codes_users_id_hash (users_id, code_hash),
+    CONSTRAINT recovery_codes_users_id
+        FOREIGN KEY (users_id) REFERENCES users (id) ON DELETE CASCADE
+);
+
+CREATE TABLE IF NOT EXISTS mfa_challenges
+(
+    id         VARCHAR(36)  NOT NULL,
+    users_id   VARCHAR(100) NOT NULL,
+    token_hash CHAR(64)     NOT NULL,
+    enroll     BOOLEAN      NOT NULL,
+    attempts   INT          NOT NULL,
+    expires_at DATETIME     NOT NULL,
+    used_at    DATETIME     NULL,
+    dateup     DATETIME     NOT NULL,
+    CONSTRAINT mfa_challenges_id
+        PRIMARY KEY (id),
+    CONSTRAINT mfa_challenges_token_hash
+        UNIQUE (token_hash),
+    CONSTRAINT mfa_challenges_users_id
+        FOREIGN KEY (users_id) REFERENCES users (id) ON DELETE CASCADE
+);
+
+CREATE TABLE IF NOT EXISTS mfa_required_roles
+(
+    role VARCHAR(20) NOT NULL,
+    CONSTRAINT mfa_required_roles_id
+        PRIMARY KEY (role)
+);
+
+CREATE TABLE IF NOT EXISTS sso_states
+(
+    id         VARCHAR(36) NOT NULL,
+    state_hash CHAR(64)    NOT NULL,
+    nonce      VARCHAR(64) NOT NULL,
+    verifier   VARCHAR(64) NOT NULL,
+    expires_at DATETIME    NOT NULL,
+    used_at    DATETIME    NULL,
+    dateup     DATETIME    NOT NULL,
+    CONSTRAINT sso_states_id
+        PRIMARY KEY (id),
+    CONSTRAINT sso_states_state_hash
+        UNIQUE (state_hash)
+);
+
+CREATE TABLE IF NOT EXISTS user_identities
+(
+    issuer   VARCHAR(255) NOT NULL,
+    subject  VARCHAR(255) NOT NULL,
+    users_id VARCHAR(100) NOT NULL,
+    dateup   DATETIME     NOT NULL,
+    CONSTRAINT user_identities_id
+        PRIMARY KEY (issuer, subject),
+    CONSTRAINT user_identities_users_id
+        FOREIGN KEY (users_id) REFERENCES users (id) ON DELETE CASCADE
+);
+
+CREATE TABLE IF NOT EXISTS revoked_tokens
+(
+    jti        VARCHAR(36) NOT NULL,
+    expires_at DATETIME    NOT NULL,
+    CONSTRAINT revoked_tokens_jti
+        PRIMARY KEY (jti)
+);
+
+CREATE TABLE IF NOT EXISTS api_keys
+(
+    id           INT NOT NULL AUTO_INCREMENT,
+    name         VARCHAR(100) NOT NULL,
+    prefix       VARCHAR(12)  NOT NULL,
+    key_hash     CHAR(64)     NOT NULL,
+    permissions  VARCHAR(500) NOT NULL,
+    created_by   VARCHAR(100) NOT NULL,
+    last_used_at DATETIME     NULL,
+    revoked_at   DATETIME     NULL,
+    dateup       DATETIME     NOT NULL,
+    CONSTRAINT api_keys_id
+        PRIMARY KEY (id),
+    CONSTRAINT api_keys_prefix
+        UNIQUE (prefix)
+);
+
+CREATE TABLE IF NOT EXISTS specialties
+(
+    code VARCHAR(30)  NOT NULL,
+    name VARCHAR(100) NOT NULL,
+    CONSTRAINT specialties_code
+        PRIMARY KEY (code)
+);
+
+INSERT IGNORE INTO specialties(code, name)
+VALUES ('general', 'Odontología general'),
+       ('orthodontics', 'Ortodoncia'),
+       ('endodontics', 'Endodoncia'),
+       ('periodontics', 'Periodoncia'),
+       ('pediatric', 'Odontopediatría'),
+       ('prosthodontics', 'Prostodoncia'),
+       ('oral_surgery', 'Cirugía bucal');
+
+CREATE TABLE IF NOT EXISTS dentist_specialties
+(
+    dentists_id      INT         NOT NULL,
+    specialties_code VARCHAR(30) NOT NULL,
+    CONSTRAINT dentist_specialties_id
+        PRIMARY KEY (dentists_id, specialties_code),
+    CONSTRAINT dentist_specialties_dentists_id
+        FOREIGN KEY (dentists_id) REFERENCES dentists (id) ON DELETE CASCADE,
+    CONSTRAINT dentist_specialties_specialties_code
+        FOREIGN KEY (specialties_code) REFERENCES specialties (code)
+);
+
+CREATE TABLE IF NOT EXISTS procedures
+(
+    code             VARCHAR(20)    NOT NULL,
+    name             VARCHAR(100)   NOT NULL,
+    price            DECIMAL(10, 2) NOT NULL,
+    specialties_code VARCHAR(30)    NULL,
+    CONSTRAINT procedures_code
+        PRIMARY KEY (code),
+    CONSTRAINT procedures_specialties_code
+        FOREIGN KEY (specialties_code) REFERENCES specialties (code)
+);
+
 CREATE TABLE IF NOT EXISTS turns
 (
     id          INT NOT NULL AUTO_INCREMENT,
@@ -48,10 +307,305 @@ CREATE TABLE IF NOT EXISTS turns
     description VARCHAR(250) NOT NULL,
     patients_id int NOT NULL,
     dentists_id int NOT NULL,
+    procedures_code VARCHAR(20) NULL,
+    created_by  VARCHAR(100) NULL,
+    updated_by  VARCHAR(100) NULL,
     CONSTRAINT turns_id
         PRIMARY KEY (id),
     CONSTRAINT patients_id
         FOREIGN KEY (patients_id) REFERENCES patients (id),
     CONSTRAINT dentists_id
-    FOREIGN KEY (dentists_id) REFERENCES dentists (id)
+    FOREIGN KEY (dentists_id) REFERENCES dentists (id),
+    CONSTRAINT turns_procedures_code
+        FOREIGN KEY (procedures_code) REFERENCES procedures (code)
+);
+
+CREATE TABLE IF NOT EXISTS attachments
+(
+    id           INT NOT NULL AUTO_INCREMENT,
+    patients_id  INT NOT NULL,
+    turns_id     INT NULL,
+    kind         VARCHAR(20)  NOT NULL,
+    filename     VARCHAR(250) NOT NULL,
+    content_type VARCHAR(100) NOT NULL,
+    size         BIGINT       NOT NULL,
+    checksum     CHAR(64)     NOT NULL,
+    storage_key  VARCHAR(100) NOT NULL,
+    dateup       DATETIME     NOT NULL,
+    CONSTRAINT attachments_id
+        PRIMARY KEY (id),
+    CONSTRAINT attachments_storage_key
+        UNIQUE (storage_key),
+    CONSTRAINT attachments_patients_id
+        FOREIGN KEY (patients_id) REFERENCES patients (id),
+    CONSTRAINT attachments_turns_id
+        FOREIGN KEY (turns_id) REFERENCES turns (id) ON DELETE SET NULL
+);
+
+CREATE TABLE IF NOT EXISTS attachment_radiographs
+(
+    attachments_id   INT NOT NULL,
+    modality         VARCHAR(16)  NOT NULL,
+    acquisition_date DATE         NULL,
+    patient_name     VARCHAR(100) NOT NULL,
+    patient_identity VARCHAR(64)  NOT NULL,
+    region           VARCHAR(100) NOT NULL,
+    image_rows       INT          NOT NULL,
+    image_columns    INT          NOT NULL,
+    preview_key      VARCHAR(120) NULL,
+    CONSTRAINT attachment_radiographs_id
+        PRIMARY KEY (attachments_id),
+    CONSTRAINT attachment_radiographs_attachments_id
+        FOREIGN KEY (attachments_id) REFERENCES attachments (id)
+);
+
+CREATE TABLE IF NOT EXISTS patient_duplicates
+(
+    patients_id  INT NOT NULL,
+    duplicate_id INT NOT NULL,
+    score        DECIMAL(4, 3) NOT NULL,
+    reasons      VARCHAR(250)  NOT NULL,
+    dateup       DATETIME      NOT NULL,
+    CONSTRAINT patient_duplicates_id
+        PRIMARY KEY (patients_id, duplicate_id),
+    CONSTRAINT patient_duplicates_patients_id
+        FOREIGN KEY (patients_id) REFERENCES patients (id) ON DELETE CASCADE,
+    CONSTRAINT patient_duplicates_duplicate_id
+        FOREIGN KEY (duplicate_id) REFERENCES patients (id) ON DELETE CASCADE
+);
+
+CREATE TABLE IF NOT EXISTS patient_merges
+(
+    id          INT NOT NULL AUTO_INCREMENT,
+    survivor_id INT      NOT NULL,
+    merged_id   INT      NOT NULL,
+    snapshot    TEXT     NOT NULL,
+    dateup      DATETIME NOT NULL,
+    CONSTRAINT patient_merges_id
+        PRIMARY KEY (id)
+);
+
+CREATE TABLE IF NOT EXISTS patient_contacts
+(
+    patients_id       INT NOT NULL,
+    phone             VARCHAR(16)  NOT NULL,
+    email             VARCHAR(100) NOT NULL,
+    preferred_channel VARCHAR(10)  NOT NULL,
+    quiet_hours_start VARCHAR(5)   NOT NULL,
+    quiet_hours_end   VARCHAR(5)   NOT NULL,
+    timezone          VARCHAR(50)  NOT NULL,
+    CONSTRAINT patient_contacts_id
+        PRIMARY KEY (patients_id),
+    CONSTRAINT patient_contacts_patients_id
+        FOREIGN KEY (patients_id) REFERENCES patients (id) ON DELETE CASCADE
+);
+
+CREATE TABLE IF NOT EXISTS patient_consents
+(
+    id          INT NOT NULL AUTO_INCREMENT,
+    patients_id INT         NOT NULL,
+    channel     VARCHAR(10) NOT NULL,
+    opted_in    BOOLEAN     NOT NULL,
+    guardian_id INT         NULL,
+    dateup      DATETIME    NOT NULL,
+    CONSTRAINT patient_consents_id
+        PRIMARY KEY (id),
+    CONSTRAINT patient_consents_patients_id
+        FOREIGN KEY (patients_id) REFERENCES patients (id) ON DELETE CASCADE,
+    CONSTRAINT patient_consents_guardian_id
+        FOREIGN KEY (guardian_id) REFERENCES patients (id) ON DELETE SET NULL
+);
+
+CREATE TABLE IF NOT EXISTS notification_queue
+(
+    id          INT NOT NULL AUTO_INCREMENT,
+    patients_id INT          NOT NULL,
+    subject     VARCHAR(150) NOT NULL,
+    body        TEXT         NOT NULL,
+    send_after  DATETIME     NOT NULL,
+    attempts    INT          NOT NULL DEFAULT 0,
+    sent_at     DATETIME     NULL,
+    dateup      DATETIME     NOT NULL,
+    CONSTRAINT notification_queue_id
+        PRIMARY KEY (id),
+    INDEX notification_queue_send_after (sent_at, send_after),
+    CONSTRAINT notification_queue_patients_id
+        FOREIGN KEY (patients_id) REFERENCES patients (id) ON DELETE CASCADE
+);
+
+CREATE TABLE IF NOT EXISTS insurers
+(
+    id   INT NOT NULL AUTO_INCREMENT,
+    name VARCHAR(100) NOT NULL,
+    CONSTRAINT insurers_id
+        PRIMARY KEY (id),
+    CONSTRAINT insurers_name
+        UNIQUE (name)
+);
+
+CREATE TABLE IF NOT EXISTS insurance_plans
+(
+    id          INT NOT NULL AUTO_INCREMENT,
+    insurers_id INT          NOT NULL,
+    name        VARCHAR(100) NOT NULL,
+    CONSTRAINT insurance_plans_id
+        PRIMARY KEY (id),
+    CONSTRAINT insurance_plans_name
+        UNIQUE (insurers_id, name),
+    CONSTRAINT insurance_plans_insurers_id
+        FOREIGN KEY (insurers_id) REFERENCES insurers (id)
+);
+
+CREATE TABLE IF NOT EXISTS coverage_rules
+(
+    id                 INT NOT NULL AUTO_INCREMENT,
+    insurance_plans_id INT            NOT NULL,
+    procedures_code    VARCHAR(20)    NOT NULL,
+    percentage         DECIMAL(5, 2)  NOT NULL,
+    copay              DECIMAL(10, 2) NOT NULL,
+    annual_limit       INT            NOT NULL,
+    annual_cap         DECIMAL(10, 2) NOT NULL,
+    CONSTRAINT coverage_rules_id
+        PRIMARY KEY (id),
+    CONSTRAINT coverage_rules_procedure
+        UNIQUE (insurance_plans_id, procedures_code),
+    CONSTRAINT coverage_rules_insurance_plans_id
+        FOREIGN KEY (insurance_plans_id) REFERENCES insurance_plans (id),
+    CONSTRAINT coverage_rules_procedures_code
+        FOREIGN KEY (procedures_code) REFERENCES procedures (code)
+);
+
+CREATE TABLE IF NOT EXISTS patient_coverages
+(
+    id                 INT NOT NULL AUTO_INCREMENT,
+    patients_id        INT         NOT NULL,
+    insurance_plans_id INT         NOT NULL,
+    affiliate_number   VARCHAR(30) NOT NULL,
+    valid_from         DATE        NOT NULL,
+    valid_to           DATE        NOT NULL,
+    CONSTRAINT patient_coverages_id
+        PRIMARY KEY (id),
+    CONSTRAINT patient_coverages_patients_id
+        FOREIGN KEY (patients_id) REFERENCES patients (id),
+    CONSTRAINT patient_coverages_insurance_plans_id
+        FOREIGN KEY (insurance_plans_id) REFERENCES insurance_plans (id)
+);
+
+CREATE TABLE IF NOT EXISTS turn_coverages
+(
+    turns_id             INT NOT NULL,
+    patient_coverages_id INT            NULL,
+    procedures_code      VARCHAR(20)    NOT NULL,
+    price                DECIMAL(10, 2) NOT NULL,
+    covered              BOOLEAN        NOT NULL,
+    reason               VARCHAR(30)    NOT NULL,
+    insurer_amount       DECIMAL(10, 2) NOT NULL,
+    copay                DECIMAL(10, 2) NOT NULL,
+    patient_amount       DECIMAL(10, 2) NOT NULL,
+    CONSTRAINT turn_coverages_id
+        PRIMARY KEY (turns_id),
+    CONSTRAINT turn_coverages_turns_id
+        FOREIGN KEY (turns_id) REFERENCES turns (id) ON DELETE CASCADE,
+    CONSTRAINT turn_coverages_patient_coverages_id
+        FOREIGN KEY (patient_coverages_id) REFERENCES patient_coverages (id)
+);
+
+CREATE TABLE IF NOT EXISTS patient_erasures
+(
+    id          INT NOT NULL AUTO_INCREMENT,
+    patients_id INT      NOT NULL,
+    dateup      DATETIME NOT NULL,
+    CONSTRAINT patient_erasures_id
+        PRIMARY KEY (id)
+);
+
+CREATE TABLE IF NOT EXISTS patient_guardians
+(
+    id           INT NOT NULL AUTO_INCREMENT,
+    guardian_id  INT         NOT NULL,
+    dependent_id INT         NOT NULL,
+    relationship VARCHAR(20) NOT NULL,
+    notify       BOOLEAN     NOT NULL,
+    dateup       DATETIME    NOT NULL,
+    CONSTRAINT patient_guardians_id
+        PRIMARY KEY (id),
+    CONSTRAINT patient_guardians_guardian_dependent
+        UNIQUE (guardian_id, dependent_id),
+    CONSTRAINT patient_guardians_guardian_id
+        FOREIGN KEY (guardian_id) REFERENCES patients (id) ON DELETE CASCADE,
+    CONSTRAINT patient_guardians_dependent_id
+        FOREIGN KEY (dependent_id) REFERENCES patients (id) ON DELETE CASCADE
+);
+
+CREATE TABLE IF NOT EXISTS audit_log
+(
+    id         BIGINT NOT NULL AUTO_INCREMENT,
+    actor      VARCHAR(100) NOT NULL,
+    action     VARCHAR(20)  NOT NULL,
+    entity     VARCHAR(20)  NOT NULL,
+    entity_id  INT          NOT NULL,
+    request_id VARCHAR(64)  NOT NULL,
+    diff       MEDIUMTEXT   NOT NULL,
+    prev_hash  CHAR(64)     NOT NULL,
+    hash       CHAR(64)     NOT NULL,
+    dateup     DATETIME     NOT NULL,
+    CONSTRAINT audit_log_id
+        PRIMARY KEY (id),
+    INDEX audit_log_entity (entity, entity_id),
+    INDEX audit_log_actor (actor),
+    INDEX audit_log_dateup (dateup)
+);
+
+-- The hash of the last entry, to chain the next one to and to notice
+-- entries removed from the end.
+CREATE TABLE IF NOT EXISTS audit_head
+(
+    id   INT      NOT NULL,
+    hash CHAR(64) NOT NULL,
+    CONSTRAINT audit_head_id
+        PRIMARY KEY (id)
+);
+
+INSERT IGNORE INTO audit_head(id, hash)
+VALUES (1, '');
+
+DROP TRIGGER IF EXISTS audit_log_no_update;
+CREATE TRIGGER audit_log_no_update
+    BEFORE UPDATE ON audit_log FOR EACH ROW
+    SIGNAL SQLSTATE '45000' SET MESSAGE_TEXT = 'audit_log is append-only';
+
+DROP TRIGGER IF EXISTS audit_log_no_delete;
+CREATE TRIGGER audit_log_no_delete
+    BEFORE DELETE ON audit_log FOR EACH ROW
+    SIGNAL SQLSTATE '45000' SET MESSAGE_TEXT = 'audit_log is append-only';
+
+CREATE TABLE IF NOT EXISTS patient_access_log
+(
+    id          BIGINT NOT NULL AUTO_INCREMENT,
+    patients_id INT          NOT NULL,
+    actor       VARCHAR(100) NOT NULL,
+    resource    VARCHAR(20)  NOT NULL,
+    resource_id INT          NOT NULL,
+    purpose     VARCHAR(20)  NOT NULL,
+    granted     BOOLEAN      NOT NULL,
+    break_glass BOOLEAN      NOT NULL,
+    request_id  VARCHAR(64)  NOT NULL,
+    dateup      DATETIME     NOT NULL,
+    CONSTRAINT patient_access_log_id
+        PRIMARY KEY (id),
+    INDEX patient_access_log_patients_id (patients_id)
+);
+
+CREATE TABLE IF NOT EXISTS break_glass_accesses
+(
+    id          INT NOT NULL AUTO_INCREMENT,
+    patients_id INT          NOT NULL,
+    actor       VARCHAR(100) NOT NULL,
+    dentists_id INT          NOT NULL,
+    reason      VARCHAR(500) NOT NULL,
+    expires_at  DATETIME     NOT NULL,
+    dateup      DATETIME     NOT NULL,
+    CONSTRAINT break_glass_accesses_id
+        PRIMARY KEY (id),
+    INDEX break_glass_accesses_actor_patients_id (actor, patients_id)
 );
@@ -0,0 +1,9 @@
+-- Deleting a turn keeps its attachments, they stay with the patient.
+USE `dental_clinic`;
+
+ALTER TABLE attachments
+    DROP FOREIGN KEY attachments_turns_id;
+
+ALTER TABLE attachments
+    ADD CONSTRAINT attachments_turns_id
+        FOREIGN KEY (turns_id) REFERENCES turns (id) ON DELETE SET NULL;
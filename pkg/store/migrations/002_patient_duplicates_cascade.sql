@@ -0,0 +1,12 @@
+-- Deleting a patient drops the duplicate candidates it was part of.
+USE `dental_clinic`;
+
+ALTER TABLE patient_duplicates
+    DROP FOREIGN KEY patient_duplicates_patients_id,
+    DROP FOREIGN KEY patient_duplicates_duplicate_id;
+
+ALTER TABLE patient_duplicates
+    ADD CONSTRAINT patient_duplicates_patients_id
+        FOREIGN KEY (patients_id) REFERENCES patients (id) ON DELETE CASCADE,
+    ADD CONSTRAINT patient_duplicates_duplicate_id
+        FOREIGN KEY (duplicate_id) REFERENCES patients (id) ON DELETE CASCADE;
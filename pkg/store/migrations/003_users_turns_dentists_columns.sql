@@ -0,0 +1,24 @@
+-- Columns added to users, dentists and turns after their tables were created.
+-- Run pkg/store/init.sql first so the procedures table exists.
+USE `dental_clinic`;
+
+ALTER TABLE dentists
+    ADD COLUMN active BOOLEAN NOT NULL DEFAULT TRUE;
+
+ALTER TABLE users
+    ADD COLUMN dentists_id INT      NULL,
+    ADD COLUMN verified_at DATETIME NULL,
+    ADD CONSTRAINT users_dentists_id
+        UNIQUE (dentists_id),
+    ADD CONSTRAINT users_dentists_id_fk
+        FOREIGN KEY (dentists_id) REFERENCES dentists (id) ON DELETE SET NULL;
+
+-- Accounts created before email verification keep logging in.
+UPDATE users SET verified_at = NOW() WHERE verified_at IS NULL;
+
+ALTER TABLE turns
+    ADD COLUMN procedures_code VARCHAR(20)  NULL,
+    ADD COLUMN created_by      VARCHAR(100) NULL,
+    ADD COLUMN updated_by      VARCHAR(100) NULL,
+    ADD CONSTRAINT turns_procedures_code
+        FOREIGN KEY (procedures_code) REFERENCES procedures (code);
@@ -0,0 +1,9 @@
+-- Users with the patient role act as the guardian of the patient they are linked to.
+USE `dental_clinic`;
+
+ALTER TABLE users
+    ADD COLUMN patients_id INT NULL AFTER dentists_id,
+    ADD CONSTRAINT users_patients_id
+        UNIQUE (patients_id),
+    ADD CONSTRAINT users_patients_id_fk
+        FOREIGN KEY (patients_id) REFERENCES patients (id) ON DELETE SET NULL;
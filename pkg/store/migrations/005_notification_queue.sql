@@ -0,0 +1,19 @@
+-- Messages that reach a patient in quiet hours are queued until they end.
+USE `dental_clinic`;
+
+CREATE TABLE IF NOT EXISTS notification_queue
+(
+    id          INT NOT NULL AUTO_INCREMENT,
+    patients_id INT          NOT NULL,
+    subject     VARCHAR(150) NOT NULL,
+    body        TEXT         NOT NULL,
+    send_after  DATETIME     NOT NULL,
+    attempts    INT          NOT NULL DEFAULT 0,
+    sent_at     DATETIME     NULL,
+    dateup      DATETIME     NOT NULL,
+    CONSTRAINT notification_queue_id
+        PRIMARY KEY (id),
+    INDEX notification_queue_send_after (sent_at, send_after),
+    CONSTRAINT notification_queue_patients_id
+        FOREIGN KEY (patients_id) REFERENCES patients (id) ON DELETE CASCADE
+);
@@ -5,9 +5,14 @@ import (
 	"reflect"
 )
 
+// RequestJsonValidation checks that every field of the request has a value.
+// Fields tagged `optional:"true"` may be left empty.
 func RequestJsonValidation(request interface{}) string {
 	requestCamps := reflect.ValueOf(request)
 	for i := 0; i < requestCamps.NumField(); i++ {
+		if requestCamps.Type().Field(i).Tag.Get("optional") == "true" {
+			continue
+		}
 		campName := requestCamps.Type().Field(i).Name
 		campValue := requestCamps.Field(i).Interface()
 		campType := fmt.Sprint(reflect.TypeOf(campValue).Kind())
@@ -32,4 +37,4 @@ func RequestJsonValidation(request interface{}) string {
 		}
 	}
 	return ""
-}
\ No newline at end of file
+}
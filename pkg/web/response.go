@@ -15,7 +15,18 @@ type ErrorResponse struct {
 }
 
 type LoginResponse struct {
-	Token string `json:"access_token"`
+	Token         string   `json:"access_token"`
+	RefreshToken  string   `json:"refresh_token"`
+	ExpiresIn     int      `json:"expires_in"`
+	RecoveryCodes []string `json:"recovery_codes,omitempty"`
+}
+
+// ChallengeResponse asks for the second factor of a login. With Enroll the
+// user has to set up an authenticator app first.
+type ChallengeResponse struct {
+	MfaToken  string `json:"mfa_token"`
+	Enroll    bool   `json:"mfa_enroll"`
+	ExpiresIn int    `json:"expires_in"`
 }
 
 func NewSuccessResponse(